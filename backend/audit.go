@@ -0,0 +1,128 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actor is the user performing an administrative action and the address the
+// request came from.
+type Actor struct {
+	ID int
+	IP string
+}
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+const (
+	AuditTargetUser   = "user"
+	AuditTargetGroup  = "group"
+	AuditTargetDevice = "device"
+	AuditTargetIP     = "ip"
+
+	AuditTargetDirectoryOp   = "directory_operation"
+	AuditTargetDirectorySync = "directory_sync"
+	AuditTargetRollover      = "rollover"
+)
+
+const (
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditUserImport         = "user.import"
+	AuditUserDisable        = "user.disable"
+	AuditUserEnable         = "user.enable"
+	AuditUserArchive        = "user.archive"
+	AuditUserRestore        = "user.restore"
+	AuditUserPurge          = "user.purge"
+	AuditUserPasswordChange = "user.password_change"
+	AuditUser2FAEnable      = "user.2fa_enable"
+	AuditUser2FADisable     = "user.2fa_disable"
+	AuditUser2FAReset       = "user.2fa_reset"
+	AuditUserRecoveryCodes  = "user.2fa_recovery_codes"
+	AuditGroupCreate        = "group.create"
+	AuditGroupUpdate        = "group.update"
+	AuditGroupDelete        = "group.delete"
+	AuditGroupTeacherAdd    = "group.teacher_add"
+	AuditGroupTeacherRemove = "group.teacher_remove"
+	AuditGroupMemberAdd     = "group.member_add"
+	AuditGroupMemberRemove  = "group.member_remove"
+	AuditDeviceDelete       = "device.delete"
+	AuditDeviceRevoke       = "device.revoke"
+	AuditDeviceRoomChange   = "device.room_change"
+	AuditAuthLockout        = "auth.lockout"
+	AuditAuthUnlock         = "auth.unlock"
+	AuditDirectoryRetry     = "directory.retry"
+	AuditDirectorySync      = "directory.sync"
+	AuditRolloverApply      = "rollover.apply"
+	AuditRolloverRevert     = "rollover.revert"
+)
+
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditChanges is the before/after diff of an action keyed by field name,
+// stored as JSON.
+type AuditChanges map[string]AuditChange
+
+// Set records a field change; values that did not change are skipped.
+func (c AuditChanges) Set(field string, from, to interface{}) {
+	if fmt.Sprint(from) == fmt.Sprint(to) {
+		return
+	}
+	c[field] = AuditChange{From: from, To: to}
+}
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditChanges", src)
+	}
+}
+
+type AuditEvent struct {
+	ID            int64        `json:"id" db:"id"`
+	ActorID       *int         `json:"actor_id" db:"actor_id"`
+	ActorUsername string       `json:"actor_username" db:"actor_username"`
+	Action        string       `json:"action" db:"action"`
+	TargetType    string       `json:"target_type" db:"target_type"`
+	TargetID      string       `json:"target_id" db:"target_id"`
+	TargetName    string       `json:"target_name" db:"target_name"`
+	Changes       AuditChanges `json:"changes" db:"changes"`
+	IP            string       `json:"ip" db:"ip"`
+	Result        string       `json:"result" db:"result"`
+	Error         string       `json:"error,omitempty" db:"error"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+}
+
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   string
+	FromDate   *time.Time
+	ToDate     *time.Time
+	Limit      int
+	Offset     int
+}
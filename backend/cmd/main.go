@@ -42,25 +42,62 @@ func main() {
 	repos := repository.NewRepository(db)
 
 	adService := service.NewADService()
-	if err := adService.TestConnection(); err != nil {
-		logrus.Printf("Warning: AD connection failed: %v", err)
-		logrus.Printf("Application will work in DB-only mode")
-	} else {
-		logrus.Println("AD connection established successfully")
+	directory := service.NewDirectory(adService, repos.DirectorySync)
+	if adService.Enabled() {
+		if err := adService.TestConnection(); err != nil {
+			logrus.Printf("Warning: AD connection failed: %v", err)
+			logrus.Printf("Directory changes will be retried until AD is reachable")
+		} else {
+			logrus.Println("AD connection established successfully")
+		}
 	}
 
-	authService := service.NewAuthService(repos.Authorization)
+	auditService := service.NewAuditService(repos.Audit)
+	directoryJournal := service.NewDirectoryJournal(repos.Directory, directory, auditService)
+	directorySync := service.NewDirectorySyncService(repos.DirectorySync, directory, auditService)
+	loginLimiter := service.NewLoginLimiter(repos.LoginAttempts, auditService)
+	twoFactorService := service.NewTwoFactorService(repos.TwoFactor, repos.Authorization, auditService)
+	authService := service.NewAuthService(repos.Authorization, adService, loginLimiter, twoFactorService)
+	agentHub := service.NewAgentHub()
+	policyService := service.NewPolicyService(repos.Whitelist, repos.GlobalWhitelist, repos.Exam, repos.Device, agentHub)
+	commandService := service.NewCommandService(repos.Command, repos.Device, repos.Group, agentHub)
+	groupService := service.NewIntegratedGroupService(repos.Group, repos.User, auditService, directoryJournal)
+	userService := service.NewIntegratedUserService(repos.User, repos.Group, authService, auditService, directoryJournal)
 
 	services := &service.Service{
-		Authorization: authService,
-		Group:         service.NewIntegratedGroupService(repos.Group, adService),
-		User:          service.NewIntegratedUserService(repos.User, repos.Group, authService, adService),
-		Device:        service.NewDeviceService(repos.Device),
-		Logs:          service.NewLogsService(repos.Logs),
+		Authorization:       authService,
+		Group:               groupService,
+		User:                userService,
+		UserImport:          service.NewUserImportService(userService, groupService, repos.Group, repos.Authorization, auditService),
+		Whitelist:           service.NewWhitelistService(repos.Whitelist, repos.Group, policyService),
+		GlobalWhitelist:     service.NewGlobalWhitelistService(repos.GlobalWhitelist, policyService),
+		Policy:              policyService,
+		Agents:              agentHub,
+		Device:              service.NewDeviceService(repos.Device, agentHub, auditService),
+		Command:             commandService,
+		Exam:                service.NewExamService(repos.Exam, repos.Group, policyService),
+		Timetable:           service.NewTimetableService(repos.Timetable, repos.Group),
+		Logs:                service.NewLogsService(repos.Logs),
+		Audit:               auditService,
+		Lockout:             loginLimiter,
+		TwoFactor:           twoFactorService,
+		DirectoryOperations: directoryJournal,
+		DirectorySync:       directorySync,
+		Rollover:            service.NewRolloverService(repos.Rollover, directoryJournal, authService, auditService),
 	}
 
 	handlers := handler.NewHandler(services)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go commandService.RunExpiryLoop(ctx)
+	go policyService.RunReconcileLoop(ctx)
+	go loginLimiter.RunCleanupLoop(ctx)
+	go directoryJournal.RunRetryLoop(ctx)
+	go directorySync.RunScheduleLoop(ctx)
+	go userService.RunPurgeLoop(ctx)
+
 	host := viper.GetString("host")
 	if host == "" {
 		host = "localhost" 
@@ -88,6 +125,8 @@ func main() {
 
 	logrus.Print("classOS_backend shutting down")
 
+	cancel()
+
 	if err := srv.Shutdown(context.Background()); err != nil {
 		logrus.Errorf("error occured on server shutting down: %s", err.Error())
 	}
@@ -0,0 +1,124 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	CommandLock     = "lock"
+	CommandUnlock   = "unlock"
+	CommandMessage  = "message"
+	CommandLogoff   = "logoff"
+	CommandShutdown = "shutdown"
+)
+
+const (
+	CommandStatusPending   = "pending"
+	CommandStatusDelivered = "delivered"
+	CommandStatusExecuted  = "executed"
+	CommandStatusFailed    = "failed"
+	CommandStatusExpired   = "expired"
+)
+
+const (
+	DefaultCommandTimeout = time.Minute
+	MaxCommandTimeout     = 24 * time.Hour
+)
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+// DeviceCommand is a remote action sent to an agent. It moves from pending to
+// delivered once written to the socket and is then acknowledged by the agent
+// as executed or failed, or expires when the agent never answers.
+type DeviceCommand struct {
+	ID             string     `json:"id" db:"id"`
+	DeviceName     string     `json:"device_name" db:"device_name"`
+	Type           string     `json:"type" db:"command_type"`
+	Payload        string     `json:"payload,omitempty" db:"payload"`
+	Status         string     `json:"status" db:"status"`
+	Result         *string    `json:"result,omitempty" db:"result"`
+	CreatedBy      *int       `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+}
+
+type SendCommandInput struct {
+	Type           string `json:"type" binding:"required"`
+	Message        string `json:"message"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	// QueueIfOffline keeps the command pending until the device connects
+	// or the timeout passes, instead of failing right away.
+	QueueIfOffline bool `json:"queue_if_offline"`
+}
+
+func (i SendCommandInput) Validate() error {
+	switch i.Type {
+	case CommandLock, CommandUnlock, CommandLogoff, CommandShutdown:
+	case CommandMessage:
+		if i.Message == "" {
+			return fmt.Errorf("%w: message text is required", ErrInvalidCommand)
+		}
+	default:
+		return fmt.Errorf("%w: unknown command type %q", ErrInvalidCommand, i.Type)
+	}
+
+	if i.TimeoutSeconds < 0 || time.Duration(i.TimeoutSeconds)*time.Second > MaxCommandTimeout {
+		return fmt.Errorf("%w: timeout must be between 0 and %d seconds", ErrInvalidCommand, int(MaxCommandTimeout.Seconds()))
+	}
+
+	return nil
+}
+
+func (i SendCommandInput) Timeout() time.Duration {
+	if i.TimeoutSeconds == 0 {
+		return DefaultCommandTimeout
+	}
+	return time.Duration(i.TimeoutSeconds) * time.Second
+}
+
+// CommandAck is what the agent reports back after handling a command.
+type CommandAck struct {
+	CommandID string `json:"command_id"`
+	Status    string `json:"status"`
+	Result    string `json:"result"`
+}
+
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryQueued    = "queued"
+	DeliveryFailed    = "failed"
+)
+
+type CommandDeliveryResult struct {
+	DeviceName string `json:"device_name"`
+	CommandID  string `json:"command_id,omitempty"`
+	Delivery   string `json:"delivery"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CommandDeliveryReport summarises a command fanned out to a group or room.
+type CommandDeliveryReport struct {
+	Target    string                  `json:"target"`
+	Total     int                     `json:"total"`
+	Delivered int                     `json:"delivered"`
+	Queued    int                     `json:"queued"`
+	Failed    int                     `json:"failed"`
+	Results   []CommandDeliveryResult `json:"results"`
+}
+
+func (r *CommandDeliveryReport) Add(result CommandDeliveryResult) {
+	r.Total++
+	switch result.Delivery {
+	case DeliveryDelivered:
+		r.Delivered++
+	case DeliveryQueued:
+		r.Queued++
+	default:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
@@ -0,0 +1,127 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrDirectoryOpNotFailed = errors.New("only failed directory operations can be retried")
+
+// Directory operations journal every change that has to reach both the
+// database and Active Directory, so a change that fails half-way is either
+// finished or undone later instead of being forgotten.
+const (
+	DirectoryUserCreate  = "user.create"
+	DirectoryUserUpdate  = "user.update"
+	DirectoryUserDelete  = "user.delete"
+	DirectoryUserDisable = "user.disable"
+	DirectoryUserEnable  = "user.enable"
+	DirectoryGroupCreate = "group.create"
+	DirectoryGroupUpdate = "group.update"
+	DirectoryGroupDelete = "group.delete"
+	// Memberships besides the primary group.
+	DirectoryGroupMemberAdd    = "group.member_add"
+	DirectoryGroupMemberRemove = "group.member_remove"
+	// Batch operations run one step per action of their payload.
+	DirectoryRolloverApply  = "rollover.apply"
+	DirectoryRolloverRevert = "rollover.revert"
+)
+
+// Actions of batch operations.
+const (
+	DirectoryActionGroupRename = "group.rename"
+	DirectoryActionUserMove    = "user.move"
+	DirectoryActionUserAdd     = "user.add"
+	DirectoryActionUserRemove  = "user.remove"
+	DirectoryActionUserDisable = "user.disable"
+	DirectoryActionUserEnable  = "user.enable"
+)
+
+// DirectoryAction is a single AD change of a batch operation. A move adds
+// the user to GroupName and takes them out of PreviousGroupName only.
+type DirectoryAction struct {
+	Kind              string `json:"kind"`
+	Username          string `json:"username,omitempty"`
+	GroupName         string `json:"group_name,omitempty"`
+	PreviousGroupName string `json:"previous_group_name,omitempty"`
+}
+
+const (
+	DirectoryOpRunning      = "running"
+	DirectoryOpPending      = "pending"
+	DirectoryOpCompensating = "compensating"
+	DirectoryOpSucceeded    = "succeeded"
+	DirectoryOpCompensated  = "compensated"
+	DirectoryOpFailed       = "failed"
+)
+
+const (
+	DirectoryPhaseForward    = "forward"
+	DirectoryPhaseCompensate = "compensate"
+)
+
+// DirectoryPayload holds what the steps of an operation need to run again
+// or be undone. Passwords are never stored; PasswordChanged only records
+// that one was set.
+type DirectoryPayload struct {
+	Username            string `json:"username,omitempty"`
+	DisplayName         string `json:"display_name,omitempty"`
+	GroupName           string `json:"group_name,omitempty"`
+	PreviousDisplayName string `json:"previous_display_name,omitempty"`
+	PreviousGroupName   string `json:"previous_group_name,omitempty"`
+	PasswordChanged     bool   `json:"password_changed,omitempty"`
+
+	Actions []DirectoryAction `json:"actions,omitempty"`
+
+	// Password is only known while the operation runs inline.
+	Password string `json:"-"`
+}
+
+func (p DirectoryPayload) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *DirectoryPayload) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, p)
+	case string:
+		return json.Unmarshal([]byte(data), p)
+	case nil:
+		*p = DirectoryPayload{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported directory payload type %T", src)
+	}
+}
+
+// DirectoryOperation is one journaled change. Step is the index of the next
+// step to run while going forward, and the number of steps left to undo
+// while compensating.
+type DirectoryOperation struct {
+	ID            int64            `json:"id" db:"id"`
+	Kind          string           `json:"kind" db:"kind"`
+	TargetID      string           `json:"target_id" db:"target_id"`
+	TargetName    string           `json:"target_name" db:"target_name"`
+	Payload       DirectoryPayload `json:"payload" db:"payload"`
+	Status        string           `json:"status" db:"status"`
+	Phase         string           `json:"phase" db:"phase"`
+	Step          int              `json:"step" db:"step"`
+	Attempts      int              `json:"attempts" db:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	LastError     string           `json:"last_error" db:"last_error"`
+	ActorID       *int             `json:"actor_id,omitempty" db:"actor_id"`
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// DirectoryOperationFilter lists unfinished operations when Status is empty
+// and every operation when it is "all".
+type DirectoryOperationFilter struct {
+	Status string
+	Limit  int
+	Offset int
+}
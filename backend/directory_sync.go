@@ -0,0 +1,137 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSyncInProgress = errors.New("a directory sync is already running")
+	ErrInvalidSyncFix = errors.New("invalid sync fix")
+)
+
+// A sync compares the users and groups under the ClassOS OUs in AD with the
+// database. A dry run only reports the drift; an apply run fixes the drift
+// items it was given, each in the chosen direction.
+const (
+	SyncModeDryRun = "dry_run"
+	SyncModeApply  = "apply"
+
+	SyncTriggerManual   = "manual"
+	SyncTriggerSchedule = "schedule"
+
+	SyncRunRunning   = "running"
+	SyncRunSucceeded = "succeeded"
+	SyncRunFailed    = "failed"
+
+	SyncPhaseReading  = "reading"
+	SyncPhaseApplying = "applying"
+	SyncPhaseDone     = "done"
+)
+
+const (
+	SyncObjectUser  = "user"
+	SyncObjectGroup = "group"
+
+	SyncDriftMissingInDB = "missing_in_db"
+	SyncDriftMissingInAD = "missing_in_ad"
+	SyncDriftDisplayName = "display_name"
+	SyncDriftGroup       = "group"
+
+	SyncToDB = "to_db"
+	SyncToAD = "to_ad"
+
+	SyncResultApplied  = "applied"
+	SyncResultFailed   = "failed"
+	SyncResultResolved = "resolved"
+)
+
+// SyncDrift is one difference between the database and AD. Its ID only
+// depends on what differs, so an item picked from a dry run report can be
+// applied by a later run. Fixes lists the directions the item can be fixed
+// in.
+type SyncDrift struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	UserID  int      `json:"user_id,omitempty"`
+	DBValue string   `json:"db_value,omitempty"`
+	ADValue string   `json:"ad_value,omitempty"`
+	Fixes   []string `json:"fixes"`
+
+	Direction string `json:"direction,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func SyncDriftID(object, kind, name string) string {
+	return fmt.Sprintf("%s:%s:%s", object, kind, name)
+}
+
+// SyncReport is the drift found by a dry run, or the fixes of an apply run
+// with their results.
+type SyncReport struct {
+	Drift []SyncDrift `json:"drift"`
+}
+
+func (r SyncReport) Value() (driver.Value, error) {
+	if r.Drift == nil {
+		r.Drift = []SyncDrift{}
+	}
+	return json.Marshal(r)
+}
+
+func (r *SyncReport) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	case nil:
+		*r = SyncReport{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported sync report type %T", src)
+	}
+}
+
+type SyncRun struct {
+	ID         int64      `json:"id" db:"id"`
+	Trigger    string     `json:"trigger" db:"trigger"`
+	Mode       string     `json:"mode" db:"mode"`
+	Status     string     `json:"status" db:"status"`
+	Phase      string     `json:"phase" db:"phase"`
+	Total      int        `json:"total" db:"total"`
+	Processed  int        `json:"processed" db:"processed"`
+	Applied    int        `json:"applied" db:"applied"`
+	Failed     int        `json:"failed" db:"failed"`
+	Report     SyncReport `json:"report" db:"report"`
+	Error      string     `json:"error" db:"error"`
+	ActorID    *int       `json:"actor_id,omitempty" db:"actor_id"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// SyncFix selects a drift item to apply. Direction may be left out when the
+// item can only be fixed one way.
+type SyncFix struct {
+	ID        string `json:"id" binding:"required"`
+	Direction string `json:"direction"`
+}
+
+type SyncApplyInput struct {
+	Fixes []SyncFix `json:"fixes" binding:"required,min=1,dive"`
+}
+
+func (i SyncApplyInput) Validate() error {
+	for _, fix := range i.Fixes {
+		if fix.Direction != "" && fix.Direction != SyncToDB && fix.Direction != SyncToAD {
+			return fmt.Errorf("%w: direction must be %q or %q", ErrInvalidSyncFix, SyncToDB, SyncToAD)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidExamSession = errors.New("invalid exam session")
+
+// ExamSession is a time-boxed strict policy for one group. While it is
+// active, the exam whitelist replaces the group and global allow lists of
+// every member; the global deny list still applies.
+type ExamSession struct {
+	ID             int64        `json:"id" db:"id"`
+	GroupID        int64        `json:"group_id" db:"group_id" binding:"required"`
+	Title          string       `json:"title" db:"title" binding:"required"`
+	StartsAt       time.Time    `json:"starts_at" db:"starts_at" binding:"required"`
+	EndsAt         time.Time    `json:"ends_at" db:"ends_at" binding:"required"`
+	BlockClipboard bool         `json:"block_clipboard" db:"block_clipboard"`
+	BlockUSB       bool         `json:"block_usb" db:"block_usb"`
+	CreatedBy      *int         `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	Whitelist      []PolicyRule `json:"whitelist" db:"-"`
+}
+
+func (e ExamSession) IsActive(at time.Time) bool {
+	return !at.Before(e.StartsAt) && at.Before(e.EndsAt)
+}
+
+// Normalize checks the time window and normalizes the exam whitelist.
+func (e *ExamSession) Normalize() error {
+	if !e.EndsAt.After(e.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidExamSession)
+	}
+
+	rules, err := normalizeRules(e.Whitelist)
+	if err != nil {
+		return err
+	}
+	e.Whitelist = rules
+	return nil
+}
+
+type UpdateExamSessionInput struct {
+	Title          *string       `json:"title"`
+	StartsAt       *time.Time    `json:"starts_at"`
+	EndsAt         *time.Time    `json:"ends_at"`
+	BlockClipboard *bool         `json:"block_clipboard"`
+	BlockUSB       *bool         `json:"block_usb"`
+	Whitelist      *[]PolicyRule `json:"whitelist"`
+}
+
+func (i UpdateExamSessionInput) Validate() error {
+	if i.Title == nil && i.StartsAt == nil && i.EndsAt == nil &&
+		i.BlockClipboard == nil && i.BlockUSB == nil && i.Whitelist == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+// Apply returns a copy of the session with the input applied.
+func (i UpdateExamSessionInput) Apply(session ExamSession) ExamSession {
+	if i.Title != nil {
+		session.Title = *i.Title
+	}
+	if i.StartsAt != nil {
+		session.StartsAt = *i.StartsAt
+	}
+	if i.EndsAt != nil {
+		session.EndsAt = *i.EndsAt
+	}
+	if i.BlockClipboard != nil {
+		session.BlockClipboard = *i.BlockClipboard
+	}
+	if i.BlockUSB != nil {
+		session.BlockUSB = *i.BlockUSB
+	}
+	if i.Whitelist != nil {
+		session.Whitelist = *i.Whitelist
+	}
+	return session
+}
+
+// ExamRestrictions are the device-level restrictions an agent enforces on
+// top of the rules while an exam is running.
+type ExamRestrictions struct {
+	ExamID         int64     `json:"exam_id"`
+	BlockClipboard bool      `json:"block_clipboard"`
+	BlockUSB       bool      `json:"block_usb"`
+	EndsAt         time.Time `json:"ends_at"`
+}
+
+// ExamViolation is an attempt to use a resource the exam policy does not
+// allow, taken from the agent activity logs.
+type ExamViolation struct {
+	ID         int64     `json:"id" db:"id"`
+	ExamID     int64     `json:"exam_id" db:"exam_id"`
+	Username   string    `json:"username" db:"username"`
+	DeviceName string    `json:"device_name" db:"device_name"`
+	Program    string    `json:"program" db:"program"`
+	Action     string    `json:"action" db:"action"`
+	OccurredAt time.Time `json:"occurred_at" db:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+func normalizeRules(rules []PolicyRule) ([]PolicyRule, error) {
+	normalized := make([]PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		value, err := NormalizeWhitelistValue(rule.Type, rule.Value)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Type == "" {
+			rule.Type = DetectWhitelistType(rule.Value)
+		}
+		rule.Value = value
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
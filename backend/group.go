@@ -2,19 +2,49 @@ package classosbackend
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 )
 
 type Group struct {
 	ID   int64  `json:"id" db:"id"`
 	Name string `json:"name" db:"name" binding:"required"`
+	// ArchivedAt is set on classes retired by a rollover.
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	// MemberCount is only filled in by the group list.
+	MemberCount *int `json:"member_count,omitempty" db:"member_count"`
 }
 
+// GroupMember is a user's membership in a group.
+type GroupMember struct {
+	GroupID  int    `json:"group_id" db:"group_id"`
+	UserID   int    `json:"user_id" db:"user_id"`
+	Username string `json:"username" db:"username"`
+	Role     string `json:"role" db:"role"`
+	Status   string `json:"status" db:"status"`
+	Primary  bool   `json:"primary" db:"is_primary"`
+}
+
+const (
+	WhitelistTypeDomain = "domain"
+	WhitelistTypeURL    = "url"
+	WhitelistTypeApp    = "app"
+)
+
+var ErrInvalidWhitelistEntry = errors.New("invalid whitelist entry")
+
+// WhitelistEntry is a group allow rule. Schedules limit it to recurring time
+// windows; without schedules it applies all the time.
 type WhitelistEntry struct {
-	ID        int64     `json:"id"`
-	GroupID   int64     `json:"group_id"`
-	Value     string    `json:"value"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64               `json:"id" db:"id"`
+	GroupID   int64               `json:"group_id" db:"group_id"`
+	Type      string              `json:"type" db:"entry_type"`
+	Value     string              `json:"value" db:"resource" binding:"required"`
+	CreatedAt time.Time           `json:"created_at" db:"created_at"`
+	Schedules []WhitelistSchedule `json:"schedules" db:"-"`
 }
 
 type Settings struct {
@@ -35,3 +65,147 @@ func (i UpdateGroupInput) Validate() error {
 
     return nil
 }
+
+const (
+	GlobalListAllow = "allow"
+	GlobalListDeny  = "deny"
+)
+
+// GlobalWhitelistEntry is a school-wide rule that applies to every group.
+type GlobalWhitelistEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	List      string    `json:"list" db:"list_type" binding:"required"`
+	Type      string    `json:"type" db:"entry_type"`
+	Value     string    `json:"value" db:"resource" binding:"required"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (e *GlobalWhitelistEntry) Normalize() error {
+	if e.List != GlobalListAllow && e.List != GlobalListDeny {
+		return fmt.Errorf("%w: list must be %q or %q", ErrInvalidWhitelistEntry, GlobalListAllow, GlobalListDeny)
+	}
+
+	value, err := NormalizeWhitelistValue(e.Type, e.Value)
+	if err != nil {
+		return err
+	}
+
+	if e.Type == "" {
+		e.Type = DetectWhitelistType(e.Value)
+	}
+	e.Value = value
+	return nil
+}
+
+type UpdateGlobalWhitelistEntryInput struct {
+	List  *string `json:"list"`
+	Type  *string `json:"type"`
+	Value *string `json:"value"`
+}
+
+func (i UpdateGlobalWhitelistEntryInput) Validate() error {
+	if i.List == nil && i.Type == nil && i.Value == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+type UpdateWhitelistEntryInput struct {
+	Type      *string              `json:"type"`
+	Value     *string              `json:"value"`
+	Schedules *[]WhitelistSchedule `json:"schedules"`
+}
+
+func (i UpdateWhitelistEntryInput) Validate() error {
+	if i.Type == nil && i.Value == nil && i.Schedules == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+type ReplaceWhitelistInput struct {
+	Entries []WhitelistEntry `json:"entries"`
+}
+
+var (
+	domainPattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+	appPattern    = regexp.MustCompile(`^[a-z0-9_][a-z0-9_\-. ]{0,254}$`)
+)
+
+// DetectWhitelistType guesses the entry type when the client did not send one:
+// executables end with .exe, anything with a path or scheme is a URL pattern.
+func DetectWhitelistType(value string) string {
+	v := strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case strings.HasSuffix(v, ".exe"):
+		return WhitelistTypeApp
+	case strings.Contains(v, "://") || strings.Contains(v, "/"):
+		return WhitelistTypeURL
+	default:
+		return WhitelistTypeDomain
+	}
+}
+
+// Normalize fills in the entry type, lower-cases the value and checks that it
+// is a valid domain, URL pattern or executable name with valid schedules.
+func (e *WhitelistEntry) Normalize() error {
+	value, err := NormalizeWhitelistValue(e.Type, e.Value)
+	if err != nil {
+		return err
+	}
+
+	for i := range e.Schedules {
+		if err := e.Schedules[i].Normalize(); err != nil {
+			return err
+		}
+	}
+
+	if e.Type == "" {
+		e.Type = DetectWhitelistType(e.Value)
+	}
+	e.Value = value
+	return nil
+}
+
+func NormalizeWhitelistValue(entryType, value string) (string, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if v == "" {
+		return "", fmt.Errorf("%w: value is empty", ErrInvalidWhitelistEntry)
+	}
+
+	if entryType == "" {
+		entryType = DetectWhitelistType(v)
+	}
+
+	switch entryType {
+	case WhitelistTypeDomain:
+		if !domainPattern.MatchString(v) {
+			return "", fmt.Errorf("%w: %q is not a valid domain", ErrInvalidWhitelistEntry, value)
+		}
+	case WhitelistTypeURL:
+		rest := v
+		if scheme, after, ok := strings.Cut(v, "://"); ok {
+			if scheme != "http" && scheme != "https" {
+				return "", fmt.Errorf("%w: %q must use http or https", ErrInvalidWhitelistEntry, value)
+			}
+			rest = after
+		}
+		host, path, _ := strings.Cut(rest, "/")
+		if !domainPattern.MatchString(host) {
+			return "", fmt.Errorf("%w: %q has an invalid host", ErrInvalidWhitelistEntry, value)
+		}
+		if _, err := url.Parse("https://" + host + "/" + path); err != nil || strings.ContainsAny(path, " \t") {
+			return "", fmt.Errorf("%w: %q is not a valid url pattern", ErrInvalidWhitelistEntry, value)
+		}
+	case WhitelistTypeApp:
+		if strings.ContainsAny(v, `/\`) || !appPattern.MatchString(v) {
+			return "", fmt.Errorf("%w: %q is not a valid executable name", ErrInvalidWhitelistEntry, value)
+		}
+	default:
+		return "", fmt.Errorf("%w: unknown type %q", ErrInvalidWhitelistEntry, entryType)
+	}
+
+	return v, nil
+}
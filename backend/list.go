@@ -0,0 +1,106 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// Fields the user and group lists can be sorted by; the first one is the
+// default.
+var (
+	UserSortFields  = []string{"id", "name", "username", "role", "group_name", "status"}
+	GroupSortFields = []string{"id", "name", "member_count"}
+)
+
+// ListQuery is what the user and group lists share: a text search, the sort
+// field and direction and the page as limit and offset. Limit 0 lists every
+// row.
+type ListQuery struct {
+	Search string
+	Sort   string
+	Order  string
+	Limit  int
+	Offset int
+}
+
+func (q *ListQuery) validate(sortFields []string) error {
+	q.Search = strings.TrimSpace(q.Search)
+
+	if q.Sort == "" {
+		q.Sort = sortFields[0]
+	}
+	if !containsField(sortFields, q.Sort) {
+		return fmt.Errorf("%w: sort must be one of %s", ErrInvalidListQuery, strings.Join(sortFields, ", "))
+	}
+
+	switch q.Order {
+	case "":
+		q.Order = SortAsc
+	case SortAsc, SortDesc:
+	default:
+		return fmt.Errorf("%w: order must be asc or desc", ErrInvalidListQuery)
+	}
+
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("%w: limit and offset cannot be negative", ErrInvalidListQuery)
+	}
+	return nil
+}
+
+// UsersFilter narrows down the user list. GroupID selects the members of a
+// group, any of their groups counting; 0 selects the users without a group.
+// Status "" leaves archived users out and "all" lists every user.
+type UsersFilter struct {
+	ListQuery
+	GroupID *int
+	Role    string
+	Status  string
+}
+
+func (f *UsersFilter) Validate() error {
+	if err := f.validate(UserSortFields); err != nil {
+		return err
+	}
+
+	switch f.Role {
+	case "", RoleAdmin, RoleTeacher, RoleClient:
+	default:
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidListQuery, f.Role)
+	}
+
+	switch f.Status {
+	case "", "all", UserStatusActive, UserStatusDisabled, UserStatusArchived:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidListQuery, f.Status)
+	}
+
+	if f.GroupID != nil && *f.GroupID < 0 {
+		return fmt.Errorf("%w: invalid group_id", ErrInvalidListQuery)
+	}
+	return nil
+}
+
+type GroupsFilter struct {
+	ListQuery
+}
+
+func (f *GroupsFilter) Validate() error {
+	return f.validate(GroupSortFields)
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package classosbackend
+
+import "time"
+
+// LoginAttempts counts the recent failed sign-ins for one key, a username or
+// a client address, and the lock they earned.
+type LoginAttempts struct {
+	Key           string     `json:"key" db:"key"`
+	Failures      int        `json:"failures" db:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at" db:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+}
+
+func (a LoginAttempts) IsLocked(at time.Time) bool {
+	return a.LockedUntil != nil && at.Before(*a.LockedUntil)
+}
@@ -1,16 +1,80 @@
 package classosbackend
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeviceEnrolled is returned when an enrollment code that was not issued
+// for a device is used to enroll it again.
+var ErrDeviceEnrolled = errors.New("device is already enrolled, re-enrolling it needs a code issued for that device")
 
 type DeviceStatus struct {
-	DeviceName    string    `json:"device_name" db:"device_name"`
-	Username      string    `json:"username" db:"username"`
-	LastHeartbeat time.Time `json:"last_heartbeat" db:"last_heartbeat"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
-	IsOnline      bool      `json:"is_online" db:"-"`
+	DeviceName          string     `json:"device_name" db:"device_name"`
+	Username            string     `json:"username" db:"username"`
+	LastHeartbeat       time.Time  `json:"last_heartbeat" db:"last_heartbeat"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+	PolicyVersion       *string    `json:"policy_version" db:"policy_version"`
+	PolicyPushedVersion *string    `json:"policy_pushed_version" db:"policy_pushed_version"`
+	PolicyAppliedAt     *time.Time `json:"policy_applied_at" db:"policy_applied_at"`
+	PolicyOutdated      bool       `json:"policy_outdated" db:"-"`
+	IsOnline            bool       `json:"is_online" db:"-"`
+}
+
+// EnrolledDevice is an agent that exchanged an enrollment code for its own
+// credential. Only the hash of the credential is stored.
+type EnrolledDevice struct {
+	ID             int        `json:"id" db:"id"`
+	DeviceName     string     `json:"device_name" db:"device_name"`
+	Room           *string    `json:"room" db:"room"`
+	CredentialHash string     `json:"-" db:"credential_hash"`
+	EnrolledBy     *int       `json:"enrolled_by" db:"enrolled_by"`
+	EnrolledAt     time.Time  `json:"enrolled_at" db:"enrolled_at"`
+	LastSeenAt     *time.Time `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt      *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+// EnrollmentCode is a one-time code an agent exchanges for its credential. A
+// code with a device name only enrolls that device and is needed to enroll a
+// device that is already known, including a revoked one.
+type EnrollmentCode struct {
+	Code       string    `json:"code"`
+	DeviceName *string   `json:"device_name,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type CreateEnrollmentCodeInput struct {
+	DeviceName *string `json:"device_name"`
+}
+
+type EnrollDeviceInput struct {
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name" binding:"required"`
+}
+
+type UpdateDeviceRoomInput struct {
+	Room *string `json:"room"`
+}
+
+type DeviceCredential struct {
+	DeviceName string `json:"device_name"`
+	Credential string `json:"credential"`
+}
+
+// AgentMessage is a message the server pushes to a connected agent.
+type AgentMessage struct {
+	Type    string         `json:"type"`
+	Policy  *Policy        `json:"policy,omitempty"`
+	Command *DeviceCommand `json:"command,omitempty"`
 }
 
+const (
+	LogTypeSystem  = "system"
+	LogTypeProcess = "process"
+	LogTypeBrowser = "browser"
+)
+
 type UserLog struct {
 	ID         int       `json:"id" db:"id"`
 	Username   string    `json:"username" db:"username"`
@@ -22,7 +86,10 @@ type UserLog struct {
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
+// LogsFilter selects logs. CheckerID limits them to what that user may see;
+// zero means no limit and is only used internally.
 type LogsFilter struct {
+	CheckerID  int
 	Username   string
 	DeviceName string
 	FromDate   *time.Time
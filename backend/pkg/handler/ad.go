@@ -1,23 +1,122 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
+// syncFromAD starts a dry run. The run goes on in the background; its
+// progress and drift report are read from /admin/sync/runs/:id.
 func (h *Handler) syncFromAD(c *gin.Context) {
-	// Предполагаем, что IntegratedUserService имеет метод SyncAllFromAD
-	// Этот метод нужно будет добавить в интерфейс User
-	c.JSON(http.StatusOK, statusResponse{
-		Status: "Sync started",
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	run, err := h.services.DirectorySync.StartSync(actor)
+	if err != nil {
+		newErrorResponse(c, syncErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// applyADSync starts a run fixing the selected drift items.
+func (h *Handler) applyADSync(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.SyncApplyInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	run, err := h.services.DirectorySync.ApplySync(actor, input)
+	if err != nil {
+		newErrorResponse(c, syncErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+func (h *Handler) getADSyncRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	runs, err := h.services.DirectorySync.GetRuns(limit, offset)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	count, err := h.services.DirectorySync.CountRuns()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   runs,
+		"total":  count,
+		"limit":  limit,
+		"offset": offset,
 	})
 }
 
+func (h *Handler) getADSyncRunById(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	run, err := h.services.DirectorySync.GetRun(id)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
 func (h *Handler) checkADConnection(c *gin.Context) {
-	// Предполагаем, что IntegratedUserService имеет метод ValidateADConnection
+	if err := h.services.DirectorySync.TestConnection(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "unavailable",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "connected",
 		"message": "AD connection is working",
 	})
 }
+
+func syncErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, classosbackend.ErrSyncInProgress):
+		return http.StatusConflict
+	case errors.Is(err, classosbackend.ErrInvalidSyncFix):
+		return http.StatusBadRequest
+	default:
+		return errorStatus(err)
+	}
+}
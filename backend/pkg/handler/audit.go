@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func (h *Handler) getAuditEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	filter.Limit = limit
+	filter.Offset = offset
+
+	events, err := h.services.Audit.GetAll(filter)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	count, err := h.services.Audit.Count(filter)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   events,
+		"total":  count,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *Handler) exportAuditEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	if err := h.services.Audit.ExportCSV(c.Writer, filter); err != nil {
+		// Headers are already sent, all we can do is stop the download.
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+func parseAuditFilter(c *gin.Context) (classosbackend.AuditFilter, error) {
+	filter := classosbackend.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	if value := c.Query("actor_id"); value != "" {
+		actorId, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid actor_id param")
+		}
+		filter.ActorID = actorId
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from param, expected RFC3339")
+		}
+		filter.FromDate = &from
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to param, expected RFC3339")
+		}
+		filter.ToDate = &to
+	}
+
+	return filter, nil
+}
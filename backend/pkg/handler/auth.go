@@ -3,6 +3,8 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	classosbackend "github.com/rinat0880/classOS_backend"
@@ -42,29 +44,153 @@ func (h *Handler) signIn(c *gin.Context) {
 		return
 	}
 
-	token, err := h.services.Authorization.GenerateToken(input.Username, input.Password)
+	result, err := h.services.Authorization.SignIn(input.Username, input.Password, clientInfo(c))
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidCredentials) {
-			newErrorResponse(c, http.StatusUnauthorized, err.Error()) // 401
-			return
-		}
-		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server") // 500
+		signInError(c, err)
+		return
+	}
+
+	signInResponse(c, result)
+}
+
+func (h *Handler) verifyMFA(c *gin.Context) {
+	var input classosbackend.MFAInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	user, err := h.services.Authorization.GetUserByCredentials(input.Username, input.Password)
+	result, err := h.services.Authorization.VerifyMFA(input.MFAToken, input.Code, clientInfo(c))
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, "failed to get user data")
+		signInError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
+	signInResponse(c, result)
+}
+
+func (h *Handler) setupMFAEnrollment(c *gin.Context) {
+	var input classosbackend.MFAInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	setup, err := h.services.Authorization.SetupMFAEnrollment(input.MFAToken)
+	if err != nil {
+		signInError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *Handler) completeMFAEnrollment(c *gin.Context) {
+	var input classosbackend.MFAInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.services.Authorization.CompleteMFAEnrollment(input.MFAToken, input.Code, clientInfo(c))
+	if err != nil {
+		signInError(c, err)
+		return
+	}
+
+	signInResponse(c, result)
+}
+
+// signInResponse answers a sign-in step either with the session or with the
+// MFA token for the next step.
+func signInResponse(c *gin.Context, result classosbackend.SignInResult) {
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"mfa_required":            true,
+			"mfa_enrollment_required": result.MFAEnrollmentRequired,
+			"mfa_token":               result.MFAToken,
+		})
+		return
+	}
+
+	response := map[string]interface{}{
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
 		"user": map[string]interface{}{
-			"id":       user.ID,
-			"name":     user.Name,
-			"username": user.Username,
-			"role":     user.Role,
+			"id":       result.User.ID,
+			"name":     result.User.Name,
+			"username": result.User.Username,
+			"role":     result.User.Role,
 		},
-	})
+	}
+	if result.RecoveryCodes != nil {
+		response["recovery_codes"] = result.RecoveryCodes
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func signInError(c *gin.Context, err error) {
+	var locked *service.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		retryAfter := int(time.Until(locked.Until).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		newErrorResponse(c, http.StatusTooManyRequests, err.Error()) // 429
+	case errors.Is(err, service.ErrInvalidCredentials),
+		errors.Is(err, service.ErrInvalidMFAToken),
+		errors.Is(err, service.ErrInvalidTwoFactorCode):
+		newErrorResponse(c, http.StatusUnauthorized, err.Error()) // 401
+	case errors.Is(err, service.ErrTwoFactorEnabled),
+		errors.Is(err, service.ErrTwoFactorNotSetUp):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server") // 500
+	}
+}
+
+func (h *Handler) refreshToken(c *gin.Context) {
+	var input classosbackend.RefreshTokenInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := h.services.Authorization.Refresh(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server")
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) logout(c *gin.Context) {
+	var input classosbackend.RefreshTokenInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.Authorization.Logout(input.RefreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func clientInfo(c *gin.Context) classosbackend.ClientInfo {
+	return classosbackend.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
 }
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+func (h *Handler) sendDeviceCommand(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	deviceName := c.Param("name")
+	if deviceName == "" {
+		newErrorResponse(c, http.StatusBadRequest, "device name is required")
+		return
+	}
+
+	var input classosbackend.SendCommandInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	command, err := h.services.Command.Send(checkerId, deviceName, input)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceOffline) {
+			newErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, command)
+}
+
+func (h *Handler) sendGroupCommand(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	var input classosbackend.SendCommandInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.services.Command.SendToGroup(checkerId, groupId, input)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handler) sendRoomCommand(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	room := c.Param("room")
+	if room == "" {
+		newErrorResponse(c, http.StatusBadRequest, "room is required")
+		return
+	}
+
+	var input classosbackend.SendCommandInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.services.Command.SendToRoom(checkerId, room, input)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handler) getDeviceCommands(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	deviceName := c.Param("name")
+	if deviceName == "" {
+		newErrorResponse(c, http.StatusBadRequest, "device name is required")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	commands, err := h.services.Command.GetByDevice(checkerId, deviceName, limit, offset)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data": commands,
+	})
+}
+
+func (h *Handler) getCommandById(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	command, err := h.services.Command.GetById(checkerId, c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, command)
+}
@@ -1,13 +1,22 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
 func (h *Handler) getAllDevices(c *gin.Context) {
-	devices, err := h.services.Device.GetAllDevices()
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	devices, err := h.services.Device.GetAllDevices(checkerId)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -19,7 +28,12 @@ func (h *Handler) getAllDevices(c *gin.Context) {
 }
 
 func (h *Handler) getOnlineDevices(c *gin.Context) {
-	devices, err := h.services.Device.GetOnlineDevices()
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	devices, err := h.services.Device.GetOnlineDevices(checkerId)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -31,13 +45,18 @@ func (h *Handler) getOnlineDevices(c *gin.Context) {
 }
 
 func (h *Handler) getDeviceByName(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
 	deviceName := c.Param("name")
 	if deviceName == "" {
 		newErrorResponse(c, http.StatusBadRequest, "device name is required")
 		return
 	}
 
-	device, err := h.services.Device.GetDeviceByName(deviceName)
+	device, err := h.services.Device.GetDeviceByName(checkerId, deviceName)
 	if err != nil {
 		newErrorResponse(c, http.StatusNotFound, "device not found")
 		return
@@ -47,13 +66,18 @@ func (h *Handler) getDeviceByName(c *gin.Context) {
 }
 
 func (h *Handler) deleteDevice(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
 	deviceName := c.Param("name")
 	if deviceName == "" {
 		newErrorResponse(c, http.StatusBadRequest, "device name is required")
 		return
 	}
 
-	err := h.services.Device.DeleteDevice(deviceName)
+	err = h.services.Device.DeleteDevice(actor, deviceName)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -61,3 +85,107 @@ func (h *Handler) deleteDevice(c *gin.Context) {
 
 	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
 }
+
+func (h *Handler) getEnrolledDevices(c *gin.Context) {
+	devices, err := h.services.Device.GetEnrolledDevices()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data": devices,
+	})
+}
+
+func (h *Handler) createEnrollmentCode(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	// The body is optional: without one the code enrolls a new device.
+	var input classosbackend.CreateEnrollmentCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	code, err := h.services.Device.CreateEnrollmentCode(checkerId, input)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, code)
+}
+
+func (h *Handler) revokeDevice(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	deviceName := c.Param("name")
+	if deviceName == "" {
+		newErrorResponse(c, http.StatusBadRequest, "device name is required")
+		return
+	}
+
+	if err := h.services.Device.RevokeDevice(actor, deviceName); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (h *Handler) setDeviceRoom(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	deviceName := c.Param("name")
+	if deviceName == "" {
+		newErrorResponse(c, http.StatusBadRequest, "device name is required")
+		return
+	}
+
+	var input classosbackend.UpdateDeviceRoomInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.Device.SetDeviceRoom(actor, deviceName, input.Room); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (h *Handler) enrollDevice(c *gin.Context) {
+	var input classosbackend.EnrollDeviceInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	credential, err := h.services.Device.EnrollDevice(input)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEnrollmentCode) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if errors.Is(err, classosbackend.ErrDeviceEnrolled) {
+			newErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
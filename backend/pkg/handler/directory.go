@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// getDirectoryOperations lists unfinished operations by default; ?status=
+// narrows the list to one status, ?status=all shows everything.
+func (h *Handler) getDirectoryOperations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	filter := classosbackend.DirectoryOperationFilter{
+		Status: c.Query("status"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	operations, err := h.services.DirectoryOperations.GetAll(filter)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	count, err := h.services.DirectoryOperations.Count(filter)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   operations,
+		"total":  count,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *Handler) getDirectoryOperationById(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	operation, err := h.services.DirectoryOperations.GetById(id)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, operation)
+}
+
+// retryDirectoryOperation runs a failed operation again at once and returns
+// it with the outcome of that attempt.
+func (h *Handler) retryDirectoryOperation(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	operation, err := h.services.DirectoryOperations.Retry(actor, id)
+	if errors.Is(err, classosbackend.ErrDirectoryOpNotFailed) {
+		newErrorResponse(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, operation)
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func (h *Handler) createGroup(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -20,7 +20,7 @@ func (h *Handler) createGroup(c *gin.Context) {
 		return
 	}
 
-	id, err := h.services.Group.Create(checkerId, input)
+	id, err := h.services.Group.Create(actor, input)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -32,24 +32,38 @@ func (h *Handler) createGroup(c *gin.Context) {
 
 }
 
-type getAllGroupsResponse struct {
-	Data []classosbackend.Group `json:"data"`
-}
-
+// getAllGroups lists a page of the groups; search matches the name and sort
+// is id, name or member_count.
 func (h *Handler) getAllGroups(c *gin.Context) {
 	checkerId, err := getUserId(c)
 	if err != nil {
 		return
 	}
 
-	groups, err := h.services.Group.GetAll(checkerId)
+	query, page, err := parseListQuery(c)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := classosbackend.GroupsFilter{ListQuery: query}
+
+	groups, err := h.services.Group.GetAll(checkerId, filter)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	total, err := h.services.Group.Count(checkerId, filter)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, getAllGroupsResponse{
-		Data: groups,
+	c.JSON(http.StatusOK, paginatedResponse{
+		Data:     groups,
+		Total:    total,
+		Page:     page.Page,
+		PageSize: page.PageSize,
 	})
 }
 
@@ -67,7 +81,7 @@ func (h *Handler) getGroupById(c *gin.Context) {
 
 	group, err := h.services.Group.GetById(checkerId, id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newErrorResponse(c, errorStatus(err), err.Error())
 		return
 	}
 
@@ -76,7 +90,7 @@ func (h *Handler) getGroupById(c *gin.Context) {
 }
 
 func (h *Handler) updateGroup(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -94,7 +108,7 @@ func (h *Handler) updateGroup(c *gin.Context) {
 	}
 
 
-	if err := h.services.Group.Update(checkerId, id, input); err != nil {
+	if err := h.services.Group.Update(actor, id, input); err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -105,7 +119,7 @@ func (h *Handler) updateGroup(c *gin.Context) {
 }
 
 func (h *Handler) deleteGroup(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -116,7 +130,7 @@ func (h *Handler) deleteGroup(c *gin.Context) {
 		return
 	}
 
-	err = h.services.Group.Delete(checkerId, id)
+	err = h.services.Group.Delete(actor, id)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
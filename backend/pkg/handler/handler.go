@@ -2,11 +2,14 @@
 package handler
 
 import (
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/rinat0880/classOS_backend/pkg/service"
+	"github.com/sirupsen/logrus"
 )
 
 type Handler struct {
@@ -19,6 +22,12 @@ func NewHandler(services *service.Service) *Handler {
 
 func (h *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
+	// Client addresses feed the sign-in lockout and the audit trail, so
+	// X-Forwarded-For is only believed when it comes from a known proxy.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		logrus.WithError(err).Warn("Invalid TRUSTED_PROXIES, trusting no proxy")
+		router.SetTrustedProxies(nil)
+	}
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -31,49 +40,202 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 	router.GET("/ws", h.handleWebSocket)
 
+	agent := router.Group("/agent")
+	{
+		agent.POST("/enroll", h.enrollDevice)
+	}
+
 	auth := router.Group("/auth")
 	{
 		auth.POST("/sign-up", h.signUp)
 		auth.POST("/sign-in", h.signIn)
+		auth.POST("/refresh", h.refreshToken)
+		auth.POST("/logout", h.logout)
+
+		mfa := auth.Group("/2fa")
+		{
+			mfa.POST("/verify", h.verifyMFA)
+			mfa.POST("/setup", h.setupMFAEnrollment)
+			mfa.POST("/enable", h.completeMFAEnrollment)
+		}
 	}
 
-	api := router.Group("/api", h.userIdentity, h.adminOnly)
+	api := router.Group("/api", h.userIdentity, h.staffOnly)
 	{
 		groups := api.Group("/groups")
 		{
 			groups.GET("/", h.getAllGroups)
-			groups.POST("/", h.createGroup)
+			groups.POST("/", h.adminOnly, h.createGroup)
 			groups.GET("/:id", h.getGroupById)
-			groups.PATCH("/:id", h.updateGroup)
-			groups.DELETE("/:id", h.deleteGroup)
+			groups.PATCH("/:id", h.adminOnly, h.updateGroup)
+			groups.DELETE("/:id", h.adminOnly, h.deleteGroup)
 
-			users := groups.Group(":id/users")
+			users := groups.Group(":id/users", h.adminOnly)
 			{
 				users.POST("/", h.createUser)
 			}
+
+			members := groups.Group(":id/members")
+			{
+				members.GET("", h.getGroupMembers)
+				members.POST("", h.adminOnly, h.addGroupMember)
+				members.DELETE("/:uid", h.adminOnly, h.removeGroupMember)
+			}
+
+			teachers := groups.Group(":id/teachers", h.adminOnly)
+			{
+				teachers.GET("", h.getGroupTeachers)
+				teachers.POST("", h.addGroupTeacher)
+				teachers.DELETE("/:uid", h.removeGroupTeacher)
+			}
+
+			whitelist := groups.Group(":id/whitelist", h.adminOnly)
+			{
+				whitelist.GET("", h.getWhitelist)
+				whitelist.POST("", h.createWhitelistEntry)
+				whitelist.PUT("", h.replaceWhitelist)
+				whitelist.GET("/:wid", h.getWhitelistEntryById)
+				whitelist.PATCH("/:wid", h.updateWhitelistEntry)
+				whitelist.PUT("/:wid", h.updateWhitelistEntry)
+				whitelist.DELETE("/:wid", h.deleteWhitelistEntry)
+			}
+
+			groups.POST("/:id/commands", h.sendGroupCommand)
+			groups.GET("/:id/lessons", h.getGroupLessons)
+			groups.GET("/:id/current-lesson", h.getCurrentLesson)
 		}
 
-		users := api.Group("/users")
+		users := api.Group("/users", h.adminOnly)
 		{
 			users.GET("/", h.getAllUsers)
+			users.POST("/import", h.importUsers)
+			users.GET("/import/:cid/credentials", h.downloadImportCredentials)
 			users.GET("/:id", h.getUserById)
 			users.PATCH("/:id", h.updateUser)
 			users.DELETE("/:id", h.deleteUser)
+			users.POST("/:id/disable", h.disableUser)
+			users.POST("/:id/enable", h.enableUser)
+			users.POST("/:id/archive", h.archiveUser)
+			users.POST("/:id/restore", h.restoreUser)
 			users.POST("/:id/password", h.changePassword)
+			users.GET("/:id/sessions", h.getUserSessions)
+			users.DELETE("/:id/sessions", h.revokeAllUserSessions)
+			users.DELETE("/:id/sessions/:sid", h.revokeUserSession)
+			users.DELETE("/:id/2fa", h.resetUserTwoFactor)
 		}
 
-		admin := api.Group("/admin")
+		account := api.Group("/account/2fa")
+		{
+			account.GET("", h.getTwoFactorStatus)
+			account.POST("/setup", h.setupTwoFactor)
+			account.POST("/enable", h.enableTwoFactor)
+			account.POST("/disable", h.disableTwoFactor)
+			account.POST("/recovery-codes", h.regenerateRecoveryCodes)
+		}
+
+		admin := api.Group("/admin", h.adminOnly)
 		{
 			admin.POST("/sync", h.syncFromAD)
+			admin.POST("/sync/apply", h.applyADSync)
+			admin.GET("/sync/runs", h.getADSyncRuns)
+			admin.GET("/sync/runs/:id", h.getADSyncRunById)
 			admin.GET("/ad/status", h.checkADConnection)
+			admin.GET("/lockouts", h.getLockouts)
+			admin.DELETE("/lockouts/users/:username", h.unlockUser)
+			admin.DELETE("/lockouts/ips/:ip", h.unlockIP)
+			admin.GET("/directory-operations", h.getDirectoryOperations)
+			admin.GET("/directory-operations/:id", h.getDirectoryOperationById)
+			admin.POST("/directory-operations/:id/retry", h.retryDirectoryOperation)
+			admin.POST("/rollover/preview", h.previewRollover)
+			admin.POST("/rollover", h.applyRollover)
+			admin.GET("/rollovers", h.getRollovers)
+			admin.GET("/rollovers/:id", h.getRolloverById)
+			admin.POST("/rollovers/:id/rollback", h.rollbackRollover)
 		}
 
 		devices := api.Group("/devices")
 		{
 			devices.GET("/", h.getAllDevices)
 			devices.GET("/online", h.getOnlineDevices)
+			devices.GET("/enrolled", h.adminOnly, h.getEnrolledDevices)
+			devices.POST("/enrollment-codes", h.adminOnly, h.createEnrollmentCode)
 			devices.GET("/:name", h.getDeviceByName)
-			devices.DELETE("/:name", h.deleteDevice)
+			devices.DELETE("/:name", h.adminOnly, h.deleteDevice)
+			devices.POST("/:name/revoke", h.adminOnly, h.revokeDevice)
+			devices.GET("/:name/commands", h.getDeviceCommands)
+			devices.POST("/:name/commands", h.sendDeviceCommand)
+			devices.PUT("/:name/room", h.adminOnly, h.setDeviceRoom)
+		}
+
+		rooms := api.Group("/rooms", h.adminOnly)
+		{
+			rooms.POST("/:room/commands", h.sendRoomCommand)
+		}
+
+		commands := api.Group("/commands")
+		{
+			commands.GET("/:id", h.getCommandById)
+		}
+
+		timetable := api.Group("/timetable", h.adminOnly)
+		{
+			terms := timetable.Group("/terms")
+			{
+				terms.GET("", h.getTerms)
+				terms.POST("", h.createTerm)
+				terms.GET("/:id", h.getTermById)
+				terms.PATCH("/:id", h.updateTerm)
+				terms.DELETE("/:id", h.deleteTerm)
+			}
+
+			periods := timetable.Group("/periods")
+			{
+				periods.GET("", h.getPeriods)
+				periods.POST("", h.createPeriod)
+				periods.GET("/:id", h.getPeriodById)
+				periods.PATCH("/:id", h.updatePeriod)
+				periods.DELETE("/:id", h.deletePeriod)
+			}
+
+			lessons := timetable.Group("/lessons")
+			{
+				lessons.GET("", h.getLessons)
+				lessons.POST("", h.createLesson)
+				lessons.GET("/:id", h.getLessonById)
+				lessons.PATCH("/:id", h.updateLesson)
+				lessons.DELETE("/:id", h.deleteLesson)
+			}
+		}
+
+		exams := api.Group("/exams", h.adminOnly)
+		{
+			exams.GET("", h.getAllExamSessions)
+			exams.POST("", h.createExamSession)
+			exams.GET("/:id", h.getExamSessionById)
+			exams.PATCH("/:id", h.updateExamSession)
+			exams.DELETE("/:id", h.deleteExamSession)
+			exams.GET("/:id/violations", h.getExamViolations)
+		}
+
+		globalWhitelist := api.Group("/whitelist/global", h.adminOnly)
+		{
+			globalWhitelist.GET("", h.getGlobalWhitelist)
+			globalWhitelist.POST("", h.createGlobalWhitelistEntry)
+			globalWhitelist.GET("/:id", h.getGlobalWhitelistEntryById)
+			globalWhitelist.PATCH("/:id", h.updateGlobalWhitelistEntry)
+			globalWhitelist.DELETE("/:id", h.deleteGlobalWhitelistEntry)
+		}
+
+		policy := api.Group("/policy", h.adminOnly)
+		{
+			policy.GET("/:username", h.getEffectivePolicy)
+			policy.GET("/:username/check", h.checkPolicyAccess)
+		}
+
+		audit := api.Group("/audit", h.adminOnly)
+		{
+			audit.GET("", h.getAuditEvents)
+			audit.GET("/export", h.exportAuditEvents)
 		}
 
 		logs := api.Group("/logs")
@@ -85,3 +247,16 @@ func (h *Handler) InitRoutes() *gin.Engine {
 	}
 	return router
 }
+
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of addresses
+// or CIDR ranges of the reverse proxies in front of the server. Without it
+// no proxy is trusted and the client address is the peer address.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
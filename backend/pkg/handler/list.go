@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// listPage is the page a list request asks for, counted from 1.
+type listPage struct {
+	Page     int
+	PageSize int
+}
+
+// parseListQuery reads the search, sort, order, page and page_size params
+// shared by the user and group lists.
+func parseListQuery(c *gin.Context) (classosbackend.ListQuery, listPage, error) {
+	page := listPage{Page: 1, PageSize: defaultPageSize}
+	for param, target := range map[string]*int{
+		"page":      &page.Page,
+		"page_size": &page.PageSize,
+	} {
+		if raw := c.Query(param); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil || value <= 0 {
+				return classosbackend.ListQuery{}, page, fmt.Errorf("invalid %s param", param)
+			}
+			*target = value
+		}
+	}
+	if page.PageSize > maxPageSize {
+		page.PageSize = maxPageSize
+	}
+
+	query := classosbackend.ListQuery{
+		Search: c.Query("search"),
+		Sort:   c.Query("sort"),
+		Order:  c.Query("order"),
+		Limit:  page.PageSize,
+		Offset: (page.Page - 1) * page.PageSize,
+	}
+	return query, page, nil
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) getLockouts(c *gin.Context) {
+	lockouts, err := h.services.Lockout.GetLockouts()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data": lockouts,
+	})
+}
+
+func (h *Handler) unlockUser(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	if err := h.services.Lockout.UnlockUser(actor, c.Param("username")); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (h *Handler) unlockIP(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	if err := h.services.Lockout.UnlockIP(actor, c.Param("ip")); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
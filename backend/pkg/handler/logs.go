@@ -10,6 +10,11 @@ import (
 )
 
 func (h *Handler) getLogs(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
 	username := c.Query("username")
 	deviceName := c.Query("device")
 	fromDateStr := c.Query("from")
@@ -48,13 +53,13 @@ func (h *Handler) getLogs(c *gin.Context) {
 		}
 	}
 
-	logs, err := h.services.Logs.GetLogsFiltered(filter)
+	logs, err := h.services.Logs.GetLogsFiltered(checkerId, filter)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	count, err := h.services.Logs.GetLogsCount(filter)
+	count, err := h.services.Logs.GetLogsCount(checkerId, filter)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -69,6 +74,11 @@ func (h *Handler) getLogs(c *gin.Context) {
 }
 
 func (h *Handler) getLogsByUsername(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
 	username := c.Param("username")
 	if username == "" {
 		newErrorResponse(c, http.StatusBadRequest, "username is required")
@@ -88,7 +98,7 @@ func (h *Handler) getLogsByUsername(c *gin.Context) {
 		offset = 0
 	}
 
-	logs, err := h.services.Logs.GetLogsByUsername(username, limit, offset)
+	logs, err := h.services.Logs.GetLogsByUsername(checkerId, username, limit, offset)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -100,6 +110,11 @@ func (h *Handler) getLogsByUsername(c *gin.Context) {
 }
 
 func (h *Handler) getLogsByDevice(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
 	deviceName := c.Param("device")
 	if deviceName == "" {
 		newErrorResponse(c, http.StatusBadRequest, "device name is required")
@@ -119,7 +134,7 @@ func (h *Handler) getLogsByDevice(c *gin.Context) {
 		offset = 0
 	}
 
-	logs, err := h.services.Logs.GetLogsByDevice(deviceName, limit, offset)
+	logs, err := h.services.Logs.GetLogsByDevice(checkerId, deviceName, limit, offset)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/sirupsen/logrus"
 )
 
@@ -68,7 +69,27 @@ func getUserId(c *gin.Context) (int, error) {
 	return idInt, nil
 }
 
+// getActor identifies the user and client address behind a request for the
+// audit trail.
+func getActor(c *gin.Context) (classosbackend.Actor, error) {
+	id, err := getUserId(c)
+	if err != nil {
+		return classosbackend.Actor{}, err
+	}
+	return classosbackend.Actor{ID: id, IP: c.ClientIP()}, nil
+}
+
+// staffOnly lets admins and teachers through; what a teacher actually sees is
+// narrowed down to their groups by the services.
+func (h *Handler) staffOnly(c *gin.Context) {
+	requireRole(c, "staff access required", classosbackend.RoleAdmin, classosbackend.RoleTeacher)
+}
+
 func (h *Handler) adminOnly(c *gin.Context) {
+	requireRole(c, "admin access required", classosbackend.RoleAdmin)
+}
+
+func requireRole(c *gin.Context, message string, roles ...string) {
 	roleVal, exists := c.Get("role")
 	if !exists {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "role not found"})
@@ -76,10 +97,12 @@ func (h *Handler) adminOnly(c *gin.Context) {
 	}
 
 	role := roleVal.(string)
-	if role != "admin" {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-		return
+	for _, allowed := range roles {
+		if role == allowed {
+			c.Next()
+			return
+		}
 	}
 
-	c.Next()
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": message})
 }
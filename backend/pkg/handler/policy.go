@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) getEffectivePolicy(c *gin.Context) {
+	username := c.Param("username")
+	if username == "" {
+		newErrorResponse(c, http.StatusBadRequest, "username is required")
+		return
+	}
+
+	policy, err := h.services.Policy.GetEffectivePolicy(username)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *Handler) checkPolicyAccess(c *gin.Context) {
+	username := c.Param("username")
+	resource := c.Query("resource")
+	if username == "" || resource == "" {
+		newErrorResponse(c, http.StatusBadRequest, "username and resource are required")
+		return
+	}
+
+	decision, err := h.services.Policy.CheckAccess(username, resource)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,7 +18,37 @@ type statusResponse struct {
 	Status string `json:"status"`
 }
 
+// paginatedResponse is one page of a list in the shape the frontend expects.
+type paginatedResponse struct {
+	Data     interface{} `json:"data"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+}
+
 func newErrorResponse(c *gin.Context, statusCode int, message string) {
 	logrus.Error(message)
 	c.AbortWithStatusJSON(statusCode, errorResponse{message})
 }
+
+// errorStatus maps well-known service errors to HTTP status codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, classosbackend.ErrImportCredentialsExpired):
+		return http.StatusNotFound
+	case errors.Is(err, classosbackend.ErrInvalidWhitelistEntry),
+		errors.Is(err, classosbackend.ErrInvalidCommand),
+		errors.Is(err, classosbackend.ErrInvalidExamSession),
+		errors.Is(err, classosbackend.ErrInvalidTimetable),
+		errors.Is(err, classosbackend.ErrInvalidImport),
+		errors.Is(err, classosbackend.ErrInvalidListQuery),
+		errors.Is(err, classosbackend.ErrNotATeacher):
+		return http.StatusBadRequest
+	case errors.Is(err, classosbackend.ErrUserStatusConflict),
+		errors.Is(err, classosbackend.ErrPrimaryGroup):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// previewRollover returns what the plan would change without changing it.
+func (h *Handler) previewRollover(c *gin.Context) {
+	var plan classosbackend.RolloverPlan
+	if err := c.BindJSON(&plan); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	changes, err := h.services.Rollover.Preview(plan)
+	if err != nil {
+		newErrorResponse(c, rolloverErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+func (h *Handler) applyRollover(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var plan classosbackend.RolloverPlan
+	if err := c.BindJSON(&plan); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rollover, err := h.services.Rollover.Apply(actor, plan)
+	if err != nil {
+		newErrorResponse(c, rolloverErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, rollover)
+}
+
+func (h *Handler) getRollovers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	rollovers, err := h.services.Rollover.GetAll(limit, offset)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	count, err := h.services.Rollover.Count()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   rollovers,
+		"total":  count,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *Handler) getRolloverById(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	rollover, err := h.services.Rollover.GetById(id)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, rollover)
+}
+
+func (h *Handler) rollbackRollover(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	rollover, err := h.services.Rollover.Rollback(actor, id)
+	if err != nil {
+		newErrorResponse(c, rolloverErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, rollover)
+}
+
+func rolloverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, classosbackend.ErrRolloverConflict),
+		errors.Is(err, classosbackend.ErrRolloverNotRevertible):
+		return http.StatusConflict
+	case errors.Is(err, classosbackend.ErrInvalidRollover):
+		return http.StatusBadRequest
+	default:
+		return errorStatus(err)
+	}
+}
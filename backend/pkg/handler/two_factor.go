@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+func (h *Handler) getTwoFactorStatus(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	status, err := h.services.TwoFactor.GetStatus(userId)
+	if err != nil {
+		newErrorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *Handler) setupTwoFactor(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	setup, err := h.services.TwoFactor.Setup(userId)
+	if err != nil {
+		newErrorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *Handler) enableTwoFactor(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.TwoFactorCodeInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := h.services.TwoFactor.Enable(actor, input.Code)
+	if err != nil {
+		newErrorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) disableTwoFactor(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.TwoFactorCodeInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.TwoFactor.Disable(actor, input.Code); err != nil {
+		newErrorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (h *Handler) regenerateRecoveryCodes(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.TwoFactorCodeInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := h.services.TwoFactor.RegenerateRecoveryCodes(actor, input.Code)
+	if err != nil {
+		newErrorResponse(c, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) resetUserTwoFactor(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	if err := h.services.TwoFactor.Reset(actor, userId); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// twoFactorErrorStatus keeps wrong codes away from 401, which the frontend
+// takes for an expired session.
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode),
+		errors.Is(err, service.ErrTwoFactorEnabled),
+		errors.Is(err, service.ErrTwoFactorNotSetUp):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	default:
+		return errorStatus(err)
+	}
+}
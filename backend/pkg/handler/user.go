@@ -9,7 +9,7 @@ import (
 )
 
 func (h *Handler) createUser(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -26,7 +26,7 @@ func (h *Handler) createUser(c *gin.Context) {
 		return
 	}
 
-	id, err := h.services.User.Create(checkerId, groupId, input)
+	id, err := h.services.User.Create(actor, groupId, input)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -37,19 +37,53 @@ func (h *Handler) createUser(c *gin.Context) {
 	})
 }
 
+// getAllUsers lists a page of the users. search matches the name and the
+// username, group_id selects the members of a group (0 the users without
+// one), and role and status narrow the list down further.
 func (h *Handler) getAllUsers(c *gin.Context) {
 	checkerId, err := getUserId(c)
 	if err != nil {
 		return
 	}
 
-	users, err := h.services.User.GetAll(checkerId)
+	query, page, err := parseListQuery(c)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := classosbackend.UsersFilter{
+		ListQuery: query,
+		Role:      c.Query("role"),
+		Status:    c.Query("status"),
+	}
+	if raw := c.Query("group_id"); raw != "" {
+		groupId, err := strconv.Atoi(raw)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid group_id param")
+			return
+		}
+		filter.GroupID = &groupId
+	}
+
+	users, err := h.services.User.GetAll(checkerId, filter)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	total, err := h.services.User.Count(checkerId, filter)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, paginatedResponse{
+		Data:     users,
+		Total:    total,
+		Page:     page.Page,
+		PageSize: page.PageSize,
+	})
 }
 
 func (h *Handler) getUserById(c *gin.Context) {
@@ -74,7 +108,7 @@ func (h *Handler) getUserById(c *gin.Context) {
 }
 
 func (h *Handler) updateUser(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -92,7 +126,7 @@ func (h *Handler) updateUser(c *gin.Context) {
 	}
 
 
-	if err := h.services.User.Update(checkerId, id, input); err != nil {
+	if err := h.services.User.Update(actor, id, input); err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -103,7 +137,7 @@ func (h *Handler) updateUser(c *gin.Context) {
 }
 
 func (h *Handler) deleteUser(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -114,9 +148,50 @@ func (h *Handler) deleteUser(c *gin.Context) {
 		return
 	}
 
-	err = h.services.User.Delete(checkerId, user_id)
+	// Users are archived; ?purge=true deletes them with their history.
+	if c.Query("purge") == "true" {
+		err = h.services.User.Delete(actor, user_id)
+	} else {
+		err = h.services.User.Archive(actor, user_id)
+	}
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func (h *Handler) disableUser(c *gin.Context) {
+	h.changeUserStatus(c, h.services.User.Disable)
+}
+
+func (h *Handler) enableUser(c *gin.Context) {
+	h.changeUserStatus(c, h.services.User.Enable)
+}
+
+func (h *Handler) archiveUser(c *gin.Context) {
+	h.changeUserStatus(c, h.services.User.Archive)
+}
+
+func (h *Handler) restoreUser(c *gin.Context) {
+	h.changeUserStatus(c, h.services.User.Restore)
+}
+
+func (h *Handler) changeUserStatus(c *gin.Context, change func(actor classosbackend.Actor, userId int) error) {
+	actor, err := getActor(c)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	if err := change(actor, userId); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
 		return
 	}
 
@@ -124,7 +199,7 @@ func (h *Handler) deleteUser(c *gin.Context) {
 }
 
 func (h *Handler) changePassword(c *gin.Context) {
-	checkerId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return
 	}
@@ -148,7 +223,7 @@ func (h *Handler) changePassword(c *gin.Context) {
 		Password: &input.NewPassword,
 	}
 
-	if err := h.services.User.Update(checkerId, userId, updateInput); err != nil {
+	if err := h.services.User.Update(actor, userId, updateInput); err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const maxImportFileSize = 10 << 20
+
+// importUsers creates students from a CSV or XLSX class list sent as the
+// "file" form field. dry_run=true only validates the rows and shows the
+// usernames that would be given; create_groups=true creates missing classes.
+func (h *Handler) importUsers(c *gin.Context) {
+	actor, err := getActor(c)
+	if err != nil {
+		return
+	}
+
+	var options classosbackend.ImportOptions
+	if options.DryRun, err = strconv.ParseBool(c.DefaultQuery("dry_run", "false")); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid dry_run param")
+		return
+	}
+	if options.CreateGroups, err = strconv.ParseBool(c.DefaultQuery("create_groups", "false")); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid create_groups param")
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "file is required")
+		return
+	}
+	if file.Size > maxImportFileSize {
+		newErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d MB", maxImportFileSize>>20))
+		return
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxImportFileSize))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.services.UserImport.Import(actor, file.Filename, data, options)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// downloadImportCredentials sends the usernames and passwords of an import
+// as a CSV sheet while it is kept on the server.
+func (h *Handler) downloadImportCredentials(c *gin.Context) {
+	// Buffered so that an expired sheet still gets a JSON error.
+	var buf bytes.Buffer
+	if err := h.services.UserImport.WriteCredentials(&buf, c.Param("cid")); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("credentials-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
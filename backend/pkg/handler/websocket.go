@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"time"
@@ -9,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
 var upgrader = websocket.Upgrader{
@@ -24,6 +24,10 @@ type WSMessage struct {
 	Timestamp time.Time                 `json:"timestamp,omitempty"`
 	Data      []classosbackend.UserLog  `json:"data,omitempty"`
 	Token     string                    `json:"token,omitempty"`
+	Version   string                    `json:"version,omitempty"`
+	CommandID string                    `json:"command_id,omitempty"`
+	Status    string                    `json:"status,omitempty"`
+	Result    string                    `json:"result,omitempty"`
 }
 
 func (h *Handler) handleWebSocket(c *gin.Context) {
@@ -34,6 +38,9 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 	}
 	defer conn.Close()
 
+	session := service.NewAgentSession(conn)
+	defer h.services.Agents.Unregister(session)
+
 	authenticated := false
 	var deviceName string
 
@@ -47,13 +54,24 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 
 		switch msg.Type {
 		case "auth":
-			if msg.Token == "" {
-				log.Printf("Authentication failed: no token")
-				conn.Close()
+			if authenticated {
+				continue
+			}
+
+			if err := h.services.Device.AuthenticateDevice(msg.Device, msg.Token); err != nil {
+				log.Printf("Authentication failed for device %q: %v", msg.Device, err)
+				session.Send(map[string]string{"status": "error", "message": "unauthorized"})
 				return
 			}
+
 			authenticated = true
-			log.Printf("Agent authenticated with token")
+			deviceName = msg.Device
+			h.services.Agents.Register(deviceName, session)
+			log.Printf("Agent authenticated as device %s", deviceName)
+
+			if err := h.services.Command.DeliverPending(deviceName); err != nil {
+				log.Printf("Failed to deliver queued commands to %s: %v", deviceName, err)
+			}
 
 		case "heartbeat":
 			if !authenticated {
@@ -61,9 +79,12 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 				continue
 			}
 
-			deviceName = msg.Device
+			if msg.Device != "" && msg.Device != deviceName {
+				log.Printf("Device %s sent heartbeat for %s, ignoring the claimed name", deviceName, msg.Device)
+			}
+
 			device := classosbackend.DeviceStatus{
-				DeviceName:    msg.Device,
+				DeviceName:    deviceName,
 				Username:      msg.User,
 				LastHeartbeat: time.Now(),
 			}
@@ -72,7 +93,44 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 			if err != nil {
 				log.Printf("Failed to update device status: %v", err)
 			} else {
-				log.Printf("Heartbeat received from device %s, user %s", msg.Device, msg.User)
+				log.Printf("Heartbeat received from device %s, user %s", deviceName, msg.User)
+			}
+
+			// A new connection or a different user logged in: send the policy
+			// that applies to them.
+			if session.SetUsername(msg.User) && msg.User != "" {
+				if err := h.services.Policy.PushToDevice(deviceName, msg.User); err != nil {
+					log.Printf("Failed to push policy to device %s: %v", deviceName, err)
+				}
+			}
+
+		case "policy_ack":
+			if !authenticated {
+				log.Printf("Policy ack from unauthenticated client")
+				continue
+			}
+
+			if err := h.services.Policy.AcknowledgePolicy(deviceName, msg.Version); err != nil {
+				log.Printf("Failed to record policy ack from device %s: %v", deviceName, err)
+			} else {
+				log.Printf("Device %s applied policy %s", deviceName, msg.Version)
+			}
+
+		case "command_ack":
+			if !authenticated {
+				log.Printf("Command ack from unauthenticated client")
+				continue
+			}
+
+			ack := classosbackend.CommandAck{
+				CommandID: msg.CommandID,
+				Status:    msg.Status,
+				Result:    msg.Result,
+			}
+			if err := h.services.Command.Acknowledge(deviceName, ack); err != nil {
+				log.Printf("Failed to record command ack from device %s: %v", deviceName, err)
+			} else {
+				log.Printf("Device %s reported command %s as %s", deviceName, msg.CommandID, msg.Status)
 			}
 
 		case "logs":
@@ -83,9 +141,7 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 
 			if len(msg.Data) > 0 {
 				for i := range msg.Data {
-					if msg.Data[i].DeviceName == "" && deviceName != "" {
-						msg.Data[i].DeviceName = deviceName
-					}
+					msg.Data[i].DeviceName = deviceName
 				}
 
 				err := h.services.Logs.SaveLogs(msg.Data)
@@ -94,6 +150,10 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 				} else {
 					log.Printf("Saved %d logs from device %s", len(msg.Data), deviceName)
 				}
+
+				if err := h.services.Exam.RecordViolations(deviceName, msg.Data); err != nil {
+					log.Printf("Failed to check logs for exam violations: %v", err)
+				}
 			}
 
 		default:
@@ -101,7 +161,6 @@ func (h *Handler) handleWebSocket(c *gin.Context) {
 		}
 
 		response := map[string]string{"status": "ok"}
-		jsonResp, _ := json.Marshal(response)
-		conn.WriteMessage(websocket.TextMessage, jsonResp)
+		session.Send(response)
 	}
 }
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type getAllWhitelistResponse struct {
+	Data []classosbackend.WhitelistEntry `json:"data"`
+}
+
+func getWhitelistParams(c *gin.Context) (int, int, error) {
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return 0, 0, err
+	}
+
+	if c.Param("wid") == "" {
+		return groupId, 0, nil
+	}
+
+	entryId, err := strconv.Atoi(c.Param("wid"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid whitelist id in params")
+		return 0, 0, err
+	}
+
+	return groupId, entryId, nil
+}
+
+func (h *Handler) getWhitelist(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, _, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	entries, err := h.services.Whitelist.GetAll(checkerId, groupId)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, getAllWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) createWhitelistEntry(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, _, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.WhitelistEntry
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := h.services.Whitelist.Create(checkerId, groupId, input)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+func (h *Handler) replaceWhitelist(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, _, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.ReplaceWhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.services.Whitelist.Replace(checkerId, groupId, input.Entries)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, getAllWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) getWhitelistEntryById(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, entryId, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	entry, err := h.services.Whitelist.GetById(checkerId, groupId, entryId)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *Handler) updateWhitelistEntry(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, entryId, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.UpdateWhitelistEntryInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.Whitelist.Update(checkerId, groupId, entryId, input); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{
+		Status: "ok",
+	})
+}
+
+func (h *Handler) deleteWhitelistEntry(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, entryId, err := getWhitelistParams(c)
+	if err != nil {
+		return
+	}
+
+	if err := h.services.Whitelist.Delete(checkerId, groupId, entryId); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{
+		Status: "ok",
+	})
+}
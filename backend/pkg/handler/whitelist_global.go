@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type getAllGlobalWhitelistResponse struct {
+	Data []classosbackend.GlobalWhitelistEntry `json:"data"`
+}
+
+func (h *Handler) getGlobalWhitelist(c *gin.Context) {
+	list := c.Query("list")
+	if list != "" && list != classosbackend.GlobalListAllow && list != classosbackend.GlobalListDeny {
+		newErrorResponse(c, http.StatusBadRequest, "list must be allow or deny")
+		return
+	}
+
+	entries, err := h.services.GlobalWhitelist.GetAll(list)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, getAllGlobalWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) createGlobalWhitelistEntry(c *gin.Context) {
+	var input classosbackend.GlobalWhitelistEntry
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := h.services.GlobalWhitelist.Create(input)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+func (h *Handler) getGlobalWhitelistEntryById(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	entry, err := h.services.GlobalWhitelist.GetById(id)
+	if err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *Handler) updateGlobalWhitelistEntry(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.UpdateGlobalWhitelistEntryInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.GlobalWhitelist.Update(id, input); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{
+		Status: "ok",
+	})
+}
+
+func (h *Handler) deleteGlobalWhitelistEntry(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	if err := h.services.GlobalWhitelist.Delete(id); err != nil {
+		newErrorResponse(c, errorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{
+		Status: "ok",
+	})
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const auditEventColumns = `id, actor_id, actor_username, action, target_type, target_id, target_name,
+	changes, ip, result, error, created_at`
+
+type AuditPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAuditPostgres(db *sqlx.DB) *AuditPostgres {
+	return &AuditPostgres{db: db}
+}
+
+// Create stores the event together with the actor's current username, so the
+// record stays readable after the actor is deleted.
+func (r *AuditPostgres) Create(event classosbackend.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, actor_username, action, target_type, target_id, target_name,
+			changes, ip, result, error, created_at)
+		VALUES ($1, COALESCE((SELECT username FROM users WHERE id = $1), ''), $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.Exec(query, event.ActorID, event.Action, event.TargetType, event.TargetID, event.TargetName,
+		event.Changes, event.IP, event.Result, event.Error, event.CreatedAt)
+	return err
+}
+
+func (r *AuditPostgres) GetAll(filter classosbackend.AuditFilter) ([]classosbackend.AuditEvent, error) {
+	events := make([]classosbackend.AuditEvent, 0)
+	where, args := auditConditions(filter)
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events` + where + ` ORDER BY created_at DESC, id DESC`
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	err := r.db.Select(&events, query, args...)
+	return events, err
+}
+
+func (r *AuditPostgres) Count(filter classosbackend.AuditFilter) (int, error) {
+	var count int
+	where, args := auditConditions(filter)
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM audit_events`+where, args...)
+	return count, err
+}
+
+func auditConditions(filter classosbackend.AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != 0 {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		add("target_id = $%d", filter.TargetID)
+	}
+	if filter.FromDate != nil {
+		add("created_at >= $%d", *filter.FromDate)
+	}
+	if filter.ToDate != nil {
+		add("created_at <= $%d", *filter.ToDate)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
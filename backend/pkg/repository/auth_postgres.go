@@ -2,6 +2,7 @@ package repository
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	classosbackend "github.com/rinat0880/classOS_backend"
@@ -25,14 +26,126 @@ func (r *AuthPostgres) CreateUser(user classosbackend.User) (int, error) {
 	return id, nil
 }
 
-func (r *AuthPostgres) GetUser(username, password string) (classosbackend.User, error) {
+// GetUser loads a user with the stored password hash; the hash is verified
+// by the service.
+func (r *AuthPostgres) GetUser(username string) (classosbackend.User, error) {
 	var user classosbackend.User
 	query := fmt.Sprintf(`
-		SELECT id, name, username, role 
-		FROM %s 
-		WHERE username=$1 AND password_hash=$2
+		SELECT id, name, username, role, password_hash, status
+		FROM %s
+		WHERE username=$1
 	`, usersTable)
-	err := r.db.Get(&user, query, username, password)
-	
+	err := r.db.Get(&user, query, username)
+
+	return user, err
+}
+
+func (r *AuthPostgres) GetUserById(userId int) (classosbackend.User, error) {
+	var user classosbackend.User
+	query := fmt.Sprintf("SELECT id, name, username, role FROM %s WHERE id=$1", usersTable)
+	err := r.db.Get(&user, query, userId)
 	return user, err
 }
+
+// CreateDirectoryUser inserts a user whose password lives in the directory;
+// unlike CreateUser it keeps the given role and password hash as they are.
+func (r *AuthPostgres) CreateDirectoryUser(user classosbackend.User) (int, error) {
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (name, username, role, password_hash) values ($1, $2, $3, $4) RETURNING id", usersTable)
+	row := r.db.QueryRow(query, user.Name, user.Username, user.Role, user.Password)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *AuthPostgres) UpdateRole(userId int, role string) error {
+	query := fmt.Sprintf("UPDATE %s SET role=$1 WHERE id=$2", usersTable)
+	_, err := r.db.Exec(query, role, userId)
+	return err
+}
+
+func (r *AuthPostgres) UpdatePasswordHash(userId int, passwordHash string) error {
+	query := fmt.Sprintf("UPDATE %s SET password_hash=$1 WHERE id=$2", usersTable)
+	_, err := r.db.Exec(query, passwordHash, userId)
+	return err
+}
+
+const authSessionColumns = `id, user_id, refresh_token_hash, previous_token_hash, user_agent, ip,
+	created_at, last_used_at, expires_at, revoked_at`
+
+func (r *AuthPostgres) CreateSession(session classosbackend.AuthSession) error {
+	query := `
+		INSERT INTO auth_sessions (id, user_id, refresh_token_hash, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+	`
+	_, err := r.db.Exec(query, session.ID, session.UserID, session.RefreshTokenHash,
+		session.UserAgent, session.IP, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+func (r *AuthPostgres) GetSession(sessionId string) (classosbackend.AuthSession, error) {
+	var session classosbackend.AuthSession
+	query := `SELECT ` + authSessionColumns + ` FROM auth_sessions WHERE id = $1`
+	err := r.db.Get(&session, query, sessionId)
+	return session, err
+}
+
+// GetSessionByRefreshHash finds the session a refresh token belongs to, also
+// when the token is the one that was already rotated away.
+func (r *AuthPostgres) GetSessionByRefreshHash(tokenHash string) (classosbackend.AuthSession, error) {
+	var session classosbackend.AuthSession
+	query := `
+		SELECT ` + authSessionColumns + `
+		FROM auth_sessions
+		WHERE refresh_token_hash = $1 OR previous_token_hash = $1
+		LIMIT 1
+	`
+	err := r.db.Get(&session, query, tokenHash)
+	return session, err
+}
+
+func (r *AuthPostgres) GetActiveSessions(userId int) ([]classosbackend.AuthSession, error) {
+	sessions := make([]classosbackend.AuthSession, 0)
+	query := `
+		SELECT ` + authSessionColumns + `
+		FROM auth_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`
+	err := r.db.Select(&sessions, query, userId, time.Now())
+	return sessions, err
+}
+
+// RotateSession swaps the refresh token of an active session. It fails with
+// sql.ErrNoRows if the current token was rotated concurrently.
+func (r *AuthPostgres) RotateSession(sessionId, currentHash, newHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE auth_sessions
+		SET previous_token_hash = refresh_token_hash, refresh_token_hash = $1, last_used_at = $2, expires_at = $3
+		WHERE id = $4 AND refresh_token_hash = $5 AND revoked_at IS NULL
+	`
+	result, err := r.db.Exec(query, newHash, time.Now(), expiresAt, sessionId, currentHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AuthPostgres) RevokeSession(userId int, sessionId string) error {
+	query := `UPDATE auth_sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), sessionId, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *AuthPostgres) RevokeAllSessions(userId int) (int64, error) {
+	query := `UPDATE auth_sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const deviceCommandColumns = `id, device_name, command_type, payload, status, result, created_by,
+	created_at, expires_at, delivered_at, acknowledged_at`
+
+type CommandPostgres struct {
+	db *sqlx.DB
+}
+
+func NewCommandPostgres(db *sqlx.DB) *CommandPostgres {
+	return &CommandPostgres{db: db}
+}
+
+func (r *CommandPostgres) Create(command classosbackend.DeviceCommand) error {
+	query := `
+		INSERT INTO device_commands (id, device_name, command_type, payload, status, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.Exec(query, command.ID, command.DeviceName, command.Type, command.Payload,
+		command.Status, command.CreatedBy, command.CreatedAt, command.ExpiresAt)
+	return err
+}
+
+func (r *CommandPostgres) GetById(commandId string) (classosbackend.DeviceCommand, error) {
+	var command classosbackend.DeviceCommand
+	query := `SELECT ` + deviceCommandColumns + ` FROM device_commands WHERE id = $1`
+	err := r.db.Get(&command, query, commandId)
+	return command, err
+}
+
+func (r *CommandPostgres) GetByDevice(deviceName string, limit, offset int) ([]classosbackend.DeviceCommand, error) {
+	commands := make([]classosbackend.DeviceCommand, 0)
+	query := `
+		SELECT ` + deviceCommandColumns + `
+		FROM device_commands
+		WHERE device_name = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	err := r.db.Select(&commands, query, deviceName, limit, offset)
+	return commands, err
+}
+
+// GetPending returns commands queued for a device while it was offline that
+// have not expired yet, oldest first.
+func (r *CommandPostgres) GetPending(deviceName string) ([]classosbackend.DeviceCommand, error) {
+	commands := make([]classosbackend.DeviceCommand, 0)
+	query := `
+		SELECT ` + deviceCommandColumns + `
+		FROM device_commands
+		WHERE device_name = $1 AND status = 'pending' AND expires_at > $2
+		ORDER BY created_at
+	`
+	err := r.db.Select(&commands, query, deviceName, time.Now())
+	return commands, err
+}
+
+func (r *CommandPostgres) MarkDelivered(commandId string) error {
+	query := `
+		UPDATE device_commands
+		SET status = 'delivered', delivered_at = $1
+		WHERE id = $2 AND status = 'pending'
+	`
+	_, err := r.db.Exec(query, time.Now(), commandId)
+	return err
+}
+
+func (r *CommandPostgres) MarkFailed(commandId, reason string) error {
+	query := `UPDATE device_commands SET status = 'failed', result = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, reason, commandId)
+	return err
+}
+
+// Acknowledge stores the agent's answer. Only the device the command was sent
+// to can acknowledge it, and only while it is still in flight.
+func (r *CommandPostgres) Acknowledge(deviceName string, ack classosbackend.CommandAck) error {
+	query := `
+		UPDATE device_commands
+		SET status = $1, result = $2, acknowledged_at = $3
+		WHERE id = $4 AND device_name = $5 AND status IN ('pending', 'delivered')
+	`
+	result, err := r.db.Exec(query, ack.Status, ack.Result, time.Now(), ack.CommandID, deviceName)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *CommandPostgres) ExpireOverdue() (int64, error) {
+	query := `
+		UPDATE device_commands
+		SET status = 'expired'
+		WHERE status IN ('pending', 'delivered') AND expires_at < $1
+	`
+	result, err := r.db.Exec(query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
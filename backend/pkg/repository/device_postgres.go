@@ -7,6 +7,9 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+const deviceStatusColumns = `device_name, username, last_heartbeat, created_at, updated_at,
+	policy_version, policy_pushed_version, policy_applied_at`
+
 type DevicePostgres struct {
 	db *sqlx.DB
 }
@@ -29,59 +32,246 @@ func (r *DevicePostgres) UpsertDeviceStatus(device classosbackend.DeviceStatus)
 	return err
 }
 
-func (r *DevicePostgres) GetAllDevices() ([]classosbackend.DeviceStatus, error) {
+func (r *DevicePostgres) GetAllDevices(checkerId int) ([]classosbackend.DeviceStatus, error) {
 	var devices []classosbackend.DeviceStatus
-	query := `SELECT device_name, username, last_heartbeat, created_at, updated_at FROM device_status ORDER BY last_heartbeat DESC`
+	query := `SELECT ` + deviceStatusColumns + ` FROM device_status
+		WHERE ` + usernameScope("username", "$1") + `
+		ORDER BY last_heartbeat DESC`
 	
-	err := r.db.Select(&devices, query)
+	err := r.db.Select(&devices, query, checkerId)
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range devices {
 		devices[i].IsOnline = time.Since(devices[i].LastHeartbeat) < 2*time.Minute
+		devices[i].PolicyOutdated = isPolicyOutdated(devices[i])
 	}
 
 	return devices, nil
 }
 
-func (r *DevicePostgres) GetOnlineDevices() ([]classosbackend.DeviceStatus, error) {
+func (r *DevicePostgres) GetOnlineDevices(checkerId int) ([]classosbackend.DeviceStatus, error) {
 	var devices []classosbackend.DeviceStatus
 	query := `
-		SELECT device_name, username, last_heartbeat, created_at, updated_at 
+		SELECT ` + deviceStatusColumns + `
 		FROM device_status 
-		WHERE last_heartbeat > $1
+		WHERE last_heartbeat > $1 AND ` + usernameScope("username", "$2") + `
 		ORDER BY last_heartbeat DESC
 	`
 	
 	threshold := time.Now().Add(-2 * time.Minute)
-	err := r.db.Select(&devices, query, threshold)
+	err := r.db.Select(&devices, query, threshold, checkerId)
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range devices {
 		devices[i].IsOnline = true
+		devices[i].PolicyOutdated = isPolicyOutdated(devices[i])
 	}
 
 	return devices, nil
 }
 
-func (r *DevicePostgres) GetDeviceByName(deviceName string) (classosbackend.DeviceStatus, error) {
+func (r *DevicePostgres) GetDeviceByName(checkerId int, deviceName string) (classosbackend.DeviceStatus, error) {
 	var device classosbackend.DeviceStatus
-	query := `SELECT device_name, username, last_heartbeat, created_at, updated_at FROM device_status WHERE device_name = $1`
+	query := `SELECT ` + deviceStatusColumns + ` FROM device_status
+		WHERE device_name = $1 AND ` + usernameScope("username", "$2")
 	
-	err := r.db.Get(&device, query, deviceName)
+	err := r.db.Get(&device, query, deviceName, checkerId)
 	if err != nil {
 		return device, err
 	}
 
 	device.IsOnline = time.Since(device.LastHeartbeat) < 2*time.Minute
+	device.PolicyOutdated = isPolicyOutdated(device)
 	return device, nil
 }
 
+// CanAccessDevice reports whether the checker may see and command the
+// device: admins may use any device, teachers the devices last used by a
+// member of their groups.
+func (r *DevicePostgres) CanAccessDevice(checkerId int, deviceName string) (bool, error) {
+	var ok bool
+	query := `SELECT ` + checkerIsAdmin("$1") + ` OR EXISTS (
+		SELECT 1 FROM device_status
+		WHERE device_name = $2 AND ` + usernameScope("username", "$1") + `)`
+	err := r.db.Get(&ok, query, checkerId, deviceName)
+	return ok, err
+}
+
 func (r *DevicePostgres) DeleteDevice(deviceName string) error {
 	query := `DELETE FROM device_status WHERE device_name = $1`
 	_, err := r.db.Exec(query, deviceName)
 	return err
 }
+
+func (r *DevicePostgres) GetDevicesByGroup(groupId int) ([]classosbackend.DeviceStatus, error) {
+	var devices []classosbackend.DeviceStatus
+	// The device reports the signed-in account name as Windows spells it, so
+	// it is matched against the users table without regard to case; the
+	// group comes from that user's current memberships.
+	query := `
+		SELECT ` + deviceStatusColumns + `
+		FROM device_status ds
+		WHERE EXISTS (
+			SELECT 1 FROM users u
+			JOIN users_lists ul ON ul.user_id = u.id
+			WHERE LOWER(u.username) = LOWER(ds.username) AND ul.group_id = $1 AND u.status != $2
+		)
+	`
+
+	err := r.db.Select(&devices, query, groupId, classosbackend.UserStatusArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range devices {
+		devices[i].IsOnline = time.Since(devices[i].LastHeartbeat) < 2*time.Minute
+		devices[i].PolicyOutdated = isPolicyOutdated(devices[i])
+	}
+
+	return devices, nil
+}
+
+func (r *DevicePostgres) SetPolicyPushed(deviceName, version string) error {
+	query := `UPDATE device_status SET policy_pushed_version = $1 WHERE device_name = $2`
+	_, err := r.db.Exec(query, version, deviceName)
+	return err
+}
+
+func (r *DevicePostgres) SetPolicyApplied(deviceName, version string) error {
+	query := `UPDATE device_status SET policy_version = $1, policy_applied_at = $2 WHERE device_name = $3`
+	_, err := r.db.Exec(query, version, time.Now(), deviceName)
+	return err
+}
+
+func isPolicyOutdated(device classosbackend.DeviceStatus) bool {
+	if device.PolicyPushedVersion == nil {
+		return false
+	}
+	return device.PolicyVersion == nil || *device.PolicyVersion != *device.PolicyPushedVersion
+}
+
+func (r *DevicePostgres) CreateEnrollmentCode(codeHash string, deviceName *string, createdBy int, expiresAt time.Time) error {
+	query := `INSERT INTO device_enrollment_codes (code_hash, device_name, created_by, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := r.db.Exec(query, codeHash, deviceName, createdBy, expiresAt)
+	return err
+}
+
+// EnrollDevice consumes a one-time enrollment code and stores the device
+// credential. A device that is already enrolled, revoked or not, can only be
+// enrolled again with a code issued for it; that replaces its credential and
+// lifts a previous revocation.
+func (r *DevicePostgres) EnrollDevice(codeHash, deviceName, credentialHash string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var code struct {
+		CreatedBy  *int    `db:"created_by"`
+		DeviceName *string `db:"device_name"`
+	}
+	consumeQuery := `
+		UPDATE device_enrollment_codes
+		SET used_at = $1, used_by_device = $2
+		WHERE code_hash = $3 AND used_at IS NULL AND expires_at > $1
+			AND (device_name IS NULL OR device_name = $2)
+		RETURNING created_by, device_name
+	`
+	if err := tx.Get(&code, consumeQuery, time.Now(), deviceName, codeHash); err != nil {
+		return err
+	}
+
+	enrollQuery := `
+		INSERT INTO devices (device_name, credential_hash, enrolled_by, enrolled_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (device_name)
+		DO UPDATE SET
+			credential_hash = EXCLUDED.credential_hash,
+			enrolled_by = EXCLUDED.enrolled_by,
+			enrolled_at = EXCLUDED.enrolled_at,
+			revoked_at = NULL
+	`
+	if code.DeviceName == nil {
+		enrollQuery = `
+			INSERT INTO devices (device_name, credential_hash, enrolled_by, enrolled_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (device_name) DO NOTHING
+		`
+	}
+	result, err := tx.Exec(enrollQuery, deviceName, credentialHash, code.CreatedBy, time.Now())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return classosbackend.ErrDeviceEnrolled
+	}
+
+	return tx.Commit()
+}
+
+func (r *DevicePostgres) GetEnrolledDevice(deviceName string) (classosbackend.EnrolledDevice, error) {
+	var device classosbackend.EnrolledDevice
+	query := `
+		SELECT id, device_name, room, credential_hash, enrolled_by, enrolled_at, last_seen_at, revoked_at
+		FROM devices
+		WHERE device_name = $1
+	`
+	err := r.db.Get(&device, query, deviceName)
+	return device, err
+}
+
+func (r *DevicePostgres) GetEnrolledDevices() ([]classosbackend.EnrolledDevice, error) {
+	devices := make([]classosbackend.EnrolledDevice, 0)
+	query := `
+		SELECT id, device_name, room, credential_hash, enrolled_by, enrolled_at, last_seen_at, revoked_at
+		FROM devices
+		ORDER BY device_name
+	`
+	err := r.db.Select(&devices, query)
+	return devices, err
+}
+
+func (r *DevicePostgres) TouchEnrolledDevice(deviceName string) error {
+	query := `UPDATE devices SET last_seen_at = $1 WHERE device_name = $2`
+	_, err := r.db.Exec(query, time.Now(), deviceName)
+	return err
+}
+
+func (r *DevicePostgres) RevokeDevice(deviceName string) error {
+	query := `UPDATE devices SET revoked_at = $1 WHERE device_name = $2 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), deviceName)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *DevicePostgres) GetEnrolledDevicesByRoom(room string) ([]classosbackend.EnrolledDevice, error) {
+	devices := make([]classosbackend.EnrolledDevice, 0)
+	query := `
+		SELECT id, device_name, room, credential_hash, enrolled_by, enrolled_at, last_seen_at, revoked_at
+		FROM devices
+		WHERE room = $1 AND revoked_at IS NULL
+		ORDER BY device_name
+	`
+	err := r.db.Select(&devices, query, room)
+	return devices, err
+}
+
+func (r *DevicePostgres) SetDeviceRoom(deviceName string, room *string) error {
+	query := `UPDATE devices SET room = $1 WHERE device_name = $2`
+	result, err := r.db.Exec(query, room, deviceName)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
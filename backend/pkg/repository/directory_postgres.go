@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const directoryOperationColumns = `id, kind, target_id, target_name, payload, status, phase, step, attempts,
+	next_attempt_at, last_error, actor_id, created_at, updated_at`
+
+type DirectoryPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDirectoryPostgres(db *sqlx.DB) *DirectoryPostgres {
+	return &DirectoryPostgres{db: db}
+}
+
+func (r *DirectoryPostgres) BeginTransaction() (*sql.Tx, error) {
+	return r.db.Begin()
+}
+
+func (r *DirectoryPostgres) Create(op classosbackend.DirectoryOperation) (int64, error) {
+	var id int64
+	query := `
+		INSERT INTO directory_operations (kind, target_id, target_name, payload, status, phase, step, attempts,
+			next_attempt_at, last_error, actor_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+	err := r.db.QueryRow(query, op.Kind, op.TargetID, op.TargetName, op.Payload, op.Status, op.Phase, op.Step,
+		op.Attempts, op.NextAttemptAt, op.LastError, op.ActorID, op.CreatedAt, op.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+const saveDirectoryOperationQuery = `
+	UPDATE directory_operations
+	SET target_id = $2, status = $3, phase = $4, step = $5, attempts = $6, next_attempt_at = $7,
+		last_error = $8, updated_at = $9
+	WHERE id = $1
+`
+
+// Save stores the progress of an operation.
+func (r *DirectoryPostgres) Save(op classosbackend.DirectoryOperation) error {
+	result, err := r.db.Exec(saveDirectoryOperationQuery, op.ID, op.TargetID, op.Status, op.Phase, op.Step,
+		op.Attempts, op.NextAttemptAt, op.LastError, op.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// SaveWithTx stores the progress together with the database change of the
+// operation, so the journal never disagrees with the data.
+func (r *DirectoryPostgres) SaveWithTx(tx *sql.Tx, op classosbackend.DirectoryOperation) error {
+	result, err := tx.Exec(saveDirectoryOperationQuery, op.ID, op.TargetID, op.Status, op.Phase, op.Step,
+		op.Attempts, op.NextAttemptAt, op.LastError, op.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *DirectoryPostgres) GetById(id int64) (classosbackend.DirectoryOperation, error) {
+	var op classosbackend.DirectoryOperation
+	query := `SELECT ` + directoryOperationColumns + ` FROM directory_operations WHERE id = $1`
+	err := r.db.Get(&op, query, id)
+	return op, err
+}
+
+func (r *DirectoryPostgres) GetAll(filter classosbackend.DirectoryOperationFilter) ([]classosbackend.DirectoryOperation, error) {
+	ops := make([]classosbackend.DirectoryOperation, 0)
+	where, args := directoryConditions(filter)
+
+	query := `SELECT ` + directoryOperationColumns + ` FROM directory_operations` + where + ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	err := r.db.Select(&ops, query, args...)
+	return ops, err
+}
+
+func (r *DirectoryPostgres) Count(filter classosbackend.DirectoryOperationFilter) (int, error) {
+	var count int
+	where, args := directoryConditions(filter)
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM directory_operations`+where, args...)
+	return count, err
+}
+
+func directoryConditions(filter classosbackend.DirectoryOperationFilter) (string, []interface{}) {
+	switch filter.Status {
+	case "all":
+		return "", nil
+	case "":
+		return " WHERE status NOT IN ('succeeded', 'compensated')", nil
+	default:
+		return " WHERE status = $1", []interface{}{filter.Status}
+	}
+}
+
+// ClaimDue marks operations whose retry is due, and running operations not
+// touched since staleBefore, as running and returns them. Rows locked by
+// another instance are skipped.
+func (r *DirectoryPostgres) ClaimDue(now, staleBefore time.Time, limit int) ([]classosbackend.DirectoryOperation, error) {
+	ops := make([]classosbackend.DirectoryOperation, 0)
+	query := `
+		UPDATE directory_operations SET status = 'running', updated_at = $1
+		WHERE id IN (
+			SELECT id FROM directory_operations
+			WHERE (status IN ('pending', 'compensating') AND next_attempt_at <= $1)
+				OR (status = 'running' AND updated_at < $2)
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + directoryOperationColumns
+	err := r.db.Select(&ops, query, now, staleBefore, limit)
+	return ops, err
+}
+
+// ClaimFailed takes a failed operation for a manual retry with a fresh
+// attempt budget.
+func (r *DirectoryPostgres) ClaimFailed(id int64, now time.Time) (classosbackend.DirectoryOperation, error) {
+	var op classosbackend.DirectoryOperation
+	query := `
+		UPDATE directory_operations
+		SET status = 'running', attempts = 0, next_attempt_at = NULL, updated_at = $2
+		WHERE id = $1 AND status = 'failed'
+		RETURNING ` + directoryOperationColumns
+	err := r.db.Get(&op, query, id, now)
+	return op, err
+}
+
+func (r *DirectoryPostgres) DeleteFinished(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM directory_operations
+		WHERE status IN ('succeeded', 'compensated') AND updated_at < $1
+	`
+	result, err := r.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const syncRunColumns = `id, trigger, mode, status, phase, total, processed, applied, failed, error, actor_id,
+	started_at, finished_at`
+
+// DirectorySyncPostgres reads and writes users and groups for the directory
+// sync. It is not scoped to a checker: only admins and the scheduler sync.
+type DirectorySyncPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDirectorySyncPostgres(db *sqlx.DB) *DirectorySyncPostgres {
+	return &DirectorySyncPostgres{db: db}
+}
+
+func (r *DirectorySyncPostgres) CreateRun(run classosbackend.SyncRun) (int64, error) {
+	var id int64
+	query := `
+		INSERT INTO directory_sync_runs (trigger, mode, status, phase, report, actor_id, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	err := r.db.QueryRow(query, run.Trigger, run.Mode, run.Status, run.Phase, run.Report, run.ActorID,
+		run.StartedAt).Scan(&id)
+	return id, err
+}
+
+// SaveRun stores the progress of a run.
+func (r *DirectorySyncPostgres) SaveRun(run classosbackend.SyncRun) error {
+	query := `
+		UPDATE directory_sync_runs
+		SET status = $2, phase = $3, total = $4, processed = $5, applied = $6, failed = $7, report = $8,
+			error = $9, finished_at = $10
+		WHERE id = $1
+	`
+	result, err := r.db.Exec(query, run.ID, run.Status, run.Phase, run.Total, run.Processed, run.Applied,
+		run.Failed, run.Report, run.Error, run.FinishedAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *DirectorySyncPostgres) GetRun(id int64) (classosbackend.SyncRun, error) {
+	var run classosbackend.SyncRun
+	query := `SELECT ` + syncRunColumns + `, report FROM directory_sync_runs WHERE id = $1`
+	err := r.db.Get(&run, query, id)
+	return run, err
+}
+
+// GetRuns lists runs newest first, without their reports.
+func (r *DirectorySyncPostgres) GetRuns(limit, offset int) ([]classosbackend.SyncRun, error) {
+	runs := make([]classosbackend.SyncRun, 0)
+	query := `SELECT ` + syncRunColumns + ` FROM directory_sync_runs ORDER BY id DESC LIMIT $1 OFFSET $2`
+	err := r.db.Select(&runs, query, limit, offset)
+	return runs, err
+}
+
+func (r *DirectorySyncPostgres) CountRuns() (int, error) {
+	var count int
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM directory_sync_runs`)
+	return count, err
+}
+
+// FailRunning marks runs that a restart interrupted as failed.
+func (r *DirectorySyncPostgres) FailRunning(now time.Time) (int64, error) {
+	query := `
+		UPDATE directory_sync_runs
+		SET status = 'failed', error = 'interrupted by a restart', finished_at = $1
+		WHERE status = 'running'
+	`
+	result, err := r.db.Exec(query, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUsers returns every user with their primary group and all of their
+// groups.
+func (r *DirectorySyncPostgres) GetUsers() ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role, ul.group_id, g.name AS group_name
+		FROM %s u
+		LEFT JOIN %s ul ON ul.user_id = u.id AND ul.is_primary
+		LEFT JOIN %s g ON g.id = ul.group_id
+		ORDER BY u.id`, usersTable, users_listsTable, groupsTable)
+	if err := r.db.Select(&users, query); err != nil {
+		return nil, err
+	}
+	return users, loadUserGroups(r.db, users)
+}
+
+func (r *DirectorySyncPostgres) GetGroups() ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	query := fmt.Sprintf(`SELECT id, name FROM %s ORDER BY id`, groupsTable)
+	err := r.db.Select(&groups, query)
+	return groups, err
+}
+
+func (r *DirectorySyncPostgres) CreateGroup(name string) (int, error) {
+	var id int
+	query := fmt.Sprintf(`INSERT INTO %s (name) VALUES ($1) RETURNING id`, groupsTable)
+	err := r.db.QueryRow(query, name).Scan(&id)
+	return id, err
+}
+
+// CreateUser inserts an imported user into the groups, the first one being
+// primary; no groups leave it without a group.
+func (r *DirectorySyncPostgres) CreateUser(user classosbackend.User, groupIds []int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf(`INSERT INTO %s (name, username, role, password_hash) VALUES ($1, $2, $3, $4) RETURNING id`,
+		usersTable)
+	if err := tx.QueryRow(query, user.Name, user.Username, user.Role, user.Password).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	query = fmt.Sprintf(`INSERT INTO %s (user_id, group_id, is_primary) VALUES ($1, $2, $3)`, users_listsTable)
+	for i, groupId := range groupIds {
+		if _, err := tx.Exec(query, id, groupId, i == 0); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *DirectorySyncPostgres) UpdateUserName(userId int, name string) error {
+	query := fmt.Sprintf(`UPDATE %s SET name = $1 WHERE id = $2`, usersTable)
+	result, err := r.db.Exec(query, name, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// SetUserGroups replaces the groups of a user with the given ones. The
+// primary group is kept when it is one of them; otherwise the first one
+// becomes primary.
+func (r *DirectorySyncPostgres) SetUserGroups(userId int, groupIds []int) error {
+	if len(groupIds) == 0 {
+		return fmt.Errorf("user %d needs at least one group", userId)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(groupIds))
+	for _, groupId := range groupIds {
+		ids = append(ids, int64(groupId))
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1 AND group_id != ALL($2)`, users_listsTable)
+	if _, err := tx.Exec(query, userId, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		INSERT INTO %s (user_id, group_id) SELECT $1, unnest($2::int[])
+		ON CONFLICT (user_id, group_id) DO NOTHING`, users_listsTable)
+	if _, err := tx.Exec(query, userId, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		UPDATE %[1]s SET is_primary = TRUE
+		WHERE user_id = $1 AND group_id = $2
+			AND NOT EXISTS (SELECT 1 FROM %[1]s WHERE user_id = $1 AND is_primary)`, users_listsTable)
+	if _, err := tx.Exec(query, userId, groupIds[0]); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const examSessionColumns = `id, group_id, title, starts_at, ends_at, block_clipboard, block_usb,
+	created_by, created_at`
+
+type ExamPostgres struct {
+	db *sqlx.DB
+}
+
+func NewExamPostgres(db *sqlx.DB) *ExamPostgres {
+	return &ExamPostgres{db: db}
+}
+
+func (r *ExamPostgres) Create(session classosbackend.ExamSession) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `
+		INSERT INTO exam_sessions (group_id, title, starts_at, ends_at, block_clipboard, block_usb, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	row := tx.QueryRow(query, session.GroupID, session.Title, session.StartsAt, session.EndsAt,
+		session.BlockClipboard, session.BlockUSB, session.CreatedBy)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if err := insertExamWhitelist(tx, id, session.Whitelist); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetAll lists exam sessions, newest first. A groupId of 0 lists all groups.
+func (r *ExamPostgres) GetAll(groupId int) ([]classosbackend.ExamSession, error) {
+	sessions := make([]classosbackend.ExamSession, 0)
+	query := `SELECT ` + examSessionColumns + ` FROM exam_sessions`
+	args := make([]interface{}, 0)
+	if groupId != 0 {
+		query += ` WHERE group_id = $1`
+		args = append(args, groupId)
+	}
+	query += ` ORDER BY starts_at DESC`
+
+	if err := r.db.Select(&sessions, query, args...); err != nil {
+		return nil, err
+	}
+	if err := r.loadWhitelists(sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *ExamPostgres) GetById(examId int) (classosbackend.ExamSession, error) {
+	var session classosbackend.ExamSession
+	query := `SELECT ` + examSessionColumns + ` FROM exam_sessions WHERE id = $1`
+	if err := r.db.Get(&session, query, examId); err != nil {
+		return session, err
+	}
+
+	sessions := []classosbackend.ExamSession{session}
+	if err := r.loadWhitelists(sessions); err != nil {
+		return session, err
+	}
+	return sessions[0], nil
+}
+
+// GetActiveForUser returns the exam running at the given time for any group
+// of the user. If several overlap, the one that started first wins. The
+// username is the one the device reports, so its case does not matter.
+func (r *ExamPostgres) GetActiveForUser(username string, at time.Time) (classosbackend.ExamSession, error) {
+	var session classosbackend.ExamSession
+	query := `
+		SELECT e.id, e.group_id, e.title, e.starts_at, e.ends_at, e.block_clipboard, e.block_usb,
+			e.created_by, e.created_at
+		FROM exam_sessions e
+		JOIN ` + users_listsTable + ` ul ON ul.group_id = e.group_id
+		JOIN ` + usersTable + ` u ON u.id = ul.user_id
+		WHERE LOWER(u.username) = LOWER($1) AND e.starts_at <= $2 AND e.ends_at > $2
+		ORDER BY e.starts_at, e.id
+		LIMIT 1
+	`
+	if err := r.db.Get(&session, query, username, at); err != nil {
+		return session, err
+	}
+
+	sessions := []classosbackend.ExamSession{session}
+	if err := r.loadWhitelists(sessions); err != nil {
+		return session, err
+	}
+	return sessions[0], nil
+}
+
+// Update overwrites the session and replaces its whitelist in one transaction.
+func (r *ExamPostgres) Update(session classosbackend.ExamSession) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE exam_sessions
+		SET title = $1, starts_at = $2, ends_at = $3, block_clipboard = $4, block_usb = $5
+		WHERE id = $6
+	`
+	result, err := tx.Exec(query, session.Title, session.StartsAt, session.EndsAt,
+		session.BlockClipboard, session.BlockUSB, session.ID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM exam_whitelist WHERE exam_id = $1`, session.ID); err != nil {
+		return err
+	}
+	if err := insertExamWhitelist(tx, int(session.ID), session.Whitelist); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *ExamPostgres) Delete(examId int) error {
+	result, err := r.db.Exec(`DELETE FROM exam_sessions WHERE id = $1`, examId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *ExamPostgres) CreateViolations(violations []classosbackend.ExamViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO exam_violations (exam_id, username, device_name, program, action, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for _, v := range violations {
+		if _, err := tx.Exec(query, v.ExamID, v.Username, v.DeviceName, v.Program, v.Action, v.OccurredAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *ExamPostgres) GetViolations(examId, limit, offset int) ([]classosbackend.ExamViolation, error) {
+	violations := make([]classosbackend.ExamViolation, 0)
+	query := `
+		SELECT id, exam_id, username, device_name, COALESCE(program, '') AS program,
+			COALESCE(action, '') AS action, occurred_at, created_at
+		FROM exam_violations
+		WHERE exam_id = $1
+		ORDER BY occurred_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	err := r.db.Select(&violations, query, examId, limit, offset)
+	return violations, err
+}
+
+func (r *ExamPostgres) loadWhitelists(sessions []classosbackend.ExamSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(sessions))
+	index := make(map[int64]int, len(sessions))
+	for i := range sessions {
+		sessions[i].Whitelist = make([]classosbackend.PolicyRule, 0)
+		ids = append(ids, sessions[i].ID)
+		index[sessions[i].ID] = i
+	}
+
+	var rows []struct {
+		ExamID int64 `db:"exam_id"`
+		classosbackend.PolicyRule
+	}
+	query := `
+		SELECT exam_id, entry_type, resource
+		FROM exam_whitelist
+		WHERE exam_id = ANY($1)
+		ORDER BY id
+	`
+	if err := r.db.Select(&rows, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		i := index[row.ExamID]
+		sessions[i].Whitelist = append(sessions[i].Whitelist, row.PolicyRule)
+	}
+	return nil
+}
+
+func insertExamWhitelist(tx *sqlx.Tx, examId int, rules []classosbackend.PolicyRule) error {
+	query := `
+		INSERT INTO exam_whitelist (exam_id, entry_type, resource)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+	for _, rule := range rules {
+		if _, err := tx.Exec(query, examId, rule.Type, rule.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -44,16 +44,17 @@ func (r *GroupPostgres) UpdateWithTx(tx *sql.Tx, checkerId, groupId int, input c
 	}
 
 	setQuery := strings.Join(setValues, ", ")
-	query := fmt.Sprintf("UPDATE %s Set %s Where id = $%d", groupsTable, setQuery, argId)
-	args = append(args, groupId)
+	query := fmt.Sprintf("UPDATE %s Set %s Where id = $%d AND %s", groupsTable, setQuery, argId,
+		groupScope("id", fmt.Sprintf("$%d", argId+1)))
+	args = append(args, groupId, checkerId)
 
 	_, err := tx.Exec(query, args...)
 	return err
 }
 
 func (r *GroupPostgres) DeleteWithTx(tx *sql.Tx, checkerId, groupId int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", groupsTable)
-	_, err := tx.Exec(query, groupId)
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND %s", groupsTable, groupScope("id", "$2"))
+	_, err := tx.Exec(query, groupId, checkerId)
 	return err
 }
 
@@ -74,23 +75,65 @@ func (r *GroupPostgres) Create(checkerId int, group classosbackend.Group) (int,
 	return id, tx.Commit()
 }
 
-func (r *GroupPostgres) GetAll(checkerId int) ([]classosbackend.Group, error) {
-	var groups []classosbackend.Group
-	query := fmt.Sprintf("SELECT id, name FROM %s", groupsTable)
-	err := r.db.Select(&groups, query)
+var groupSortColumns = map[string]string{
+	"id":           "g.id",
+	"name":         "g.name",
+	"member_count": "member_count",
+}
+
+// groupListWhere builds the conditions of the group list; $1 is the checker.
+// Classes retired by a rollover are only kept for the record.
+func groupListWhere(checkerId int, filter classosbackend.GroupsFilter) (string, []interface{}) {
+	where := "g.archived_at IS NULL AND " + groupScope("g.id", "$1")
+	args := []interface{}{checkerId}
+	if filter.Search != "" {
+		where += " AND g.name ILIKE $2"
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+	}
+	return where, args
+}
+
+func (r *GroupPostgres) GetAll(checkerId int, filter classosbackend.GroupsFilter) ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	where, args := groupListWhere(checkerId, filter)
+
+	column, ok := groupSortColumns[filter.Sort]
+	if !ok {
+		column = "g.id"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT g.id, g.name, (
+			SELECT COUNT(*) FROM %s ul
+			JOIN %s u ON u.id = ul.user_id
+			WHERE ul.group_id = g.id AND u.status != '%s'
+		) AS member_count
+		FROM %s g
+		WHERE %s
+		%s%s`, users_listsTable, usersTable, classosbackend.UserStatusArchived, groupsTable, where,
+		listOrder(column, "g.id", filter.ListQuery), listPage(filter.ListQuery))
+	err := r.db.Select(&groups, query, args...)
 	return groups, err
 }
 
+func (r *GroupPostgres) Count(checkerId int, filter classosbackend.GroupsFilter) (int, error) {
+	var count int
+	where, args := groupListWhere(checkerId, filter)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s g WHERE %s", groupsTable, where)
+	err := r.db.Get(&count, query, args...)
+	return count, err
+}
+
 func (r *GroupPostgres) GetById(checkerId, groupId int) (classosbackend.Group, error) {
 	var group classosbackend.Group
-	query := fmt.Sprintf("SELECT id, name FROM %s WHERE id = $1", groupsTable)
-	err := r.db.Get(&group, query, groupId)
+	query := fmt.Sprintf("SELECT id, name, archived_at FROM %s WHERE id = $1 AND %s", groupsTable, groupScope("id", "$2"))
+	err := r.db.Get(&group, query, groupId, checkerId)
 	return group, err
 }
 
 func (r *GroupPostgres) Delete(checkerId, groupId int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", groupsTable)
-	_, err := r.db.Exec(query, groupId)
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND %s", groupsTable, groupScope("id", "$2"))
+	_, err := r.db.Exec(query, groupId, checkerId)
 	return err
 }
 
@@ -106,9 +149,77 @@ func (r *GroupPostgres) Update(checkerId, groupId int, input classosbackend.Upda
 	}
 
 	setQuery := strings.Join(setValues, ", ")
-	query := fmt.Sprintf("UPDATE %s Set %s Where id = $%d", groupsTable, setQuery, argId)
-	args = append(args, groupId)
+	query := fmt.Sprintf("UPDATE %s Set %s Where id = $%d AND %s", groupsTable, setQuery, argId,
+		groupScope("id", fmt.Sprintf("$%d", argId+1)))
+	args = append(args, groupId, checkerId)
 
 	_, err := r.db.Exec(query, args...)
 	return err
-}
\ No newline at end of file
+}
+
+func (r *GroupPostgres) GetTeachers(groupId int) ([]classosbackend.User, error) {
+	teachers := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role
+		FROM %s u
+		JOIN %s tg ON tg.teacher_id = u.id
+		WHERE tg.group_id = $1
+		ORDER BY u.name
+	`, usersTable, teacherGroupsTable)
+	err := r.db.Select(&teachers, query, groupId)
+	return teachers, err
+}
+
+func (r *GroupPostgres) AddTeacher(groupId, userId int) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (teacher_id, group_id) VALUES ($1, $2)
+		ON CONFLICT (teacher_id, group_id) DO NOTHING
+	`, teacherGroupsTable)
+	_, err := r.db.Exec(query, userId, groupId)
+	return err
+}
+
+func (r *GroupPostgres) RemoveTeacher(groupId, userId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE teacher_id = $1 AND group_id = $2", teacherGroupsTable)
+	result, err := r.db.Exec(query, userId, groupId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *GroupPostgres) GetMembers(groupId int) ([]classosbackend.GroupMember, error) {
+	members := make([]classosbackend.GroupMember, 0)
+	query := fmt.Sprintf(`
+		SELECT ul.group_id, u.id AS user_id, u.username, u.role, u.status, ul.is_primary
+		FROM %s u
+		JOIN %s ul ON ul.user_id = u.id
+		WHERE ul.group_id = $1 AND u.status != '%s'
+		ORDER BY u.name
+	`, usersTable, users_listsTable, classosbackend.UserStatusArchived)
+	err := r.db.Select(&members, query, groupId)
+	return members, err
+}
+
+// AddMemberWithTx adds the user to the group. It becomes the primary group
+// only for a user who has none.
+func (r *GroupPostgres) AddMemberWithTx(tx *sql.Tx, groupId, userId int) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s (user_id, group_id, is_primary)
+		VALUES ($1, $2, NOT EXISTS (SELECT 1 FROM %[1]s WHERE user_id = $1 AND is_primary))
+		ON CONFLICT (user_id, group_id) DO NOTHING
+	`, users_listsTable)
+	_, err := tx.Exec(query, userId, groupId)
+	return err
+}
+
+// RemoveMemberWithTx removes the user from a group other than their primary
+// one; sql.ErrNoRows is returned when there is no such membership.
+func (r *GroupPostgres) RemoveMemberWithTx(tx *sql.Tx, groupId, userId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND group_id = $2 AND NOT is_primary", users_listsTable)
+	result, err := tx.Exec(query, userId, groupId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
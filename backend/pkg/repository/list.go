@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes a search text match literally inside a LIKE pattern.
+func escapeLike(text string) string {
+	return likeEscaper.Replace(text)
+}
+
+// listOrder is the ORDER BY of a list sorted by column, with the id as the
+// tie-breaker so that pages do not overlap.
+func listOrder(column, idColumn string, query classosbackend.ListQuery) string {
+	direction := "ASC"
+	if query.Order == classosbackend.SortDesc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s", column, direction, idColumn, direction)
+}
+
+// listPage is the LIMIT of a list; limit 0 returns every row.
+func listPage(query classosbackend.ListQuery) string {
+	if query.Limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", query.Limit, query.Offset)
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// LoginAttemptsMemory keeps failed sign-ins in process. It is enough for a
+// single backend instance; counters are lost on restart.
+type LoginAttemptsMemory struct {
+	mu       sync.Mutex
+	attempts map[string]classosbackend.LoginAttempts
+}
+
+func NewLoginAttemptsMemory() *LoginAttemptsMemory {
+	return &LoginAttemptsMemory{attempts: make(map[string]classosbackend.LoginAttempts)}
+}
+
+func (r *LoginAttemptsMemory) Reserve(key string, at, resetBefore time.Time, lockout func(failures int) time.Duration) (classosbackend.LoginAttempts, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if ok && attempts.IsLocked(at) {
+		return attempts, false, nil
+	}
+	if !ok || attempts.LastFailureAt.Before(resetBefore) {
+		attempts.Key = key
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at
+	attempts.LockedUntil = nil
+	if d := lockout(attempts.Failures); d > 0 {
+		until := at.Add(d)
+		attempts.LockedUntil = &until
+	}
+	r.attempts[key] = attempts
+	return attempts, true, nil
+}
+
+func (r *LoginAttemptsMemory) Refund(key string, placedLock *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if attempts.Failures > 0 {
+		attempts.Failures--
+	}
+	if placedLock != nil && attempts.LockedUntil != nil && attempts.LockedUntil.Equal(*placedLock) {
+		attempts.LockedUntil = nil
+	}
+	r.attempts[key] = attempts
+	return nil
+}
+
+func (r *LoginAttemptsMemory) Get(key string) (classosbackend.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok {
+		return classosbackend.LoginAttempts{}, sql.ErrNoRows
+	}
+	return attempts, nil
+}
+
+func (r *LoginAttemptsMemory) GetLocked(at time.Time) ([]classosbackend.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	locked := make([]classosbackend.LoginAttempts, 0)
+	for _, attempts := range r.attempts {
+		if attempts.IsLocked(at) {
+			locked = append(locked, attempts)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool {
+		return locked[i].LockedUntil.After(*locked[j].LockedUntil)
+	})
+	return locked, nil
+}
+
+func (r *LoginAttemptsMemory) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.attempts[key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *LoginAttemptsMemory) DeleteStale(resetBefore, at time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key, attempts := range r.attempts {
+		if attempts.LastFailureAt.Before(resetBefore) && !attempts.IsLocked(at) {
+			delete(r.attempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type LoginAttemptsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptsPostgres(db *sqlx.DB) *LoginAttemptsPostgres {
+	return &LoginAttemptsPostgres{db: db}
+}
+
+// Reserve holds the row lock of the key while it checks and counts the
+// attempt, so concurrent attempts on several instances are serialised.
+func (r *LoginAttemptsPostgres) Reserve(key string, at, resetBefore time.Time, lockout func(failures int) time.Duration) (classosbackend.LoginAttempts, bool, error) {
+	var attempts classosbackend.LoginAttempts
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return attempts, false, err
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 0, $2)
+		ON CONFLICT (key) DO NOTHING
+	`
+	if _, err := tx.Exec(insertQuery, key, at); err != nil {
+		return attempts, false, err
+	}
+
+	selectQuery := `SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1 FOR UPDATE`
+	if err := tx.Get(&attempts, selectQuery, key); err != nil {
+		return attempts, false, err
+	}
+	if attempts.IsLocked(at) {
+		return attempts, false, nil
+	}
+
+	if attempts.LastFailureAt.Before(resetBefore) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at
+	attempts.LockedUntil = nil
+	if d := lockout(attempts.Failures); d > 0 {
+		until := at.Add(d)
+		attempts.LockedUntil = &until
+	}
+
+	updateQuery := `
+		UPDATE login_attempts SET failures = $2, last_failure_at = $3, locked_until = $4
+		WHERE key = $1
+		RETURNING key, failures, last_failure_at, locked_until
+	`
+	if err := tx.Get(&attempts, updateQuery, key, attempts.Failures, attempts.LastFailureAt, attempts.LockedUntil); err != nil {
+		return attempts, false, err
+	}
+
+	return attempts, true, tx.Commit()
+}
+
+func (r *LoginAttemptsPostgres) Refund(key string, placedLock *time.Time) error {
+	query := `
+		UPDATE login_attempts SET
+			failures = GREATEST(failures - 1, 0),
+			locked_until = CASE WHEN locked_until = $2 THEN NULL ELSE locked_until END
+		WHERE key = $1
+	`
+	result, err := r.db.Exec(query, key, placedLock)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *LoginAttemptsPostgres) Get(key string) (classosbackend.LoginAttempts, error) {
+	var attempts classosbackend.LoginAttempts
+	query := `SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1`
+	err := r.db.Get(&attempts, query, key)
+	return attempts, err
+}
+
+func (r *LoginAttemptsPostgres) GetLocked(at time.Time) ([]classosbackend.LoginAttempts, error) {
+	attempts := make([]classosbackend.LoginAttempts, 0)
+	query := `
+		SELECT key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE locked_until > $1
+		ORDER BY locked_until DESC
+	`
+	err := r.db.Select(&attempts, query, at)
+	return attempts, err
+}
+
+func (r *LoginAttemptsPostgres) Delete(key string) error {
+	result, err := r.db.Exec(`DELETE FROM login_attempts WHERE key = $1`, key)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *LoginAttemptsPostgres) DeleteStale(resetBefore, at time.Time) (int64, error) {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= $2)
+	`
+	result, err := r.db.Exec(query, resetBefore, at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
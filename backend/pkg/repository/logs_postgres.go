@@ -42,31 +42,31 @@ func (r *LogsPostgres) SaveLogs(logs []classosbackend.UserLog) error {
 	return tx.Commit()
 }
 
-func (r *LogsPostgres) GetLogsByUsername(username string, limit, offset int) ([]classosbackend.UserLog, error) {
+func (r *LogsPostgres) GetLogsByUsername(checkerId int, username string, limit, offset int) ([]classosbackend.UserLog, error) {
 	var logs []classosbackend.UserLog
 	query := `
 		SELECT id, username, device_name, timestamp, log_type, program, action, created_at
 		FROM user_logs
-		WHERE username = $1
+		WHERE username = $1 AND ` + usernameScope("username", "$4") + `
 		ORDER BY timestamp DESC
 		LIMIT $2 OFFSET $3
 	`
 	
-	err := r.db.Select(&logs, query, username, limit, offset)
+	err := r.db.Select(&logs, query, username, limit, offset, checkerId)
 	return logs, err
 }
 
-func (r *LogsPostgres) GetLogsByDevice(deviceName string, limit, offset int) ([]classosbackend.UserLog, error) {
+func (r *LogsPostgres) GetLogsByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.UserLog, error) {
 	var logs []classosbackend.UserLog
 	query := `
 		SELECT id, username, device_name, timestamp, log_type, program, action, created_at
 		FROM user_logs
-		WHERE device_name = $1
+		WHERE device_name = $1 AND ` + usernameScope("username", "$4") + `
 		ORDER BY timestamp DESC
 		LIMIT $2 OFFSET $3
 	`
 	
-	err := r.db.Select(&logs, query, deviceName, limit, offset)
+	err := r.db.Select(&logs, query, deviceName, limit, offset, checkerId)
 	return logs, err
 }
 
@@ -76,6 +76,12 @@ func (r *LogsPostgres) GetLogsFiltered(filter classosbackend.LogsFilter) ([]clas
 	var args []interface{}
 	argIndex := 1
 
+	if filter.CheckerID != 0 {
+		conditions = append(conditions, usernameScope("username", fmt.Sprintf("$%d", argIndex)))
+		args = append(args, filter.CheckerID)
+		argIndex++
+	}
+
 	if filter.Username != "" {
 		conditions = append(conditions, fmt.Sprintf("username = $%d", argIndex))
 		args = append(args, filter.Username)
@@ -132,6 +138,12 @@ func (r *LogsPostgres) GetLogsCount(filter classosbackend.LogsFilter) (int, erro
 	var args []interface{}
 	argIndex := 1
 
+	if filter.CheckerID != 0 {
+		conditions = append(conditions, usernameScope("username", fmt.Sprintf("$%d", argIndex)))
+		args = append(args, filter.CheckerID)
+		argIndex++
+	}
+
 	if filter.Username != "" {
 		conditions = append(conditions, fmt.Sprintf("username = $%d", argIndex))
 		args = append(args, filter.Username)
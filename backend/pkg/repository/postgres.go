@@ -7,10 +7,13 @@ import (
 )
 
 const (
-	usersTable            = "users"
-	groupsTable           = "groups"
-	users_listsTable      = "users_lists"
-	whitelist_globalTable = "whitelist_global"
+	usersTable               = "users"
+	groupsTable              = "groups"
+	users_listsTable         = "users_lists"
+	whitelistTable           = "whitelist"
+	whitelist_globalTable    = "whitelist_global"
+	whitelist_schedulesTable = "whitelist_schedules"
+	teacherGroupsTable       = "teacher_groups"
 )
 
 type Config struct {
@@ -2,21 +2,46 @@ package repository
 
 import (
 	"database/sql"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
 type Authorization interface {
 	CreateUser(user classosbackend.User) (int, error)
-	GetUser(username, password string) (classosbackend.User, error)
+	GetUser(username string) (classosbackend.User, error)
+	GetUserById(userId int) (classosbackend.User, error)
+	CreateDirectoryUser(user classosbackend.User) (int, error)
+	UpdateRole(userId int, role string) error
+	UpdatePasswordHash(userId int, passwordHash string) error
+
+	CreateSession(session classosbackend.AuthSession) error
+	GetSession(sessionId string) (classosbackend.AuthSession, error)
+	GetSessionByRefreshHash(tokenHash string) (classosbackend.AuthSession, error)
+	GetActiveSessions(userId int) ([]classosbackend.AuthSession, error)
+	RotateSession(sessionId, currentHash, newHash string, expiresAt time.Time) error
+	RevokeSession(userId int, sessionId string) error
+	RevokeAllSessions(userId int) (int64, error)
 }
 
 type Group interface {
 	Create(checkerId int, group classosbackend.Group) (int, error)
-	GetAll(checkerId int) ([]classosbackend.Group, error)
+	GetAll(checkerId int, filter classosbackend.GroupsFilter) ([]classosbackend.Group, error)
+	Count(checkerId int, filter classosbackend.GroupsFilter) (int, error)
 	GetById(checkerId, groupId int) (classosbackend.Group, error)
 	Delete(checkerId, groupId int) error
 	Update(checkerId, groupId int, input classosbackend.UpdateGroupInput) error
+
+	GetTeachers(groupId int) ([]classosbackend.User, error)
+	AddTeacher(groupId, userId int) error
+	RemoveTeacher(groupId, userId int) error
+
+	GetMembers(groupId int) ([]classosbackend.GroupMember, error)
+	AddMemberWithTx(tx *sql.Tx, groupId, userId int) error
+	RemoveMemberWithTx(tx *sql.Tx, groupId, userId int) error
 	
 	// Методы для транзакций
 	BeginTransaction() (*sql.Tx, error)
@@ -27,7 +52,8 @@ type Group interface {
 
 type User interface {
 	Create(groupId int, user classosbackend.User) (int, error)
-	GetAll(checkerId int) ([]classosbackend.User, error)
+	GetAll(checkerId int, filter classosbackend.UsersFilter) ([]classosbackend.User, error)
+	Count(checkerId int, filter classosbackend.UsersFilter) (int, error)
 	GetById(checkerId, userId int) (classosbackend.User, error)
 	Delete(checkerId, userId int) error
 	Update(checkerId, userId int, input classosbackend.UpdateUserInput) error
@@ -37,38 +63,223 @@ type User interface {
 	CreateWithTx(tx *sql.Tx, groupId int, user classosbackend.User) (int, error)
 	UpdateWithTx(tx *sql.Tx, checkerId, userId int, input classosbackend.UpdateUserInput) error
 	DeleteWithTx(tx *sql.Tx, checkerId, userId int) error
+	SetStatusWithTx(tx *sql.Tx, checkerId, userId int, from, to string) error
+
+	GetArchivedBefore(before time.Time) ([]classosbackend.User, error)
+	PurgeWithTx(tx *sql.Tx, userId int) error
+}
+
+type Whitelist interface {
+	GetAll(groupId int) ([]classosbackend.WhitelistEntry, error)
+	GetAllForUser(username string) ([]classosbackend.WhitelistEntry, error)
+	GetById(groupId, entryId int) (classosbackend.WhitelistEntry, error)
+	Create(groupId int, entry classosbackend.WhitelistEntry) (int, error)
+	Update(groupId, entryId int, input classosbackend.UpdateWhitelistEntryInput) error
+	Delete(groupId, entryId int) error
+	Replace(groupId int, entries []classosbackend.WhitelistEntry) error
+	GetAllSchedules() ([]classosbackend.WhitelistSchedule, error)
+}
+
+type GlobalWhitelist interface {
+	GetAll(list string) ([]classosbackend.GlobalWhitelistEntry, error)
+	GetById(entryId int) (classosbackend.GlobalWhitelistEntry, error)
+	Create(entry classosbackend.GlobalWhitelistEntry) (int, error)
+	Update(entryId int, input classosbackend.UpdateGlobalWhitelistEntryInput) error
+	Delete(entryId int) error
 }
 
 type Device interface {
 	UpsertDeviceStatus(device classosbackend.DeviceStatus) error
-	GetAllDevices() ([]classosbackend.DeviceStatus, error)
-	GetOnlineDevices() ([]classosbackend.DeviceStatus, error)
-	GetDeviceByName(deviceName string) (classosbackend.DeviceStatus, error)
+	GetAllDevices(checkerId int) ([]classosbackend.DeviceStatus, error)
+	GetOnlineDevices(checkerId int) ([]classosbackend.DeviceStatus, error)
+	GetDeviceByName(checkerId int, deviceName string) (classosbackend.DeviceStatus, error)
+	CanAccessDevice(checkerId int, deviceName string) (bool, error)
 	DeleteDevice(deviceName string) error
+	GetDevicesByGroup(groupId int) ([]classosbackend.DeviceStatus, error)
+	SetPolicyPushed(deviceName, version string) error
+	SetPolicyApplied(deviceName, version string) error
+
+	CreateEnrollmentCode(codeHash string, deviceName *string, createdBy int, expiresAt time.Time) error
+	EnrollDevice(codeHash, deviceName, credentialHash string) error
+	GetEnrolledDevice(deviceName string) (classosbackend.EnrolledDevice, error)
+	GetEnrolledDevices() ([]classosbackend.EnrolledDevice, error)
+	TouchEnrolledDevice(deviceName string) error
+	RevokeDevice(deviceName string) error
+	GetEnrolledDevicesByRoom(room string) ([]classosbackend.EnrolledDevice, error)
+	SetDeviceRoom(deviceName string, room *string) error
+}
+
+type Command interface {
+	Create(command classosbackend.DeviceCommand) error
+	GetById(commandId string) (classosbackend.DeviceCommand, error)
+	GetByDevice(deviceName string, limit, offset int) ([]classosbackend.DeviceCommand, error)
+	MarkDelivered(commandId string) error
+	MarkFailed(commandId, reason string) error
+	Acknowledge(deviceName string, ack classosbackend.CommandAck) error
+	GetPending(deviceName string) ([]classosbackend.DeviceCommand, error)
+	ExpireOverdue() (int64, error)
+}
+
+type Exam interface {
+	Create(session classosbackend.ExamSession) (int, error)
+	GetAll(groupId int) ([]classosbackend.ExamSession, error)
+	GetById(examId int) (classosbackend.ExamSession, error)
+	GetActiveForUser(username string, at time.Time) (classosbackend.ExamSession, error)
+	Update(session classosbackend.ExamSession) error
+	Delete(examId int) error
+	CreateViolations(violations []classosbackend.ExamViolation) error
+	GetViolations(examId, limit, offset int) ([]classosbackend.ExamViolation, error)
+}
+
+type Timetable interface {
+	GetTerms() ([]classosbackend.Term, error)
+	GetTermById(termId int) (classosbackend.Term, error)
+	CreateTerm(term classosbackend.Term) (int, error)
+	UpdateTerm(term classosbackend.Term) error
+	DeleteTerm(termId int) error
+
+	GetPeriods() ([]classosbackend.Period, error)
+	GetPeriodById(periodId int) (classosbackend.Period, error)
+	CreatePeriod(period classosbackend.Period) (int, error)
+	UpdatePeriod(period classosbackend.Period) error
+	DeletePeriod(periodId int) error
+
+	GetLessons(filter classosbackend.LessonsFilter) ([]classosbackend.Lesson, error)
+	GetLessonById(lessonId int) (classosbackend.Lesson, error)
+	CreateLesson(lesson classosbackend.Lesson) (int, error)
+	UpdateLesson(lesson classosbackend.Lesson) error
+	DeleteLesson(lessonId int) error
+	GetLessonAt(groupId int, date string, weekday int, clock string) (classosbackend.CurrentLesson, error)
 }
 
 type Logs interface {
 	SaveLogs(logs []classosbackend.UserLog) error
-	GetLogsByUsername(username string, limit, offset int) ([]classosbackend.UserLog, error)
-	GetLogsByDevice(deviceName string, limit, offset int) ([]classosbackend.UserLog, error)
+	GetLogsByUsername(checkerId int, username string, limit, offset int) ([]classosbackend.UserLog, error)
+	GetLogsByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.UserLog, error)
 	GetLogsFiltered(filter classosbackend.LogsFilter) ([]classosbackend.UserLog, error)
 	GetLogsCount(filter classosbackend.LogsFilter) (int, error)
 }
 
+type Audit interface {
+	Create(event classosbackend.AuditEvent) error
+	GetAll(filter classosbackend.AuditFilter) ([]classosbackend.AuditEvent, error)
+	Count(filter classosbackend.AuditFilter) (int, error)
+}
+
+// LoginAttempts stores failed sign-ins keyed by username or client address.
+// Reserve counts an attempt before its credentials are checked, in one step
+// with the lock check, so parallel guesses cannot all pass the check first:
+// it refuses the attempt while the key is locked, otherwise counts it,
+// starting afresh when the last one is older than resetBefore, and locks the
+// key for lockout(failures). Refund takes back an attempt that turned out to
+// be no failure, together with the lock it placed.
+type LoginAttempts interface {
+	Reserve(key string, at, resetBefore time.Time, lockout func(failures int) time.Duration) (classosbackend.LoginAttempts, bool, error)
+	Refund(key string, placedLock *time.Time) error
+	Get(key string) (classosbackend.LoginAttempts, error)
+	GetLocked(at time.Time) ([]classosbackend.LoginAttempts, error)
+	Delete(key string) error
+	DeleteStale(resetBefore, at time.Time) (int64, error)
+}
+
+type TwoFactor interface {
+	Get(userId int) (classosbackend.TwoFactor, error)
+	SaveSecret(userId int, secret string) error
+	Enable(userId int, step int64, enabledAt time.Time, codeHashes []string) error
+	UseStep(userId int, step int64) error
+	ReplaceRecoveryCodes(userId int, codeHashes []string) error
+	UseRecoveryCode(userId int, codeHash string, usedAt time.Time) error
+	CountRecoveryCodes(userId int) (int, error)
+	Delete(userId int) error
+}
+
+type Directory interface {
+	BeginTransaction() (*sql.Tx, error)
+	Create(op classosbackend.DirectoryOperation) (int64, error)
+	Save(op classosbackend.DirectoryOperation) error
+	SaveWithTx(tx *sql.Tx, op classosbackend.DirectoryOperation) error
+	GetById(id int64) (classosbackend.DirectoryOperation, error)
+	GetAll(filter classosbackend.DirectoryOperationFilter) ([]classosbackend.DirectoryOperation, error)
+	Count(filter classosbackend.DirectoryOperationFilter) (int, error)
+	ClaimDue(now, staleBefore time.Time, limit int) ([]classosbackend.DirectoryOperation, error)
+	ClaimFailed(id int64, now time.Time) (classosbackend.DirectoryOperation, error)
+	DeleteFinished(before time.Time) (int64, error)
+}
+
+type DirectorySync interface {
+	CreateRun(run classosbackend.SyncRun) (int64, error)
+	SaveRun(run classosbackend.SyncRun) error
+	GetRun(id int64) (classosbackend.SyncRun, error)
+	GetRuns(limit, offset int) ([]classosbackend.SyncRun, error)
+	CountRuns() (int, error)
+	FailRunning(now time.Time) (int64, error)
+
+	GetUsers() ([]classosbackend.User, error)
+	GetGroups() ([]classosbackend.Group, error)
+	CreateGroup(name string) (int, error)
+	CreateUser(user classosbackend.User, groupIds []int) (int, error)
+	UpdateUserName(userId int, name string) error
+	SetUserGroups(userId int, groupIds []int) error
+}
+
+type Rollover interface {
+	GetGroups() ([]classosbackend.Group, error)
+	GetMembers() ([]classosbackend.GroupMember, error)
+	CreateWithTx(tx *sql.Tx, rollover classosbackend.Rollover) (int64, error)
+	ApplyWithTx(tx *sql.Tx, changes classosbackend.RolloverChanges, at time.Time) error
+	RevertWithTx(tx *sql.Tx, changes classosbackend.RolloverChanges) error
+	MarkRolledBackWithTx(tx *sql.Tx, id int64, at time.Time) error
+	GetById(id int64) (classosbackend.Rollover, error)
+	GetLatest() (classosbackend.Rollover, error)
+	GetAll(limit, offset int) ([]classosbackend.Rollover, error)
+	Count() (int, error)
+}
+
 type Repository struct {
 	Authorization
 	Group
 	User
+	Whitelist
+	GlobalWhitelist
 	Device
+	Command
+	Exam
+	Timetable
 	Logs
+	Audit
+	LoginAttempts
+	TwoFactor
+	Directory
+	DirectorySync
+	Rollover
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		Authorization: NewAuthPostgres(db),
-		Group:         NewGroupPostgres(db),
-		User:          NewUserPostgres(db),
-		Device:        NewDevicePostgres(db),
-		Logs:          NewLogsPostgres(db),
+		Authorization:   NewAuthPostgres(db),
+		Group:           NewGroupPostgres(db),
+		User:            NewUserPostgres(db),
+		Whitelist:       NewWhitelistPostgres(db),
+		GlobalWhitelist: NewGlobalWhitelistPostgres(db),
+		Device:          NewDevicePostgres(db),
+		Command:         NewCommandPostgres(db),
+		Exam:            NewExamPostgres(db),
+		Timetable:       NewTimetablePostgres(db),
+		Logs:            NewLogsPostgres(db),
+		Audit:           NewAuditPostgres(db),
+		LoginAttempts:   newLoginAttempts(db),
+		TwoFactor:       NewTwoFactorPostgres(db),
+		Directory:       NewDirectoryPostgres(db),
+		DirectorySync:   NewDirectorySyncPostgres(db),
+		Rollover:        NewRolloverPostgres(db),
+	}
+}
+
+// newLoginAttempts keeps sign-in counters in process unless
+// LOGIN_ATTEMPTS_STORE=postgres asks to share them between instances.
+func newLoginAttempts(db *sqlx.DB) LoginAttempts {
+	if strings.ToLower(os.Getenv("LOGIN_ATTEMPTS_STORE")) == "postgres" {
+		return NewLoginAttemptsPostgres(db)
 	}
+	return NewLoginAttemptsMemory()
 }
\ No newline at end of file
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const rolloverColumns = `id, plan, changes, status, actor_id, applied_at, rollback_until, rolled_back_at`
+
+// RolloverPostgres changes classes for a new school year. It is not scoped
+// to a checker: only admins roll classes over. Every change is conditional
+// on the state it was planned from and fails with sql.ErrNoRows otherwise.
+type RolloverPostgres struct {
+	db *sqlx.DB
+}
+
+func NewRolloverPostgres(db *sqlx.DB) *RolloverPostgres {
+	return &RolloverPostgres{db: db}
+}
+
+// GetGroups returns every group, archived ones included.
+func (r *RolloverPostgres) GetGroups() ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	query := fmt.Sprintf("SELECT id, name, archived_at FROM %s ORDER BY name", groupsTable)
+	err := r.db.Select(&groups, query)
+	return groups, err
+}
+
+func (r *RolloverPostgres) GetMembers() ([]classosbackend.GroupMember, error) {
+	members := make([]classosbackend.GroupMember, 0)
+	query := fmt.Sprintf(`
+		SELECT ul.group_id, u.id AS user_id, u.username, u.role, u.status, ul.is_primary
+		FROM %s ul
+		JOIN %s u ON u.id = ul.user_id
+		ORDER BY ul.group_id, u.username
+	`, users_listsTable, usersTable)
+	err := r.db.Select(&members, query)
+	return members, err
+}
+
+func (r *RolloverPostgres) CreateWithTx(tx *sql.Tx, rollover classosbackend.Rollover) (int64, error) {
+	var id int64
+	query := `
+		INSERT INTO rollovers (plan, changes, status, actor_id, applied_at, rollback_until)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	err := tx.QueryRow(query, rollover.Plan, rollover.Changes, rollover.Status, rollover.ActorID,
+		rollover.AppliedAt, rollover.RollbackUntil).Scan(&id)
+	return id, err
+}
+
+func (r *RolloverPostgres) ApplyWithTx(tx *sql.Tx, changes classosbackend.RolloverChanges, at time.Time) error {
+	for _, group := range changes.Groups {
+		var archivedAt *time.Time
+		if group.Archived {
+			archivedAt = &at
+		}
+		query := fmt.Sprintf(`
+			UPDATE %s SET name = $1, archived_at = $2
+			WHERE id = $3 AND name = $4 AND archived_at IS NULL
+		`, groupsTable)
+		if err := execAffected(tx, query, group.NewName, archivedAt, group.GroupID, group.Name); err != nil {
+			return fmt.Errorf("group %s: %w", group.Name, err)
+		}
+	}
+
+	for _, move := range changes.Moves {
+		query := fmt.Sprintf("UPDATE %s SET group_id = $1 WHERE user_id = $2 AND group_id = $3", users_listsTable)
+		args := []interface{}{move.ToGroupID, move.UserID, move.FromGroupID}
+		if move.AlreadyMember {
+			query = fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND group_id = $2", users_listsTable)
+			args = args[1:]
+		}
+		if err := execAffected(tx, query, args...); err != nil {
+			return fmt.Errorf("member %s: %w", move.Username, err)
+		}
+		// The target becomes primary in place of the merged group.
+		if move.AlreadyMember && move.Primary {
+			if err := setPrimaryMembership(tx, move.UserID, move.ToGroupID, true); err != nil {
+				return fmt.Errorf("member %s: %w", move.Username, err)
+			}
+		}
+	}
+
+	for _, user := range changes.Archived {
+		query := fmt.Sprintf("UPDATE %s SET status = $1, archived_at = $2 WHERE id = $3 AND status = $4", usersTable)
+		if err := execAffected(tx, query, classosbackend.UserStatusArchived, at, user.UserID, user.PreviousStatus); err != nil {
+			return fmt.Errorf("user %s: %w", user.Username, err)
+		}
+	}
+
+	return nil
+}
+
+// RevertWithTx undoes ApplyWithTx from the changes it was given.
+func (r *RolloverPostgres) RevertWithTx(tx *sql.Tx, changes classosbackend.RolloverChanges) error {
+	for _, user := range changes.Archived {
+		query := fmt.Sprintf("UPDATE %s SET status = $1, archived_at = NULL WHERE id = $2 AND status = $3", usersTable)
+		if err := execAffected(tx, query, user.PreviousStatus, user.UserID, classosbackend.UserStatusArchived); err != nil {
+			return fmt.Errorf("user %s: %w", user.Username, err)
+		}
+	}
+
+	for _, move := range changes.Moves {
+		query := fmt.Sprintf("UPDATE %s SET group_id = $1 WHERE user_id = $2 AND group_id = $3", users_listsTable)
+		args := []interface{}{move.FromGroupID, move.UserID, move.ToGroupID}
+		if move.AlreadyMember {
+			if move.Primary {
+				if err := setPrimaryMembership(tx, move.UserID, move.ToGroupID, false); err != nil {
+					return fmt.Errorf("member %s: %w", move.Username, err)
+				}
+			}
+			query = fmt.Sprintf("INSERT INTO %s (user_id, group_id, is_primary) VALUES ($1, $2, $3)", users_listsTable)
+			args = []interface{}{move.UserID, move.FromGroupID, move.Primary}
+		}
+		if err := execAffected(tx, query, args...); err != nil {
+			return fmt.Errorf("member %s: %w", move.Username, err)
+		}
+	}
+
+	for _, group := range changes.Groups {
+		query := fmt.Sprintf(`
+			UPDATE %s SET name = $1, archived_at = NULL
+			WHERE id = $2 AND name = $3 AND (archived_at IS NOT NULL) = $4
+		`, groupsTable)
+		if err := execAffected(tx, query, group.Name, group.GroupID, group.NewName, group.Archived); err != nil {
+			return fmt.Errorf("group %s: %w", group.NewName, err)
+		}
+	}
+
+	return nil
+}
+
+func setPrimaryMembership(tx *sql.Tx, userId, groupId int, primary bool) error {
+	query := fmt.Sprintf("UPDATE %s SET is_primary = $1 WHERE user_id = $2 AND group_id = $3", users_listsTable)
+	return execAffected(tx, query, primary, userId, groupId)
+}
+
+func (r *RolloverPostgres) MarkRolledBackWithTx(tx *sql.Tx, id int64, at time.Time) error {
+	query := `UPDATE rollovers SET status = $1, rolled_back_at = $2 WHERE id = $3 AND status = $4`
+	return execAffected(tx, query, classosbackend.RolloverRolledBack, at, id, classosbackend.RolloverApplied)
+}
+
+func (r *RolloverPostgres) GetById(id int64) (classosbackend.Rollover, error) {
+	var rollover classosbackend.Rollover
+	query := `SELECT ` + rolloverColumns + ` FROM rollovers WHERE id = $1`
+	err := r.db.Get(&rollover, query, id)
+	return rollover, err
+}
+
+// GetLatest returns the rollover applied last, rolled back or not.
+func (r *RolloverPostgres) GetLatest() (classosbackend.Rollover, error) {
+	var rollover classosbackend.Rollover
+	query := `SELECT ` + rolloverColumns + ` FROM rollovers ORDER BY id DESC LIMIT 1`
+	err := r.db.Get(&rollover, query)
+	return rollover, err
+}
+
+func (r *RolloverPostgres) GetAll(limit, offset int) ([]classosbackend.Rollover, error) {
+	rollovers := make([]classosbackend.Rollover, 0)
+	query := `SELECT ` + rolloverColumns + ` FROM rollovers ORDER BY id DESC LIMIT $1 OFFSET $2`
+	err := r.db.Select(&rollovers, query, limit, offset)
+	return rollovers, err
+}
+
+func (r *RolloverPostgres) Count() (int, error) {
+	var count int
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM rollovers`)
+	return count, err
+}
+
+func execAffected(tx *sql.Tx, query string, args ...interface{}) error {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
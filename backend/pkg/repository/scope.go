@@ -0,0 +1,40 @@
+package repository
+
+import "fmt"
+
+// The checker scope decides which rows the user behind checkerId may see:
+// admins see everything, teachers see the groups assigned to them in
+// teacher_groups together with the members of those groups and their
+// devices and logs, everyone else sees nothing. The helpers below render SQL
+// predicates; arg is the placeholder holding the checker id, e.g. "$2".
+
+func checkerIsAdmin(arg string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE id = %s AND role = 'admin')", usersTable, arg)
+}
+
+// groupScope limits a group id column to the checker's groups.
+func groupScope(column, arg string) string {
+	return fmt.Sprintf("(%s OR %s IN (SELECT group_id FROM %s WHERE teacher_id = %s))",
+		checkerIsAdmin(arg), column, teacherGroupsTable, arg)
+}
+
+// userScope limits a user id column to members of the checker's groups.
+func userScope(column, arg string) string {
+	return fmt.Sprintf(`(%s OR %s IN (
+		SELECT ul.user_id FROM %s ul
+		JOIN %s tg ON tg.group_id = ul.group_id
+		WHERE tg.teacher_id = %s))`,
+		checkerIsAdmin(arg), column, users_listsTable, teacherGroupsTable, arg)
+}
+
+// usernameScope is userScope for tables that refer to users by username.
+// Those names come from the agents, spelled the way Windows reports them, so
+// they are compared case-insensitively.
+func usernameScope(column, arg string) string {
+	return fmt.Sprintf(`(%s OR LOWER(%s) IN (
+		SELECT LOWER(u.username) FROM %s u
+		JOIN %s ul ON ul.user_id = u.id
+		JOIN %s tg ON tg.group_id = ul.group_id
+		WHERE tg.teacher_id = %s))`,
+		checkerIsAdmin(arg), column, usersTable, users_listsTable, teacherGroupsTable, arg)
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const (
+	termColumns   = `id, name, start_date, end_date`
+	periodColumns = `id, number, to_char(start_time, 'HH24:MI') AS start_time, to_char(end_time, 'HH24:MI') AS end_time`
+	lessonColumns = `id, term_id, group_id, teacher_id, room, subject, weekday, period_id`
+)
+
+type TimetablePostgres struct {
+	db *sqlx.DB
+}
+
+func NewTimetablePostgres(db *sqlx.DB) *TimetablePostgres {
+	return &TimetablePostgres{db: db}
+}
+
+func (r *TimetablePostgres) GetTerms() ([]classosbackend.Term, error) {
+	terms := make([]classosbackend.Term, 0)
+	query := `SELECT ` + termColumns + ` FROM timetable_terms ORDER BY start_date`
+	err := r.db.Select(&terms, query)
+	return terms, err
+}
+
+func (r *TimetablePostgres) GetTermById(termId int) (classosbackend.Term, error) {
+	var term classosbackend.Term
+	query := `SELECT ` + termColumns + ` FROM timetable_terms WHERE id = $1`
+	err := r.db.Get(&term, query, termId)
+	return term, err
+}
+
+func (r *TimetablePostgres) CreateTerm(term classosbackend.Term) (int, error) {
+	var id int
+	query := `INSERT INTO timetable_terms (name, start_date, end_date) VALUES ($1, $2, $3) RETURNING id`
+	row := r.db.QueryRow(query, term.Name, term.StartDate, term.EndDate)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *TimetablePostgres) UpdateTerm(term classosbackend.Term) error {
+	query := `UPDATE timetable_terms SET name = $1, start_date = $2, end_date = $3 WHERE id = $4`
+	result, err := r.db.Exec(query, term.Name, term.StartDate, term.EndDate, term.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TimetablePostgres) DeleteTerm(termId int) error {
+	result, err := r.db.Exec(`DELETE FROM timetable_terms WHERE id = $1`, termId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TimetablePostgres) GetPeriods() ([]classosbackend.Period, error) {
+	periods := make([]classosbackend.Period, 0)
+	query := `SELECT ` + periodColumns + ` FROM timetable_periods ORDER BY number`
+	err := r.db.Select(&periods, query)
+	return periods, err
+}
+
+func (r *TimetablePostgres) GetPeriodById(periodId int) (classosbackend.Period, error) {
+	var period classosbackend.Period
+	query := `SELECT ` + periodColumns + ` FROM timetable_periods WHERE id = $1`
+	err := r.db.Get(&period, query, periodId)
+	return period, err
+}
+
+func (r *TimetablePostgres) CreatePeriod(period classosbackend.Period) (int, error) {
+	var id int
+	query := `INSERT INTO timetable_periods (number, start_time, end_time) VALUES ($1, $2, $3) RETURNING id`
+	row := r.db.QueryRow(query, period.Number, period.StartTime, period.EndTime)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *TimetablePostgres) UpdatePeriod(period classosbackend.Period) error {
+	query := `UPDATE timetable_periods SET number = $1, start_time = $2, end_time = $3 WHERE id = $4`
+	result, err := r.db.Exec(query, period.Number, period.StartTime, period.EndTime, period.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TimetablePostgres) DeletePeriod(periodId int) error {
+	result, err := r.db.Exec(`DELETE FROM timetable_periods WHERE id = $1`, periodId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TimetablePostgres) GetLessons(filter classosbackend.LessonsFilter) ([]classosbackend.Lesson, error) {
+	lessons := make([]classosbackend.Lesson, 0)
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if filter.TermID != 0 {
+		conditions = append(conditions, fmt.Sprintf("l.term_id = $%d", argIndex))
+		args = append(args, filter.TermID)
+		argIndex++
+	}
+
+	if filter.GroupID != 0 {
+		conditions = append(conditions, fmt.Sprintf("l.group_id = $%d", argIndex))
+		args = append(args, filter.GroupID)
+		argIndex++
+	}
+
+	if filter.TeacherID != 0 {
+		conditions = append(conditions, fmt.Sprintf("l.teacher_id = $%d", argIndex))
+		args = append(args, filter.TeacherID)
+		argIndex++
+	}
+
+	if filter.Room != "" {
+		conditions = append(conditions, fmt.Sprintf("l.room = $%d", argIndex))
+		args = append(args, filter.Room)
+		argIndex++
+	}
+
+	if filter.Weekday != nil {
+		conditions = append(conditions, fmt.Sprintf("l.weekday = $%d", argIndex))
+		args = append(args, *filter.Weekday)
+	}
+
+	query := `
+		SELECT l.id, l.term_id, l.group_id, l.teacher_id, l.room, l.subject, l.weekday, l.period_id
+		FROM lessons l
+		JOIN timetable_periods p ON p.id = l.period_id
+	`
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY l.weekday, p.number, l.group_id"
+
+	err := r.db.Select(&lessons, query, args...)
+	return lessons, err
+}
+
+func (r *TimetablePostgres) GetLessonById(lessonId int) (classosbackend.Lesson, error) {
+	var lesson classosbackend.Lesson
+	query := `SELECT ` + lessonColumns + ` FROM lessons WHERE id = $1`
+	err := r.db.Get(&lesson, query, lessonId)
+	return lesson, err
+}
+
+func (r *TimetablePostgres) CreateLesson(lesson classosbackend.Lesson) (int, error) {
+	var id int
+	query := `
+		INSERT INTO lessons (term_id, group_id, teacher_id, room, subject, weekday, period_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	row := r.db.QueryRow(query, lesson.TermID, lesson.GroupID, lesson.TeacherID, lesson.Room,
+		lesson.Subject, lesson.Weekday, lesson.PeriodID)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *TimetablePostgres) UpdateLesson(lesson classosbackend.Lesson) error {
+	query := `
+		UPDATE lessons
+		SET term_id = $1, teacher_id = $2, room = $3, subject = $4, weekday = $5, period_id = $6
+		WHERE id = $7
+	`
+	result, err := r.db.Exec(query, lesson.TermID, lesson.TeacherID, lesson.Room, lesson.Subject,
+		lesson.Weekday, lesson.PeriodID, lesson.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TimetablePostgres) DeleteLesson(lessonId int) error {
+	result, err := r.db.Exec(`DELETE FROM lessons WHERE id = $1`, lessonId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetLessonAt finds the lesson of the group on the given calendar date
+// ("2006-01-02") and weekday whose period covers the time of day ("15:04").
+func (r *TimetablePostgres) GetLessonAt(groupId int, date string, weekday int, clock string) (classosbackend.CurrentLesson, error) {
+	var row struct {
+		classosbackend.Lesson
+		PeriodNumber    int                 `db:"period_number"`
+		PeriodStartTime string              `db:"period_start_time"`
+		PeriodEndTime   string              `db:"period_end_time"`
+		Term            classosbackend.Term `db:"term"`
+	}
+	query := `
+		SELECT l.id, l.term_id, l.group_id, l.teacher_id, l.room, l.subject, l.weekday, l.period_id,
+			p.number AS period_number,
+			to_char(p.start_time, 'HH24:MI') AS period_start_time,
+			to_char(p.end_time, 'HH24:MI') AS period_end_time,
+			t.id AS "term.id", t.name AS "term.name",
+			t.start_date AS "term.start_date", t.end_date AS "term.end_date"
+		FROM lessons l
+		JOIN timetable_periods p ON p.id = l.period_id
+		JOIN timetable_terms t ON t.id = l.term_id
+		WHERE l.group_id = $1 AND l.weekday = $2
+			AND t.start_date <= $3 AND t.end_date >= $3
+			AND p.start_time <= $4 AND p.end_time > $4
+		ORDER BY t.start_date DESC
+		LIMIT 1
+	`
+	if err := r.db.Get(&row, query, groupId, weekday, date, clock); err != nil {
+		return classosbackend.CurrentLesson{}, err
+	}
+
+	return classosbackend.CurrentLesson{
+		Lesson: row.Lesson,
+		Period: classosbackend.Period{
+			ID:        row.PeriodID,
+			Number:    row.PeriodNumber,
+			StartTime: row.PeriodStartTime,
+			EndTime:   row.PeriodEndTime,
+		},
+		Term: row.Term,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type TwoFactorPostgres struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactorPostgres(db *sqlx.DB) *TwoFactorPostgres {
+	return &TwoFactorPostgres{db: db}
+}
+
+func (r *TwoFactorPostgres) Get(userId int) (classosbackend.TwoFactor, error) {
+	var twoFactor classosbackend.TwoFactor
+	query := `SELECT user_id, secret, enabled_at, last_used_step FROM user_totp WHERE user_id = $1`
+	err := r.db.Get(&twoFactor, query, userId)
+	return twoFactor, err
+}
+
+// SaveSecret starts a new enrollment. An enabled enrollment is left alone and
+// sql.ErrNoRows is returned.
+func (r *TwoFactorPostgres) SaveSecret(userId int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = EXCLUDED.created_at
+		WHERE user_totp.enabled_at IS NULL
+	`
+	result, err := r.db.Exec(query, userId, secret, time.Now())
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// Enable confirms the enrollment with the step of the first accepted code and
+// stores its recovery codes.
+func (r *TwoFactorPostgres) Enable(userId int, step int64, enabledAt time.Time, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_totp SET enabled_at = $2, last_used_step = $3
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`
+	result, err := tx.Exec(query, userId, enabledAt, step)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userId, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep accepts a code of the given time step only if no code of the same
+// or a later step was accepted before.
+func (r *TwoFactorPostgres) UseStep(userId int, step int64) error {
+	query := `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2
+	`
+	result, err := r.db.Exec(query, userId, step)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TwoFactorPostgres) ReplaceRecoveryCodes(userId int, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userId, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sqlx.Tx, userId int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		query := `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.Exec(query, userId, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TwoFactorPostgres) UseRecoveryCode(userId int, codeHash string, usedAt time.Time) error {
+	query := `
+		UPDATE user_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := r.db.Exec(query, userId, codeHash, usedAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *TwoFactorPostgres) CountRecoveryCodes(userId int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.Get(&count, query, userId)
+	return count, err
+}
+
+// Delete removes the enrollment together with its recovery codes.
+func (r *TwoFactorPostgres) Delete(userId int) error {
+	result, err := r.db.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 	
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
@@ -30,7 +32,7 @@ func (r *UserPostgres) CreateWithTx(tx *sql.Tx, groupId int, user classosbackend
 		return 0, err
 	}
 
-	createUserListsQuery := fmt.Sprintf("INSERT INTO %s (group_id, user_id) values ($1, $2)", users_listsTable)
+	createUserListsQuery := fmt.Sprintf("INSERT INTO %s (group_id, user_id, is_primary) values ($1, $2, TRUE)", users_listsTable)
 	_, err = tx.Exec(createUserListsQuery, groupId, userId)
 	if err != nil {
 		return 0, err
@@ -64,8 +66,9 @@ func (r *UserPostgres) UpdateWithTx(tx *sql.Tx, checkerId, userId int, input cla
 
 	if len(userSetValues) > 0 {
 		setQuery := strings.Join(userSetValues, ", ")
-		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", usersTable, setQuery, argId)
-		userArgs = append(userArgs, userId)
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d AND %s", usersTable, setQuery, argId,
+			userScope("id", fmt.Sprintf("$%d", argId+1)))
+		userArgs = append(userArgs, userId, checkerId)
 
 		_, err := tx.Exec(query, userArgs...)
 		if err != nil {
@@ -74,22 +77,7 @@ func (r *UserPostgres) UpdateWithTx(tx *sql.Tx, checkerId, userId int, input cla
 	}
 
 	if input.GroupID != nil {
-	    deleteQuery := fmt.Sprintf(`
-	        DELETE FROM %s  
-	        WHERE user_id = $1
-	    `, users_listsTable)
-	
-	    _, err := tx.Exec(deleteQuery, userId)
-	    if err != nil {
-	        return err
-	    }
-
-		insertQuery := fmt.Sprintf(`
-			INSERT INTO %s (user_id, group_id)
-			VALUES ($1, $2)
-		`, users_listsTable)
-		_, err = tx.Exec(insertQuery, userId, *input.GroupID)
-		if err != nil {
+		if err := setPrimaryGroup(tx, userId, *input.GroupID); err != nil {
 			return err
 		}
 	}
@@ -97,12 +85,78 @@ func (r *UserPostgres) UpdateWithTx(tx *sql.Tx, checkerId, userId int, input cla
 	return nil
 }
 
+// sqlExecer is a transaction of either database/sql or sqlx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// setPrimaryGroup moves the user from their primary group to groupId. The
+// other groups are kept; a group the user was already in becomes primary.
+func setPrimaryGroup(tx sqlExecer, userId, groupId int) error {
+	deleteQuery := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE user_id = $1 AND is_primary AND group_id != $2
+	`, users_listsTable)
+	if _, err := tx.Exec(deleteQuery, userId, groupId); err != nil {
+		return err
+	}
+
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO %s (user_id, group_id, is_primary)
+		VALUES ($1, $2, TRUE)
+		ON CONFLICT (user_id, group_id) DO UPDATE SET is_primary = TRUE
+	`, users_listsTable)
+	_, err := tx.Exec(insertQuery, userId, groupId)
+	return err
+}
+
 func (r *UserPostgres) DeleteWithTx(tx *sql.Tx, checkerId, userId int) error {
-	query := fmt.Sprintf(`Delete FROM %s WHERE id = $1`, usersTable)
-	_, err := tx.Exec(query, userId)
+	query := fmt.Sprintf(`Delete FROM %s WHERE id = $1 AND %s`, usersTable, userScope("id", "$2"))
+	_, err := tx.Exec(query, userId, checkerId)
 	return err
 }
 
+// SetStatusWithTx moves the user from one account state to another and
+// fails with sql.ErrNoRows when the user is no longer in the from state.
+func (r *UserPostgres) SetStatusWithTx(tx *sql.Tx, checkerId, userId int, from, to string) error {
+	var archivedAt *time.Time
+	if to == classosbackend.UserStatusArchived {
+		now := time.Now()
+		archivedAt = &now
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, archived_at = $2 WHERE id = $3 AND status = $4 AND %s`,
+		usersTable, userScope("id", "$5"))
+	result, err := tx.Exec(query, to, archivedAt, userId, from, checkerId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetArchivedBefore returns the users archived before the given time.
+func (r *UserPostgres) GetArchivedBefore(before time.Time) ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT id, name, username, role, status, archived_at
+		FROM %s
+		WHERE status = $1 AND archived_at < $2
+		ORDER BY archived_at
+	`, usersTable)
+	err := r.db.Select(&users, query, classosbackend.UserStatusArchived, before)
+	return users, err
+}
+
+// PurgeWithTx deletes an archived user for good.
+func (r *UserPostgres) PurgeWithTx(tx *sql.Tx, userId int) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND status = $2`, usersTable)
+	result, err := tx.Exec(query, userId, classosbackend.UserStatusArchived)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
 func (r *UserPostgres) Create(groupId int, user classosbackend.User) (int, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -118,7 +172,7 @@ func (r *UserPostgres) Create(groupId int, user classosbackend.User) (int, error
 		return 0, err
 	}
 
-	createUserListsQuery := fmt.Sprintf("INSERT INTO %s (group_id, user_id) values ($1, $2)", users_listsTable)
+	createUserListsQuery := fmt.Sprintf("INSERT INTO %s (group_id, user_id, is_primary) values ($1, $2, TRUE)", users_listsTable)
 	_, err = tx.Exec(createUserListsQuery, groupId, userId)
 	if err != nil {
 		tx.Rollback()
@@ -128,38 +182,146 @@ func (r *UserPostgres) Create(groupId int, user classosbackend.User) (int, error
 	return userId, tx.Commit()
 }
 
-func (r *UserPostgres) GetAll(checkerId int) ([]classosbackend.User, error) {
-	var users []classosbackend.User
+var userSortColumns = map[string]string{
+	"id":         "u.id",
+	"name":       "u.name",
+	"username":   "u.username",
+	"role":       "u.role",
+	"group_name": "COALESCE(g.name, '')",
+	"status":     "u.status",
+}
+
+// userListWhere builds the conditions of the user list; $1 is the checker.
+func userListWhere(checkerId int, filter classosbackend.UsersFilter) (string, []interface{}) {
+	conditions := []string{"u.id != 1", userScope("u.id", "$1")}
+	args := []interface{}{checkerId}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// Archived users are left out unless the status asks for them.
+	switch filter.Status {
+	case "":
+		conditions = append(conditions, "u.status != "+arg(classosbackend.UserStatusArchived))
+	case "all":
+	default:
+		conditions = append(conditions, "u.status = "+arg(filter.Status))
+	}
+
+	if filter.Search != "" {
+		pattern := arg("%" + escapeLike(filter.Search) + "%")
+		conditions = append(conditions, fmt.Sprintf("(u.name ILIKE %[1]s OR u.username ILIKE %[1]s)", pattern))
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "u.role = "+arg(filter.Role))
+	}
+	if filter.GroupID != nil {
+		if *filter.GroupID == 0 {
+			conditions = append(conditions, fmt.Sprintf(
+				"NOT EXISTS (SELECT 1 FROM %s x WHERE x.user_id = u.id)", users_listsTable))
+		} else {
+			conditions = append(conditions, fmt.Sprintf(
+				"EXISTS (SELECT 1 FROM %s x WHERE x.user_id = u.id AND x.group_id = %s)", users_listsTable, arg(*filter.GroupID)))
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r *UserPostgres) GetAll(checkerId int, filter classosbackend.UsersFilter) ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	where, args := userListWhere(checkerId, filter)
+
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		column = "u.id"
+	}
+
 	query := fmt.Sprintf(`
-		SELECT u.id, u.name, u.username, u.role, 
-			   COALESCE(ul.group_id, 0) as group_id, 
-			   COALESCE(g.name, '') as group_name 
-		FROM %s u 
-		LEFT JOIN %s ul ON u.id = ul.user_id 
-		LEFT JOIN %s g ON ul.group_id = g.id 
-		WHERE u.id != 1`, 
-		usersTable, users_listsTable, groupsTable)
-	
-	err := r.db.Select(&users, query)
-	return users, err
+		SELECT u.id, u.name, u.username, u.role, u.status, u.archived_at,
+			   COALESCE(ul.group_id, 0) as group_id,
+			   COALESCE(g.name, '') as group_name
+		FROM %s u
+		LEFT JOIN %s ul ON u.id = ul.user_id AND ul.is_primary
+		LEFT JOIN %s g ON ul.group_id = g.id
+		WHERE %s
+		%s%s`,
+		usersTable, users_listsTable, groupsTable, where, listOrder(column, "u.id", filter.ListQuery),
+		listPage(filter.ListQuery))
+
+	if err := r.db.Select(&users, query, args...); err != nil {
+		return nil, err
+	}
+	return users, loadUserGroups(r.db, users)
+}
+
+func (r *UserPostgres) Count(checkerId int, filter classosbackend.UsersFilter) (int, error) {
+	var count int
+	where, args := userListWhere(checkerId, filter)
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s u WHERE %s`, usersTable, where)
+	err := r.db.Get(&count, query, args...)
+	return count, err
 }
 
 func (r *UserPostgres) GetById(checkerId, userId int) (classosbackend.User, error) {
 	var user classosbackend.User
 	query := fmt.Sprintf(`
-		SELECT u.id, u.name, u.username, u.role, ul.group_id, g.name as group_name 
+		SELECT u.id, u.name, u.username, u.role, u.status, u.archived_at, ul.group_id, g.name as group_name 
 		FROM %s u 
-		LEFT JOIN %s ul ON u.id = ul.user_id 
+		LEFT JOIN %s ul ON u.id = ul.user_id AND ul.is_primary
 		LEFT JOIN %s g ON ul.group_id = g.id 
-		WHERE u.id = $1`, usersTable, users_listsTable, groupsTable)
+		WHERE u.id = $1 AND %s`, usersTable, users_listsTable, groupsTable, userScope("u.id", "$2"))
+
+	if err := r.db.Get(&user, query, userId, checkerId); err != nil {
+		return user, err
+	}
 
-	err := r.db.Get(&user, query, userId)
-	return user, err
+	users := []classosbackend.User{user}
+	if err := loadUserGroups(r.db, users); err != nil {
+		return user, err
+	}
+	return users[0], nil
+}
+
+// loadUserGroups fills in every group of the users, the primary one first.
+func loadUserGroups(db *sqlx.DB, users []classosbackend.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(users))
+	index := make(map[int]int, len(users))
+	for i := range users {
+		users[i].Groups = make([]classosbackend.Group, 0)
+		ids = append(ids, int64(users[i].ID))
+		index[users[i].ID] = i
+	}
+
+	var rows []struct {
+		UserID int `db:"user_id"`
+		classosbackend.Group
+	}
+	query := fmt.Sprintf(`
+		SELECT ul.user_id, g.id, g.name, g.archived_at
+		FROM %s ul
+		JOIN %s g ON g.id = ul.group_id
+		WHERE ul.user_id = ANY($1)
+		ORDER BY ul.is_primary DESC, g.name`, users_listsTable, groupsTable)
+	if err := db.Select(&rows, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		i := index[row.UserID]
+		users[i].Groups = append(users[i].Groups, row.Group)
+	}
+	return nil
 }
 
 func (r *UserPostgres) Delete(checkerId, userId int) error {
-	query := fmt.Sprintf(`Delete FROM %s WHERE id = $1`, usersTable)
-	_, err := r.db.Exec(query, userId)
+	query := fmt.Sprintf(`Delete FROM %s WHERE id = $1 AND %s`, usersTable, userScope("id", "$2"))
+	_, err := r.db.Exec(query, userId, checkerId)
 	return err
 }
 
@@ -194,8 +356,9 @@ func (r *UserPostgres) Update(checkerId, userId int, input classosbackend.Update
 
 	if len(userSetValues) > 0 {
 		setQuery := strings.Join(userSetValues, ", ")
-		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", usersTable, setQuery, argId)
-		userArgs = append(userArgs, userId)
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d AND %s", usersTable, setQuery, argId,
+			userScope("id", fmt.Sprintf("$%d", argId+1)))
+		userArgs = append(userArgs, userId, checkerId)
 
 		_, err = tx.Exec(query, userArgs...)
 		if err != nil {
@@ -204,22 +367,7 @@ func (r *UserPostgres) Update(checkerId, userId int, input classosbackend.Update
 	}
 
 	if input.GroupID != nil {
-	    deleteQuery := fmt.Sprintf(`
-	        DELETE FROM %s  
-	        WHERE user_id = $1
-	    `, users_listsTable)
-	
-	    _, err := tx.Exec(deleteQuery, userId)
-	    if err != nil {
-	        return err
-	    }
-
-		insertQuery := fmt.Sprintf(`
-			INSERT INTO %s (user_id, group_id)
-			VALUES ($1, $2)
-		`, users_listsTable)
-		_, err = tx.Exec(insertQuery, userId, *input.GroupID)
-		if err != nil {
+		if err := setPrimaryGroup(tx, userId, *input.GroupID); err != nil {
 			return err
 		}
 	}
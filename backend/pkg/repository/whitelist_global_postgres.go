@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type GlobalWhitelistPostgres struct {
+	db *sqlx.DB
+}
+
+func NewGlobalWhitelistPostgres(db *sqlx.DB) *GlobalWhitelistPostgres {
+	return &GlobalWhitelistPostgres{db: db}
+}
+
+func (r *GlobalWhitelistPostgres) GetAll(list string) ([]classosbackend.GlobalWhitelistEntry, error) {
+	entries := make([]classosbackend.GlobalWhitelistEntry, 0)
+	query := fmt.Sprintf(`
+		SELECT id, list_type, entry_type, resource, created_at
+		FROM %s
+		WHERE $1 = '' OR list_type = $1
+		ORDER BY list_type, id`, whitelist_globalTable)
+	err := r.db.Select(&entries, query, list)
+	return entries, err
+}
+
+func (r *GlobalWhitelistPostgres) GetById(entryId int) (classosbackend.GlobalWhitelistEntry, error) {
+	var entry classosbackend.GlobalWhitelistEntry
+	query := fmt.Sprintf(`
+		SELECT id, list_type, entry_type, resource, created_at
+		FROM %s
+		WHERE id = $1`, whitelist_globalTable)
+	err := r.db.Get(&entry, query, entryId)
+	return entry, err
+}
+
+func (r *GlobalWhitelistPostgres) Create(entry classosbackend.GlobalWhitelistEntry) (int, error) {
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (list_type, entry_type, resource) VALUES ($1, $2, $3) RETURNING id", whitelist_globalTable)
+	row := r.db.QueryRow(query, entry.List, entry.Type, entry.Value)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *GlobalWhitelistPostgres) Update(entryId int, input classosbackend.UpdateGlobalWhitelistEntryInput) error {
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if input.List != nil {
+		setValues = append(setValues, fmt.Sprintf("list_type=$%d", argId))
+		args = append(args, *input.List)
+		argId++
+	}
+
+	if input.Type != nil {
+		setValues = append(setValues, fmt.Sprintf("entry_type=$%d", argId))
+		args = append(args, *input.Type)
+		argId++
+	}
+
+	if input.Value != nil {
+		setValues = append(setValues, fmt.Sprintf("resource=$%d", argId))
+		args = append(args, *input.Value)
+		argId++
+	}
+
+	setQuery := strings.Join(setValues, ", ")
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", whitelist_globalTable, setQuery, argId)
+	args = append(args, entryId)
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *GlobalWhitelistPostgres) Delete(entryId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", whitelist_globalTable)
+	result, err := r.db.Exec(query, entryId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type WhitelistPostgres struct {
+	db *sqlx.DB
+}
+
+func NewWhitelistPostgres(db *sqlx.DB) *WhitelistPostgres {
+	return &WhitelistPostgres{db: db}
+}
+
+func (r *WhitelistPostgres) GetAll(groupId int) ([]classosbackend.WhitelistEntry, error) {
+	entries := make([]classosbackend.WhitelistEntry, 0)
+	query := fmt.Sprintf(`
+		SELECT id, group_id, entry_type, resource, created_at
+		FROM %s
+		WHERE group_id = $1
+		ORDER BY id`, whitelistTable)
+	if err := r.db.Select(&entries, query, groupId); err != nil {
+		return nil, err
+	}
+	return entries, r.loadSchedules(entries)
+}
+
+func (r *WhitelistPostgres) GetAllForUser(username string) ([]classosbackend.WhitelistEntry, error) {
+	entries := make([]classosbackend.WhitelistEntry, 0)
+	// Entries of every group of the user are merged; classes retired by a
+	// rollover no longer count.
+	query := fmt.Sprintf(`
+		SELECT w.id, w.group_id, w.entry_type, w.resource, w.created_at
+		FROM %s w
+		JOIN %s ul ON ul.group_id = w.group_id
+		JOIN %s u ON u.id = ul.user_id
+		JOIN %s g ON g.id = w.group_id AND g.archived_at IS NULL
+		WHERE LOWER(u.username) = LOWER($1)
+		ORDER BY w.id`, whitelistTable, users_listsTable, usersTable, groupsTable)
+	if err := r.db.Select(&entries, query, username); err != nil {
+		return nil, err
+	}
+	return entries, r.loadSchedules(entries)
+}
+
+func (r *WhitelistPostgres) GetById(groupId, entryId int) (classosbackend.WhitelistEntry, error) {
+	var entry classosbackend.WhitelistEntry
+	query := fmt.Sprintf(`
+		SELECT id, group_id, entry_type, resource, created_at
+		FROM %s
+		WHERE id = $1 AND group_id = $2`, whitelistTable)
+	if err := r.db.Get(&entry, query, entryId, groupId); err != nil {
+		return entry, err
+	}
+
+	entries := []classosbackend.WhitelistEntry{entry}
+	if err := r.loadSchedules(entries); err != nil {
+		return entry, err
+	}
+	return entries[0], nil
+}
+
+func (r *WhitelistPostgres) Create(groupId int, entry classosbackend.WhitelistEntry) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (group_id, entry_type, resource) VALUES ($1, $2, $3) RETURNING id", whitelistTable)
+	row := tx.QueryRow(query, groupId, entry.Type, entry.Value)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if err := insertSchedules(tx, id, entry.Schedules); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetAllSchedules returns every schedule window, used to find the next time
+// the effective policy of some group changes.
+func (r *WhitelistPostgres) GetAllSchedules() ([]classosbackend.WhitelistSchedule, error) {
+	schedules := make([]classosbackend.WhitelistSchedule, 0)
+	query := fmt.Sprintf(`SELECT %s FROM %s`, whitelistScheduleColumns, whitelist_schedulesTable)
+	err := r.db.Select(&schedules, query)
+	return schedules, err
+}
+
+func (r *WhitelistPostgres) Update(groupId, entryId int, input classosbackend.UpdateWhitelistEntryInput) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if input.Type != nil {
+		setValues = append(setValues, fmt.Sprintf("entry_type=$%d", argId))
+		args = append(args, *input.Type)
+		argId++
+	}
+
+	if input.Value != nil {
+		setValues = append(setValues, fmt.Sprintf("resource=$%d", argId))
+		args = append(args, *input.Value)
+		argId++
+	}
+
+	// A schedules-only update still has to match the entry of this group.
+	if len(setValues) == 0 {
+		setValues = append(setValues, "id=id")
+	}
+
+	setQuery := strings.Join(setValues, ", ")
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d AND group_id = $%d", whitelistTable, setQuery, argId, argId+1)
+	args = append(args, entryId, groupId)
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if input.Schedules != nil {
+		deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE whitelist_id = $1", whitelist_schedulesTable)
+		if _, err := tx.Exec(deleteQuery, entryId); err != nil {
+			return err
+		}
+		if err := insertSchedules(tx, entryId, *input.Schedules); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *WhitelistPostgres) Delete(groupId, entryId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND group_id = $2", whitelistTable)
+	result, err := r.db.Exec(query, entryId, groupId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *WhitelistPostgres) Replace(groupId int, entries []classosbackend.WhitelistEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE group_id = $1", whitelistTable)
+	if _, err := tx.Exec(deleteQuery, groupId); err != nil {
+		return err
+	}
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (group_id, entry_type, resource) VALUES ($1, $2, $3) RETURNING id", whitelistTable)
+	for _, entry := range entries {
+		var id int
+		if err := tx.QueryRow(insertQuery, groupId, entry.Type, entry.Value).Scan(&id); err != nil {
+			return err
+		}
+		if err := insertSchedules(tx, id, entry.Schedules); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const whitelistScheduleColumns = `id, whitelist_id, weekdays, to_char(start_time, 'HH24:MI') AS start_time,
+	to_char(end_time, 'HH24:MI') AS end_time, timezone`
+
+func (r *WhitelistPostgres) loadSchedules(entries []classosbackend.WhitelistEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(entries))
+	index := make(map[int64][]int, len(entries))
+	for i := range entries {
+		entries[i].Schedules = make([]classosbackend.WhitelistSchedule, 0)
+		ids = append(ids, entries[i].ID)
+		index[entries[i].ID] = append(index[entries[i].ID], i)
+	}
+
+	var schedules []classosbackend.WhitelistSchedule
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE whitelist_id = ANY($1) ORDER BY id`,
+		whitelistScheduleColumns, whitelist_schedulesTable)
+	if err := r.db.Select(&schedules, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		for _, i := range index[schedule.EntryID] {
+			entries[i].Schedules = append(entries[i].Schedules, schedule)
+		}
+	}
+	return nil
+}
+
+func insertSchedules(tx *sqlx.Tx, entryId int, schedules []classosbackend.WhitelistSchedule) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (whitelist_id, weekdays, start_time, end_time, timezone)
+		VALUES ($1, $2, $3, $4, $5)`, whitelist_schedulesTable)
+	for _, schedule := range schedules {
+		if _, err := tx.Exec(query, entryId, schedule.Weekdays, schedule.StartTime, schedule.EndTime, schedule.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expectAffected turns an UPDATE/DELETE that matched nothing into sql.ErrNoRows
+// so callers can tell "not found" apart from a real failure.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+var (
+	ErrADUserNotFound  = errors.New("user not found in AD")
+	ErrADGroupNotFound = errors.New("group not found in AD")
+)
+
+// ADIdentity is what a successful AD sign-in tells us about the user.
+type ADIdentity struct {
+	Username          string
+	DisplayName       string
+	DistinguishedName string
+	MemberOf          []string
+}
+
+// Authenticate verifies the password by binding as the user's own DN. The
+// service account is only used to look the DN up. Wrong passwords, disabled
+// and locked accounts all come back as ErrInvalidCredentials.
+func (ads *ADService) Authenticate(username, password string) (ADIdentity, error) {
+	if !ads.enabled {
+		return ADIdentity{}, fmt.Errorf("AD service is disabled")
+	}
+	// An empty password would be an unauthenticated bind, which AD accepts.
+	if password == "" {
+		return ADIdentity{}, ErrInvalidCredentials
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return ADIdentity{}, err
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return ADIdentity{}, err
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ADIdentity{}, ErrInvalidCredentials
+		}
+		return ADIdentity{}, fmt.Errorf("failed to bind as %s: %w", userDN, err)
+	}
+
+	attributes := []string{ads.schema.loginAttr, ads.schema.displayAttr}
+	if ads.schema.memberOfAttr != "" {
+		attributes = append(attributes, ads.schema.memberOfAttr)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		userDN,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, 0, false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil {
+		return ADIdentity{}, fmt.Errorf("failed to read AD user %s: %w", username, err)
+	}
+	if len(searchResult.Entries) == 0 {
+		return ADIdentity{}, fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+
+	entry := searchResult.Entries[0]
+	if login := entry.GetAttributeValue(ads.schema.loginAttr); login != "" {
+		username = login
+	}
+
+	memberOf := entry.GetAttributeValues(ads.schema.memberOfAttr)
+	if ads.schema.memberOfAttr == "" {
+		if memberOf, err = ads.userGroupDNs(conn, userDN, username, ads.baseDN); err != nil {
+			return ADIdentity{}, fmt.Errorf("failed to read groups of %s: %w", username, err)
+		}
+	}
+
+	return ADIdentity{
+		Username:          username,
+		DisplayName:       entry.GetAttributeValue(ads.schema.displayAttr),
+		DistinguishedName: userDN,
+		MemberOf:          memberOf,
+	}, nil
+}
+
+// adRoleMapping derives local roles from AD group membership.
+// AD_ADMIN_GROUPS and AD_TEACHER_GROUPS are comma separated lists of group
+// names or DNs; direct members sign in as admins or teachers, admin winning
+// over teacher. Users in neither are provisioned as clients, and the role of
+// an existing user is left alone when no group matches.
+type adRoleMapping struct {
+	adminGroups   []string
+	teacherGroups []string
+}
+
+func newADRoleMapping() adRoleMapping {
+	return adRoleMapping{
+		adminGroups:   splitGroupList(os.Getenv("AD_ADMIN_GROUPS")),
+		teacherGroups: splitGroupList(os.Getenv("AD_TEACHER_GROUPS")),
+	}
+}
+
+// Role returns the role the identity's groups map to and whether any mapped
+// group matched; without a match it returns the client role.
+func (m adRoleMapping) Role(identity ADIdentity) (string, bool) {
+	switch {
+	case memberOfAny(identity.MemberOf, m.adminGroups):
+		return classosbackend.RoleAdmin, true
+	case memberOfAny(identity.MemberOf, m.teacherGroups):
+		return classosbackend.RoleTeacher, true
+	default:
+		return classosbackend.RoleClient, false
+	}
+}
+
+func splitGroupList(value string) []string {
+	var groups []string
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func memberOfAny(memberOf, groups []string) bool {
+	for _, dn := range memberOf {
+		for _, group := range groups {
+			if strings.EqualFold(dn, group) || strings.EqualFold(extractCN(dn), group) {
+				return true
+			}
+		}
+	}
+	return false
+}
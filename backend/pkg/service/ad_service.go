@@ -4,8 +4,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
-	"unicode/utf16"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/sirupsen/logrus"
@@ -19,6 +19,8 @@ type ADUser struct {
 	Enabled           bool   `json:"enabled"`
 	DistinguishedName string `json:"distinguished_name"`
 	Password          string `json:"password"`
+	// Groups are the ClassOS groups the user is a direct member of.
+	Groups []string `json:"groups,omitempty"`
 }
 
 type ADGroup struct {
@@ -34,7 +36,11 @@ type ADService struct {
 	bindUser string
 	bindPass string
 	useTLS   bool
+	startTLS bool
 	enabled  bool
+	usersOU  string
+	groupsOU string
+	schema   ldapSchema
 }
 
 func NewADService() *ADService {
@@ -49,6 +55,18 @@ func NewADService() *ADService {
 	}
 
 	useTLS := port == "636" || strings.ToLower(os.Getenv("AD_USE_TLS")) == "true"
+	// На ldap:// соединение можно перевести в TLS через StartTLS
+	startTLS := !useTLS && strings.ToLower(os.Getenv("AD_START_TLS")) == "true"
+
+	// OU, в которых ClassOS создаёт и синхронизирует пользователей и группы
+	usersOU := os.Getenv("AD_USERS_OU")
+	if usersOU == "" {
+		usersOU = "OU=classos_users"
+	}
+	groupsOU := os.Getenv("AD_GROUPS_OU")
+	if groupsOU == "" {
+		groupsOU = "OU=classos_groups"
+	}
 
 	service := &ADService{
 		host:     os.Getenv("AD_HOST"),
@@ -57,20 +75,35 @@ func NewADService() *ADService {
 		bindUser: os.Getenv("AD_BIND_USER"),
 		bindPass: os.Getenv("AD_BIND_PASS"),
 		useTLS:   useTLS,
+		startTLS: startTLS,
 		enabled:  enabled,
+		usersOU:  usersOU,
+		groupsOU: groupsOU,
+		schema:   newLDAPSchema(),
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"enabled": service.enabled,
-		"host":    service.host,
-		"port":    service.port,
-		"useTLS":  service.useTLS,
-		"baseDN":  service.baseDN,
+		"enabled":  service.enabled,
+		"host":     service.host,
+		"port":     service.port,
+		"useTLS":   service.useTLS,
+		"startTLS": service.startTLS,
+		"baseDN":   service.baseDN,
+		"schema":   service.schema.name,
 	}).Info("AD Service initialized")
 
+	if enabled && service.schema.passwordHash == passwordHashUnicode && !useTLS && !startTLS {
+		logrus.Warn("AD only accepts unicodePwd over TLS, password changes will fail without AD_USE_TLS or AD_START_TLS")
+	}
+
 	return service
 }
 
+// Enabled reports whether AD is configured.
+func (ads *ADService) Enabled() bool {
+	return ads.enabled
+}
+
 func (ads *ADService) connect() (*ldap.Conn, error) {
 	if !ads.enabled {
 		return nil, fmt.Errorf("AD service is disabled")
@@ -80,15 +113,28 @@ func (ads *ADService) connect() (*ldap.Conn, error) {
 	var err error
 
 	address := fmt.Sprintf("%s:%s", ads.host, ads.port)
-
-	conn, err = ldap.DialTLS("tcp", address, &tls.Config{
+	tlsConfig := &tls.Config{
 		InsecureSkipVerify: false,
-	})
+		ServerName:         ads.host,
+	}
+
+	if ads.useTLS {
+		conn, err = ldap.DialURL("ldaps://"+address, ldap.DialWithTLSConfig(tlsConfig))
+	} else {
+		conn, err = ldap.DialURL("ldap://" + address)
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to AD: %w", err)
 	}
 
+	if ads.startTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS with AD: %w", err)
+		}
+	}
+
 	if err := conn.Bind(ads.bindUser, ads.bindPass); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to bind user(%s) to AD: %w", ads.bindUser, err)
@@ -143,9 +189,7 @@ func (ads *ADService) CreateGroup(group ADGroup) error {
 	}
 	defer conn.Close()
 
-	fmt.Print("user: ", ads.bindUser, "|  pswrd: ", ads.bindPass, "|  baseDN: ", ads.baseDN)
-
-	groupDN := fmt.Sprintf("CN=%s, OU=classos_groups, %s", group.Name, ads.baseDN)
+	groupDN := fmt.Sprintf("%s=%s, %s", ads.schema.groupRDN, ldap.EscapeDN(group.Name), ads.groupsDN())
 
 	logrus.WithFields(logrus.Fields{
 		"groupDN": groupDN,
@@ -153,11 +197,17 @@ func (ads *ADService) CreateGroup(group ADGroup) error {
 
 	addReq := ldap.NewAddRequest(groupDN, []ldap.Control{})
 
-	addReq.Attribute("objectClass", []string{"top", "group"})
-	addReq.Attribute("name", []string{group.Name})
-	addReq.Attribute("sAMAccountName", []string{group.Name})
-	addReq.Attribute("instanceType", []string{fmt.Sprintf("%d", 0x00000004)})
-	addReq.Attribute("groupType", []string{fmt.Sprintf("%d", 0x00000004|0x80000000)})
+	addReq.Attribute("objectClass", ads.schema.groupClasses)
+	addReq.Attribute(ads.schema.groupRDN, []string{group.Name})
+	if ads.schema.adAccounts {
+		addReq.Attribute("name", []string{group.Name})
+		addReq.Attribute("sAMAccountName", []string{group.Name})
+		addReq.Attribute("instanceType", []string{fmt.Sprintf("%d", 0x00000004)})
+		addReq.Attribute("groupType", []string{fmt.Sprintf("%d", 0x00000004|0x80000000)})
+	}
+	if ads.schema.groupNeedsMember {
+		addReq.Attribute(ads.schema.memberAttr, []string{ads.schema.memberValue(ads.bindUser, ads.bindUser)})
+	}
 
 	if err := conn.Add(addReq); err != nil {
 		return fmt.Errorf("failed to create group in AD: %w", err)
@@ -178,9 +228,7 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 	}
 	defer conn.Close()
 
-	fmt.Print("user: ", ads.bindUser, "|  pswrd: ", ads.bindPass, "|  baseDN: ", ads.baseDN)
-
-	userDN := fmt.Sprintf("CN=%s, OU=classos_users, %s", user.DisplayName, ads.baseDN)
+	userDN := fmt.Sprintf("%s=%s, %s", ads.schema.userRDN, ldap.EscapeDN(ads.schema.userRDNValue(user)), ads.usersDN())
 
 	logrus.WithFields(logrus.Fields{
 		"userDN": userDN,
@@ -197,15 +245,19 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 	// addRequest.Attribute("userAccountControl", []string{"514"}) // disabled account
 
 	addRequest := ldap.NewAddRequest(userDN, []ldap.Control{})
-	addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "user"})
+	addRequest.Attribute("objectClass", ads.schema.userClasses)
 	addRequest.Attribute("cn", []string{user.DisplayName})
 	addRequest.Attribute("sn", []string{"User"})
-	addRequest.Attribute("displayName", []string{user.DisplayName})
-	addRequest.Attribute("sAMAccountName", []string{user.SamAccountName})
-	addRequest.Attribute("userPrincipalName", []string{
-		fmt.Sprintf("%s@school.local", user.SamAccountName),
-	})
-	addRequest.Attribute("userAccountControl", []string{"514"})
+	addRequest.Attribute(ads.schema.displayAttr, []string{user.DisplayName})
+	addRequest.Attribute(ads.schema.loginAttr, []string{user.SamAccountName})
+	if ads.schema.upnAttr != "" {
+		addRequest.Attribute(ads.schema.upnAttr, []string{
+			ads.schema.userPrincipalName(user.SamAccountName),
+		})
+	}
+	if ads.schema.adAccounts {
+		addRequest.Attribute("userAccountControl", []string{"514"})
+	}
 
 	if err := conn.Add(addRequest); err != nil {
 		return fmt.Errorf("failed to create user in AD: %w", err)
@@ -225,7 +277,7 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
     //     return fmt.Errorf("failed to force password reset: %w", err)
     // }
 
-	if user.Enabled {
+	if user.Enabled && ads.schema.adAccounts {
 		if err := ads.enableUser(conn, userDN); err != nil {
 			ads.deleteUserByDN(conn, userDN)
 			return fmt.Errorf("failed to enable user: %w", err)
@@ -243,12 +295,7 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 }
 
 func (ads *ADService) setUserPassword(conn *ldap.Conn, userDN, password string) error {
-	passwordBytes := ads.encodePasswordForAD(password)
-
-	modifyRequest := ldap.NewModifyRequest(userDN, nil)
-	modifyRequest.Replace("unicodePwd", []string{string(passwordBytes)})
-
-	if err := conn.Modify(modifyRequest); err != nil {
+	if err := ads.schema.setPassword(conn, userDN, password); err != nil {
 		return fmt.Errorf("failed to set password: %w", err)
 	}
 
@@ -266,18 +313,43 @@ func (ads *ADService) enableUser(conn *ldap.Conn, userDN string) error {
 	return nil
 }
 
-func (ads *ADService) encodePasswordForAD(password string) []byte {
-	quotedPassword := fmt.Sprintf("\"%s\"", password)
-	utf16Password := utf16.Encode([]rune(quotedPassword))
+func (ads *ADService) disableUser(conn *ldap.Conn, userDN string) error {
+	modifyRequest := ldap.NewModifyRequest(userDN, nil)
+	modifyRequest.Replace("userAccountControl", []string{"66050"})
 
-	// Конвертируем в little-endian bytes
-	passwordBytes := make([]byte, len(utf16Password)*2)
-	for i, r := range utf16Password {
-		passwordBytes[i*2] = byte(r)
-		passwordBytes[i*2+1] = byte(r >> 8)
+	if err := conn.Modify(modifyRequest); err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
 	}
 
-	return passwordBytes
+	return nil
+}
+
+// SetUserEnabled enables or disables the account. Directories without
+// userAccountControl have no such switch; sign-in is then refused by
+// ClassOS alone.
+func (ads *ADService) SetUserEnabled(username string, enabled bool) error {
+	if !ads.enabled {
+		return fmt.Errorf("AD service is disabled")
+	}
+	if !ads.schema.adAccounts {
+		return nil
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if enabled {
+		return ads.enableUser(conn, userDN)
+	}
+	return ads.disableUser(conn, userDN)
 }
 
 func (ads *ADService) UpdateUser(username string, updates ADUser, groupname string) error {
@@ -299,7 +371,7 @@ func (ads *ADService) UpdateUser(username string, updates ADUser, groupname stri
     modifyReq := ldap.NewModifyRequest(userDN, nil)
 
     if updates.DisplayName != "" {
-        modifyReq.Replace("displayName", []string{updates.DisplayName})
+        modifyReq.Replace(ads.schema.displayAttr, []string{updates.DisplayName})
     }
 
     if len(modifyReq.Changes) > 0 {
@@ -340,6 +412,17 @@ func (ads *ADService) DeleteUser(username string) error {
 		return fmt.Errorf("user not found: %w", err)
 	}
 
+	// Без обратных ссылок memberOf сервер не убирает удалённого из групп
+	if ads.schema.memberOfAttr == "" {
+		groupDNs, err := ads.userGroupDNs(conn, userDN, username, ads.baseDN)
+		if err != nil {
+			return fmt.Errorf("failed to read user groups: %w", err)
+		}
+		if err := ads.removeFromGroups(conn, groupDNs, ads.schema.memberValue(userDN, username)); err != nil {
+			return err
+		}
+	}
+
 	return ads.deleteUserByDN(conn, userDN)
 }
 
@@ -377,14 +460,14 @@ func (ads *ADService) ChangeUserPassword(username, newPassword string) error {
 	return nil
 }
 
-// Находит DN пользователя по sAMAccountName
+// Находит DN пользователя по атрибуту входа (sAMAccountName, uid)
 func (ads *ADService) findUserDN(conn *ldap.Conn, username string) (string, error) {
 	searchRequest := ldap.NewSearchRequest(
 		ads.baseDN,
 		ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases,
 		1, 0, false,
-		fmt.Sprintf("(&(objectClass=user)(sAMAccountName=%s))", ldap.EscapeFilter(username)),
+		ads.schema.findUserFilter(username),
 		[]string{"dn"},
 		nil,
 	)
@@ -395,7 +478,7 @@ func (ads *ADService) findUserDN(conn *ldap.Conn, username string) (string, erro
 	}
 
 	if len(searchResult.Entries) == 0 {
-		return "", fmt.Errorf("user %s not found", username)
+		return "", fmt.Errorf("%w: %s", ErrADUserNotFound, username)
 	}
 
 	return searchResult.Entries[0].DN, nil
@@ -453,7 +536,7 @@ func (ads *ADService) UpdateGroup(groupName string, updates ADGroup) error {
 	}
 
 	logrus.Infof("ModifyDN: oldDN=%s, and new name: %s", groupDN, updates.Name)
-	newRDN := fmt.Sprintf("CN=%s", ldap.EscapeFilter(updates.Name))
+	newRDN := fmt.Sprintf("%s=%s", ads.schema.groupRDN, ldap.EscapeDN(updates.Name))
 	logrus.Infof("newRDN: %s", newRDN)
 
 	modifyRequest := ldap.NewModifyDNRequest(groupDN, newRDN, true, "") //остановился на изменении имени группы (CN)
@@ -499,7 +582,7 @@ func (ads *ADService) findGroupDN(conn *ldap.Conn, groupName string) (string, er
 		ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases,
 		1, 0, false,
-		fmt.Sprintf("(&(objectClass=group)(cn=%s))", ldap.EscapeFilter(groupName)),
+		ads.schema.findGroupFilter(groupName),
 		[]string{"dn"},
 		nil,
 	)
@@ -510,7 +593,7 @@ func (ads *ADService) findGroupDN(conn *ldap.Conn, groupName string) (string, er
 	}
 
 	if len(searchResult.Entries) == 0 {
-		return "", fmt.Errorf("group %s not found", groupName)
+		return "", fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
 	}
 
 	return searchResult.Entries[0].DN, nil
@@ -538,7 +621,7 @@ func (ads *ADService) AddUserToGroup(username, groupName string) error {
 	}
 
 	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
-	modifyRequest.Add("member", []string{userDN})
+	modifyRequest.Add(ads.schema.memberAttr, []string{ads.schema.memberValue(userDN, username)})
 
 	if err := conn.Modify(modifyRequest); err != nil {
 		return fmt.Errorf("failed to add user to group in AD: %w", err)
@@ -563,81 +646,128 @@ func (ads *ADService) MoveUserToAnotherGroup(username, groupName string) error {
 	}
 	defer conn.Close()
 
-	oldGroupName, err := ads.GetUserGroups(username)
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	oldGroupDNs, err := ads.userGroupDNs(conn, userDN, username, ads.groupsDN())
 	if err != nil {
 		return fmt.Errorf("problem with finding group: %w", err)
 	}
 
+	if err := ads.removeFromGroups(conn, oldGroupDNs, ads.schema.memberValue(userDN, username)); err != nil {
+		return err
+	}
+
+	if err := ads.AddUserToGroup(username, groupName); err != nil {
+		return fmt.Errorf("failed user to add to a group: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveUserFromGroup takes the user out of one group and leaves the others.
+func (ads *ADService) RemoveUserFromGroup(username, groupName string) error {
+	if !ads.enabled {
+		return fmt.Errorf("AD service is disabled")
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
 	userDN, err := ads.findUserDN(conn, username)
 	if err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
 
-	logrus.Infof("oldgroupname: %s", oldGroupName)
-	groupDN, err := ads.findGroupDN(conn, oldGroupName)
+	groupDN, err := ads.findGroupDN(conn, groupName)
 	if err != nil {
 		return fmt.Errorf("group not found: %w", err)
 	}
 
-	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
-	modifyRequest.Delete("member", []string{userDN})
+	return ads.removeFromGroups(conn, []string{groupDN}, ads.schema.memberValue(userDN, username))
+}
 
-	if err := conn.Modify(modifyRequest); err != nil {
-		return fmt.Errorf("failed to remove user from group in AD: %w", err)
-	}
+func (ads *ADService) removeFromGroups(conn *ldap.Conn, groupDNs []string, member string) error {
+	for _, groupDN := range groupDNs {
+		modifyRequest := ldap.NewModifyRequest(groupDN, nil)
+		modifyRequest.Delete(ads.schema.memberAttr, []string{member})
 
-	logrus.WithFields(logrus.Fields{
-		"userDN":  userDN,
-		"groupDN": groupDN,
-	}).Info("User removed from AD group successfully")
+		if err := conn.Modify(modifyRequest); err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchAttribute) {
+			return fmt.Errorf("failed to remove user from group in AD: %w", err)
+		}
 
-	if err := ads.AddUserToGroup(username, groupname); err != nil {
-		return fmt.Errorf("failed user to add to a group: %w", err)
+		logrus.WithFields(logrus.Fields{
+			"member":  member,
+			"groupDN": groupDN,
+		}).Info("User removed from AD group successfully")
 	}
-
 	return nil
 }
 
 func extractCN(dn string) string {
     parts := strings.Split(dn, ",")
-    if len(parts) > 0 && strings.HasPrefix(parts[0], "CN=") {
-        return strings.TrimPrefix(parts[0], "CN=")
+    if len(parts) > 0 && len(parts[0]) > 3 && strings.EqualFold(parts[0][:3], "CN=") {
+        return parts[0][3:]
     }
     return dn 
 }
 
-func (ads *ADService) GetUserGroups(username string) (string, error) {
-	conn, err := ads.connect()
-	if err != nil {
-		return "", err
+// userGroupDNs returns the groups under base the user is a direct member
+// of. Servers without memberOf are asked for the groups listing the user.
+func (ads *ADService) userGroupDNs(conn *ldap.Conn, userDN, username, base string) ([]string, error) {
+	if ads.schema.memberOfAttr == "" {
+		searchRequest := ldap.NewSearchRequest(
+			base,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0, 0, false,
+			ads.schema.groupsWithMemberFilter(ads.schema.memberValue(userDN, username)),
+			[]string{"dn"},
+			nil,
+		)
+
+		sr, err := conn.SearchWithPaging(searchRequest, 500)
+		if err != nil {
+			return nil, err
+		}
+
+		groupDNs := make([]string, 0, len(sr.Entries))
+		for _, entry := range sr.Entries {
+			groupDNs = append(groupDNs, entry.DN)
+		}
+		return groupDNs, nil
 	}
-	defer conn.Close()
 
 	searchRequest := ldap.NewSearchRequest(
-		ads.baseDN, 
-		ldap.ScopeWholeSubtree,
+		userDN,
+		ldap.ScopeBaseObject,
 		ldap.NeverDerefAliases,
-		0,
-		0,
-		false,
-		fmt.Sprintf("(sAMAccountName=%s)", username),
-		[]string{"memberOf"},
+		1, 0, false,
+		"(objectClass=*)",
+		[]string{ads.schema.memberOfAttr},
 		nil,
 	)
 
 	sr, err := conn.Search(searchRequest)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if len(sr.Entries) != 1 {
-		return "", fmt.Errorf("user not found or multiple entries")
+	if len(sr.Entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrADUserNotFound, username)
 	}
 
-	groups := sr.Entries[0].GetAttributeValues("memberOf")
-	if len(groups) > 0 {
-		return extractCN(groups[0]), nil
+	var groupDNs []string
+	for _, groupDN := range sr.Entries[0].GetAttributeValues(ads.schema.memberOfAttr) {
+		if dnUnder(groupDN, base) {
+			groupDNs = append(groupDNs, groupDN)
+		}
 	}
-	return "", fmt.Errorf("user has no group memberships")
+	return groupDNs, nil
 }
 
 func (ads *ADService) GetAllUsers() ([]ADUser, error) {
@@ -651,13 +781,21 @@ func (ads *ADService) GetAllUsers() ([]ADUser, error) {
 	}
 	defer conn.Close()
 
+	attributes := []string{ads.schema.loginAttr, ads.schema.displayAttr, "mail"}
+	if ads.schema.upnAttr != "" {
+		attributes = append(attributes, ads.schema.upnAttr)
+	}
+	if ads.schema.adAccounts {
+		attributes = append(attributes, "userAccountControl")
+	}
+
 	searchRequest := ldap.NewSearchRequest(
 		ads.baseDN,
 		ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases,
 		0, 0, false,
-		"(&(objectClass=user)(!(objectClass=computer)))",
-		[]string{"sAMAccountName", "displayName", "mail", "userPrincipalName", "userAccountControl", "distinguishedName"},
+		ads.schema.userFilter,
+		attributes,
 		nil,
 	)
 
@@ -669,13 +807,15 @@ func (ads *ADService) GetAllUsers() ([]ADUser, error) {
 	var users []ADUser
 	for _, entry := range searchResult.Entries {
 		user := ADUser{
-			SamAccountName:    entry.GetAttributeValue("sAMAccountName"),
-			DisplayName:       entry.GetAttributeValue("displayName"),
+			SamAccountName:    entry.GetAttributeValue(ads.schema.loginAttr),
+			DisplayName:       entry.GetAttributeValue(ads.schema.displayAttr),
 			EmailAddress:      entry.GetAttributeValue("mail"),
-			UserPrincipalName: entry.GetAttributeValue("userPrincipalName"),
 			DistinguishedName: entry.DN,
 			Enabled:           ads.isUserEnabled(entry.GetAttributeValue("userAccountControl")),
 		}
+		if ads.schema.upnAttr != "" {
+			user.UserPrincipalName = entry.GetAttributeValue(ads.schema.upnAttr)
+		}
 		users = append(users, user)
 	}
 
@@ -683,21 +823,167 @@ func (ads *ADService) GetAllUsers() ([]ADUser, error) {
 }
 
 func (ads *ADService) isUserEnabled(userAccountControl string) bool {
-	// userAccountControl: 512 = enabled, 514 = disabled
-	return userAccountControl == "512"
+	// Без userAccountControl учётные записи не отключаются
+	if !ads.schema.adAccounts {
+		return true
+	}
+	// userAccountControl: бит 0x2 (ACCOUNTDISABLE) отключает учётную запись
+	flags, err := strconv.Atoi(userAccountControl)
+	return err == nil && flags&0x2 == 0
 }
 
-func (ads *ADService) SyncAllUsersFromAD() error {
-	if !ads.enabled {
-		return fmt.Errorf("AD service is disabled")
+func (ads *ADService) usersDN() string {
+	return fmt.Sprintf("%s, %s", ads.usersOU, ads.baseDN)
+}
+
+func (ads *ADService) groupsDN() string {
+	return fmt.Sprintf("%s, %s", ads.groupsOU, ads.baseDN)
+}
+
+// ListUsers returns the users under the ClassOS users OU together with the
+// ClassOS groups they belong to.
+func (ads *ADService) ListUsers() ([]ADUser, error) {
+	conn, err := ads.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := []string{ads.schema.loginAttr, ads.schema.displayAttr}
+	if ads.schema.adAccounts {
+		attributes = append(attributes, "userAccountControl")
 	}
 
-	users, err := ads.GetAllUsers()
+	// Без memberOf членство читаем со стороны групп
+	var members map[string][]string
+	if ads.schema.memberOfAttr == "" {
+		if members, err = ads.groupMembers(conn); err != nil {
+			return nil, err
+		}
+	} else {
+		attributes = append(attributes, ads.schema.memberOfAttr)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		ads.usersDN(),
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		ads.schema.userFilter,
+		attributes,
+		nil,
+	)
+
+	searchResult, err := conn.SearchWithPaging(searchRequest, 500)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to search users in AD: %w", err)
 	}
 
-	logrus.WithField("count", len(users)).Info("Synced users from AD")
-	// Здесь может быть логика синхронизации с БД
-	return nil
+	groupsDN := ads.groupsDN()
+	users := make([]ADUser, 0, len(searchResult.Entries))
+	for _, entry := range searchResult.Entries {
+		user := ADUser{
+			SamAccountName:    entry.GetAttributeValue(ads.schema.loginAttr),
+			DisplayName:       entry.GetAttributeValue(ads.schema.displayAttr),
+			DistinguishedName: entry.DN,
+			Enabled:           ads.isUserEnabled(entry.GetAttributeValue("userAccountControl")),
+		}
+		if members != nil {
+			user.Groups = members[ads.memberKey(ads.schema.memberValue(entry.DN, user.SamAccountName))]
+		}
+		for _, groupDN := range entry.GetAttributeValues(ads.schema.memberOfAttr) {
+			if dnUnder(groupDN, groupsDN) {
+				user.Groups = append(user.Groups, extractCN(groupDN))
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// groupMembers maps every member of the ClassOS groups to the names of the
+// groups listing it.
+func (ads *ADService) groupMembers(conn *ldap.Conn) (map[string][]string, error) {
+	searchRequest := ldap.NewSearchRequest(
+		ads.groupsDN(),
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		ads.schema.groupFilter,
+		[]string{ads.schema.groupRDN, ads.schema.memberAttr},
+		nil,
+	)
+
+	searchResult, err := conn.SearchWithPaging(searchRequest, 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups in AD: %w", err)
+	}
+
+	members := make(map[string][]string)
+	for _, entry := range searchResult.Entries {
+		name := entry.GetAttributeValue(ads.schema.groupRDN)
+		for _, member := range entry.GetAttributeValues(ads.schema.memberAttr) {
+			key := ads.memberKey(member)
+			members[key] = append(members[key], name)
+		}
+	}
+	return members, nil
+}
+
+func (ads *ADService) memberKey(member string) string {
+	if ads.schema.memberIsDN {
+		return normalizeDN(member)
+	}
+	return strings.ToLower(member)
+}
+
+// ListGroups returns the groups under the ClassOS groups OU.
+func (ads *ADService) ListGroups() ([]ADGroup, error) {
+	conn, err := ads.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		ads.groupsDN(),
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		ads.schema.groupFilter,
+		[]string{ads.schema.groupRDN, "description"},
+		nil,
+	)
+
+	searchResult, err := conn.SearchWithPaging(searchRequest, 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups in AD: %w", err)
+	}
+
+	groups := make([]ADGroup, 0, len(searchResult.Entries))
+	for _, entry := range searchResult.Entries {
+		groups = append(groups, ADGroup{
+			Name:              entry.GetAttributeValue(ads.schema.groupRDN),
+			Description:       entry.GetAttributeValue("description"),
+			DistinguishedName: entry.DN,
+		})
+	}
+
+	return groups, nil
+}
+
+// normalizeDN lowercases a DN and drops the spaces around its separators, so
+// DNs written by hand compare equal to the ones AD returns.
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// dnUnder reports whether dn lies below base.
+func dnUnder(dn, base string) bool {
+	return strings.HasSuffix(normalizeDN(dn), ","+normalizeDN(base))
 }
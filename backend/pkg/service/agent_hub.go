@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AgentConn is the write side of an agent connection (a *websocket.Conn in
+// production).
+type AgentConn interface {
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// AgentSession wraps a live agent connection. Writes are serialized because
+// the read loop and the services push to the same socket concurrently.
+type AgentSession struct {
+	conn AgentConn
+	mu   sync.Mutex
+
+	stateMu       sync.Mutex
+	deviceName    string
+	username      string
+	policyVersion string
+}
+
+func NewAgentSession(conn AgentConn) *AgentSession {
+	return &AgentSession{conn: conn}
+}
+
+func (s *AgentSession) Send(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteJSON(v)
+}
+
+func (s *AgentSession) Close() error {
+	return s.conn.Close()
+}
+
+func (s *AgentSession) DeviceName() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.deviceName
+}
+
+func (s *AgentSession) Username() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.username
+}
+
+// SetUsername records who is logged in on the device and reports whether it
+// changed since the previous heartbeat.
+func (s *AgentSession) SetUsername(username string) bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	changed := s.username != username
+	s.username = username
+	return changed
+}
+
+// PolicyVersion is the version of the last policy pushed over this
+// connection.
+func (s *AgentSession) PolicyVersion() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.policyVersion
+}
+
+func (s *AgentSession) setPolicyVersion(version string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.policyVersion = version
+}
+
+// AgentHub is the registry of live agent connections keyed by device name.
+type AgentHub struct {
+	mu       sync.RWMutex
+	sessions map[string]*AgentSession
+}
+
+func NewAgentHub() *AgentHub {
+	return &AgentHub{sessions: make(map[string]*AgentSession)}
+}
+
+// Register binds the session to a device. A newer connection from the same
+// device replaces the previous one.
+func (h *AgentHub) Register(deviceName string, session *AgentSession) {
+	session.stateMu.Lock()
+	session.deviceName = deviceName
+	session.stateMu.Unlock()
+
+	h.mu.Lock()
+	h.sessions[deviceName] = session
+	h.mu.Unlock()
+}
+
+func (h *AgentHub) Unregister(session *AgentSession) {
+	deviceName := session.DeviceName()
+	if deviceName == "" {
+		return
+	}
+
+	h.mu.Lock()
+	if h.sessions[deviceName] == session {
+		delete(h.sessions, deviceName)
+	}
+	h.mu.Unlock()
+}
+
+func (h *AgentHub) Get(deviceName string) (*AgentSession, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	session, ok := h.sessions[deviceName]
+	return session, ok
+}
+
+func (h *AgentHub) IsOnline(deviceName string) bool {
+	_, ok := h.Get(deviceName)
+	return ok
+}
+
+func (h *AgentHub) Sessions() []*AgentSession {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	sessions := make([]*AgentSession, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Disconnect drops the live connection of a device, if there is one.
+func (h *AgentHub) Disconnect(deviceName string) {
+	h.mu.Lock()
+	session, ok := h.sessions[deviceName]
+	delete(h.sessions, deviceName)
+	h.mu.Unlock()
+
+	if ok {
+		session.Close()
+	}
+}
+
+func (h *AgentHub) Send(deviceName string, v interface{}) error {
+	session, ok := h.Get(deviceName)
+	if !ok {
+		return fmt.Errorf("device %s is not connected", deviceName)
+	}
+	return session.Send(v)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const auditExportPageSize = 1000
+
+type AuditService struct {
+	repo repository.Audit
+}
+
+func NewAuditService(repo repository.Audit) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record stores the outcome of an action; err is the error the action
+// returned, if any. Failing to write the audit record is logged and never
+// fails the action itself.
+func (s *AuditService) Record(actor classosbackend.Actor, event classosbackend.AuditEvent, err error) {
+	if actor.ID != 0 {
+		actorId := actor.ID
+		event.ActorID = &actorId
+	}
+	event.IP = actor.IP
+	event.CreatedAt = time.Now()
+	event.Result = classosbackend.AuditResultSuccess
+	if err != nil {
+		event.Result = classosbackend.AuditResultFailure
+		event.Error = err.Error()
+	}
+
+	if err := s.repo.Create(event); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"action": event.Action,
+			"target": event.TargetType + ":" + event.TargetID,
+		}).Error("Failed to write audit event")
+	}
+}
+
+func (s *AuditService) GetAll(filter classosbackend.AuditFilter) ([]classosbackend.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	return s.repo.GetAll(filter)
+}
+
+func (s *AuditService) Count(filter classosbackend.AuditFilter) (int, error) {
+	return s.repo.Count(filter)
+}
+
+// ExportCSV writes every event matching the filter, newest first. Limit and
+// offset of the filter are ignored.
+func (s *AuditService) ExportCSV(w io.Writer, filter classosbackend.AuditFilter) error {
+	writer := csv.NewWriter(w)
+	header := []string{"id", "created_at", "actor_id", "actor_username", "action", "target_type",
+		"target_id", "target_name", "changes", "ip", "result", "error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	filter.Limit = auditExportPageSize
+	filter.Offset = 0
+	for {
+		events, err := s.repo.GetAll(filter)
+		if err != nil {
+			return fmt.Errorf("failed to load audit events: %w", err)
+		}
+
+		for _, event := range events {
+			if err := writer.Write(auditCSVRecord(event)); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < filter.Limit {
+			break
+		}
+		filter.Offset += len(events)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func auditCSVRecord(event classosbackend.AuditEvent) []string {
+	actorId := ""
+	if event.ActorID != nil {
+		actorId = strconv.Itoa(*event.ActorID)
+	}
+
+	changes := ""
+	if len(event.Changes) > 0 {
+		if data, err := json.Marshal(event.Changes); err == nil {
+			changes = string(data)
+		}
+	}
+
+	return []string{
+		strconv.FormatInt(event.ID, 10),
+		event.CreatedAt.Format(time.RFC3339),
+		actorId,
+		csvSafe(event.ActorUsername),
+		event.Action,
+		event.TargetType,
+		csvSafe(event.TargetID),
+		csvSafe(event.TargetName),
+		changes,
+		event.IP,
+		event.Result,
+		csvSafe(event.Error),
+	}
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user supplied
+// values such as usernames as formulas.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
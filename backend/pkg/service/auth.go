@@ -1,30 +1,59 @@
 package service
 
 import (
-	"crypto/sha1"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
 )
 
-const tokenTTL = 12 * time.Hour
+// Access tokens are short-lived; clients keep their session alive with the
+// refresh token, which rotates on every use.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
 
-var ErrInvalidCredentials = errors.New("incorrect login or password")
+var (
+	ErrInvalidCredentials  = errors.New("incorrect login or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked or has expired")
+)
 
 type tokenClaims struct {
 	jwt.StandardClaims
 	CheckerId int    `json:"checker_id"`
 	Role      string `json:"role"`
+	SessionId string `json:"sid"`
 }
 
+// AUTH_MODE selects where passwords are checked: "local" (the users table,
+// default), "ad" (LDAP bind against Active Directory) or "ad_fallback" (AD
+// first, local accounts for users AD does not know or while AD is down).
+const (
+	AuthModeLocal      = "local"
+	AuthModeAD         = "ad"
+	AuthModeADFallback = "ad_fallback"
+)
+
+// adManagedPasswordHash marks users provisioned on their first AD sign-in.
+// It never verifies, so such users cannot sign in locally.
+const adManagedPasswordHash = "!ad"
+
 type AuthService struct {
-	repo repository.Authorization
+	repo      repository.Authorization
+	adService *ADService
+	limiter   *LoginLimiter
+	twoFactor *TwoFactorService
+	mode      string
+	roles     adRoleMapping
 }
 
 func getSigningKey() string {
@@ -35,26 +64,87 @@ func getSalt() string {
 	return os.Getenv("AUTH_salt")
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo repository.Authorization, adService *ADService, limiter *LoginLimiter, twoFactor *TwoFactorService) *AuthService {
+	mode := strings.ToLower(os.Getenv("AUTH_MODE"))
+	switch mode {
+	case AuthModeLocal, AuthModeAD, AuthModeADFallback:
+	case "":
+		mode = AuthModeLocal
+	default:
+		logrus.Printf("Warning: unknown AUTH_MODE %q, using local accounts", mode)
+		mode = AuthModeLocal
+	}
+
+	if mode != AuthModeLocal && (adService == nil || !adService.enabled) {
+		logrus.Printf("Warning: AUTH_MODE=%s but AD is not configured", mode)
+	}
+
+	return &AuthService{
+		repo:      repo,
+		adService: adService,
+		limiter:   limiter,
+		twoFactor: twoFactor,
+		mode:      mode,
+		roles:     newADRoleMapping(),
+	}
 }
 
-func (s *AuthService) GenerateToken(username, password string) (string, error) {
-	user, err := s.repo.GetUser(username, s.GeneratePasswordHash(password))
+// SignIn checks the credentials and opens a new session for the client, or
+// asks for a second factor when the user has one or must enroll one. Wrong
+// credentials count towards the lockout of the username and the client
+// address; while either is locked the password is not checked at all.
+func (s *AuthService) SignIn(username, password string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error) {
+	attempt, err := s.limiter.Begin(username, client.IP)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrInvalidCredentials
+		return classosbackend.SignInResult{}, err
+	}
+
+	user, err := s.GetUserByCredentials(username, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			attempt.Failed()
+		} else {
+			attempt.Release()
 		}
-		return "", fmt.Errorf("auth.GenerateToken: %w", err)
+		return classosbackend.SignInResult{}, err
+	}
+
+	enabled, err := s.twoFactor.IsEnabled(user.ID)
+	if err != nil {
+		attempt.Release()
+		return classosbackend.SignInResult{}, fmt.Errorf("auth.SignIn: %w", err)
+	}
+
+	switch {
+	case enabled:
+		attempt.Release()
+		return s.mfaChallenge(user, mfaPurposeVerify)
+	case s.twoFactor.IsRequired(user):
+		attempt.Release()
+		return s.mfaChallenge(user, mfaPurposeEnroll)
 	}
 
+	attempt.Succeeded()
+	return s.completeSignIn(user, client)
+}
+
+func (s *AuthService) completeSignIn(user classosbackend.User, client classosbackend.ClientInfo) (classosbackend.SignInResult, error) {
+	tokens, err := s.openSession(user, client)
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+	return classosbackend.SignInResult{Tokens: tokens, User: user}, nil
+}
+
+func (s *AuthService) newAccessToken(user classosbackend.User, sessionId string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
+			ExpiresAt: time.Now().Add(accessTokenTTL).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 		CheckerId: user.ID,
 		Role:      user.Role,
+		SessionId: sessionId,
 	})
 
 	signingKey := getSigningKey()
@@ -66,15 +156,133 @@ func (s *AuthService) GenerateToken(username, password string) (string, error) {
 }
 
 func (s *AuthService) CreateUser(user classosbackend.User) (int, error) {
-	user.Password = s.GeneratePasswordHash(user.Password)
+	hash, err := s.GeneratePasswordHash(user.Password)
+	if err != nil {
+		return 0, err
+	}
+	user.Password = hash
 	return s.repo.CreateUser(user)
 }
 
+// GetUserByCredentials checks the password according to the auth mode. The
+// returned user never carries the password hash.
 func (s *AuthService) GetUserByCredentials(username, password string) (classosbackend.User, error) {
-  return s.repo.GetUser(username, s.GeneratePasswordHash(password))
+	switch s.mode {
+	case AuthModeAD:
+		user, err := s.getADUser(username, password)
+		if errors.Is(err, ErrADUserNotFound) {
+			return classosbackend.User{}, ErrInvalidCredentials
+		}
+		return user, err
+	case AuthModeADFallback:
+		user, err := s.getADUser(username, password)
+		if err == nil || errors.Is(err, ErrInvalidCredentials) {
+			return user, err
+		}
+		if !errors.Is(err, ErrADUserNotFound) {
+			logrus.WithError(err).WithField("user", username).Warn("AD sign-in failed, falling back to local accounts")
+		}
+		return s.getLocalUser(username, password)
+	default:
+		return s.getLocalUser(username, password)
+	}
 }
 
+// getLocalUser verifies the password against the users table and, when the
+// stored hash uses a legacy format, replaces it with a current one.
+func (s *AuthService) getLocalUser(username, password string) (classosbackend.User, error) {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.User{}, ErrInvalidCredentials
+		}
+		return classosbackend.User{}, fmt.Errorf("auth.GetUserByCredentials: %w", err)
+	}
 
+	ok, needsRehash, err := VerifyPassword(user.Password, password)
+	if err != nil {
+		return classosbackend.User{}, fmt.Errorf("auth.GetUserByCredentials: user %s: %w", username, err)
+	}
+	if !ok {
+		return classosbackend.User{}, ErrInvalidCredentials
+	}
+
+	// The status is only looked at once the password matched, so that the
+	// answer and its timing do not tell a disabled account from a wrong
+	// password.
+	if !user.Active() {
+		return classosbackend.User{}, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// getADUser binds as the user in AD and returns the matching local user,
+// creating it on the first sign-in. The role follows AD group membership on
+// every sign-in.
+func (s *AuthService) getADUser(username, password string) (classosbackend.User, error) {
+	if s.adService == nil {
+		return classosbackend.User{}, fmt.Errorf("AD service is disabled")
+	}
+
+	identity, err := s.adService.Authenticate(username, password)
+	if err != nil {
+		return classosbackend.User{}, err
+	}
+	role, mapped := s.roles.Role(identity)
+
+	user, err := s.repo.GetUser(identity.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		name := identity.DisplayName
+		if name == "" {
+			name = identity.Username
+		}
+		user = classosbackend.User{
+			Name:     name,
+			Username: identity.Username,
+			Role:     role,
+			Password: adManagedPasswordHash,
+		}
+		user.ID, err = s.repo.CreateDirectoryUser(user)
+		if err != nil {
+			return classosbackend.User{}, fmt.Errorf("auth.getADUser: provision %s: %w", identity.Username, err)
+		}
+		logrus.WithFields(logrus.Fields{"user": user.Username, "role": role}).Info("Provisioned user from AD")
+	} else if err != nil {
+		return classosbackend.User{}, fmt.Errorf("auth.getADUser: %w", err)
+	} else if !user.Active() {
+		return classosbackend.User{}, ErrInvalidCredentials
+	} else if mapped && user.Role != role && user.Username != classosbackend.SuperAdminUsername {
+		if err := s.repo.UpdateRole(user.ID, role); err != nil {
+			return classosbackend.User{}, fmt.Errorf("auth.getADUser: update role of %s: %w", user.Username, err)
+		}
+		logrus.WithFields(logrus.Fields{"user": user.Username, "from": user.Role, "to": role}).Info("Role updated from AD groups")
+		user.Role = role
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+func (s *AuthService) rehashPassword(user classosbackend.User, password string) {
+	hash, err := HashPassword(password)
+	if err == nil {
+		err = s.repo.UpdatePasswordHash(user.ID, hash)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("user", user.Username).Warn("Failed to upgrade password hash")
+		return
+	}
+	logrus.WithField("user", user.Username).Info("Password hash upgraded")
+}
+
+// ParseToken validates an access token and checks that its session is still
+// active, so revoked sessions lose access before the token expires.
 func (s *AuthService) ParseToken(accessToken string) (int, string, error) {
 	signingKey := getSigningKey()
 	if signingKey == "" {
@@ -96,13 +304,23 @@ func (s *AuthService) ParseToken(accessToken string) (int, string, error) {
 		return 0, "", errors.New("token claims are not type of *tokenClaims")
 	}
 
+	if claims.SessionId == "" {
+		return 0, "", ErrSessionRevoked
+	}
+	session, err := s.repo.GetSession(claims.SessionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrSessionRevoked
+		}
+		return 0, "", fmt.Errorf("auth.ParseToken: %w", err)
+	}
+	if !session.IsActive(time.Now()) || session.UserID != claims.CheckerId {
+		return 0, "", ErrSessionRevoked
+	}
+
 	return claims.CheckerId, claims.Role, nil
 }
 
-func (s *AuthService) GeneratePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	salt := getSalt()
-	result := fmt.Sprintf("%x", hash.Sum([]byte(salt)))
-	return result
+func (s *AuthService) GeneratePasswordHash(password string) (string, error) {
+	return HashPassword(password)
 }
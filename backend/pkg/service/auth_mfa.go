@@ -0,0 +1,157 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// After the password check a user with two-factor authentication gets an MFA
+// token instead of a session. It is only good for the second step: it names
+// the user in its own claim and carries no session id, so ParseToken never
+// accepts it as an access token.
+const (
+	mfaTokenTTL = 5 * time.Minute
+
+	mfaPurposeVerify = "mfa_verify"
+	mfaPurposeEnroll = "mfa_enroll"
+)
+
+var ErrInvalidMFAToken = errors.New("invalid or expired mfa token")
+
+type mfaClaims struct {
+	jwt.StandardClaims
+	UserId  int    `json:"mfa_user_id"`
+	Purpose string `json:"purpose"`
+}
+
+func (s *AuthService) mfaChallenge(user classosbackend.User, purpose string) (classosbackend.SignInResult, error) {
+	signingKey := getSigningKey()
+	if signingKey == "" {
+		return classosbackend.SignInResult{}, fmt.Errorf("AUTH_signingKey environment variable is not set")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &mfaClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(mfaTokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+		UserId:  user.ID,
+		Purpose: purpose,
+	})
+
+	mfaToken, err := token.SignedString([]byte(signingKey))
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+
+	return classosbackend.SignInResult{
+		User:                  user,
+		MFAToken:              mfaToken,
+		MFAEnrollmentRequired: purpose == mfaPurposeEnroll,
+	}, nil
+}
+
+func (s *AuthService) parseMFAToken(mfaToken, purpose string) (classosbackend.User, error) {
+	signingKey := getSigningKey()
+	if signingKey == "" {
+		return classosbackend.User{}, fmt.Errorf("AUTH_signingKey env var is not set")
+	}
+
+	token, err := jwt.ParseWithClaims(mfaToken, &mfaClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return []byte(signingKey), nil
+	})
+	if err != nil {
+		return classosbackend.User{}, ErrInvalidMFAToken
+	}
+
+	claims, ok := token.Claims.(*mfaClaims)
+	if !ok || claims.Purpose != purpose || claims.UserId == 0 {
+		return classosbackend.User{}, ErrInvalidMFAToken
+	}
+
+	user, err := s.repo.GetUserById(claims.UserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.User{}, ErrInvalidMFAToken
+		}
+		return classosbackend.User{}, fmt.Errorf("auth.parseMFAToken: %w", err)
+	}
+	// The account may have been disabled after the password step.
+	if !user.Active() {
+		return classosbackend.User{}, ErrInvalidMFAToken
+	}
+	return user, nil
+}
+
+// VerifyMFA completes a sign-in with a TOTP or recovery code. Wrong codes
+// count towards the same lockout as wrong passwords.
+func (s *AuthService) VerifyMFA(mfaToken, code string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error) {
+	user, err := s.parseMFAToken(mfaToken, mfaPurposeVerify)
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+
+	attempt, err := s.limiter.Begin(user.Username, client.IP)
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+
+	if err := s.twoFactor.Verify(user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			attempt.Failed()
+		} else {
+			attempt.Release()
+		}
+		return classosbackend.SignInResult{}, err
+	}
+
+	attempt.Succeeded()
+	return s.completeSignIn(user, client)
+}
+
+// SetupMFAEnrollment starts the enrollment of a user who has to set up
+// two-factor authentication before getting a session.
+func (s *AuthService) SetupMFAEnrollment(mfaToken string) (classosbackend.TOTPSetup, error) {
+	user, err := s.parseMFAToken(mfaToken, mfaPurposeEnroll)
+	if err != nil {
+		return classosbackend.TOTPSetup{}, err
+	}
+	return s.twoFactor.Setup(user.ID)
+}
+
+// CompleteMFAEnrollment confirms the enrollment and opens the session. The
+// result carries the new recovery codes.
+func (s *AuthService) CompleteMFAEnrollment(mfaToken, code string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error) {
+	user, err := s.parseMFAToken(mfaToken, mfaPurposeEnroll)
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+
+	attempt, err := s.limiter.Begin(user.Username, client.IP)
+	if err != nil {
+		return classosbackend.SignInResult{}, err
+	}
+
+	codes, err := s.twoFactor.Enable(classosbackend.Actor{ID: user.ID, IP: client.IP}, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			attempt.Failed()
+		} else {
+			attempt.Release()
+		}
+		return classosbackend.SignInResult{}, err
+	}
+
+	attempt.Succeeded()
+	result, err := s.completeSignIn(user, client)
+	result.RecoveryCodes = codes
+	return result, err
+}
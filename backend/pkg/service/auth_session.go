@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *AuthService) openSession(user classosbackend.User, client classosbackend.ClientInfo) (classosbackend.TokenPair, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	now := time.Now()
+	session := classosbackend.AuthSession{
+		ID:               uuid.NewString(),
+		UserID:           user.ID,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		UserAgent:        client.UserAgent,
+		IP:               client.IP,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(refreshTokenTTL),
+	}
+	if err := s.repo.CreateSession(session); err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.tokenPair(user, session.ID, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// stops working; presenting it again is treated as theft and revokes the
+// whole session.
+func (s *AuthService) Refresh(refreshToken string) (classosbackend.TokenPair, error) {
+	tokenHash := hashRefreshToken(refreshToken)
+
+	session, err := s.repo.GetSessionByRefreshHash(tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+
+	if !session.IsActive(time.Now()) {
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if session.RefreshTokenHash != tokenHash {
+		if err := s.repo.RevokeSession(session.UserID, session.ID); err != nil {
+			logrus.WithError(err).WithField("session", session.ID).Error("Failed to revoke session after refresh token reuse")
+		}
+		logrus.WithFields(logrus.Fields{
+			"session": session.ID,
+			"user_id": session.UserID,
+		}).Warn("Rotated refresh token reused, session revoked")
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetUserById(session.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+	// Sessions are revoked when an account is disabled, but that can fail;
+	// a disabled account never gets new tokens either way.
+	if !user.Active() {
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	newToken, err := generateRefreshToken()
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	err = s.repo.RotateSession(session.ID, tokenHash, hashRefreshToken(newToken), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+
+	return s.tokenPair(user, session.ID, newToken)
+}
+
+// Logout revokes the session the refresh token belongs to.
+func (s *AuthService) Logout(refreshToken string) error {
+	session, err := s.repo.GetSessionByRefreshHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+
+	if session.RevokedAt != nil {
+		return nil
+	}
+	return s.repo.RevokeSession(session.UserID, session.ID)
+}
+
+func (s *AuthService) GetSessions(userId int) ([]classosbackend.AuthSession, error) {
+	return s.repo.GetActiveSessions(userId)
+}
+
+func (s *AuthService) RevokeSession(userId int, sessionId string) error {
+	return s.repo.RevokeSession(userId, sessionId)
+}
+
+func (s *AuthService) RevokeAllSessions(userId int) error {
+	revoked, err := s.repo.RevokeAllSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":  userId,
+		"sessions": revoked,
+	}).Info("All sessions of user revoked")
+	return nil
+}
+
+func (s *AuthService) tokenPair(user classosbackend.User, sessionId, refreshToken string) (classosbackend.TokenPair, error) {
+	accessToken, err := s.newAccessToken(user, sessionId)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	return classosbackend.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func generateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
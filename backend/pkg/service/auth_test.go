@@ -0,0 +1,109 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+type fakeAuthRepo struct {
+	repository.Authorization
+	users    map[int]classosbackend.User
+	sessions map[string]classosbackend.AuthSession
+	created  int
+	rotated  int
+}
+
+func (r *fakeAuthRepo) GetUserById(userId int) (classosbackend.User, error) {
+	user, ok := r.users[userId]
+	if !ok {
+		return classosbackend.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *fakeAuthRepo) GetSessionByRefreshHash(tokenHash string) (classosbackend.AuthSession, error) {
+	session, ok := r.sessions[tokenHash]
+	if !ok {
+		return classosbackend.AuthSession{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (r *fakeAuthRepo) CreateSession(classosbackend.AuthSession) error {
+	r.created++
+	return nil
+}
+
+func (r *fakeAuthRepo) RotateSession(string, string, string, time.Time) error {
+	r.rotated++
+	return nil
+}
+
+func newDisabledUserAuth(t *testing.T) (*AuthService, *fakeAuthRepo, classosbackend.User) {
+	t.Helper()
+	t.Setenv("AUTH_signingKey", "test-signing-key")
+
+	user := classosbackend.User{ID: 7, Username: "ivanov", Status: classosbackend.UserStatusDisabled}
+	repo := &fakeAuthRepo{
+		users:    map[int]classosbackend.User{user.ID: user},
+		sessions: make(map[string]classosbackend.AuthSession),
+	}
+	return &AuthService{repo: repo}, repo, user
+}
+
+func TestMFARejectsUserDisabledAfterPassword(t *testing.T) {
+	client := classosbackend.ClientInfo{IP: "10.0.0.1"}
+
+	for _, tc := range []struct {
+		purpose  string
+		complete func(s *AuthService, token string) error
+	}{
+		{mfaPurposeVerify, func(s *AuthService, token string) error {
+			_, err := s.VerifyMFA(token, "123456", client)
+			return err
+		}},
+		{mfaPurposeEnroll, func(s *AuthService, token string) error {
+			_, err := s.CompleteMFAEnrollment(token, "123456", client)
+			return err
+		}},
+	} {
+		t.Run(tc.purpose, func(t *testing.T) {
+			s, repo, user := newDisabledUserAuth(t)
+			challenge, err := s.mfaChallenge(user, tc.purpose)
+			if err != nil {
+				t.Fatalf("mfaChallenge: %v", err)
+			}
+
+			if err := tc.complete(s, challenge.MFAToken); !errors.Is(err, ErrInvalidMFAToken) {
+				t.Fatalf("err = %v, want ErrInvalidMFAToken", err)
+			}
+			if repo.created != 0 {
+				t.Error("a session was opened for a disabled user")
+			}
+		})
+	}
+}
+
+func TestRefreshRejectsDisabledUser(t *testing.T) {
+	s, repo, user := newDisabledUserAuth(t)
+	refreshToken := "refresh-token"
+	tokenHash := hashRefreshToken(refreshToken)
+	repo.sessions[tokenHash] = classosbackend.AuthSession{
+		ID:               "session-1",
+		UserID:           user.ID,
+		RefreshTokenHash: tokenHash,
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+
+	if _, err := s.Refresh(refreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh = %v, want ErrInvalidRefreshToken", err)
+	}
+	if repo.rotated != 0 {
+		t.Error("the session was rotated for a disabled user")
+	}
+}
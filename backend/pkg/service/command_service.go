@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const commandExpiryInterval = 30 * time.Second
+
+var ErrDeviceOffline = errors.New("device is offline")
+
+type CommandService struct {
+	repo       repository.Command
+	deviceRepo repository.Device
+	groupRepo  repository.Group
+	hub        *AgentHub
+}
+
+func NewCommandService(repo repository.Command, deviceRepo repository.Device, groupRepo repository.Group, hub *AgentHub) *CommandService {
+	return &CommandService{
+		repo:       repo,
+		deviceRepo: deviceRepo,
+		groupRepo:  groupRepo,
+		hub:        hub,
+	}
+}
+
+func (s *CommandService) Send(checkerId int, deviceName string, input classosbackend.SendCommandInput) (classosbackend.DeviceCommand, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.DeviceCommand{}, err
+	}
+
+	if err := s.checkDeviceAccess(checkerId, deviceName); err != nil {
+		return classosbackend.DeviceCommand{}, err
+	}
+
+	return s.dispatch(checkerId, deviceName, input)
+}
+
+// checkDeviceAccess hides devices outside the checker's groups as not found.
+func (s *CommandService) checkDeviceAccess(checkerId int, deviceName string) error {
+	ok, err := s.deviceRepo.CanAccessDevice(checkerId, deviceName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// dispatch stores the command and writes it to the agent. Offline devices
+// either fail with ErrDeviceOffline or keep the command queued, depending on
+// input.QueueIfOffline.
+func (s *CommandService) dispatch(checkerId int, deviceName string, input classosbackend.SendCommandInput) (classosbackend.DeviceCommand, error) {
+	session, online := s.hub.Get(deviceName)
+	if !online && !input.QueueIfOffline {
+		return classosbackend.DeviceCommand{}, fmt.Errorf("%w: %s", ErrDeviceOffline, deviceName)
+	}
+
+	now := time.Now()
+	command := classosbackend.DeviceCommand{
+		ID:         uuid.NewString(),
+		DeviceName: deviceName,
+		Type:       input.Type,
+		Payload:    input.Message,
+		Status:     classosbackend.CommandStatusPending,
+		CreatedBy:  &checkerId,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(input.Timeout()),
+	}
+
+	if err := s.repo.Create(command); err != nil {
+		return command, fmt.Errorf("failed to store command: %w", err)
+	}
+
+	if !online {
+		logrus.WithFields(logrus.Fields{
+			"command": command.ID,
+			"device":  deviceName,
+		}).Info("Device offline, command queued")
+		return command, nil
+	}
+
+	return s.deliver(session, command)
+}
+
+// SendToGroup fans a command out to every device a member of the group is
+// logged into. Offline devices keep the command queued until it expires.
+func (s *CommandService) SendToGroup(checkerId, groupId int, input classosbackend.SendCommandInput) (classosbackend.CommandDeliveryReport, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.CommandDeliveryReport{}, err
+	}
+
+	group, err := s.groupRepo.GetById(checkerId, groupId)
+	if err != nil {
+		return classosbackend.CommandDeliveryReport{}, err
+	}
+
+	devices, err := s.deviceRepo.GetDevicesByGroup(groupId)
+	if err != nil {
+		return classosbackend.CommandDeliveryReport{}, fmt.Errorf("failed to find devices of group %d: %w", groupId, err)
+	}
+
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		names = append(names, device.DeviceName)
+	}
+
+	return s.fanOut(checkerId, "group:"+group.Name, names, input), nil
+}
+
+// SendToRoom fans a command out to every enrolled device placed in the room.
+func (s *CommandService) SendToRoom(checkerId int, room string, input classosbackend.SendCommandInput) (classosbackend.CommandDeliveryReport, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.CommandDeliveryReport{}, err
+	}
+
+	devices, err := s.deviceRepo.GetEnrolledDevicesByRoom(room)
+	if err != nil {
+		return classosbackend.CommandDeliveryReport{}, fmt.Errorf("failed to find devices in room %s: %w", room, err)
+	}
+
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		names = append(names, device.DeviceName)
+	}
+
+	return s.fanOut(checkerId, "room:"+room, names, input), nil
+}
+
+func (s *CommandService) fanOut(checkerId int, target string, deviceNames []string, input classosbackend.SendCommandInput) classosbackend.CommandDeliveryReport {
+	input.QueueIfOffline = true
+	report := classosbackend.CommandDeliveryReport{
+		Target:  target,
+		Results: make([]classosbackend.CommandDeliveryResult, 0, len(deviceNames)),
+	}
+
+	for _, deviceName := range deviceNames {
+		result := classosbackend.CommandDeliveryResult{DeviceName: deviceName}
+
+		command, err := s.dispatch(checkerId, deviceName, input)
+		result.CommandID = command.ID
+		switch {
+		case err != nil:
+			result.Delivery = classosbackend.DeliveryFailed
+			result.Error = err.Error()
+		case command.Status == classosbackend.CommandStatusPending:
+			result.Delivery = classosbackend.DeliveryQueued
+		default:
+			result.Delivery = classosbackend.DeliveryDelivered
+		}
+
+		report.Add(result)
+	}
+
+	return report
+}
+
+// DeliverPending sends commands that were queued while the device was
+// offline. It is called right after the agent authenticates.
+func (s *CommandService) DeliverPending(deviceName string) error {
+	session, ok := s.hub.Get(deviceName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDeviceOffline, deviceName)
+	}
+
+	commands, err := s.repo.GetPending(deviceName)
+	if err != nil {
+		return fmt.Errorf("failed to load pending commands: %w", err)
+	}
+
+	for _, command := range commands {
+		if _, err := s.deliver(session, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CommandService) deliver(session *AgentSession, command classosbackend.DeviceCommand) (classosbackend.DeviceCommand, error) {
+	if err := session.Send(classosbackend.AgentMessage{Type: "command", Command: &command}); err != nil {
+		reason := fmt.Sprintf("delivery failed: %v", err)
+		if markErr := s.repo.MarkFailed(command.ID, reason); markErr != nil {
+			logrus.WithError(markErr).WithField("command", command.ID).Error("Failed to mark command as failed")
+		}
+		command.Status = classosbackend.CommandStatusFailed
+		command.Result = &reason
+		return command, fmt.Errorf("failed to deliver command to %s: %w", command.DeviceName, err)
+	}
+
+	if err := s.repo.MarkDelivered(command.ID); err != nil {
+		return command, fmt.Errorf("failed to mark command as delivered: %w", err)
+	}
+
+	deliveredAt := time.Now()
+	command.Status = classosbackend.CommandStatusDelivered
+	command.DeliveredAt = &deliveredAt
+
+	logrus.WithFields(logrus.Fields{
+		"command": command.ID,
+		"device":  command.DeviceName,
+		"type":    command.Type,
+	}).Info("Command delivered to agent")
+	return command, nil
+}
+
+func (s *CommandService) GetById(checkerId int, commandId string) (classosbackend.DeviceCommand, error) {
+	command, err := s.repo.GetById(commandId)
+	if err != nil {
+		return command, err
+	}
+
+	if err := s.checkDeviceAccess(checkerId, command.DeviceName); err != nil {
+		return classosbackend.DeviceCommand{}, err
+	}
+	return command, nil
+}
+
+func (s *CommandService) GetByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.DeviceCommand, error) {
+	if err := s.checkDeviceAccess(checkerId, deviceName); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.repo.GetByDevice(deviceName, limit, offset)
+}
+
+func (s *CommandService) Acknowledge(deviceName string, ack classosbackend.CommandAck) error {
+	if ack.CommandID == "" {
+		return fmt.Errorf("%w: command id is required", classosbackend.ErrInvalidCommand)
+	}
+	if ack.Status != classosbackend.CommandStatusExecuted && ack.Status != classosbackend.CommandStatusFailed {
+		return fmt.Errorf("%w: ack status must be executed or failed", classosbackend.ErrInvalidCommand)
+	}
+	return s.repo.Acknowledge(deviceName, ack)
+}
+
+// RunExpiryLoop marks commands that were never acknowledged as expired until
+// the context is cancelled.
+func (s *CommandService) RunExpiryLoop(ctx context.Context) {
+	ticker := time.NewTicker(commandExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.repo.ExpireOverdue()
+			if err != nil {
+				logrus.WithError(err).Error("Failed to expire overdue commands")
+				continue
+			}
+			if expired > 0 {
+				logrus.WithField("count", expired).Info("Expired unacknowledged commands")
+			}
+		}
+	}
+}
@@ -1,34 +1,205 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
 
+const enrollmentCodeTTL = 24 * time.Hour
+
+var (
+	ErrInvalidEnrollmentCode = errors.New("enrollment code is invalid, expired or already used")
+	ErrDeviceUnauthorized    = errors.New("device is not enrolled or its credential is invalid")
+)
+
 type DeviceService struct {
-	repo repository.Device
+	repo         repository.Device
+	hub          *AgentHub
+	auditService *AuditService
 }
 
-func NewDeviceService(repo repository.Device) *DeviceService {
-	return &DeviceService{repo: repo}
+func NewDeviceService(repo repository.Device, hub *AgentHub, auditService *AuditService) *DeviceService {
+	return &DeviceService{repo: repo, hub: hub, auditService: auditService}
 }
 
 func (s *DeviceService) UpsertDeviceStatus(device classosbackend.DeviceStatus) error {
 	return s.repo.UpsertDeviceStatus(device)
 }
 
-func (s *DeviceService) GetAllDevices() ([]classosbackend.DeviceStatus, error) {
-	return s.repo.GetAllDevices()
+func (s *DeviceService) GetAllDevices(checkerId int) ([]classosbackend.DeviceStatus, error) {
+	return s.repo.GetAllDevices(checkerId)
 }
 
-func (s *DeviceService) GetOnlineDevices() ([]classosbackend.DeviceStatus, error) {
-	return s.repo.GetOnlineDevices()
+func (s *DeviceService) GetOnlineDevices(checkerId int) ([]classosbackend.DeviceStatus, error) {
+	return s.repo.GetOnlineDevices(checkerId)
 }
 
-func (s *DeviceService) GetDeviceByName(deviceName string) (classosbackend.DeviceStatus, error) {
-	return s.repo.GetDeviceByName(deviceName)
+func (s *DeviceService) GetDeviceByName(checkerId int, deviceName string) (classosbackend.DeviceStatus, error) {
+	return s.repo.GetDeviceByName(checkerId, deviceName)
 }
 
-func (s *DeviceService) DeleteDevice(deviceName string) error {
+func (s *DeviceService) DeleteDevice(actor classosbackend.Actor, deviceName string) (err error) {
+	event := deviceEvent(classosbackend.AuditDeviceDelete, deviceName)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
 	return s.repo.DeleteDevice(deviceName)
 }
+
+// CreateEnrollmentCode issues a code for a new device or, with a device name,
+// for re-enrolling that device.
+func (s *DeviceService) CreateEnrollmentCode(checkerId int, input classosbackend.CreateEnrollmentCodeInput) (classosbackend.EnrollmentCode, error) {
+	code := classosbackend.EnrollmentCode{
+		Code:      generateEnrollmentCode(),
+		ExpiresAt: time.Now().Add(enrollmentCodeTTL),
+	}
+	if input.DeviceName != nil {
+		if deviceName := strings.TrimSpace(*input.DeviceName); deviceName != "" {
+			code.DeviceName = &deviceName
+		}
+	}
+
+	if err := s.repo.CreateEnrollmentCode(hashSecret(normalizeEnrollmentCode(code.Code)), code.DeviceName, checkerId, code.ExpiresAt); err != nil {
+		return classosbackend.EnrollmentCode{}, fmt.Errorf("failed to store enrollment code: %w", err)
+	}
+
+	return code, nil
+}
+
+func (s *DeviceService) EnrollDevice(input classosbackend.EnrollDeviceInput) (classosbackend.DeviceCredential, error) {
+	deviceName := strings.TrimSpace(input.DeviceName)
+	if deviceName == "" {
+		return classosbackend.DeviceCredential{}, errors.New("device name is required")
+	}
+
+	credential := generateSecret(32)
+	err := s.repo.EnrollDevice(hashSecret(normalizeEnrollmentCode(input.Code)), deviceName, hashSecret(credential))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.DeviceCredential{}, ErrInvalidEnrollmentCode
+		}
+		if errors.Is(err, classosbackend.ErrDeviceEnrolled) {
+			return classosbackend.DeviceCredential{}, err
+		}
+		return classosbackend.DeviceCredential{}, fmt.Errorf("failed to enroll device: %w", err)
+	}
+
+	return classosbackend.DeviceCredential{
+		DeviceName: deviceName,
+		Credential: credential,
+	}, nil
+}
+
+// AuthenticateDevice checks the credential an agent presents when it opens
+// the WebSocket channel.
+func (s *DeviceService) AuthenticateDevice(deviceName, credential string) error {
+	if deviceName == "" || credential == "" {
+		return ErrDeviceUnauthorized
+	}
+
+	device, err := s.repo.GetEnrolledDevice(deviceName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDeviceUnauthorized
+		}
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+
+	if device.RevokedAt != nil {
+		return ErrDeviceUnauthorized
+	}
+
+	if subtle.ConstantTimeCompare([]byte(device.CredentialHash), []byte(hashSecret(credential))) != 1 {
+		return ErrDeviceUnauthorized
+	}
+
+	return s.repo.TouchEnrolledDevice(deviceName)
+}
+
+func (s *DeviceService) GetEnrolledDevices() ([]classosbackend.EnrolledDevice, error) {
+	return s.repo.GetEnrolledDevices()
+}
+
+// RevokeDevice invalidates the device credential and drops its live
+// connection, so the agent has to be enrolled again.
+func (s *DeviceService) RevokeDevice(actor classosbackend.Actor, deviceName string) (err error) {
+	event := deviceEvent(classosbackend.AuditDeviceRevoke, deviceName)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	if err := s.repo.RevokeDevice(deviceName); err != nil {
+		return err
+	}
+
+	s.hub.Disconnect(deviceName)
+	return nil
+}
+
+func (s *DeviceService) SetDeviceRoom(actor classosbackend.Actor, deviceName string, room *string) (err error) {
+	if room != nil {
+		trimmed := strings.TrimSpace(*room)
+		if trimmed == "" {
+			room = nil
+		} else {
+			room = &trimmed
+		}
+	}
+
+	event := deviceEvent(classosbackend.AuditDeviceRoomChange, deviceName)
+	if device, err := s.repo.GetEnrolledDevice(deviceName); err == nil {
+		event.Changes.Set("room", stringOrNil(device.Room), stringOrNil(room))
+	}
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	return s.repo.SetDeviceRoom(deviceName, room)
+}
+
+func deviceEvent(action, deviceName string) classosbackend.AuditEvent {
+	return classosbackend.AuditEvent{
+		Action:     action,
+		TargetType: classosbackend.AuditTargetDevice,
+		TargetID:   deviceName,
+		TargetName: deviceName,
+		Changes:    classosbackend.AuditChanges{},
+	}
+}
+
+func generateSecret(size int) string {
+	buf := make([]byte, size)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// generateEnrollmentCode returns a short code that is easy to type on a
+// classroom machine, e.g. "K7QF-2MZD-XR4A".
+func generateEnrollmentCode() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)[:12]
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12]
+}
+
+func normalizeEnrollmentCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func stringOrNil(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
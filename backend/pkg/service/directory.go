@@ -0,0 +1,69 @@
+package service
+
+import (
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Directory is the account store that users and groups are mirrored to.
+// ADService talks to Active Directory; MemoryDirectory keeps everything in
+// process for tests and for running without a domain controller.
+type Directory interface {
+	TestConnection() error
+
+	CreateUser(user ADUser, password, groupName string) error
+	UpdateUser(username string, updates ADUser, groupName string) error
+	DeleteUser(username string) error
+	ChangeUserPassword(username, newPassword string) error
+	SetUserEnabled(username string, enabled bool) error
+	ListUsers() ([]ADUser, error)
+
+	CreateGroup(group ADGroup) error
+	UpdateGroup(groupName string, updates ADGroup) error
+	DeleteGroup(groupName string) error
+	ListGroups() ([]ADGroup, error)
+
+	AddUserToGroup(username, groupName string) error
+	MoveUserToAnotherGroup(username, groupName string) error
+	RemoveUserFromGroup(username, groupName string) error
+}
+
+// NewDirectory returns AD when it is configured. Otherwise users and groups
+// are managed in the database alone (DB-only mode), mirrored to an in-memory
+// directory loaded from the database so that it agrees with it from the
+// start.
+func NewDirectory(adService *ADService, repo repository.DirectorySync) Directory {
+	if adService.Enabled() {
+		return adService
+	}
+	logrus.Println("AD is not configured, working in DB-only mode")
+
+	directory := NewMemoryDirectory()
+
+	groups, err := repo.GetGroups()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to load groups into the in-memory directory")
+		return directory
+	}
+	for _, group := range groups {
+		directory.CreateGroup(ADGroup{Name: group.Name})
+	}
+
+	users, err := repo.GetUsers()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to load users into the in-memory directory")
+		return directory
+	}
+	for _, user := range users {
+		// Users without a group, such as the admins, are not mirrored.
+		groups := dbGroupNames(user)
+		if len(groups) == 0 {
+			continue
+		}
+		directory.CreateUser(ADUser{SamAccountName: user.Username, DisplayName: user.Name}, "", groups[0])
+		for _, group := range groups[1:] {
+			directory.AddUserToGroup(user.Username, group)
+		}
+	}
+	return directory
+}
@@ -0,0 +1,557 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	directoryWorkerInterval  = 15 * time.Second
+	directoryCleanupInterval = time.Hour
+	directoryStaleAfter      = 5 * time.Minute
+	directoryRetryBase       = 30 * time.Second
+	directoryRetryMax        = time.Hour
+	directoryClaimBatch      = 20
+	directoryRetention       = 30 * 24 * time.Hour
+)
+
+// directoryStep is one AD change of an operation. Steps run again or are
+// undone by the worker from the journaled payload alone.
+type directoryStep struct {
+	name string
+	do   func(dir Directory, p classosbackend.DirectoryPayload) error
+	undo func(dir Directory, p classosbackend.DirectoryPayload) error
+}
+
+// A directory saga changes AD in its before steps, then writes the database,
+// then runs its after steps. A failure up to the database write undoes the
+// before steps that completed and the caller gets the error. Once the write
+// is committed the change stands, and after steps are retried with backoff
+// until they succeed or run out of attempts.
+type directorySaga struct {
+	before []directoryStep
+	after  []directoryStep
+	// batch sagas have a single after step per action of the payload.
+	batch bool
+}
+
+// afterSteps are the steps run once the database write is committed.
+func (s directorySaga) afterSteps(p classosbackend.DirectoryPayload) []directoryStep {
+	if !s.batch {
+		return s.after
+	}
+	steps := make([]directoryStep, len(p.Actions))
+	for i, action := range p.Actions {
+		action := action
+		target := action.Username
+		if target == "" {
+			target = action.GroupName
+		}
+		steps[i] = directoryStep{
+			name: action.Kind + " " + target,
+			do: func(dir Directory, _ classosbackend.DirectoryPayload) error {
+				return runDirectoryAction(dir, action)
+			},
+		}
+	}
+	return steps
+}
+
+var directorySagas = map[string]directorySaga{
+	classosbackend.DirectoryUserCreate: {
+		before: []directoryStep{{name: "create AD user", do: adCreateUser, undo: adDeleteUser}},
+	},
+	classosbackend.DirectoryUserUpdate: {
+		before: []directoryStep{
+			{name: "update AD user", do: adUpdateUser, undo: adRestoreUser},
+			{name: "set AD password", do: adSetPassword},
+		},
+	},
+	classosbackend.DirectoryUserDelete: {
+		after: []directoryStep{{name: "delete AD user", do: adDeleteUser}},
+	},
+	// The database decides whether a user may sign in; AD follows.
+	classosbackend.DirectoryUserDisable: {
+		after: []directoryStep{{name: "disable AD user", do: adDisableUser}},
+	},
+	classosbackend.DirectoryUserEnable: {
+		after: []directoryStep{{name: "enable AD user", do: adEnableUser}},
+	},
+	classosbackend.DirectoryGroupCreate: {
+		before: []directoryStep{{name: "create AD group", do: adCreateGroup, undo: adDeleteGroup}},
+	},
+	classosbackend.DirectoryGroupUpdate: {
+		before: []directoryStep{{name: "rename AD group", do: adRenameGroup, undo: adRestoreGroupName}},
+	},
+	classosbackend.DirectoryGroupDelete: {
+		after: []directoryStep{{name: "delete AD group", do: adDeleteGroup}},
+	},
+	classosbackend.DirectoryGroupMemberAdd: {
+		before: []directoryStep{{name: "add AD group member", do: adAddGroupMember, undo: adRemoveGroupMember}},
+	},
+	classosbackend.DirectoryGroupMemberRemove: {
+		before: []directoryStep{{name: "remove AD group member", do: adRemoveGroupMember, undo: adAddGroupMember}},
+	},
+	classosbackend.DirectoryRolloverApply:  {batch: true},
+	classosbackend.DirectoryRolloverRevert: {batch: true},
+}
+
+// DirectoryJournal runs directory operations and keeps retrying the ones that
+// did not finish. After DIRECTORY_OP_MAX_ATTEMPTS failed attempts an
+// operation is marked failed and waits for an admin to retry it.
+type DirectoryJournal struct {
+	repo         repository.Directory
+	directory    Directory
+	auditService *AuditService
+	maxAttempts  int
+}
+
+func NewDirectoryJournal(repo repository.Directory, directory Directory, auditService *AuditService) *DirectoryJournal {
+	return &DirectoryJournal{
+		repo:         repo,
+		directory:    directory,
+		auditService: auditService,
+		maxAttempts:  envInt("DIRECTORY_OP_MAX_ATTEMPTS", 8),
+	}
+}
+
+// Run journals the operation and executes it inline. write makes the
+// database change in the transaction that also records it in the journal;
+// it may set op.TargetID. Run fails only when the change did not happen.
+func (j *DirectoryJournal) Run(actor classosbackend.Actor, op classosbackend.DirectoryOperation, write func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error) error {
+	saga, ok := directorySagas[op.Kind]
+	if !ok {
+		return fmt.Errorf("unknown directory operation %q", op.Kind)
+	}
+
+	now := time.Now()
+	if actor.ID != 0 {
+		actorId := actor.ID
+		op.ActorID = &actorId
+	}
+	op.Status = classosbackend.DirectoryOpRunning
+	op.Phase = classosbackend.DirectoryPhaseForward
+	op.CreatedAt = now
+	op.UpdatedAt = now
+
+	id, err := j.repo.Create(op)
+	if err != nil {
+		return fmt.Errorf("failed to journal directory operation: %w", err)
+	}
+	op.ID = id
+
+	for i, step := range saga.before {
+		if err := step.do(j.directory, op.Payload); err != nil {
+			err = fmt.Errorf("%s: %w", step.name, err)
+			j.compensate(&op, saga, i, err)
+			return err
+		}
+		op.Step = i + 1
+		j.save(&op)
+	}
+
+	if err := j.write(&op, saga, write); err != nil {
+		j.compensate(&op, saga, len(saga.before), err)
+		return err
+	}
+
+	j.forward(&op, saga)
+	return nil
+}
+
+func (j *DirectoryJournal) write(op *classosbackend.DirectoryOperation, saga directorySaga, write func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error) error {
+	tx, err := j.repo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	next := *op
+	if err := write(tx, &next); err != nil {
+		return err
+	}
+
+	next.Step = len(saga.before) + 1
+	next.UpdatedAt = time.Now()
+	if err := j.repo.SaveWithTx(tx, next); err != nil {
+		return fmt.Errorf("failed to journal directory operation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	*op = next
+	return nil
+}
+
+// forward runs the after steps that are left.
+func (j *DirectoryJournal) forward(op *classosbackend.DirectoryOperation, saga directorySaga) {
+	first := len(saga.before) + 1
+	after := saga.afterSteps(op.Payload)
+	for op.Step-first < len(after) {
+		step := after[op.Step-first]
+		if err := step.do(j.directory, op.Payload); err != nil {
+			j.retryLater(op, classosbackend.DirectoryOpPending, fmt.Errorf("%s: %w", step.name, err))
+			return
+		}
+		op.Step++
+		j.save(op)
+	}
+
+	op.Status = classosbackend.DirectoryOpSucceeded
+	op.NextAttemptAt = nil
+	j.save(op)
+}
+
+// compensate starts undoing the first done before steps. The step that
+// failed is not undone: it did not happen, and undoing it could remove an
+// object that existed before.
+func (j *DirectoryJournal) compensate(op *classosbackend.DirectoryOperation, saga directorySaga, done int, cause error) {
+	op.Phase = classosbackend.DirectoryPhaseCompensate
+	op.Step = done
+	op.LastError = cause.Error()
+	j.undo(op, saga)
+}
+
+func (j *DirectoryJournal) undo(op *classosbackend.DirectoryOperation, saga directorySaga) {
+	for op.Step > 0 {
+		step := saga.before[op.Step-1]
+		if step.undo != nil {
+			if err := step.undo(j.directory, op.Payload); err != nil {
+				j.retryLater(op, classosbackend.DirectoryOpCompensating, fmt.Errorf("undo %s: %w", step.name, err))
+				return
+			}
+		}
+		op.Step--
+		j.save(op)
+	}
+
+	op.Status = classosbackend.DirectoryOpCompensated
+	op.NextAttemptAt = nil
+	j.save(op)
+}
+
+func (j *DirectoryJournal) retryLater(op *classosbackend.DirectoryOperation, status string, err error) {
+	op.Attempts++
+	op.LastError = err.Error()
+
+	fields := logrus.Fields{
+		"operation": op.ID,
+		"kind":      op.Kind,
+		"target":    op.TargetName,
+		"attempts":  op.Attempts,
+	}
+
+	if op.Attempts >= j.maxAttempts {
+		op.Status = classosbackend.DirectoryOpFailed
+		op.NextAttemptAt = nil
+		logrus.WithError(err).WithFields(fields).Error("Directory operation failed, manual retry needed")
+	} else {
+		next := time.Now().Add(directoryBackoff(op.Attempts))
+		op.Status = status
+		op.NextAttemptAt = &next
+		logrus.WithError(err).WithFields(fields).Warn("Directory operation step failed, will retry")
+	}
+	j.save(op)
+}
+
+func directoryBackoff(attempts int) time.Duration {
+	delay := directoryRetryBase
+	for i := 1; i < attempts && delay < directoryRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > directoryRetryMax {
+		delay = directoryRetryMax
+	}
+	return delay
+}
+
+func (j *DirectoryJournal) save(op *classosbackend.DirectoryOperation) {
+	op.UpdatedAt = time.Now()
+	if err := j.repo.Save(*op); err != nil {
+		logrus.WithError(err).WithField("operation", op.ID).Error("Failed to save directory operation progress")
+	}
+}
+
+// resume continues a claimed operation where it stopped. An operation that
+// was interrupted before its database write is undone.
+func (j *DirectoryJournal) resume(op *classosbackend.DirectoryOperation) {
+	saga, ok := directorySagas[op.Kind]
+	if !ok {
+		op.Status = classosbackend.DirectoryOpFailed
+		op.LastError = fmt.Sprintf("unknown directory operation %q", op.Kind)
+		j.save(op)
+		return
+	}
+
+	switch {
+	case op.Phase == classosbackend.DirectoryPhaseCompensate:
+		j.undo(op, saga)
+	case op.Step <= len(saga.before):
+		op.Phase = classosbackend.DirectoryPhaseCompensate
+		if op.LastError == "" {
+			op.LastError = "interrupted before the database write"
+		}
+		j.undo(op, saga)
+	default:
+		j.forward(op, saga)
+	}
+}
+
+// RunRetryLoop retries due operations and picks up interrupted ones until
+// the context is cancelled.
+func (j *DirectoryJournal) RunRetryLoop(ctx context.Context) {
+	ticker := time.NewTicker(directoryWorkerInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(directoryCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			ops, err := j.repo.ClaimDue(now, now.Add(-directoryStaleAfter), directoryClaimBatch)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to claim directory operations")
+				continue
+			}
+			for i := range ops {
+				j.resume(&ops[i])
+			}
+		case <-cleanup.C:
+			deleted, err := j.repo.DeleteFinished(time.Now().Add(-directoryRetention))
+			if err != nil {
+				logrus.WithError(err).Error("Failed to clean up directory operations")
+				continue
+			}
+			if deleted > 0 {
+				logrus.WithField("count", deleted).Info("Cleaned up finished directory operations")
+			}
+		}
+	}
+}
+
+func (j *DirectoryJournal) GetAll(filter classosbackend.DirectoryOperationFilter) ([]classosbackend.DirectoryOperation, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	return j.repo.GetAll(filter)
+}
+
+func (j *DirectoryJournal) Count(filter classosbackend.DirectoryOperationFilter) (int, error) {
+	return j.repo.Count(filter)
+}
+
+func (j *DirectoryJournal) GetById(id int64) (classosbackend.DirectoryOperation, error) {
+	return j.repo.GetById(id)
+}
+
+// Retry gives a failed operation a fresh set of attempts and runs it at
+// once, continuing in the direction it was going.
+func (j *DirectoryJournal) Retry(actor classosbackend.Actor, id int64) (op classosbackend.DirectoryOperation, err error) {
+	defer func() {
+		j.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditDirectoryRetry,
+			TargetType: classosbackend.AuditTargetDirectoryOp,
+			TargetID:   strconv.FormatInt(id, 10),
+			TargetName: op.Kind + " " + op.TargetName,
+		}, err)
+	}()
+
+	op, err = j.repo.ClaimFailed(id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		if op, err = j.repo.GetById(id); err != nil {
+			return op, err
+		}
+		return op, fmt.Errorf("%w: operation is %s", classosbackend.ErrDirectoryOpNotFailed, op.Status)
+	}
+	if err != nil {
+		return op, err
+	}
+
+	j.resume(&op)
+	return op, nil
+}
+
+func adUserFromPayload(p classosbackend.DirectoryPayload) ADUser {
+	return ADUser{
+		SamAccountName: p.Username,
+		DisplayName:    p.DisplayName,
+		EmailAddress:   p.Username + "@" + os.Getenv("AD_DOMAIN"),
+		Enabled:        true,
+	}
+}
+
+func adCreateUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	return dir.CreateUser(adUserFromPayload(p), p.Password, p.GroupName)
+}
+
+func adDeleteUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	err := dir.DeleteUser(p.Username)
+	if errors.Is(err, ErrADUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+// adUpdateUser renames the user and moves them from their previous primary
+// group to the new one; their other groups are left alone.
+func adUpdateUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	if p.DisplayName != "" {
+		if err := dir.UpdateUser(p.Username, ADUser{DisplayName: p.DisplayName}, ""); err != nil {
+			return err
+		}
+	}
+	if p.GroupName == "" || strings.EqualFold(p.GroupName, p.PreviousGroupName) {
+		return nil
+	}
+	return moveDirectoryUser(dir, p.Username, p.GroupName, p.PreviousGroupName)
+}
+
+func adRestoreUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	if p.DisplayName != "" {
+		if err := dir.UpdateUser(p.Username, ADUser{DisplayName: p.PreviousDisplayName}, ""); err != nil {
+			return err
+		}
+	}
+	if p.GroupName == "" || strings.EqualFold(p.GroupName, p.PreviousGroupName) {
+		return nil
+	}
+	if p.PreviousGroupName == "" {
+		return dir.RemoveUserFromGroup(p.Username, p.GroupName)
+	}
+	return moveDirectoryUser(dir, p.Username, p.PreviousGroupName, p.GroupName)
+}
+
+// moveDirectoryUser adds the user to a group before taking them out of the
+// other one, so that a failure never leaves them in neither.
+func moveDirectoryUser(dir Directory, username, to, from string) error {
+	if err := dir.AddUserToGroup(username, to); err != nil && !alreadyInDirectory(err) {
+		return err
+	}
+	if from == "" {
+		return nil
+	}
+	return dir.RemoveUserFromGroup(username, from)
+}
+
+func adAddGroupMember(dir Directory, p classosbackend.DirectoryPayload) error {
+	err := dir.AddUserToGroup(p.Username, p.GroupName)
+	if alreadyInDirectory(err) {
+		return nil
+	}
+	return err
+}
+
+func adRemoveGroupMember(dir Directory, p classosbackend.DirectoryPayload) error {
+	return dir.RemoveUserFromGroup(p.Username, p.GroupName)
+}
+
+// adSetPassword has no undo: the old password is not known. It runs last
+// before the database write, so only a failing write leaves AD ahead.
+func adSetPassword(dir Directory, p classosbackend.DirectoryPayload) error {
+	if !p.PasswordChanged {
+		return nil
+	}
+	if p.Password == "" {
+		return fmt.Errorf("password is only available while the operation runs inline")
+	}
+	return dir.ChangeUserPassword(p.Username, p.Password)
+}
+
+func adDisableUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	err := dir.SetUserEnabled(p.Username, false)
+	if errors.Is(err, ErrADUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+func adEnableUser(dir Directory, p classosbackend.DirectoryPayload) error {
+	err := dir.SetUserEnabled(p.Username, true)
+	if errors.Is(err, ErrADUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+func adCreateGroup(dir Directory, p classosbackend.DirectoryPayload) error {
+	return dir.CreateGroup(ADGroup{Name: p.GroupName, Description: "Created by ClassOS"})
+}
+
+func adDeleteGroup(dir Directory, p classosbackend.DirectoryPayload) error {
+	err := dir.DeleteGroup(p.GroupName)
+	if errors.Is(err, ErrADGroupNotFound) {
+		return nil
+	}
+	return err
+}
+
+func adRenameGroup(dir Directory, p classosbackend.DirectoryPayload) error {
+	if p.GroupName == "" || p.GroupName == p.PreviousGroupName {
+		return nil
+	}
+	return dir.UpdateGroup(p.PreviousGroupName, ADGroup{Name: p.GroupName})
+}
+
+func adRestoreGroupName(dir Directory, p classosbackend.DirectoryPayload) error {
+	if p.GroupName == "" || p.GroupName == p.PreviousGroupName {
+		return nil
+	}
+	err := dir.UpdateGroup(p.GroupName, ADGroup{Name: p.PreviousGroupName})
+	if errors.Is(err, ErrADGroupNotFound) {
+		return nil
+	}
+	return err
+}
+
+// runDirectoryAction makes one change of a batch operation. It may run
+// again after a failure, so changes that are already made count as done.
+func runDirectoryAction(dir Directory, action classosbackend.DirectoryAction) error {
+	var err error
+	switch action.Kind {
+	case classosbackend.DirectoryActionGroupRename:
+		err = dir.UpdateGroup(action.PreviousGroupName, ADGroup{Name: action.GroupName})
+		if errors.Is(err, ErrADGroupNotFound) {
+			// Renamed by an earlier attempt.
+			err = nil
+		}
+		return err
+	case classosbackend.DirectoryActionUserMove:
+		err = moveDirectoryUser(dir, action.Username, action.GroupName, action.PreviousGroupName)
+	case classosbackend.DirectoryActionUserAdd:
+		err = dir.AddUserToGroup(action.Username, action.GroupName)
+	case classosbackend.DirectoryActionUserRemove:
+		err = dir.RemoveUserFromGroup(action.Username, action.GroupName)
+	case classosbackend.DirectoryActionUserDisable:
+		err = dir.SetUserEnabled(action.Username, false)
+	case classosbackend.DirectoryActionUserEnable:
+		err = dir.SetUserEnabled(action.Username, true)
+	default:
+		return fmt.Errorf("unknown directory action %q", action.Kind)
+	}
+
+	// Users missing from AD are reported by the directory sync instead.
+	if errors.Is(err, ErrADUserNotFound) || alreadyInDirectory(err) {
+		return nil
+	}
+	return err
+}
+
+func alreadyInDirectory(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.LDAPResultAttributeOrValueExists)
+}
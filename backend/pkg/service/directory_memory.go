@@ -0,0 +1,260 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryDirectory is a Directory kept in process. It behaves like AD where
+// the services can tell: names are case-insensitive, missing objects give
+// ErrADUserNotFound and ErrADGroupNotFound, and users can only join groups
+// that exist. Passwords are not kept.
+type MemoryDirectory struct {
+	mu     sync.Mutex
+	users  map[string]ADUser
+	groups map[string]ADGroup
+}
+
+func NewMemoryDirectory() *MemoryDirectory {
+	return &MemoryDirectory{
+		users:  make(map[string]ADUser),
+		groups: make(map[string]ADGroup),
+	}
+}
+
+func directoryKey(name string) string {
+	return strings.ToLower(name)
+}
+
+func (d *MemoryDirectory) TestConnection() error {
+	return nil
+}
+
+func (d *MemoryDirectory) CreateUser(user ADUser, password, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(user.SamAccountName)
+	if _, ok := d.users[key]; ok {
+		return fmt.Errorf("failed to create user in AD: user %s already exists", user.SamAccountName)
+	}
+	group, ok := d.groups[directoryKey(groupName)]
+	if !ok {
+		return fmt.Errorf("failed user to add to a group: %w: %s", ErrADGroupNotFound, groupName)
+	}
+
+	user.Password = ""
+	user.Groups = []string{group.Name}
+	d.users[key] = user
+	return nil
+}
+
+func (d *MemoryDirectory) UpdateUser(username string, updates ADUser, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(username)
+	user, ok := d.users[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+
+	if updates.DisplayName != "" {
+		user.DisplayName = updates.DisplayName
+	}
+	if groupName != "" {
+		group, ok := d.groups[directoryKey(groupName)]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
+		}
+		user.Groups = []string{group.Name}
+	}
+
+	d.users[key] = user
+	return nil
+}
+
+func (d *MemoryDirectory) DeleteUser(username string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(username)
+	if _, ok := d.users[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	delete(d.users, key)
+	return nil
+}
+
+func (d *MemoryDirectory) ChangeUserPassword(username, newPassword string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.users[directoryKey(username)]; !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	return nil
+}
+
+func (d *MemoryDirectory) SetUserEnabled(username string, enabled bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(username)
+	user, ok := d.users[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	user.Enabled = enabled
+	d.users[key] = user
+	return nil
+}
+
+func (d *MemoryDirectory) ListUsers() ([]ADUser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	users := make([]ADUser, 0, len(d.users))
+	for _, user := range d.users {
+		user.Groups = append([]string(nil), user.Groups...)
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].SamAccountName < users[j].SamAccountName })
+	return users, nil
+}
+
+func (d *MemoryDirectory) CreateGroup(group ADGroup) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(group.Name)
+	if _, ok := d.groups[key]; ok {
+		return fmt.Errorf("failed to create group in AD: group %s already exists", group.Name)
+	}
+	d.groups[key] = group
+	return nil
+}
+
+// UpdateGroup renames a group; its members follow.
+func (d *MemoryDirectory) UpdateGroup(groupName string, updates ADGroup) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	oldKey := directoryKey(groupName)
+	group, ok := d.groups[oldKey]
+	if !ok {
+		return fmt.Errorf("group not found: %w: %s", ErrADGroupNotFound, groupName)
+	}
+
+	newKey := directoryKey(updates.Name)
+	if _, taken := d.groups[newKey]; taken && newKey != oldKey {
+		return fmt.Errorf("failed to update group in AD: group %s already exists", updates.Name)
+	}
+
+	oldName := group.Name
+	group.Name = updates.Name
+	delete(d.groups, oldKey)
+	d.groups[newKey] = group
+
+	d.replaceMembership(oldName, group.Name)
+	return nil
+}
+
+func (d *MemoryDirectory) DeleteGroup(groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(groupName)
+	group, ok := d.groups[key]
+	if !ok {
+		return fmt.Errorf("group not found: %w: %s", ErrADGroupNotFound, groupName)
+	}
+	delete(d.groups, key)
+
+	d.replaceMembership(group.Name, "")
+	return nil
+}
+
+// replaceMembership renames a group in every membership list, or removes it
+// when to is empty.
+func (d *MemoryDirectory) replaceMembership(from, to string) {
+	for key, user := range d.users {
+		groups := make([]string, 0, len(user.Groups))
+		for _, name := range user.Groups {
+			switch {
+			case !strings.EqualFold(name, from):
+				groups = append(groups, name)
+			case to != "":
+				groups = append(groups, to)
+			}
+		}
+		user.Groups = groups
+		d.users[key] = user
+	}
+}
+
+func (d *MemoryDirectory) ListGroups() ([]ADGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	groups := make([]ADGroup, 0, len(d.groups))
+	for _, group := range d.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (d *MemoryDirectory) AddUserToGroup(username, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(username)
+	user, ok := d.users[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	group, ok := d.groups[directoryKey(groupName)]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
+	}
+
+	for _, name := range user.Groups {
+		if strings.EqualFold(name, group.Name) {
+			return nil
+		}
+	}
+	user.Groups = append(user.Groups, group.Name)
+	d.users[key] = user
+	return nil
+}
+
+func (d *MemoryDirectory) MoveUserToAnotherGroup(username, groupName string) error {
+	return d.UpdateUser(username, ADUser{}, groupName)
+}
+
+func (d *MemoryDirectory) RemoveUserFromGroup(username, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := directoryKey(username)
+	user, ok := d.users[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	if _, ok := d.groups[directoryKey(groupName)]; !ok {
+		return fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
+	}
+
+	groups := user.Groups[:0:0]
+	for _, name := range user.Groups {
+		if !strings.EqualFold(name, groupName) {
+			groups = append(groups, name)
+		}
+	}
+	user.Groups = groups
+	d.users[key] = user
+	return nil
+}
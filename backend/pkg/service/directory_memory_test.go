@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestDirectory(t *testing.T, groups ...string) *MemoryDirectory {
+	t.Helper()
+	dir := NewMemoryDirectory()
+	for _, name := range groups {
+		if err := dir.CreateGroup(ADGroup{Name: name}); err != nil {
+			t.Fatalf("CreateGroup(%s): %v", name, err)
+		}
+	}
+	return dir
+}
+
+func directoryUser(t *testing.T, dir *MemoryDirectory, username string) (ADUser, bool) {
+	t.Helper()
+	users, err := dir.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	for _, user := range users {
+		if user.SamAccountName == username {
+			return user, true
+		}
+	}
+	return ADUser{}, false
+}
+
+func TestMemoryDirectoryCreateUser(t *testing.T) {
+	dir := newTestDirectory(t, "10A")
+
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov", DisplayName: "Ivanov"}, "secret", "10a"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	user, ok := directoryUser(t, dir, "ivanov")
+	if !ok {
+		t.Fatal("created user is not listed")
+	}
+	if user.DisplayName != "Ivanov" {
+		t.Errorf("DisplayName = %q, want %q", user.DisplayName, "Ivanov")
+	}
+	if user.Password != "" {
+		t.Error("the password is kept")
+	}
+	if want := []string{"10A"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups = %v, want %v", user.Groups, want)
+	}
+}
+
+func TestMemoryDirectoryCreateUserNeedsGroup(t *testing.T) {
+	dir := newTestDirectory(t)
+
+	err := dir.CreateUser(ADUser{SamAccountName: "ivanov"}, "", "10A")
+	if !errors.Is(err, ErrADGroupNotFound) {
+		t.Fatalf("CreateUser = %v, want ErrADGroupNotFound", err)
+	}
+	if _, ok := directoryUser(t, dir, "ivanov"); ok {
+		t.Error("user was created without a group")
+	}
+}
+
+func TestMemoryDirectoryRejectsDuplicates(t *testing.T) {
+	dir := newTestDirectory(t, "10A")
+
+	if err := dir.CreateGroup(ADGroup{Name: "10a"}); err == nil {
+		t.Error("CreateGroup accepted a group differing only in case")
+	}
+
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov"}, "", "10A"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := dir.CreateUser(ADUser{SamAccountName: "IVANOV"}, "", "10A"); err == nil {
+		t.Error("CreateUser accepted a user differing only in case")
+	}
+}
+
+func TestMemoryDirectoryRenameGroup(t *testing.T) {
+	dir := newTestDirectory(t, "10A", "11A")
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov"}, "", "10A"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := dir.UpdateGroup("10a", ADGroup{Name: "11A"}); err == nil {
+		t.Error("UpdateGroup renamed onto an existing group")
+	}
+	if err := dir.UpdateGroup("10a", ADGroup{Name: "11B"}); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+
+	groups, _ := dir.ListGroups()
+	if got, want := groups, []ADGroup{{Name: "11A"}, {Name: "11B"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+	user, _ := directoryUser(t, dir, "ivanov")
+	if want := []string{"11B"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("member groups = %v, want %v", user.Groups, want)
+	}
+
+	if err := dir.UpdateGroup("10A", ADGroup{Name: "12A"}); !errors.Is(err, ErrADGroupNotFound) {
+		t.Errorf("UpdateGroup of a renamed group = %v, want ErrADGroupNotFound", err)
+	}
+}
+
+func TestMemoryDirectoryUpdateUser(t *testing.T) {
+	dir := newTestDirectory(t, "10A", "10B")
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov", DisplayName: "Ivanov"}, "", "10A"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := dir.UpdateUser("IVANOV", ADUser{DisplayName: "Ivanov Ivan"}, "10B"); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	user, _ := directoryUser(t, dir, "ivanov")
+	if user.DisplayName != "Ivanov Ivan" {
+		t.Errorf("DisplayName = %q, want %q", user.DisplayName, "Ivanov Ivan")
+	}
+	if want := []string{"10B"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups = %v, want %v", user.Groups, want)
+	}
+
+	if err := dir.UpdateUser("petrov", ADUser{DisplayName: "Petrov"}, ""); !errors.Is(err, ErrADUserNotFound) {
+		t.Errorf("UpdateUser of a missing user = %v, want ErrADUserNotFound", err)
+	}
+}
+
+func TestMemoryDirectoryDelete(t *testing.T) {
+	dir := newTestDirectory(t, "10A", "Chess")
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov"}, "", "10A"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := dir.AddUserToGroup("ivanov", "Chess"); err != nil {
+		t.Fatalf("AddUserToGroup: %v", err)
+	}
+
+	if err := dir.DeleteGroup("chess"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	user, _ := directoryUser(t, dir, "ivanov")
+	if want := []string{"10A"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups after deleting a group = %v, want %v", user.Groups, want)
+	}
+	if err := dir.DeleteGroup("Chess"); !errors.Is(err, ErrADGroupNotFound) {
+		t.Errorf("second DeleteGroup = %v, want ErrADGroupNotFound", err)
+	}
+
+	if err := dir.DeleteUser("Ivanov"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, ok := directoryUser(t, dir, "ivanov"); ok {
+		t.Error("deleted user is still listed")
+	}
+	if err := dir.DeleteUser("ivanov"); !errors.Is(err, ErrADUserNotFound) {
+		t.Errorf("second DeleteUser = %v, want ErrADUserNotFound", err)
+	}
+}
+
+func TestMemoryDirectoryGroupMembership(t *testing.T) {
+	dir := newTestDirectory(t, "10A", "10B", "Chess")
+	if err := dir.CreateUser(ADUser{SamAccountName: "ivanov"}, "", "10A"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := dir.AddUserToGroup("ivanov", "chess"); err != nil {
+		t.Fatalf("AddUserToGroup: %v", err)
+	}
+	if err := dir.AddUserToGroup("ivanov", "Chess"); err != nil {
+		t.Fatalf("repeated AddUserToGroup: %v", err)
+	}
+	user, _ := directoryUser(t, dir, "ivanov")
+	if want := []string{"10A", "Chess"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups after adding = %v, want %v", user.Groups, want)
+	}
+
+	if err := dir.AddUserToGroup("ivanov", "Drama"); !errors.Is(err, ErrADGroupNotFound) {
+		t.Errorf("AddUserToGroup to a missing group = %v, want ErrADGroupNotFound", err)
+	}
+	if err := dir.AddUserToGroup("petrov", "Chess"); !errors.Is(err, ErrADUserNotFound) {
+		t.Errorf("AddUserToGroup of a missing user = %v, want ErrADUserNotFound", err)
+	}
+
+	if err := dir.RemoveUserFromGroup("ivanov", "CHESS"); err != nil {
+		t.Fatalf("RemoveUserFromGroup: %v", err)
+	}
+	user, _ = directoryUser(t, dir, "ivanov")
+	if want := []string{"10A"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups after removing = %v, want %v", user.Groups, want)
+	}
+
+	if err := dir.MoveUserToAnotherGroup("ivanov", "10B"); err != nil {
+		t.Fatalf("MoveUserToAnotherGroup: %v", err)
+	}
+	user, _ = directoryUser(t, dir, "ivanov")
+	if want := []string{"10B"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("Groups after moving = %v, want %v", user.Groups, want)
+	}
+}
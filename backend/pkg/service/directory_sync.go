@@ -0,0 +1,599 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// DirectorySyncService reconciles the database with the ClassOS OUs in AD.
+// Runs happen in the background, one at a time; their progress and report
+// are stored so they can be followed through the API. AD_SYNC_INTERVAL sets
+// how often a scheduled dry run happens (0 turns it off); with
+// AD_SYNC_AUTO_IMPORT=true scheduled runs also apply every fix towards the
+// database, making AD the source of truth.
+type DirectorySyncService struct {
+	repo         repository.DirectorySync
+	directory    Directory
+	auditService *AuditService
+	interval     time.Duration
+	autoImport   bool
+
+	running sync.Mutex
+}
+
+func NewDirectorySyncService(repo repository.DirectorySync, directory Directory, auditService *AuditService) *DirectorySyncService {
+	var interval time.Duration
+	if os.Getenv("AD_SYNC_INTERVAL") != "0" {
+		interval = envDuration("AD_SYNC_INTERVAL", time.Hour)
+	}
+	autoImport, _ := strconv.ParseBool(os.Getenv("AD_SYNC_AUTO_IMPORT"))
+
+	return &DirectorySyncService{
+		repo:         repo,
+		directory:    directory,
+		auditService: auditService,
+		interval:     interval,
+		autoImport:   autoImport,
+	}
+}
+
+func (s *DirectorySyncService) TestConnection() error {
+	return s.directory.TestConnection()
+}
+
+// StartSync starts a dry run that reports the drift without changing
+// anything.
+func (s *DirectorySyncService) StartSync(actor classosbackend.Actor) (classosbackend.SyncRun, error) {
+	return s.start(actor, classosbackend.SyncTriggerManual, classosbackend.SyncModeDryRun, nil)
+}
+
+// ApplySync starts a run that fixes the selected drift items. The drift is
+// read again first; items that no longer differ are reported as resolved.
+func (s *DirectorySyncService) ApplySync(actor classosbackend.Actor, input classosbackend.SyncApplyInput) (classosbackend.SyncRun, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.SyncRun{}, err
+	}
+	return s.start(actor, classosbackend.SyncTriggerManual, classosbackend.SyncModeApply, input.Fixes)
+}
+
+func (s *DirectorySyncService) GetRuns(limit, offset int) ([]classosbackend.SyncRun, error) {
+	return s.repo.GetRuns(limit, offset)
+}
+
+func (s *DirectorySyncService) CountRuns() (int, error) {
+	return s.repo.CountRuns()
+}
+
+func (s *DirectorySyncService) GetRun(id int64) (classosbackend.SyncRun, error) {
+	return s.repo.GetRun(id)
+}
+
+func (s *DirectorySyncService) start(actor classosbackend.Actor, trigger, mode string, fixes []classosbackend.SyncFix) (classosbackend.SyncRun, error) {
+	if !s.running.TryLock() {
+		return classosbackend.SyncRun{}, classosbackend.ErrSyncInProgress
+	}
+
+	run := classosbackend.SyncRun{
+		Trigger:   trigger,
+		Mode:      mode,
+		Status:    classosbackend.SyncRunRunning,
+		Phase:     classosbackend.SyncPhaseReading,
+		StartedAt: time.Now(),
+	}
+	if actor.ID != 0 {
+		actorId := actor.ID
+		run.ActorID = &actorId
+	}
+
+	id, err := s.repo.CreateRun(run)
+	if err != nil {
+		s.running.Unlock()
+		return classosbackend.SyncRun{}, fmt.Errorf("failed to create sync run: %w", err)
+	}
+	run.ID = id
+
+	go func() {
+		defer s.running.Unlock()
+		s.execute(actor, run, fixes)
+	}()
+	return run, nil
+}
+
+func (s *DirectorySyncService) execute(actor classosbackend.Actor, run classosbackend.SyncRun, fixes []classosbackend.SyncFix) {
+	state, err := s.readState()
+	if err != nil {
+		s.finish(actor, &run, err)
+		return
+	}
+
+	drift := diffDirectory(state)
+	if run.Mode == classosbackend.SyncModeDryRun {
+		run.Report.Drift = drift
+		run.Total = len(drift)
+		run.Processed = len(drift)
+		s.finish(actor, &run, nil)
+		return
+	}
+
+	if fixes == nil {
+		fixes = importFixes(drift)
+	}
+	selected := selectDrift(drift, fixes)
+
+	run.Phase = classosbackend.SyncPhaseApplying
+	run.Total = len(selected)
+	run.Report.Drift = selected
+	s.save(&run)
+
+	for i := range selected {
+		item := &run.Report.Drift[i]
+		if item.Result == "" {
+			if err := s.applyFix(state, *item); err != nil {
+				item.Result = classosbackend.SyncResultFailed
+				item.Error = err.Error()
+				run.Failed++
+			} else {
+				item.Result = classosbackend.SyncResultApplied
+				run.Applied++
+			}
+		}
+		run.Processed++
+		s.save(&run)
+	}
+
+	s.finish(actor, &run, nil)
+}
+
+func (s *DirectorySyncService) finish(actor classosbackend.Actor, run *classosbackend.SyncRun, err error) {
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Phase = classosbackend.SyncPhaseDone
+	run.Status = classosbackend.SyncRunSucceeded
+	if err != nil {
+		run.Status = classosbackend.SyncRunFailed
+		run.Error = err.Error()
+	}
+	s.save(run)
+
+	fields := logrus.Fields{
+		"run":     run.ID,
+		"mode":    run.Mode,
+		"trigger": run.Trigger,
+		"total":   run.Total,
+		"applied": run.Applied,
+		"failed":  run.Failed,
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Directory sync failed")
+	} else {
+		logrus.WithFields(fields).Info("Directory sync finished")
+	}
+
+	if run.Mode == classosbackend.SyncModeApply {
+		event := classosbackend.AuditEvent{
+			Action:     classosbackend.AuditDirectorySync,
+			TargetType: classosbackend.AuditTargetDirectorySync,
+			TargetID:   strconv.FormatInt(run.ID, 10),
+			TargetName: run.Trigger,
+			Changes:    classosbackend.AuditChanges{},
+		}
+		event.Changes.Set("applied", nil, run.Applied)
+		event.Changes.Set("failed", nil, run.Failed)
+		s.auditService.Record(actor, event, err)
+	}
+}
+
+func (s *DirectorySyncService) save(run *classosbackend.SyncRun) {
+	if err := s.repo.SaveRun(*run); err != nil {
+		logrus.WithError(err).WithField("run", run.ID).Error("Failed to save sync run progress")
+	}
+}
+
+// RunScheduleLoop starts a scheduled sync every AD_SYNC_INTERVAL until the
+// context is cancelled. A run still going on is not interrupted. In DB-only
+// mode there is no directory to sync with and the loop does not run.
+func (s *DirectorySyncService) RunScheduleLoop(ctx context.Context) {
+	if failed, err := s.repo.FailRunning(time.Now()); err != nil {
+		logrus.WithError(err).Error("Failed to close interrupted sync runs")
+	} else if failed > 0 {
+		logrus.WithField("count", failed).Warn("Closed sync runs interrupted by a restart")
+	}
+
+	if s.interval == 0 {
+		return
+	}
+	if _, ok := s.directory.(*MemoryDirectory); ok {
+		logrus.Info("No directory configured, scheduled directory sync is off")
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mode := classosbackend.SyncModeDryRun
+			if s.autoImport {
+				mode = classosbackend.SyncModeApply
+			}
+			_, err := s.start(classosbackend.Actor{}, classosbackend.SyncTriggerSchedule, mode, nil)
+			if errors.Is(err, classosbackend.ErrSyncInProgress) {
+				logrus.Info("Skipping scheduled directory sync, another run is in progress")
+			} else if err != nil {
+				logrus.WithError(err).Error("Failed to start scheduled directory sync")
+			}
+		}
+	}
+}
+
+// directoryState is both sides of the sync, indexed by lowercased name.
+type directoryState struct {
+	adUsers  map[string]ADUser
+	adGroups map[string]ADGroup
+	dbUsers  map[string]classosbackend.User
+	dbGroups map[string]classosbackend.Group
+}
+
+func (s *DirectorySyncService) readState() (directoryState, error) {
+	state := directoryState{
+		adUsers:  map[string]ADUser{},
+		adGroups: map[string]ADGroup{},
+		dbUsers:  map[string]classosbackend.User{},
+		dbGroups: map[string]classosbackend.Group{},
+	}
+
+	adGroups, err := s.directory.ListGroups()
+	if err != nil {
+		return state, err
+	}
+	for _, group := range adGroups {
+		state.adGroups[strings.ToLower(group.Name)] = group
+	}
+
+	adUsers, err := s.directory.ListUsers()
+	if err != nil {
+		return state, err
+	}
+	for _, user := range adUsers {
+		state.adUsers[strings.ToLower(user.SamAccountName)] = user
+	}
+
+	dbGroups, err := s.repo.GetGroups()
+	if err != nil {
+		return state, fmt.Errorf("failed to read groups: %w", err)
+	}
+	for _, group := range dbGroups {
+		state.dbGroups[strings.ToLower(group.Name)] = group
+	}
+
+	dbUsers, err := s.repo.GetUsers()
+	if err != nil {
+		return state, fmt.Errorf("failed to read users: %w", err)
+	}
+	for _, user := range dbUsers {
+		state.dbUsers[strings.ToLower(user.Username)] = user
+	}
+
+	return state, nil
+}
+
+// diffDirectory lists the drift sorted by ID. Database users without a group
+// are not expected in AD (admins and teachers usually live elsewhere), so
+// only users with a group are reported missing there.
+func diffDirectory(state directoryState) []classosbackend.SyncDrift {
+	drift := make([]classosbackend.SyncDrift, 0)
+	add := func(item classosbackend.SyncDrift) {
+		item.ID = classosbackend.SyncDriftID(item.Object, item.Kind, strings.ToLower(item.Name))
+		drift = append(drift, item)
+	}
+
+	for key, group := range state.adGroups {
+		if _, ok := state.dbGroups[key]; !ok {
+			add(classosbackend.SyncDrift{
+				Object: classosbackend.SyncObjectGroup,
+				Kind:   classosbackend.SyncDriftMissingInDB,
+				Name:   group.Name,
+				Fixes:  []string{classosbackend.SyncToDB},
+			})
+		}
+	}
+	for key, group := range state.dbGroups {
+		if _, ok := state.adGroups[key]; !ok {
+			add(classosbackend.SyncDrift{
+				Object: classosbackend.SyncObjectGroup,
+				Kind:   classosbackend.SyncDriftMissingInAD,
+				Name:   group.Name,
+				Fixes:  []string{classosbackend.SyncToAD},
+			})
+		}
+	}
+
+	for key, adUser := range state.adUsers {
+		adGroups := sortedGroupNames(adUser.Groups)
+		dbUser, ok := state.dbUsers[key]
+		if !ok {
+			add(classosbackend.SyncDrift{
+				Object:  classosbackend.SyncObjectUser,
+				Kind:    classosbackend.SyncDriftMissingInDB,
+				Name:    adUser.SamAccountName,
+				ADValue: strings.Join(adGroups, ", "),
+				Fixes:   []string{classosbackend.SyncToDB},
+			})
+			continue
+		}
+
+		if adUser.DisplayName != "" && adUser.DisplayName != dbUser.Name {
+			add(classosbackend.SyncDrift{
+				Object:  classosbackend.SyncObjectUser,
+				Kind:    classosbackend.SyncDriftDisplayName,
+				Name:    dbUser.Username,
+				UserID:  dbUser.ID,
+				DBValue: dbUser.Name,
+				ADValue: adUser.DisplayName,
+				Fixes:   []string{classosbackend.SyncToDB, classosbackend.SyncToAD},
+			})
+		}
+
+		dbGroups := sortedGroupNames(dbGroupNames(dbUser))
+		if !sameGroupNames(dbGroups, adGroups) {
+			var fixes []string
+			if len(adGroups) > 0 {
+				fixes = append(fixes, classosbackend.SyncToDB)
+			}
+			if len(dbGroups) > 0 {
+				fixes = append(fixes, classosbackend.SyncToAD)
+			}
+			add(classosbackend.SyncDrift{
+				Object:  classosbackend.SyncObjectUser,
+				Kind:    classosbackend.SyncDriftGroup,
+				Name:    dbUser.Username,
+				UserID:  dbUser.ID,
+				DBValue: strings.Join(dbGroups, ", "),
+				ADValue: strings.Join(adGroups, ", "),
+				Fixes:   fixes,
+			})
+		}
+	}
+	for key, dbUser := range state.dbUsers {
+		if _, ok := state.adUsers[key]; ok || dbUser.GroupName == nil {
+			continue
+		}
+		add(classosbackend.SyncDrift{
+			Object:  classosbackend.SyncObjectUser,
+			Kind:    classosbackend.SyncDriftMissingInAD,
+			Name:    dbUser.Username,
+			UserID:  dbUser.ID,
+			DBValue: strings.Join(sortedGroupNames(dbGroupNames(dbUser)), ", "),
+			Fixes:   []string{classosbackend.SyncToAD},
+		})
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].ID < drift[j].ID })
+	return drift
+}
+
+// dbGroupNames lists the groups of a database user, the primary one first.
+func dbGroupNames(user classosbackend.User) []string {
+	names := make([]string, 0, len(user.Groups))
+	for _, group := range user.Groups {
+		names = append(names, group.Name)
+	}
+	if len(names) == 0 && user.GroupName != nil {
+		names = append(names, *user.GroupName)
+	}
+	return names
+}
+
+// sortedGroupNames orders group names the same way every time, so that the
+// drift of a user only changes when their groups do.
+func sortedGroupNames(names []string) []string {
+	sorted := append([]string(nil), names...)
+	sort.Slice(sorted, func(i, j int) bool { return strings.ToLower(sorted[i]) < strings.ToLower(sorted[j]) })
+	return sorted
+}
+
+// sameGroupNames compares two sorted lists of group names, ignoring case as
+// AD does.
+func sameGroupNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsGroupName reports whether the group is in the list, ignoring case.
+func containsGroupName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// dbGroupIds resolves AD group names to database groups, keeping the order.
+func dbGroupIds(state directoryState, names []string) ([]int, error) {
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		group, ok := state.dbGroups[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("group %s is not in the database, import it first", name)
+		}
+		ids = append(ids, int(group.ID))
+	}
+	return ids, nil
+}
+
+// importFixes selects every item that can be fixed towards the database.
+func importFixes(drift []classosbackend.SyncDrift) []classosbackend.SyncFix {
+	fixes := make([]classosbackend.SyncFix, 0)
+	for _, item := range drift {
+		for _, direction := range item.Fixes {
+			if direction == classosbackend.SyncToDB {
+				fixes = append(fixes, classosbackend.SyncFix{ID: item.ID, Direction: direction})
+			}
+		}
+	}
+	return fixes
+}
+
+// selectDrift pairs the requested fixes with the current drift. Groups come
+// first so that users can be put into groups created by the same run.
+// Requests that cannot be applied carry their result already.
+func selectDrift(drift []classosbackend.SyncDrift, fixes []classosbackend.SyncFix) []classosbackend.SyncDrift {
+	byId := make(map[string]classosbackend.SyncDrift, len(drift))
+	for _, item := range drift {
+		byId[item.ID] = item
+	}
+
+	selected := make([]classosbackend.SyncDrift, 0, len(fixes))
+	seen := make(map[string]bool, len(fixes))
+	for _, fix := range fixes {
+		if seen[fix.ID] {
+			continue
+		}
+		seen[fix.ID] = true
+
+		item, ok := byId[fix.ID]
+		if !ok {
+			selected = append(selected, classosbackend.SyncDrift{
+				ID:     fix.ID,
+				Result: classosbackend.SyncResultResolved,
+			})
+			continue
+		}
+
+		item.Direction = fix.Direction
+		if item.Direction == "" && len(item.Fixes) == 1 {
+			item.Direction = item.Fixes[0]
+		}
+		if !containsString(item.Fixes, item.Direction) {
+			item.Result = classosbackend.SyncResultFailed
+			item.Error = fmt.Sprintf("%s: direction must be one of %s", classosbackend.ErrInvalidSyncFix,
+				strings.Join(item.Fixes, ", "))
+		}
+		selected = append(selected, item)
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Object == classosbackend.SyncObjectGroup && selected[j].Object != classosbackend.SyncObjectGroup
+	})
+	return selected
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *DirectorySyncService) applyFix(state directoryState, item classosbackend.SyncDrift) error {
+	toDB := item.Direction == classosbackend.SyncToDB
+
+	switch {
+	case item.Object == classosbackend.SyncObjectGroup && item.Kind == classosbackend.SyncDriftMissingInDB:
+		id, err := s.repo.CreateGroup(item.Name)
+		if err != nil {
+			return err
+		}
+		state.dbGroups[strings.ToLower(item.Name)] = classosbackend.Group{ID: int64(id), Name: item.Name}
+		return nil
+
+	case item.Object == classosbackend.SyncObjectGroup && item.Kind == classosbackend.SyncDriftMissingInAD:
+		return s.directory.CreateGroup(ADGroup{Name: item.Name, Description: "Created by ClassOS"})
+
+	case item.Kind == classosbackend.SyncDriftMissingInDB:
+		adUser := state.adUsers[strings.ToLower(item.Name)]
+		groupIds, err := dbGroupIds(state, sortedGroupNames(adUser.Groups))
+		if err != nil {
+			return err
+		}
+		name := adUser.DisplayName
+		if name == "" {
+			name = adUser.SamAccountName
+		}
+		// Imported users sign in with their AD password.
+		_, err = s.repo.CreateUser(classosbackend.User{
+			Name:     name,
+			Username: adUser.SamAccountName,
+			Role:     classosbackend.RoleClient,
+			Password: adManagedPasswordHash,
+		}, groupIds)
+		return err
+
+	case item.Kind == classosbackend.SyncDriftMissingInAD:
+		// The account is created disabled: there is no password to give it.
+		// Setting one through the users API enables it.
+		dbUser := state.dbUsers[strings.ToLower(item.Name)]
+		groups := dbGroupNames(dbUser)
+		if err := s.directory.CreateUser(ADUser{
+			SamAccountName: dbUser.Username,
+			DisplayName:    dbUser.Name,
+		}, "", groups[0]); err != nil {
+			return err
+		}
+		for _, group := range groups[1:] {
+			if err := s.directory.AddUserToGroup(dbUser.Username, group); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case item.Kind == classosbackend.SyncDriftDisplayName && toDB:
+		return s.repo.UpdateUserName(item.UserID, item.ADValue)
+
+	case item.Kind == classosbackend.SyncDriftDisplayName:
+		return s.directory.UpdateUser(item.Name, ADUser{DisplayName: item.DBValue}, "")
+
+	case item.Kind == classosbackend.SyncDriftGroup && toDB:
+		adUser := state.adUsers[strings.ToLower(item.Name)]
+		groupIds, err := dbGroupIds(state, sortedGroupNames(adUser.Groups))
+		if err != nil {
+			return err
+		}
+		return s.repo.SetUserGroups(item.UserID, groupIds)
+
+	case item.Kind == classosbackend.SyncDriftGroup:
+		adGroups := state.adUsers[strings.ToLower(item.Name)].Groups
+		dbGroups := dbGroupNames(state.dbUsers[strings.ToLower(item.Name)])
+		for _, group := range dbGroups {
+			if !containsGroupName(adGroups, group) {
+				if err := s.directory.AddUserToGroup(item.Name, group); err != nil {
+					return err
+				}
+			}
+		}
+		for _, group := range adGroups {
+			if !containsGroupName(dbGroups, group) {
+				if err := s.directory.RemoveUserFromGroup(item.Name, group); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown drift %s", classosbackend.ErrInvalidSyncFix, item.ID)
+}
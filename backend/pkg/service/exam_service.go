@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+type ExamService struct {
+	repo      repository.Exam
+	groupRepo repository.Group
+	policy    *PolicyService
+}
+
+func NewExamService(repo repository.Exam, groupRepo repository.Group, policy *PolicyService) *ExamService {
+	return &ExamService{repo: repo, groupRepo: groupRepo, policy: policy}
+}
+
+func (s *ExamService) Create(checkerId int, session classosbackend.ExamSession) (int, error) {
+	if _, err := s.groupRepo.GetById(checkerId, int(session.GroupID)); err != nil {
+		return 0, err
+	}
+
+	if err := session.Normalize(); err != nil {
+		return 0, err
+	}
+	session.CreatedBy = &checkerId
+
+	id, err := s.repo.Create(session)
+	if err != nil {
+		return 0, err
+	}
+
+	s.policy.notifyGroup(int(session.GroupID))
+	return id, nil
+}
+
+// GetAll lists exam sessions of a group, or of every group when groupId is 0.
+func (s *ExamService) GetAll(checkerId, groupId int) ([]classosbackend.ExamSession, error) {
+	if groupId != 0 {
+		if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.GetAll(groupId)
+}
+
+func (s *ExamService) GetById(checkerId, examId int) (classosbackend.ExamSession, error) {
+	session, err := s.repo.GetById(examId)
+	if err != nil {
+		return session, err
+	}
+
+	if _, err := s.groupRepo.GetById(checkerId, int(session.GroupID)); err != nil {
+		return classosbackend.ExamSession{}, err
+	}
+	return session, nil
+}
+
+func (s *ExamService) Update(checkerId, examId int, input classosbackend.UpdateExamSessionInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.GetById(checkerId, examId)
+	if err != nil {
+		return err
+	}
+
+	session := input.Apply(current)
+	if err := session.Normalize(); err != nil {
+		return err
+	}
+
+	if err := s.repo.Update(session); err != nil {
+		return err
+	}
+
+	s.policy.notifyGroup(int(session.GroupID))
+	return nil
+}
+
+// Delete removes the session. Deleting a running exam ends it right away.
+func (s *ExamService) Delete(checkerId, examId int) error {
+	session, err := s.GetById(checkerId, examId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(examId); err != nil {
+		return err
+	}
+
+	s.policy.notifyGroup(int(session.GroupID))
+	return nil
+}
+
+func (s *ExamService) GetViolations(checkerId, examId, limit, offset int) ([]classosbackend.ExamViolation, error) {
+	if _, err := s.GetById(checkerId, examId); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.repo.GetViolations(examId, limit, offset)
+}
+
+// RecordViolations checks process logs reported by an agent against the exam
+// policy of the user and stores every program the exam does not allow.
+func (s *ExamService) RecordViolations(deviceName string, logs []classosbackend.UserLog) error {
+	layersByUser := make(map[string]policyLayers)
+	violations := make([]classosbackend.ExamViolation, 0)
+
+	for _, log := range logs {
+		if log.LogType != classosbackend.LogTypeProcess || log.Program == "" || log.Username == "" {
+			continue
+		}
+
+		layers, ok := layersByUser[log.Username]
+		if !ok {
+			var err error
+			layers, err = s.policy.loadLayers(log.Username)
+			if err != nil {
+				return err
+			}
+			layersByUser[log.Username] = layers
+		}
+
+		if layers.exam == nil || !layers.exam.IsActive(log.Timestamp) {
+			continue
+		}
+
+		decision := layers.decide(classosbackend.PolicyDecision{Username: log.Username, Resource: log.Program})
+		if decision.Allowed {
+			continue
+		}
+
+		violations = append(violations, classosbackend.ExamViolation{
+			ExamID:     layers.exam.ID,
+			Username:   log.Username,
+			DeviceName: deviceName,
+			Program:    log.Program,
+			Action:     log.Action,
+			OccurredAt: log.Timestamp,
+		})
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	if err := s.repo.CreateViolations(violations); err != nil {
+		return fmt.Errorf("failed to store exam violations: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"device":     deviceName,
+		"violations": len(violations),
+	}).Warn("Exam violations recorded")
+	return nil
+}
@@ -18,7 +18,7 @@ func (s *GroupService) Create(checkerId int, group classosbackend.Group) (int, e
 }
 
 func (s *GroupService) GetAll(checkerId int) ([]classosbackend.Group, error) {
-	return s.repo.GetAll(checkerId)
+	return s.repo.GetAll(checkerId, classosbackend.GroupsFilter{})
 }
 
 func (s *GroupService) GetById(checkerId, groupId int) (classosbackend.Group, error) {
@@ -1,127 +1,298 @@
 package service
 
 import (
+	"database/sql"
 	"fmt"
+	"strconv"
 
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
 
 type IntegratedGroupService struct {
-	repo      repository.Group
-	adService *ADService
+	repo         repository.Group
+	userRepo     repository.User
+	auditService *AuditService
+	journal      *DirectoryJournal
 }
 
-func NewIntegratedGroupService(repo repository.Group, adService *ADService) *IntegratedGroupService {
+func NewIntegratedGroupService(repo repository.Group, userRepo repository.User, auditService *AuditService, journal *DirectoryJournal) *IntegratedGroupService {
 	return &IntegratedGroupService{
-		repo:      repo,
-		adService: adService,
+		repo:         repo,
+		userRepo:     userRepo,
+		auditService: auditService,
+		journal:      journal,
 	}
 }
 
-func (s *IntegratedGroupService) Create(checkerId int, group classosbackend.Group) (int, error) {
-	tx, err := s.repo.BeginTransaction()
-	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+func (s *IntegratedGroupService) Create(actor classosbackend.Actor, group classosbackend.Group) (groupId int, err error) {
+	event := classosbackend.AuditEvent{
+		Action:     classosbackend.AuditGroupCreate,
+		TargetType: classosbackend.AuditTargetGroup,
+		TargetName: group.Name,
+		Changes:    classosbackend.AuditChanges{},
 	}
-	defer tx.Rollback()
+	event.Changes.Set("name", nil, group.Name)
+	defer func() {
+		if groupId != 0 {
+			event.TargetID = strconv.Itoa(groupId)
+		}
+		s.auditService.Record(actor, event, err)
+	}()
 
-	adGroup := ADGroup{
-		Name:        group.Name,
-		Description: "Created by ClassOS",
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryGroupCreate,
+		TargetName: group.Name,
+		Payload:    classosbackend.DirectoryPayload{GroupName: group.Name},
 	}
 
-	err = s.adService.CreateGroup(adGroup)
+	var createdId int
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		id, err := s.repo.CreateWithTx(tx, actor.ID, group)
+		if err != nil {
+			return fmt.Errorf("failed to create group in DB: %w", err)
+		}
+		createdId = id
+		op.TargetID = strconv.Itoa(id)
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to create group in AD: %w", err)
+		return 0, err
 	}
 
-	groupId, err := s.repo.CreateWithTx(tx, checkerId, group)
-	if err != nil {
-		s.adService.DeleteGroup(group.Name)
-		return 0, fmt.Errorf("failed to create group in DB: %w", err)
-	}
+	return createdId, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		s.adService.DeleteGroup(group.Name)
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+func (s *IntegratedGroupService) GetAll(checkerId int, filter classosbackend.GroupsFilter) ([]classosbackend.Group, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
 	}
-
-	return groupId, nil
+	return s.repo.GetAll(checkerId, filter)
 }
 
-func (s *IntegratedGroupService) GetAll(checkerId int) ([]classosbackend.Group, error) {
-	return s.repo.GetAll(checkerId)
+func (s *IntegratedGroupService) Count(checkerId int, filter classosbackend.GroupsFilter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(checkerId, filter)
 }
 
 func (s *IntegratedGroupService) GetById(checkerId, groupId int) (classosbackend.Group, error) {
 	return s.repo.GetById(checkerId, groupId)
 }
 
-func (s *IntegratedGroupService) Update(checkerId, groupId int, input classosbackend.UpdateGroupInput) error {
+func (s *IntegratedGroupService) Update(actor classosbackend.Actor, groupId int, input classosbackend.UpdateGroupInput) (err error) {
+	event := groupEvent(classosbackend.AuditGroupUpdate, groupId)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
 	if err := input.Validate(); err != nil {
 		return err
 	}
 
-	currentGroup, err := s.repo.GetById(checkerId, groupId)
+	currentGroup, err := s.repo.GetById(actor.ID, groupId)
 	if err != nil {
 		return fmt.Errorf("group not found: %w", err)
 	}
 
-	tx, err := s.repo.BeginTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	event.TargetName = currentGroup.Name
+	if input.Name != nil {
+		event.Changes.Set("name", currentGroup.Name, *input.Name)
 	}
-	defer tx.Rollback()
 
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryGroupUpdate,
+		TargetID:   strconv.Itoa(groupId),
+		TargetName: currentGroup.Name,
+		Payload:    classosbackend.DirectoryPayload{PreviousGroupName: currentGroup.Name},
+	}
 	if input.Name != nil {
-		adUpdates := ADGroup{
-			Name: *input.Name,
+		op.Payload.GroupName = *input.Name
+	}
+
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.UpdateWithTx(tx, actor.ID, groupId, input); err != nil {
+			return fmt.Errorf("failed to update group in DB: %w", err)
 		}
+		return nil
+	})
+}
 
-		err = s.adService.UpdateGroup(currentGroup.Name, adUpdates)
-		if err != nil {
-			return fmt.Errorf("failed to update group in AD: %w", err)
+func (s *IntegratedGroupService) Delete(actor classosbackend.Actor, groupId int) (err error) {
+	event := groupEvent(classosbackend.AuditGroupDelete, groupId)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	group, err := s.repo.GetById(actor.ID, groupId)
+	if err != nil {
+		return fmt.Errorf("group not found: %w", err)
+	}
+
+	event.TargetName = group.Name
+	event.Changes.Set("name", group.Name, nil)
+
+	// The group is removed from AD after the database; if AD is unreachable
+	// the journal keeps retrying.
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryGroupDelete,
+		TargetID:   strconv.Itoa(groupId),
+		TargetName: group.Name,
+		Payload:    classosbackend.DirectoryPayload{GroupName: group.Name},
+	}
+
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.DeleteWithTx(tx, actor.ID, groupId); err != nil {
+			return fmt.Errorf("failed to delete group from DB: %w", err)
 		}
+		return nil
+	})
+}
+
+func (s *IntegratedGroupService) GetTeachers(checkerId, groupId int) ([]classosbackend.User, error) {
+	if _, err := s.repo.GetById(checkerId, groupId); err != nil {
+		return nil, err
 	}
+	return s.repo.GetTeachers(groupId)
+}
+
+func (s *IntegratedGroupService) AddTeacher(actor classosbackend.Actor, groupId, userId int) (err error) {
+	event := groupEvent(classosbackend.AuditGroupTeacherAdd, groupId)
+	event.Changes.Set("teacher", nil, userId)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	group, err := s.repo.GetById(actor.ID, groupId)
+	if err != nil {
+		return err
+	}
+	event.TargetName = group.Name
 
-	err = s.repo.UpdateWithTx(tx, checkerId, groupId, input)
+	user, err := s.userRepo.GetById(actor.ID, userId)
 	if err != nil {
-		return fmt.Errorf("failed to update group in DB: %w", err)
+		return err
 	}
+	event.Changes.Set("teacher", nil, user.Username)
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if user.Role != classosbackend.RoleTeacher {
+		return fmt.Errorf("%w: %s", classosbackend.ErrNotATeacher, user.Username)
 	}
 
-	return nil
+	return s.repo.AddTeacher(groupId, userId)
 }
 
-func (s *IntegratedGroupService) Delete(checkerId, groupId int) error {
-	group, err := s.repo.GetById(checkerId, groupId)
+func (s *IntegratedGroupService) RemoveTeacher(actor classosbackend.Actor, groupId, userId int) (err error) {
+	event := groupEvent(classosbackend.AuditGroupTeacherRemove, groupId)
+	event.Changes.Set("teacher_id", userId, nil)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	group, err := s.repo.GetById(actor.ID, groupId)
 	if err != nil {
-		return fmt.Errorf("group not found: %w", err)
+		return err
 	}
+	event.TargetName = group.Name
 
-	tx, err := s.repo.BeginTransaction()
+	return s.repo.RemoveTeacher(groupId, userId)
+}
+
+// groupEvent starts the audit event of a change to a group. It is created
+// before the group is loaded, so that failed lookups are recorded too.
+func groupEvent(action string, groupId int) classosbackend.AuditEvent {
+	return classosbackend.AuditEvent{
+		Action:     action,
+		TargetType: classosbackend.AuditTargetGroup,
+		TargetID:   strconv.Itoa(groupId),
+		Changes:    classosbackend.AuditChanges{},
+	}
+}
+
+func (s *IntegratedGroupService) GetMembers(checkerId, groupId int) ([]classosbackend.GroupMember, error) {
+	if _, err := s.repo.GetById(checkerId, groupId); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMembers(groupId)
+}
+
+// AddMember puts the user into the group besides their other groups. A user
+// without a group gets it as their primary group.
+func (s *IntegratedGroupService) AddMember(actor classosbackend.Actor, groupId, userId int) (err error) {
+	event := groupEvent(classosbackend.AuditGroupMemberAdd, groupId)
+	event.Changes.Set("member", nil, userId)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	group, err := s.repo.GetById(actor.ID, groupId)
+	if err != nil {
+		return err
+	}
+	event.TargetName = group.Name
+
+	user, err := s.userRepo.GetById(actor.ID, userId)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
+	}
+	event.Changes.Set("member", nil, user.Username)
+
+	if memberOf(user, groupId) {
+		return nil
+	}
+
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryGroupMemberAdd,
+		TargetID:   strconv.Itoa(userId),
+		TargetName: user.Username,
+		Payload:    classosbackend.DirectoryPayload{Username: user.Username, GroupName: group.Name},
 	}
-	defer tx.Rollback()
 
-	err = s.adService.DeleteGroup(group.Name)
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.AddMemberWithTx(tx, groupId, userId); err != nil {
+			return fmt.Errorf("failed to add group member in DB: %w", err)
+		}
+		return nil
+	})
+}
+
+// RemoveMember takes the user out of a group other than their primary one;
+// the primary group is changed by updating the user.
+func (s *IntegratedGroupService) RemoveMember(actor classosbackend.Actor, groupId, userId int) (err error) {
+	event := groupEvent(classosbackend.AuditGroupMemberRemove, groupId)
+	event.Changes.Set("member", userId, nil)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	group, err := s.repo.GetById(actor.ID, groupId)
 	if err != nil {
-		return fmt.Errorf("failed to delete group from AD: %w", err)
+		return err
 	}
+	event.TargetName = group.Name
 
-	err = s.repo.DeleteWithTx(tx, checkerId, groupId)
+	user, err := s.userRepo.GetById(actor.ID, userId)
 	if err != nil {
-		return fmt.Errorf("failed to delete group from DB: %w", err)
+		return err
 	}
+	event.Changes.Set("member", user.Username, nil)
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if !memberOf(user, groupId) {
+		return sql.ErrNoRows
 	}
+	if user.GroupID != nil && *user.GroupID == groupId {
+		return classosbackend.ErrPrimaryGroup
+	}
+
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryGroupMemberRemove,
+		TargetID:   strconv.Itoa(userId),
+		TargetName: user.Username,
+		Payload:    classosbackend.DirectoryPayload{Username: user.Username, GroupName: group.Name},
+	}
+
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.RemoveMemberWithTx(tx, groupId, userId); err != nil {
+			return fmt.Errorf("failed to remove group member from DB: %w", err)
+		}
+		return nil
+	})
+}
 
-	return nil
+func memberOf(user classosbackend.User, groupId int) bool {
+	for _, group := range user.Groups {
+		if int(group.ID) == groupId {
+			return true
+		}
+	}
+	return false
 }
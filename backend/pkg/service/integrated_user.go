@@ -1,8 +1,11 @@
 package service
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
@@ -10,178 +13,262 @@ import (
 )
 
 type IntegratedUserService struct {
-	repo        repository.User
-	groupRepo   repository.Group
-	authService *AuthService
-	adService   *ADService
+	repo         repository.User
+	groupRepo    repository.Group
+	authService  *AuthService
+	auditService *AuditService
+	journal      *DirectoryJournal
+	// retention is how long archived users are kept; 0 keeps them forever.
+	retention time.Duration
 }
 
-var groupname string
+func NewIntegratedUserService(repo repository.User, groupRepo repository.Group, authService *AuthService, auditService *AuditService, journal *DirectoryJournal) *IntegratedUserService {
+	var retention time.Duration
+	if os.Getenv("USER_ARCHIVE_RETENTION") != "0" {
+		retention = envDuration("USER_ARCHIVE_RETENTION", 365*24*time.Hour)
+	}
 
-func NewIntegratedUserService(repo repository.User, groupRepo repository.Group, authService *AuthService, adService *ADService) *IntegratedUserService {
 	return &IntegratedUserService{
-		repo:        repo,
-		groupRepo:   groupRepo,
-		authService: authService,
-		adService:   adService,
+		repo:         repo,
+		groupRepo:    groupRepo,
+		authService:  authService,
+		auditService: auditService,
+		journal:      journal,
+		retention:    retention,
 	}
 }
 
-func (s *IntegratedUserService) Create(checkerId, groupId int, user classosbackend.User) (int, error) {
-	_, err := s.groupRepo.GetById(checkerId, groupId)
-	if err != nil {
-		return 0, err
+func (s *IntegratedUserService) Create(actor classosbackend.Actor, groupId int, user classosbackend.User) (userId int, err error) {
+	event := classosbackend.AuditEvent{
+		Action:     classosbackend.AuditUserCreate,
+		TargetType: classosbackend.AuditTargetUser,
+		TargetName: user.Username,
+		Changes:    classosbackend.AuditChanges{},
 	}
+	event.Changes.Set("name", nil, user.Name)
+	event.Changes.Set("username", nil, user.Username)
+	event.Changes.Set("role", nil, user.Role)
+	event.Changes.Set("group", nil, groupId)
+	defer func() {
+		if userId != 0 {
+			event.TargetID = strconv.Itoa(userId)
+		}
+		s.auditService.Record(actor, event, err)
+	}()
 
-	tx, err := s.repo.BeginTransaction()
+	group, err := s.groupRepo.GetById(actor.ID, groupId)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, err
 	}
-	defer tx.Rollback()
-
-	adUser := s.convertUserToADUser(user)
+	event.Changes.Set("group", nil, group.Name)
 
-	if user.GroupName != nil {
-		groupname = *user.GroupName
-		logrus.WithField("groupname", groupname).Info("obtained successfullay groupname")
-	} else{
+	if user.GroupName == nil {
 		return 0, fmt.Errorf("failed to obtain groupname for AD")
 	}
 
-	err = s.adService.CreateUser(adUser, user.Password, groupname)
+	passwordHash, err := s.authService.GeneratePasswordHash(user.Password)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create user in AD: %w", err)
+		return 0, err
 	}
 
-	user.Password = s.authService.GeneratePasswordHash(user.Password)
-	userId, err := s.repo.CreateWithTx(tx, groupId, user)
-	if err != nil {
-		s.adService.DeleteUser(user.Username)
-		return 0, fmt.Errorf("failed to create user in DB: %w", err)
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryUserCreate,
+		TargetName: user.Username,
+		Payload: classosbackend.DirectoryPayload{
+			Username:    user.Username,
+			DisplayName: user.Name,
+			GroupName:   *user.GroupName,
+			Password:    user.Password,
+		},
 	}
 
-	if err := tx.Commit(); err != nil {
-		s.adService.DeleteUser(user.Username)
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	user.Password = passwordHash
+	var createdId int
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		id, err := s.repo.CreateWithTx(tx, groupId, user)
+		if err != nil {
+			return fmt.Errorf("failed to create user in DB: %w", err)
+		}
+		createdId = id
+		op.TargetID = strconv.Itoa(id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return userId, nil
+	return createdId, nil
 }
 
-func (s *IntegratedUserService) GetAll(checkerId int) ([]classosbackend.User, error) {
-	return s.repo.GetAll(checkerId)
+// GetAll lists a page of the users; archived users are hidden unless the
+// filter asks for them.
+func (s *IntegratedUserService) GetAll(checkerId int, filter classosbackend.UsersFilter) ([]classosbackend.User, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAll(checkerId, filter)
+}
+
+func (s *IntegratedUserService) Count(checkerId int, filter classosbackend.UsersFilter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(checkerId, filter)
 }
 
 func (s *IntegratedUserService) GetById(checkerId, userId int) (classosbackend.User, error) {
 	return s.repo.GetById(checkerId, userId)
 }
 
-func (s *IntegratedUserService) Update(checkerId, userId int, input classosbackend.UpdateUserInput) error {
+func (s *IntegratedUserService) Update(actor classosbackend.Actor, userId int, input classosbackend.UpdateUserInput) (err error) {
+	event := userEvent(classosbackend.AuditUserUpdate, userId)
+	defer func() { s.auditService.Record(actor, event, err) }()
+
 	if err := input.Validate(); err != nil {
 		return err
 	}
 
-	currentUser, err := s.repo.GetById(checkerId, userId)
+	currentUser, err := s.repo.GetById(actor.ID, userId)
 	if err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
 
-	tx, err := s.repo.BeginTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	event.TargetName = currentUser.Username
+	event.Changes = userChanges(currentUser, input)
+	if input.Password != nil {
+		if len(event.Changes) == 0 {
+			event.Action = classosbackend.AuditUserPasswordChange
+		}
+		event.Changes["password"] = classosbackend.AuditChange{From: "[hidden]", To: "[hidden]"}
 	}
-	defer tx.Rollback()
 
-	if input.Name != nil || input.Username != nil {
-		adUpdates := ADUser{}
-		if input.Name != nil {
-			adUpdates.DisplayName = *input.Name
-		}
-		if input.Username != nil {
-			adUpdates.SamAccountName = *input.Username
-		}
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryUserUpdate,
+		TargetID:   strconv.Itoa(userId),
+		TargetName: currentUser.Username,
+		Payload: classosbackend.DirectoryPayload{
+			Username:            currentUser.Username,
+			PreviousDisplayName: currentUser.Name,
+		},
+	}
 
-		if input.GroupName != nil {
-			groupname = *input.GroupName
-			logrus.WithField("groupname", groupname).Info("obtained successfullay groupname")
-		} else{
+	if input.Name != nil || input.Username != nil {
+		if input.GroupName == nil {
 			return fmt.Errorf("failed to obtain groupname for AD")
 		}
-
-		err = s.adService.UpdateUser(currentUser.Username, adUpdates, groupname)
-		if err != nil {
-			return fmt.Errorf("failed to update user in AD: %w", err)
+		if input.Name != nil {
+			op.Payload.DisplayName = *input.Name
+		}
+		op.Payload.GroupName = *input.GroupName
+		if currentUser.GroupName != nil {
+			op.Payload.PreviousGroupName = *currentUser.GroupName
 		}
 	}
 
 	if input.Password != nil {
-		err = s.adService.ChangeUserPassword(currentUser.Username, *input.Password)
+		hashedPassword, err := s.authService.GeneratePasswordHash(*input.Password)
 		if err != nil {
-			return fmt.Errorf("failed to change password in AD: %w", err)
+			return err
 		}
 
-		hashedPassword := s.authService.GeneratePasswordHash(*input.Password)
+		op.Payload.PasswordChanged = true
+		op.Payload.Password = *input.Password
 		input.Password = &hashedPassword
 	}
 
-	err = s.repo.UpdateWithTx(tx, checkerId, userId, input)
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.UpdateWithTx(tx, actor.ID, userId, input); err != nil {
+			return fmt.Errorf("failed to update user in DB: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update user in DB: %w", err)
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	// A new password signs the user out everywhere.
+	if input.Password != nil {
+		if err := s.authService.RevokeAllSessions(userId); err != nil {
+			logrus.WithError(err).WithField("user_id", userId).Warn("Failed to revoke sessions after password change")
+		}
 	}
 
 	return nil
 }
 
-func (s *IntegratedUserService) Delete(checkerId, userId int) error {
-	user, err := s.repo.GetById(checkerId, userId)
-	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
-	}
+// Delete removes the user at once. Users are normally archived instead and
+// purged after the retention period.
+func (s *IntegratedUserService) Delete(actor classosbackend.Actor, userId int) (err error) {
+	event := userEvent(classosbackend.AuditUserDelete, userId)
+	defer func() { s.auditService.Record(actor, event, err) }()
 
-	if user.Username == "admin01" {
-		return fmt.Errorf("cannot delete super admin")
-	}
-
-	tx, err := s.repo.BeginTransaction()
+	user, err := s.repo.GetById(actor.ID, userId)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("user not found: %w", err)
 	}
-	defer tx.Rollback()
 
-	err = s.adService.DeleteUser(user.Username)
-	if err != nil {
-		return fmt.Errorf("failed to delete user from AD: %w", err)
+	event.TargetName = user.Username
+	event.Changes.Set("name", user.Name, nil)
+	event.Changes.Set("role", user.Role, nil)
+	if user.GroupName != nil {
+		event.Changes.Set("group", *user.GroupName, nil)
 	}
 
-	err = s.repo.DeleteWithTx(tx, checkerId, userId)
-	if err != nil {
-		return fmt.Errorf("failed to delete user from DB: %w", err)
+	if user.Username == classosbackend.SuperAdminUsername {
+		return fmt.Errorf("cannot delete super admin")
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	// The user is removed from AD after the database; if AD is unreachable
+	// the journal keeps retrying.
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryUserDelete,
+		TargetID:   strconv.Itoa(userId),
+		TargetName: user.Username,
+		Payload:    classosbackend.DirectoryPayload{Username: user.Username},
 	}
 
-	return nil
-}
-
-func (s *IntegratedUserService) SyncAllFromAD() error {
-	return s.adService.SyncAllUsersFromAD()
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.DeleteWithTx(tx, actor.ID, userId); err != nil {
+			return fmt.Errorf("failed to delete user from DB: %w", err)
+		}
+		return nil
+	})
 }
 
-func (s *IntegratedUserService) ValidateADConnection() error {
-	return s.adService.TestConnection()
+// userEvent starts the audit event of a change to a user. It is created
+// before the user is loaded, so that failed lookups are recorded too.
+func userEvent(action string, userId int) classosbackend.AuditEvent {
+	return classosbackend.AuditEvent{
+		Action:     action,
+		TargetType: classosbackend.AuditTargetUser,
+		TargetID:   strconv.Itoa(userId),
+		Changes:    classosbackend.AuditChanges{},
+	}
 }
 
-func (s *IntegratedUserService) convertUserToADUser(user classosbackend.User) ADUser {
-	return ADUser{
-		SamAccountName: user.Username,
-		DisplayName:    user.Name,
-		EmailAddress:   user.Username + "@" + os.Getenv("AD_DOMAIN"),
-		Enabled:        true,
+// userChanges is the audit diff of an update; the password is handled by
+// the caller since its values must not be recorded.
+func userChanges(current classosbackend.User, input classosbackend.UpdateUserInput) classosbackend.AuditChanges {
+	changes := classosbackend.AuditChanges{}
+	if input.Name != nil {
+		changes.Set("name", current.Name, *input.Name)
+	}
+	if input.Username != nil {
+		changes.Set("username", current.Username, *input.Username)
+	}
+	if input.Role != nil {
+		changes.Set("role", current.Role, *input.Role)
+	}
+	if input.GroupID != nil {
+		var from, to interface{}
+		if current.GroupID != nil {
+			from = *current.GroupID
+		}
+		to = *input.GroupID
+		if current.GroupName != nil && input.GroupName != nil {
+			from, to = *current.GroupName, *input.GroupName
+		}
+		changes.Set("group", from, to)
 	}
+	return changes
 }
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/sirupsen/logrus"
+)
+
+const userPurgeInterval = time.Hour
+
+// A status change names the states it starts from and the state it ends in.
+type userStatusChange struct {
+	action string
+	from   []string
+	to     string
+}
+
+var (
+	userDisable = userStatusChange{
+		action: classosbackend.AuditUserDisable,
+		from:   []string{classosbackend.UserStatusActive},
+		to:     classosbackend.UserStatusDisabled,
+	}
+	userEnable = userStatusChange{
+		action: classosbackend.AuditUserEnable,
+		from:   []string{classosbackend.UserStatusDisabled},
+		to:     classosbackend.UserStatusActive,
+	}
+	userArchive = userStatusChange{
+		action: classosbackend.AuditUserArchive,
+		from:   []string{classosbackend.UserStatusActive, classosbackend.UserStatusDisabled},
+		to:     classosbackend.UserStatusArchived,
+	}
+	userRestore = userStatusChange{
+		action: classosbackend.AuditUserRestore,
+		from:   []string{classosbackend.UserStatusArchived},
+		to:     classosbackend.UserStatusActive,
+	}
+)
+
+// Disable blocks sign-in and disables the AD account; the user stays listed.
+func (s *IntegratedUserService) Disable(actor classosbackend.Actor, userId int) error {
+	return s.changeStatus(actor, userId, userDisable)
+}
+
+func (s *IntegratedUserService) Enable(actor classosbackend.Actor, userId int) error {
+	return s.changeStatus(actor, userId, userEnable)
+}
+
+// Archive disables the user and hides them from the default listings. The
+// row and its history are kept until the purge job deletes it.
+func (s *IntegratedUserService) Archive(actor classosbackend.Actor, userId int) error {
+	return s.changeStatus(actor, userId, userArchive)
+}
+
+// Restore brings an archived user back as active.
+func (s *IntegratedUserService) Restore(actor classosbackend.Actor, userId int) error {
+	return s.changeStatus(actor, userId, userRestore)
+}
+
+func (s *IntegratedUserService) changeStatus(actor classosbackend.Actor, userId int, change userStatusChange) (err error) {
+	event := userEvent(change.action, userId)
+	unchanged := false
+	defer func() {
+		if !unchanged {
+			s.auditService.Record(actor, event, err)
+		}
+	}()
+
+	user, err := s.repo.GetById(actor.ID, userId)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if user.Status == change.to {
+		unchanged = true
+		return nil
+	}
+
+	event.TargetName = user.Username
+	event.Changes.Set("status", user.Status, change.to)
+
+	if user.Username == classosbackend.SuperAdminUsername || userId == actor.ID {
+		return fmt.Errorf("%w: cannot change the status of %s", classosbackend.ErrUserStatusConflict, user.Username)
+	}
+	if !containsString(change.from, user.Status) {
+		return fmt.Errorf("%w: user is %s", classosbackend.ErrUserStatusConflict, user.Status)
+	}
+
+	kind := classosbackend.DirectoryUserDisable
+	if change.to == classosbackend.UserStatusActive {
+		kind = classosbackend.DirectoryUserEnable
+	}
+	op := classosbackend.DirectoryOperation{
+		Kind:       kind,
+		TargetID:   strconv.Itoa(userId),
+		TargetName: user.Username,
+		Payload:    classosbackend.DirectoryPayload{Username: user.Username},
+	}
+
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		err := s.repo.SetStatusWithTx(tx, actor.ID, userId, user.Status, change.to)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: status changed meanwhile", classosbackend.ErrUserStatusConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update user status in DB: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if change.to != classosbackend.UserStatusActive {
+		if err := s.authService.RevokeAllSessions(userId); err != nil {
+			logrus.WithError(err).WithField("user_id", userId).Warn("Failed to revoke sessions of disabled user")
+		}
+	}
+
+	return nil
+}
+
+// RunPurgeLoop deletes users archived longer than USER_ARCHIVE_RETENTION
+// until the context is cancelled. USER_ARCHIVE_RETENTION=0 keeps them.
+func (s *IntegratedUserService) RunPurgeLoop(ctx context.Context) {
+	if s.retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(userPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeArchived()
+		}
+	}
+}
+
+func (s *IntegratedUserService) purgeArchived() {
+	users, err := s.repo.GetArchivedBefore(time.Now().Add(-s.retention))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find archived users to purge")
+		return
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.purge(user); err != nil {
+			logrus.WithError(err).WithField("user", user.Username).Error("Failed to purge archived user")
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		logrus.WithField("count", purged).Info("Purged archived users")
+	}
+}
+
+// purge deletes an archived user from the database and AD. It runs as the
+// system, so the audit record has no actor.
+func (s *IntegratedUserService) purge(user classosbackend.User) (err error) {
+	actor := classosbackend.Actor{}
+	event := classosbackend.AuditEvent{
+		Action:     classosbackend.AuditUserPurge,
+		TargetType: classosbackend.AuditTargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		TargetName: user.Username,
+		Changes:    classosbackend.AuditChanges{},
+	}
+	if user.ArchivedAt != nil {
+		event.Changes.Set("archived_at", user.ArchivedAt.Format(time.RFC3339), nil)
+	}
+	defer func() { s.auditService.Record(actor, event, err) }()
+
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryUserDelete,
+		TargetID:   strconv.Itoa(user.ID),
+		TargetName: user.Username,
+		Payload:    classosbackend.DirectoryPayload{Username: user.Username},
+	}
+
+	return s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.PurgeWithTx(tx, user.ID); err != nil {
+			return fmt.Errorf("failed to purge user from DB: %w", err)
+		}
+		return nil
+	})
+}
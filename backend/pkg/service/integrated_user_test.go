@@ -0,0 +1,300 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+// txOnlyDriver is a database/sql driver whose connections can only begin,
+// commit and roll back transactions. It gives the journal the *sql.Tx it
+// hands to the repositories, which the fakes below ignore.
+type txOnlyDriver struct{}
+
+type txOnlyConn struct{}
+
+func (txOnlyDriver) Open(string) (driver.Conn, error) { return txOnlyConn{}, nil }
+
+func (txOnlyConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not supported")
+}
+func (txOnlyConn) Close() error              { return nil }
+func (txOnlyConn) Begin() (driver.Tx, error) { return txOnlyConn{}, nil }
+func (txOnlyConn) Commit() error             { return nil }
+func (txOnlyConn) Rollback() error           { return nil }
+
+func init() {
+	sql.Register("txonly", txOnlyDriver{})
+}
+
+// fakeDirectoryOps keeps journaled operations in memory. Methods the tests
+// do not reach are left to the embedded nil interface.
+type fakeDirectoryOps struct {
+	repository.Directory
+	db  *sql.DB
+	ops map[int64]classosbackend.DirectoryOperation
+}
+
+func (r *fakeDirectoryOps) BeginTransaction() (*sql.Tx, error) { return r.db.Begin() }
+
+func (r *fakeDirectoryOps) Create(op classosbackend.DirectoryOperation) (int64, error) {
+	op.ID = int64(len(r.ops) + 1)
+	r.ops[op.ID] = op
+	return op.ID, nil
+}
+
+func (r *fakeDirectoryOps) Save(op classosbackend.DirectoryOperation) error {
+	r.ops[op.ID] = op
+	return nil
+}
+
+func (r *fakeDirectoryOps) SaveWithTx(_ *sql.Tx, op classosbackend.DirectoryOperation) error {
+	return r.Save(op)
+}
+
+type fakeUserRepo struct {
+	repository.User
+	users    map[int]classosbackend.User
+	nextId   int
+	writeErr error
+}
+
+func (r *fakeUserRepo) GetById(_, userId int) (classosbackend.User, error) {
+	user, ok := r.users[userId]
+	if !ok {
+		return classosbackend.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *fakeUserRepo) CreateWithTx(_ *sql.Tx, groupId int, user classosbackend.User) (int, error) {
+	if r.writeErr != nil {
+		return 0, r.writeErr
+	}
+	r.nextId++
+	user.ID = r.nextId
+	user.GroupID = &groupId
+	r.users[user.ID] = user
+	return user.ID, nil
+}
+
+func (r *fakeUserRepo) UpdateWithTx(_ *sql.Tx, _, userId int, input classosbackend.UpdateUserInput) error {
+	if r.writeErr != nil {
+		return r.writeErr
+	}
+	user := r.users[userId]
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.GroupID != nil {
+		user.GroupID, user.GroupName = input.GroupID, input.GroupName
+	}
+	r.users[userId] = user
+	return nil
+}
+
+type fakeGroupRepo struct {
+	repository.Group
+	groups map[int]classosbackend.Group
+}
+
+func (r *fakeGroupRepo) GetById(_, groupId int) (classosbackend.Group, error) {
+	group, ok := r.groups[groupId]
+	if !ok {
+		return classosbackend.Group{}, sql.ErrNoRows
+	}
+	return group, nil
+}
+
+type fakeAuditRepo struct {
+	repository.Audit
+	events []classosbackend.AuditEvent
+}
+
+func (r *fakeAuditRepo) Create(event classosbackend.AuditEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+type userServiceFixture struct {
+	service *IntegratedUserService
+	dir     *MemoryDirectory
+	users   *fakeUserRepo
+	ops     *fakeDirectoryOps
+	audit   *fakeAuditRepo
+}
+
+func newUserServiceFixture(t *testing.T) *userServiceFixture {
+	t.Helper()
+
+	db, err := sql.Open("txonly", "")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	dir := newTestDirectory(t, "10A", "10B")
+	users := &fakeUserRepo{users: make(map[int]classosbackend.User)}
+	groups := &fakeGroupRepo{groups: map[int]classosbackend.Group{
+		1: {ID: 1, Name: "10A"},
+		2: {ID: 2, Name: "10B"},
+	}}
+	ops := &fakeDirectoryOps{db: db, ops: make(map[int64]classosbackend.DirectoryOperation)}
+	audit := &fakeAuditRepo{}
+	auditService := NewAuditService(audit)
+	journal := NewDirectoryJournal(ops, dir, auditService)
+
+	return &userServiceFixture{
+		service: NewIntegratedUserService(users, groups, &AuthService{}, auditService, journal),
+		dir:     dir,
+		users:   users,
+		ops:     ops,
+		audit:   audit,
+	}
+}
+
+func (f *userServiceFixture) lastOp(t *testing.T) classosbackend.DirectoryOperation {
+	t.Helper()
+	op, ok := f.ops.ops[int64(len(f.ops.ops))]
+	if !ok {
+		t.Fatal("no directory operation was journaled")
+	}
+	return op
+}
+
+func (f *userServiceFixture) lastEvent(t *testing.T) classosbackend.AuditEvent {
+	t.Helper()
+	if len(f.audit.events) == 0 {
+		t.Fatal("no audit event was recorded")
+	}
+	return f.audit.events[len(f.audit.events)-1]
+}
+
+var testAdmin = classosbackend.Actor{ID: 100, IP: "10.0.0.1"}
+
+func TestIntegratedUserCreate(t *testing.T) {
+	f := newUserServiceFixture(t)
+	groupName := "10A"
+
+	id, err := f.service.Create(testAdmin, 1, classosbackend.User{
+		Name:      "Ivanov",
+		Username:  "ivanov",
+		Role:      classosbackend.RoleClient,
+		Password:  "Secret-123",
+		GroupName: &groupName,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	user, ok := directoryUser(t, f.dir, "ivanov")
+	if !ok {
+		t.Fatal("user was not created in the directory")
+	}
+	if want := []string{"10A"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("directory groups = %v, want %v", user.Groups, want)
+	}
+	if f.users.users[id].Password == "Secret-123" {
+		t.Error("the database got the plain password")
+	}
+
+	op := f.lastOp(t)
+	if op.Status != classosbackend.DirectoryOpSucceeded || op.TargetID != strconv.Itoa(id) {
+		t.Errorf("operation = %s for %q, want succeeded for %q", op.Status, op.TargetID, strconv.Itoa(id))
+	}
+
+	event := f.lastEvent(t)
+	if event.Action != classosbackend.AuditUserCreate || event.Result != classosbackend.AuditResultSuccess {
+		t.Errorf("audit = %s/%s, want %s/%s", event.Action, event.Result, classosbackend.AuditUserCreate, classosbackend.AuditResultSuccess)
+	}
+}
+
+func TestIntegratedUserCreateCompensatesFailedWrite(t *testing.T) {
+	f := newUserServiceFixture(t)
+	f.users.writeErr = errors.New("connection reset")
+	groupName := "10A"
+
+	_, err := f.service.Create(testAdmin, 1, classosbackend.User{
+		Name:      "Ivanov",
+		Username:  "ivanov",
+		Role:      classosbackend.RoleClient,
+		Password:  "Secret-123",
+		GroupName: &groupName,
+	})
+	if err == nil {
+		t.Fatal("Create succeeded although the database write failed")
+	}
+
+	if _, ok := directoryUser(t, f.dir, "ivanov"); ok {
+		t.Error("the directory user was not removed again")
+	}
+	if op := f.lastOp(t); op.Status != classosbackend.DirectoryOpCompensated {
+		t.Errorf("operation status = %s, want %s", op.Status, classosbackend.DirectoryOpCompensated)
+	}
+	if event := f.lastEvent(t); event.Result != classosbackend.AuditResultFailure {
+		t.Errorf("audit result = %s, want %s", event.Result, classosbackend.AuditResultFailure)
+	}
+}
+
+func TestIntegratedUserUpdateCompensatesFailedWrite(t *testing.T) {
+	f := newUserServiceFixture(t)
+	oldGroup, newGroup := "10A", "10B"
+	id, err := f.service.Create(testAdmin, 1, classosbackend.User{
+		Name:      "Ivanov",
+		Username:  "ivanov",
+		Role:      classosbackend.RoleClient,
+		Password:  "Secret-123",
+		GroupName: &oldGroup,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	stored := f.users.users[id]
+	stored.GroupName = &oldGroup
+	f.users.users[id] = stored
+
+	f.users.writeErr = errors.New("connection reset")
+	name, groupId := "Ivanov Ivan", 2
+	err = f.service.Update(testAdmin, id, classosbackend.UpdateUserInput{
+		Name:      &name,
+		GroupID:   &groupId,
+		GroupName: &newGroup,
+	})
+	if err == nil {
+		t.Fatal("Update succeeded although the database write failed")
+	}
+
+	user, _ := directoryUser(t, f.dir, "ivanov")
+	if user.DisplayName != "Ivanov" {
+		t.Errorf("directory name = %q, want it restored to %q", user.DisplayName, "Ivanov")
+	}
+	if want := []string{"10A"}; !reflect.DeepEqual(user.Groups, want) {
+		t.Errorf("directory groups = %v, want them restored to %v", user.Groups, want)
+	}
+	if op := f.lastOp(t); op.Kind != classosbackend.DirectoryUserUpdate || op.Status != classosbackend.DirectoryOpCompensated {
+		t.Errorf("operation = %s %s, want %s %s", op.Kind, op.Status, classosbackend.DirectoryUserUpdate, classosbackend.DirectoryOpCompensated)
+	}
+}
+
+func TestIntegratedUserDeleteAuditsMissingUser(t *testing.T) {
+	f := newUserServiceFixture(t)
+
+	err := f.service.Delete(testAdmin, 42)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Delete = %v, want sql.ErrNoRows", err)
+	}
+
+	event := f.lastEvent(t)
+	if event.Action != classosbackend.AuditUserDelete || event.TargetID != "42" || event.Result != classosbackend.AuditResultFailure {
+		t.Errorf("audit = %s %s/%s, want a failed %s of 42", event.Action, event.TargetID, event.Result, classosbackend.AuditUserDelete)
+	}
+	if len(f.ops.ops) != 0 {
+		t.Error("a directory operation was journaled for a missing user")
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// Ways of writing a password into the directory.
+const (
+	// AD and Samba: quoted UTF-16LE in unicodePwd, only accepted over TLS.
+	passwordHashUnicode = "unicode"
+	// RFC 3062 password modify operation; the server hashes the password.
+	passwordHashExop = "exop"
+	// Salted SHA-1 computed here and written to the password attribute.
+	passwordHashSSHA = "ssha"
+	// Written as is, for servers hashing cleartext themselves.
+	passwordHashPlain = "plain"
+)
+
+// ldapSchema maps ClassOS users and groups onto the directory's schema.
+// LDAP_SCHEMA picks a preset (ad, samba or openldap) and the other LDAP_*
+// variables override single fields of it.
+type ldapSchema struct {
+	name string
+
+	userClasses []string
+	userFilter  string
+	// userRDN names user entries: either the login attribute or cn, which
+	// holds the display name.
+	userRDN     string
+	loginAttr   string
+	displayAttr string
+	// upnAttr is left empty when the directory has no user principal name.
+	upnAttr   string
+	upnSuffix string
+
+	passwordAttr string
+	passwordHash string
+
+	groupClasses []string
+	groupFilter  string
+	groupRDN     string
+	memberAttr   string
+	// memberIsDN is false for attributes such as memberUid that list logins.
+	memberIsDN bool
+	// memberOfAttr is left empty when the server keeps no back-links;
+	// memberships are then looked up on the groups.
+	memberOfAttr string
+	// groupNeedsMember is set for classes like groupOfNames that cannot be
+	// empty; the bind account is kept in every group as a placeholder.
+	groupNeedsMember bool
+
+	// adAccounts enables AD-only attributes: userAccountControl on users,
+	// sAMAccountName and groupType on groups.
+	adAccounts bool
+}
+
+func adSchema() ldapSchema {
+	return ldapSchema{
+		name:         "ad",
+		userClasses:  []string{"top", "person", "organizationalPerson", "user"},
+		userFilter:   "(&(objectClass=user)(!(objectClass=computer)))",
+		userRDN:      "CN",
+		loginAttr:    "sAMAccountName",
+		displayAttr:  "displayName",
+		upnAttr:      "userPrincipalName",
+		passwordAttr: "unicodePwd",
+		passwordHash: passwordHashUnicode,
+		groupClasses: []string{"top", "group"},
+		groupFilter:  "(objectClass=group)",
+		groupRDN:     "CN",
+		memberAttr:   "member",
+		memberIsDN:   true,
+		memberOfAttr: "memberOf",
+		adAccounts:   true,
+	}
+}
+
+func openLDAPSchema() ldapSchema {
+	return ldapSchema{
+		name:             "openldap",
+		userClasses:      []string{"top", "person", "organizationalPerson", "inetOrgPerson"},
+		userFilter:       "(objectClass=inetOrgPerson)",
+		userRDN:          "uid",
+		loginAttr:        "uid",
+		displayAttr:      "displayName",
+		passwordAttr:     "userPassword",
+		passwordHash:     passwordHashExop,
+		groupClasses:     []string{"top", "groupOfNames"},
+		groupFilter:      "(objectClass=groupOfNames)",
+		groupRDN:         "cn",
+		memberAttr:       "member",
+		memberIsDN:       true,
+		groupNeedsMember: true,
+	}
+}
+
+func newLDAPSchema() ldapSchema {
+	var schema ldapSchema
+	switch name := strings.ToLower(os.Getenv("LDAP_SCHEMA")); name {
+	case "", "ad":
+		schema = adSchema()
+	case "samba":
+		// Samba AD domain controllers speak the AD schema.
+		schema = adSchema()
+		schema.name = name
+	case "openldap":
+		schema = openLDAPSchema()
+	default:
+		logrus.Warnf("unknown LDAP_SCHEMA %q, using the AD schema", name)
+		schema = adSchema()
+	}
+
+	envList(&schema.userClasses, "LDAP_USER_CLASSES")
+	envString(&schema.userFilter, "LDAP_USER_FILTER")
+	envString(&schema.userRDN, "LDAP_USER_RDN_ATTR")
+	envString(&schema.loginAttr, "LDAP_LOGIN_ATTR")
+	envString(&schema.displayAttr, "LDAP_DISPLAY_NAME_ATTR")
+	envString(&schema.upnAttr, "LDAP_UPN_ATTR")
+	envString(&schema.passwordAttr, "LDAP_PASSWORD_ATTR")
+	envString(&schema.passwordHash, "LDAP_PASSWORD_HASH")
+	envList(&schema.groupClasses, "LDAP_GROUP_CLASSES")
+	envString(&schema.groupFilter, "LDAP_GROUP_FILTER")
+	envString(&schema.groupRDN, "LDAP_GROUP_RDN_ATTR")
+	envString(&schema.memberAttr, "LDAP_MEMBER_ATTR")
+	envString(&schema.memberOfAttr, "LDAP_MEMBER_OF_ATTR")
+	if value, ok := os.LookupEnv("LDAP_MEMBER_IS_DN"); ok {
+		schema.memberIsDN = strings.ToLower(value) != "false"
+	}
+	if value, ok := os.LookupEnv("LDAP_GROUP_NEEDS_MEMBER"); ok {
+		schema.groupNeedsMember = strings.ToLower(value) == "true"
+	}
+
+	schema.upnSuffix = os.Getenv("LDAP_UPN_SUFFIX")
+	if schema.upnSuffix == "" {
+		schema.upnSuffix = os.Getenv("AD_DOMAIN")
+	}
+	if schema.upnSuffix == "" {
+		schema.upnSuffix = "school.local"
+	}
+
+	// "none" clears an attribute the preset sets, e.g. memberOf on an
+	// OpenLDAP server without the memberof overlay.
+	for _, attr := range []*string{&schema.upnAttr, &schema.memberOfAttr} {
+		if strings.ToLower(*attr) == "none" {
+			*attr = ""
+		}
+	}
+
+	return schema
+}
+
+func envString(target *string, key string) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		*target = value
+	}
+}
+
+func envList(target *[]string, key string) {
+	if values := splitGroupList(os.Getenv(key)); len(values) > 0 {
+		*target = values
+	}
+}
+
+// userRDNValue is what names the user's entry: the login when the schema
+// names users by it, the display name otherwise.
+func (s ldapSchema) userRDNValue(user ADUser) string {
+	if strings.EqualFold(s.userRDN, s.loginAttr) {
+		return user.SamAccountName
+	}
+	return user.DisplayName
+}
+
+// memberValue is how a user is listed in a group's member attribute.
+func (s ldapSchema) memberValue(userDN, username string) string {
+	if s.memberIsDN {
+		return userDN
+	}
+	return username
+}
+
+func (s ldapSchema) userPrincipalName(username string) string {
+	return fmt.Sprintf("%s@%s", username, s.upnSuffix)
+}
+
+// findUserFilter matches the user signing in as username.
+func (s ldapSchema) findUserFilter(username string) string {
+	return fmt.Sprintf("(&%s(%s=%s))", s.userFilter, s.loginAttr, ldap.EscapeFilter(username))
+}
+
+func (s ldapSchema) findGroupFilter(groupName string) string {
+	return fmt.Sprintf("(&%s(%s=%s))", s.groupFilter, s.groupRDN, ldap.EscapeFilter(groupName))
+}
+
+// groupsWithMemberFilter matches the groups listing the given member value.
+func (s ldapSchema) groupsWithMemberFilter(member string) string {
+	return fmt.Sprintf("(&%s(%s=%s))", s.groupFilter, s.memberAttr, ldap.EscapeFilter(member))
+}
+
+// setPassword writes the password the way the schema asks for.
+func (s ldapSchema) setPassword(conn *ldap.Conn, userDN, password string) error {
+	var value string
+	switch s.passwordHash {
+	case passwordHashExop:
+		_, err := conn.PasswordModify(ldap.NewPasswordModifyRequest(userDN, "", password))
+		return err
+	case passwordHashUnicode:
+		value = string(encodeUnicodePwd(password))
+	case passwordHashSSHA:
+		hashed, err := hashSSHA(password)
+		if err != nil {
+			return err
+		}
+		value = hashed
+	case passwordHashPlain:
+		value = password
+	default:
+		return fmt.Errorf("unknown LDAP_PASSWORD_HASH %q", s.passwordHash)
+	}
+
+	modifyRequest := ldap.NewModifyRequest(userDN, nil)
+	modifyRequest.Replace(s.passwordAttr, []string{value})
+	return conn.Modify(modifyRequest)
+}
+
+func encodeUnicodePwd(password string) []byte {
+	quotedPassword := fmt.Sprintf("\"%s\"", password)
+	utf16Password := utf16.Encode([]rune(quotedPassword))
+
+	// Конвертируем в little-endian bytes
+	passwordBytes := make([]byte, len(utf16Password)*2)
+	for i, r := range utf16Password {
+		passwordBytes[i*2] = byte(r)
+		passwordBytes[i*2+1] = byte(r >> 8)
+	}
+
+	return passwordBytes
+}
+
+func hashSSHA(password string) (string, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	sum := sha1.Sum(append([]byte(password), salt...))
+	return "{SSHA}" + base64.StdEncoding.EncodeToString(append(sum[:], salt...)), nil
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrLoginLocked = errors.New("too many failed sign-in attempts")
+
+// LoginLockedError is returned while a username or client address is locked
+// out; Until tells the client when to try again.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, try again after %s", ErrLoginLocked, e.Until.Format(time.RFC3339))
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+const loginAttemptsCleanupInterval = 10 * time.Minute
+
+// Failed sign-ins are counted per username and per client address. Once a
+// key reaches its limit every further failure locks it, for LOGIN_LOCKOUT_BASE
+// at first and twice as long each time after, up to LOGIN_LOCKOUT_MAX. The
+// address limit is higher because a whole classroom usually shares one
+// address. Counters reset after LOGIN_LOCKOUT_MAX without failures.
+type loginLimits struct {
+	maxUserFailures int
+	maxIPFailures   int
+	baseLockout     time.Duration
+	maxLockout      time.Duration
+}
+
+func newLoginLimits() loginLimits {
+	return loginLimits{
+		maxUserFailures: envInt("LOGIN_MAX_ATTEMPTS", 5),
+		maxIPFailures:   envInt("LOGIN_MAX_ATTEMPTS_PER_IP", 50),
+		baseLockout:     envDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		maxLockout:      envDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+	}
+}
+
+// lockout returns how long a key with the given number of failures is locked.
+func (l loginLimits) lockout(failures, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	lockout := l.baseLockout
+	for i := limit; i < failures && lockout < l.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.maxLockout {
+		lockout = l.maxLockout
+	}
+	return lockout
+}
+
+type LoginLimiter struct {
+	repo         repository.LoginAttempts
+	auditService *AuditService
+	limits       loginLimits
+}
+
+func NewLoginLimiter(repo repository.LoginAttempts, auditService *AuditService) *LoginLimiter {
+	return &LoginLimiter{repo: repo, auditService: auditService, limits: newLoginLimits()}
+}
+
+func userAttemptsKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginAttempt is a sign-in attempt that was counted against its username
+// and address before the credentials were checked. Exactly one of Failed,
+// Succeeded or Release settles it.
+type LoginAttempt struct {
+	limiter  *LoginLimiter
+	username string
+	ip       string
+	reserved []reservedAttempt
+}
+
+type reservedAttempt struct {
+	key      string
+	attempts classosbackend.LoginAttempts
+}
+
+// Begin counts an attempt against the username and the address and fails
+// with a *LoginLockedError when either is locked. The break-glass admin is
+// only throttled by address, so nobody can lock it out on purpose. Store
+// errors let the attempt through: the password check still applies.
+func (l *LoginLimiter) Begin(username, ip string) (*LoginAttempt, error) {
+	attempt := &LoginAttempt{limiter: l, username: username, ip: ip}
+
+	type limitedKey struct {
+		key   string
+		limit int
+	}
+	keys := []limitedKey{{ipAttemptsKey(ip), l.limits.maxIPFailures}}
+	if !strings.EqualFold(strings.TrimSpace(username), classosbackend.SuperAdminUsername) {
+		keys = append(keys, limitedKey{userAttemptsKey(username), l.limits.maxUserFailures})
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		limit := k.limit
+		attempts, ok, err := l.repo.Reserve(k.key, now, now.Add(-l.limits.maxLockout), func(failures int) time.Duration {
+			return l.limits.lockout(failures, limit)
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("key", k.key).Warn("Failed to count sign-in attempt")
+			continue
+		}
+		if !ok {
+			attempt.Release()
+			return nil, &LoginLockedError{Until: *attempts.LockedUntil}
+		}
+		attempt.reserved = append(attempt.reserved, reservedAttempt{key: k.key, attempts: attempts})
+	}
+	return attempt, nil
+}
+
+// Failed keeps the attempt counted as a failure and reports the locks it
+// earned.
+func (a *LoginAttempt) Failed() {
+	for _, r := range a.reserved {
+		if r.attempts.LockedUntil == nil {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"key":      r.key,
+			"failures": r.attempts.Failures,
+			"until":    *r.attempts.LockedUntil,
+			"ip":       a.ip,
+		}).Warn("Sign-in locked after repeated failures")
+
+		event := classosbackend.AuditEvent{
+			Action:     classosbackend.AuditAuthLockout,
+			TargetType: classosbackend.AuditTargetIP,
+			TargetName: a.ip,
+			Changes:    classosbackend.AuditChanges{},
+		}
+		if r.key != ipAttemptsKey(a.ip) {
+			event.TargetType = classosbackend.AuditTargetUser
+			event.TargetName = a.username
+		}
+		event.Changes.Set("failures", nil, r.attempts.Failures)
+		event.Changes.Set("locked_until", nil, r.attempts.LockedUntil.Format(time.RFC3339))
+		a.limiter.auditService.Record(classosbackend.Actor{IP: a.ip}, event, nil)
+	}
+}
+
+// Succeeded clears the failures of the username. The address only gets this
+// attempt back, so that one known password does not reset a spraying attack.
+func (a *LoginAttempt) Succeeded() {
+	for _, r := range a.reserved {
+		if r.key == ipAttemptsKey(a.ip) {
+			a.limiter.refund(r)
+			continue
+		}
+		if err := a.limiter.repo.Delete(r.key); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logrus.WithError(err).WithField("key", r.key).Warn("Failed to reset sign-in attempts")
+		}
+	}
+}
+
+// Release takes the attempt back without judging it, e.g. when the password
+// was right but a second factor is still to come.
+func (a *LoginAttempt) Release() {
+	for _, r := range a.reserved {
+		a.limiter.refund(r)
+	}
+}
+
+func (l *LoginLimiter) refund(r reservedAttempt) {
+	if err := l.repo.Refund(r.key, r.attempts.LockedUntil); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logrus.WithError(err).WithField("key", r.key).Warn("Failed to refund sign-in attempt")
+	}
+}
+
+func (l *LoginLimiter) GetLockouts() ([]classosbackend.LoginAttempts, error) {
+	return l.repo.GetLocked(time.Now())
+}
+
+func (l *LoginLimiter) UnlockUser(actor classosbackend.Actor, username string) (err error) {
+	defer func() {
+		l.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditAuthUnlock,
+			TargetType: classosbackend.AuditTargetUser,
+			TargetName: username,
+		}, err)
+	}()
+
+	return l.repo.Delete(userAttemptsKey(username))
+}
+
+func (l *LoginLimiter) UnlockIP(actor classosbackend.Actor, ip string) (err error) {
+	defer func() {
+		l.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditAuthUnlock,
+			TargetType: classosbackend.AuditTargetIP,
+			TargetName: ip,
+		}, err)
+	}()
+
+	return l.repo.Delete(ipAttemptsKey(ip))
+}
+
+// RunCleanupLoop drops counters that have expired until the context is
+// cancelled.
+func (l *LoginLimiter) RunCleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(loginAttemptsCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			deleted, err := l.repo.DeleteStale(now.Add(-l.limits.maxLockout), now)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to clean up sign-in attempts")
+				continue
+			}
+			if deleted > 0 {
+				logrus.WithField("count", deleted).Debug("Cleaned up sign-in attempts")
+			}
+		}
+	}
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		logrus.Printf("Warning: invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		logrus.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -17,27 +17,29 @@ func (s *LogsService) SaveLogs(logs []classosbackend.UserLog) error {
 	return s.repo.SaveLogs(logs)
 }
 
-func (s *LogsService) GetLogsByUsername(username string, limit, offset int) ([]classosbackend.UserLog, error) {
+func (s *LogsService) GetLogsByUsername(checkerId int, username string, limit, offset int) ([]classosbackend.UserLog, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	return s.repo.GetLogsByUsername(username, limit, offset)
+	return s.repo.GetLogsByUsername(checkerId, username, limit, offset)
 }
 
-func (s *LogsService) GetLogsByDevice(deviceName string, limit, offset int) ([]classosbackend.UserLog, error) {
+func (s *LogsService) GetLogsByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.UserLog, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	return s.repo.GetLogsByDevice(deviceName, limit, offset)
+	return s.repo.GetLogsByDevice(checkerId, deviceName, limit, offset)
 }
 
-func (s *LogsService) GetLogsFiltered(filter classosbackend.LogsFilter) ([]classosbackend.UserLog, error) {
+func (s *LogsService) GetLogsFiltered(checkerId int, filter classosbackend.LogsFilter) ([]classosbackend.UserLog, error) {
 	if filter.Limit <= 0 {
 		filter.Limit = 100
 	}
+	filter.CheckerID = checkerId
 	return s.repo.GetLogsFiltered(filter)
 }
 
-func (s *LogsService) GetLogsCount(filter classosbackend.LogsFilter) (int, error) {
+func (s *LogsService) GetLogsCount(checkerId int, filter classosbackend.LogsFilter) (int, error) {
+	filter.CheckerID = checkerId
 	return s.repo.GetLogsCount(filter)
 }
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// policyReconcileInterval is how often connected agents are checked for a
+// policy that changed on its own, e.g. because an exam started or ended.
+// Whitelist schedule boundaries additionally wake the loop on time.
+const policyReconcileInterval = 15 * time.Second
+
+type PolicyService struct {
+	whitelistRepo       repository.Whitelist
+	globalWhitelistRepo repository.GlobalWhitelist
+	examRepo            repository.Exam
+	deviceRepo          repository.Device
+	hub                 *AgentHub
+}
+
+func NewPolicyService(whitelistRepo repository.Whitelist, globalWhitelistRepo repository.GlobalWhitelist, examRepo repository.Exam, deviceRepo repository.Device, hub *AgentHub) *PolicyService {
+	return &PolicyService{
+		whitelistRepo:       whitelistRepo,
+		globalWhitelistRepo: globalWhitelistRepo,
+		examRepo:            examRepo,
+		deviceRepo:          deviceRepo,
+		hub:                 hub,
+	}
+}
+
+// policyLayers holds the rules for a user split by origin, in the order they
+// are evaluated: global deny, then group allow, then global allow. While an
+// exam is active its whitelist replaces both allow layers.
+type policyLayers struct {
+	globalDeny  []classosbackend.PolicyRule
+	groupAllow  []classosbackend.PolicyRule
+	globalAllow []classosbackend.PolicyRule
+	exam        *classosbackend.ExamSession
+}
+
+func (s *PolicyService) loadLayers(username string) (policyLayers, error) {
+	var layers policyLayers
+
+	exam, err := s.examRepo.GetActiveForUser(username, time.Now())
+	switch {
+	case err == nil:
+		layers.exam = &exam
+	case !errors.Is(err, sql.ErrNoRows):
+		return layers, fmt.Errorf("failed to load active exam for %s: %w", username, err)
+	}
+
+	if layers.exam == nil {
+		entries, err := s.whitelistRepo.GetAllForUser(username)
+		if err != nil {
+			return layers, fmt.Errorf("failed to load whitelist for %s: %w", username, err)
+		}
+		now := time.Now()
+		for _, entry := range entries {
+			if !entry.ActiveAt(now) {
+				continue
+			}
+			layers.groupAllow = append(layers.groupAllow, classosbackend.PolicyRule{Type: entry.Type, Value: entry.Value})
+		}
+	}
+
+	globals, err := s.globalWhitelistRepo.GetAll("")
+	if err != nil {
+		return layers, fmt.Errorf("failed to load global lists: %w", err)
+	}
+	for _, entry := range globals {
+		rule := classosbackend.PolicyRule{Type: entry.Type, Value: entry.Value}
+		if entry.List == classosbackend.GlobalListDeny {
+			layers.globalDeny = append(layers.globalDeny, rule)
+		} else if layers.exam == nil {
+			layers.globalAllow = append(layers.globalAllow, rule)
+		}
+	}
+
+	return layers, nil
+}
+
+func (l policyLayers) policy(username string) classosbackend.Policy {
+	policy := classosbackend.Policy{
+		Username:    username,
+		Allow:       uniqueRules(l.groupAllow, l.globalAllow),
+		Deny:        uniqueRules(l.globalDeny),
+		GeneratedAt: time.Now(),
+	}
+	if l.exam != nil {
+		policy.Allow = uniqueRules(l.exam.Whitelist)
+		policy.Exam = &classosbackend.ExamRestrictions{
+			ExamID:         l.exam.ID,
+			BlockClipboard: l.exam.BlockClipboard,
+			BlockUSB:       l.exam.BlockUSB,
+			EndsAt:         l.exam.EndsAt,
+		}
+	}
+	policy.Seal()
+	return policy
+}
+
+type policyStep struct {
+	layer   string
+	allowed bool
+	rules   []classosbackend.PolicyRule
+}
+
+// steps returns the layers in evaluation order.
+func (l policyLayers) steps() []policyStep {
+	if l.exam != nil {
+		return []policyStep{
+			{classosbackend.PolicyLayerGlobalDeny, false, l.globalDeny},
+			{classosbackend.PolicyLayerExamAllow, true, l.exam.Whitelist},
+		}
+	}
+	return []policyStep{
+		{classosbackend.PolicyLayerGlobalDeny, false, l.globalDeny},
+		{classosbackend.PolicyLayerGroupAllow, true, l.groupAllow},
+		{classosbackend.PolicyLayerGlobalAllow, true, l.globalAllow},
+	}
+}
+
+// decide evaluates the layers for a resource.
+func (l policyLayers) decide(decision classosbackend.PolicyDecision) classosbackend.PolicyDecision {
+	for _, step := range l.steps() {
+		for _, rule := range step.rules {
+			if rule.Matches(decision.Resource) {
+				matched := rule
+				decision.Allowed = step.allowed
+				decision.Layer = step.layer
+				decision.MatchedRule = &matched
+				return decision
+			}
+		}
+	}
+
+	decision.Layer = classosbackend.PolicyLayerDefault
+	return decision
+}
+
+func uniqueRules(lists ...[]classosbackend.PolicyRule) []classosbackend.PolicyRule {
+	rules := make([]classosbackend.PolicyRule, 0)
+	seen := make(map[classosbackend.PolicyRule]bool)
+	for _, list := range lists {
+		for _, rule := range list {
+			if seen[rule] {
+				continue
+			}
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (s *PolicyService) GetEffectivePolicy(username string) (classosbackend.Policy, error) {
+	layers, err := s.loadLayers(username)
+	if err != nil {
+		return classosbackend.Policy{}, err
+	}
+	return layers.policy(username), nil
+}
+
+// CheckAccess answers whether a resource is allowed for a user right now and
+// which layer decided it.
+func (s *PolicyService) CheckAccess(username, resource string) (classosbackend.PolicyDecision, error) {
+	decision := classosbackend.PolicyDecision{
+		Username: username,
+		Resource: resource,
+	}
+
+	layers, err := s.loadLayers(username)
+	if err != nil {
+		return decision, err
+	}
+	decision.PolicyVersion = layers.policy(username).Version
+
+	return layers.decide(decision), nil
+}
+
+// PushToDevice sends the effective policy of the given user to a connected
+// agent. Devices that are not connected get their policy on the next connect.
+func (s *PolicyService) PushToDevice(deviceName, username string) error {
+	session, ok := s.hub.Get(deviceName)
+	if !ok {
+		return nil
+	}
+
+	policy, err := s.GetEffectivePolicy(username)
+	if err != nil {
+		return err
+	}
+
+	return s.push(session, policy)
+}
+
+func (s *PolicyService) push(session *AgentSession, policy classosbackend.Policy) error {
+	deviceName := session.DeviceName()
+
+	if err := session.Send(classosbackend.AgentMessage{Type: "policy", Policy: &policy}); err != nil {
+		return fmt.Errorf("failed to push policy to %s: %w", deviceName, err)
+	}
+	session.setPolicyVersion(policy.Version)
+
+	if err := s.deviceRepo.SetPolicyPushed(deviceName, policy.Version); err != nil {
+		return fmt.Errorf("failed to record pushed policy for %s: %w", deviceName, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"device":  deviceName,
+		"user":    policy.Username,
+		"version": policy.Version,
+	}).Info("Policy pushed to agent")
+	return nil
+}
+
+// PushToGroup re-sends the policy to every connected device on which a member
+// of the group is currently logged in.
+func (s *PolicyService) PushToGroup(groupId int) error {
+	devices, err := s.deviceRepo.GetDevicesByGroup(groupId)
+	if err != nil {
+		return fmt.Errorf("failed to find devices of group %d: %w", groupId, err)
+	}
+
+	for _, device := range devices {
+		if err := s.PushToDevice(device.DeviceName, device.Username); err != nil {
+			logrus.WithError(err).WithField("device", device.DeviceName).Warn("Policy push failed")
+		}
+	}
+	return nil
+}
+
+// PushToAll re-sends the policy to every connected agent, used when the
+// school-wide lists change.
+func (s *PolicyService) PushToAll() error {
+	for _, session := range s.hub.Sessions() {
+		username := session.Username()
+		if username == "" {
+			continue
+		}
+		if err := s.PushToDevice(session.DeviceName(), username); err != nil {
+			logrus.WithError(err).WithField("device", session.DeviceName()).Warn("Policy push failed")
+		}
+	}
+	return nil
+}
+
+// Reconcile recomputes the policy of every connected agent and pushes it
+// where it differs from what the agent last received. This is what switches
+// devices into and out of exam mode and schedule windows at the right time.
+func (s *PolicyService) Reconcile() {
+	for _, session := range s.hub.Sessions() {
+		username := session.Username()
+		if username == "" {
+			continue
+		}
+
+		policy, err := s.GetEffectivePolicy(username)
+		if err != nil {
+			logrus.WithError(err).WithField("device", session.DeviceName()).Warn("Policy reconcile failed")
+			continue
+		}
+		if policy.Version == session.PolicyVersion() {
+			continue
+		}
+
+		if err := s.push(session, policy); err != nil {
+			logrus.WithError(err).WithField("device", session.DeviceName()).Warn("Policy push failed")
+		}
+	}
+}
+
+// RunReconcileLoop calls Reconcile periodically and right after every
+// whitelist schedule boundary until the context is cancelled.
+func (s *PolicyService) RunReconcileLoop(ctx context.Context) {
+	timer := time.NewTimer(s.nextReconcileDelay(time.Now()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.Reconcile()
+			timer.Reset(s.nextReconcileDelay(time.Now()))
+		}
+	}
+}
+
+func (s *PolicyService) nextReconcileDelay(now time.Time) time.Duration {
+	delay := policyReconcileInterval
+
+	schedules, err := s.whitelistRepo.GetAllSchedules()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to load whitelist schedules")
+		return delay
+	}
+
+	boundary := classosbackend.NextScheduleBoundary(schedules, now)
+	if !boundary.IsZero() && boundary.Sub(now) < delay {
+		// Wake just after the boundary so the window is already open or
+		// closed when the policy is rebuilt.
+		delay = boundary.Sub(now) + time.Second
+	}
+	return delay
+}
+
+func (s *PolicyService) AcknowledgePolicy(deviceName, version string) error {
+	if version == "" {
+		return fmt.Errorf("policy version is required")
+	}
+	return s.deviceRepo.SetPolicyApplied(deviceName, version)
+}
+
+// notifyGroup pushes the group policy in the background so that admin
+// requests do not wait for slow agents.
+func (s *PolicyService) notifyGroup(groupId int) {
+	if s == nil {
+		return
+	}
+	go func() {
+		if err := s.PushToGroup(groupId); err != nil {
+			logrus.WithError(err).WithField("group", groupId).Warn("Group policy push failed")
+		}
+	}()
+}
+
+func (s *PolicyService) notifyAll() {
+	if s == nil {
+		return
+	}
+	go func() {
+		if err := s.PushToAll(); err != nil {
+			logrus.WithError(err).Warn("Policy push to all agents failed")
+		}
+	}()
+}
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// RolloverService moves classes on to a new school year. A plan is checked
+// against the current groups and previewed; applying it changes the database
+// in one transaction and journals the AD changes, which follow on their own.
+// The latest rollover can be rolled back until ROLLOVER_ROLLBACK_WINDOW has
+// passed.
+type RolloverService struct {
+	repo         repository.Rollover
+	journal      *DirectoryJournal
+	authService  *AuthService
+	auditService *AuditService
+	window       time.Duration
+}
+
+func NewRolloverService(repo repository.Rollover, journal *DirectoryJournal, authService *AuthService, auditService *AuditService) *RolloverService {
+	return &RolloverService{
+		repo:         repo,
+		journal:      journal,
+		authService:  authService,
+		auditService: auditService,
+		window:       envDuration("ROLLOVER_ROLLBACK_WINDOW", 30*24*time.Hour),
+	}
+}
+
+// Preview returns what applying the plan would change.
+func (s *RolloverService) Preview(plan classosbackend.RolloverPlan) (classosbackend.RolloverChanges, error) {
+	return s.changes(&plan, time.Now())
+}
+
+func (s *RolloverService) Apply(actor classosbackend.Actor, plan classosbackend.RolloverPlan) (rollover classosbackend.Rollover, err error) {
+	event := classosbackend.AuditEvent{
+		Action:     classosbackend.AuditRolloverApply,
+		TargetType: classosbackend.AuditTargetRollover,
+		Changes:    classosbackend.AuditChanges{},
+	}
+	defer func() {
+		if rollover.ID != 0 {
+			event.TargetID = strconv.FormatInt(rollover.ID, 10)
+		}
+		s.auditService.Record(actor, event, err)
+	}()
+
+	now := time.Now()
+	changes, err := s.changes(&plan, now)
+	if err != nil {
+		return rollover, err
+	}
+	event.TargetName = rolloverSummary(changes)
+	for _, group := range changes.Groups {
+		event.Changes.Set("group "+strconv.Itoa(group.GroupID), group.Name, group.NewName)
+	}
+
+	rollover = classosbackend.Rollover{
+		Plan:          plan,
+		Changes:       changes,
+		Status:        classosbackend.RolloverApplied,
+		AppliedAt:     now,
+		RollbackUntil: now.Add(s.window),
+	}
+	if actor.ID != 0 {
+		actorId := actor.ID
+		rollover.ActorID = &actorId
+	}
+
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryRolloverApply,
+		TargetName: event.TargetName,
+		Payload:    classosbackend.DirectoryPayload{Actions: rolloverApplyActions(changes)},
+	}
+
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.ApplyWithTx(tx, changes, now); err != nil {
+			return rolloverWriteError(err)
+		}
+		id, err := s.repo.CreateWithTx(tx, rollover)
+		if err != nil {
+			return fmt.Errorf("failed to save rollover: %w", err)
+		}
+		rollover.ID = id
+		op.TargetID = strconv.FormatInt(id, 10)
+		return nil
+	})
+	if err != nil {
+		rollover.ID = 0
+		return rollover, err
+	}
+
+	// Archived students lose access at once, not when their tokens expire.
+	for _, user := range changes.Archived {
+		if err := s.authService.RevokeAllSessions(user.UserID); err != nil {
+			logrus.WithError(err).WithField("user_id", user.UserID).Warn("Failed to revoke sessions of archived user")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"rollover": rollover.ID,
+		"groups":   len(changes.Groups),
+		"moves":    len(changes.Moves),
+		"archived": len(changes.Archived),
+	}).Info("Rollover applied")
+	return rollover, nil
+}
+
+// Rollback restores the groups, memberships and accounts the rollover
+// changed. Only the latest rollover can be rolled back, within its window.
+func (s *RolloverService) Rollback(actor classosbackend.Actor, id int64) (rollover classosbackend.Rollover, err error) {
+	defer func() {
+		s.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditRolloverRevert,
+			TargetType: classosbackend.AuditTargetRollover,
+			TargetID:   strconv.FormatInt(id, 10),
+			TargetName: rolloverSummary(rollover.Changes),
+		}, err)
+	}()
+
+	rollover, err = s.repo.GetById(id)
+	if err != nil {
+		return rollover, err
+	}
+
+	latest, err := s.repo.GetLatest()
+	if err != nil {
+		return rollover, err
+	}
+
+	now := time.Now()
+	switch {
+	case rollover.Status != classosbackend.RolloverApplied:
+		return rollover, fmt.Errorf("%w: it is %s", classosbackend.ErrRolloverNotRevertible, rollover.Status)
+	case latest.ID != rollover.ID:
+		return rollover, fmt.Errorf("%w: rollover %d was applied after it", classosbackend.ErrRolloverNotRevertible, latest.ID)
+	case now.After(rollover.RollbackUntil):
+		return rollover, fmt.Errorf("%w: the rollback window ended at %s", classosbackend.ErrRolloverNotRevertible, rollover.RollbackUntil.Format(time.RFC3339))
+	}
+
+	op := classosbackend.DirectoryOperation{
+		Kind:       classosbackend.DirectoryRolloverRevert,
+		TargetID:   strconv.FormatInt(id, 10),
+		TargetName: rolloverSummary(rollover.Changes),
+		Payload:    classosbackend.DirectoryPayload{Actions: rolloverRevertActions(rollover.Changes)},
+	}
+
+	err = s.journal.Run(actor, op, func(tx *sql.Tx, op *classosbackend.DirectoryOperation) error {
+		if err := s.repo.RevertWithTx(tx, rollover.Changes); err != nil {
+			return rolloverWriteError(err)
+		}
+		if err := s.repo.MarkRolledBackWithTx(tx, id, now); err != nil {
+			return rolloverWriteError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return rollover, err
+	}
+
+	rollover.Status = classosbackend.RolloverRolledBack
+	rollover.RolledBackAt = &now
+	logrus.WithField("rollover", id).Info("Rollover rolled back")
+	return rollover, nil
+}
+
+func (s *RolloverService) GetAll(limit, offset int) ([]classosbackend.Rollover, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	return s.repo.GetAll(limit, offset)
+}
+
+func (s *RolloverService) Count() (int, error) {
+	return s.repo.Count()
+}
+
+func (s *RolloverService) GetById(id int64) (classosbackend.Rollover, error) {
+	return s.repo.GetById(id)
+}
+
+// changes checks the plan against the current groups and works out what it
+// changes. Merged and archived groups are kept under a new name so that
+// their names are free for the new year and the rollover can be undone.
+func (s *RolloverService) changes(plan *classosbackend.RolloverPlan, now time.Time) (classosbackend.RolloverChanges, error) {
+	changes := classosbackend.RolloverChanges{
+		Groups:   []classosbackend.RolloverGroup{},
+		Moves:    []classosbackend.RolloverMove{},
+		Archived: []classosbackend.RolloverArchivedUser{},
+	}
+
+	if err := plan.Validate(); err != nil {
+		return changes, err
+	}
+
+	groups, err := s.repo.GetGroups()
+	if err != nil {
+		return changes, fmt.Errorf("failed to get groups: %w", err)
+	}
+	members, err := s.repo.GetMembers()
+	if err != nil {
+		return changes, fmt.Errorf("failed to get group members: %w", err)
+	}
+
+	groupsById := make(map[int]classosbackend.Group, len(groups))
+	for _, group := range groups {
+		groupsById[int(group.ID)] = group
+	}
+	membersByGroup := make(map[int][]classosbackend.GroupMember)
+	userGroups := make(map[int][]int)
+	for _, member := range members {
+		membersByGroup[member.GroupID] = append(membersByGroup[member.GroupID], member)
+		userGroups[member.UserID] = append(userGroups[member.UserID], member.GroupID)
+	}
+
+	steps := make(map[int]classosbackend.RolloverStep, len(plan.Steps))
+	for _, step := range plan.Steps {
+		steps[step.GroupID] = step
+	}
+
+	pending := make([]classosbackend.RolloverGroup, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		group, ok := groupsById[step.GroupID]
+		if !ok || group.ArchivedAt != nil {
+			return changes, fmt.Errorf("%w: group %d does not exist or is archived", classosbackend.ErrInvalidRollover, step.GroupID)
+		}
+
+		change := classosbackend.RolloverGroup{
+			GroupID: step.GroupID,
+			Action:  step.Action,
+			Name:    group.Name,
+			NewName: step.NewName,
+			Members: len(membersByGroup[step.GroupID]),
+		}
+		if step.Action != classosbackend.RolloverRename {
+			change.Archived = true
+			if change.NewName == "" {
+				change.NewName = fmt.Sprintf("%s (%d)", group.Name, now.Year())
+			}
+		}
+
+		if step.Action == classosbackend.RolloverMerge {
+			target, ok := groupsById[step.TargetGroupID]
+			if !ok || target.ArchivedAt != nil {
+				return changes, fmt.Errorf("%w: target group %d does not exist or is archived", classosbackend.ErrInvalidRollover, step.TargetGroupID)
+			}
+			if targetStep, ok := steps[step.TargetGroupID]; ok && targetStep.Action != classosbackend.RolloverRename {
+				return changes, fmt.Errorf("%w: group %s is merged into %s, which is retired too", classosbackend.ErrInvalidRollover, group.Name, target.Name)
+			}
+			change.TargetID = step.TargetGroupID
+			change.TargetName = target.Name
+			if targetStep, ok := steps[step.TargetGroupID]; ok {
+				change.TargetName = targetStep.NewName
+			}
+		}
+
+		pending = append(pending, change)
+	}
+
+	if err := checkRolloverNames(groups, pending); err != nil {
+		return changes, err
+	}
+	if changes.Groups, err = orderRolloverRenames(groups, pending); err != nil {
+		return changes, err
+	}
+
+	// Students of a merged class move to the target.
+	for _, change := range changes.Groups {
+		if change.Action != classosbackend.RolloverMerge {
+			continue
+		}
+		for _, member := range membersByGroup[change.GroupID] {
+			changes.Moves = append(changes.Moves, classosbackend.RolloverMove{
+				UserID:        member.UserID,
+				Username:      member.Username,
+				FromGroupID:   change.GroupID,
+				ToGroupID:     change.TargetID,
+				AlreadyMember: containsInt(userGroups[member.UserID], change.TargetID),
+				Primary:       member.Primary,
+			})
+		}
+	}
+
+	// Students of an archived class are archived with it, unless they are
+	// still in a class that stays.
+	archived := make(map[int]bool)
+	for _, change := range changes.Groups {
+		if change.Action != classosbackend.RolloverArchive {
+			continue
+		}
+		for _, member := range membersByGroup[change.GroupID] {
+			if member.Role != classosbackend.RoleClient || member.Status == classosbackend.UserStatusArchived || archived[member.UserID] {
+				continue
+			}
+			if rolloverKeepsUser(userGroups[member.UserID], groupsById, steps) {
+				continue
+			}
+			archived[member.UserID] = true
+			changes.Archived = append(changes.Archived, classosbackend.RolloverArchivedUser{
+				UserID:         member.UserID,
+				Username:       member.Username,
+				PreviousStatus: member.Status,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// checkRolloverNames makes sure that no two groups end up with the same
+// name. Names are compared like AD does, ignoring case.
+func checkRolloverNames(groups []classosbackend.Group, pending []classosbackend.RolloverGroup) error {
+	newNames := make(map[int]string, len(pending))
+	for _, change := range pending {
+		newNames[change.GroupID] = change.NewName
+	}
+
+	taken := make(map[string]string, len(groups))
+	for _, group := range groups {
+		name := group.Name
+		if newName, ok := newNames[int(group.ID)]; ok {
+			name = newName
+		}
+		key := strings.ToLower(name)
+		if other, ok := taken[key]; ok {
+			return fmt.Errorf("%w: %s and %s would both be named %s", classosbackend.ErrInvalidRollover, other, group.Name, name)
+		}
+		taken[key] = group.Name
+	}
+	return nil
+}
+
+// orderRolloverRenames orders the renames so that every group is renamed
+// after the group holding its new name, e.g. 10A to 11A before 9A to 10A.
+// Groups swapping names cannot be ordered and are rejected.
+func orderRolloverRenames(groups []classosbackend.Group, pending []classosbackend.RolloverGroup) ([]classosbackend.RolloverGroup, error) {
+	holders := make(map[string]int, len(groups))
+	for _, group := range groups {
+		holders[strings.ToLower(group.Name)] = int(group.ID)
+	}
+
+	ordered := make([]classosbackend.RolloverGroup, 0, len(pending))
+	renamed := make(map[int]bool, len(pending))
+	for len(pending) > 0 {
+		var blocked []classosbackend.RolloverGroup
+		for _, change := range pending {
+			holder, held := holders[strings.ToLower(change.NewName)]
+			if held && holder != change.GroupID && !renamed[holder] {
+				blocked = append(blocked, change)
+				continue
+			}
+			ordered = append(ordered, change)
+			renamed[change.GroupID] = true
+		}
+		if len(blocked) == len(pending) {
+			return nil, fmt.Errorf("%w: groups %s swap names", classosbackend.ErrInvalidRollover, rolloverGroupNames(blocked))
+		}
+		pending = blocked
+	}
+	return ordered, nil
+}
+
+// rolloverKeepsUser reports whether one of the user's groups stays active.
+// A merged group counts: its students move on to the target.
+func rolloverKeepsUser(groupIds []int, groups map[int]classosbackend.Group, steps map[int]classosbackend.RolloverStep) bool {
+	for _, groupId := range groupIds {
+		if group, ok := groups[groupId]; !ok || group.ArchivedAt != nil {
+			continue
+		}
+		if step, ok := steps[groupId]; !ok || step.Action != classosbackend.RolloverArchive {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloverApplyActions are the AD changes of a rollover. Members move while
+// the groups still have their old names; the groups are renamed last, in
+// the order the database renamed them.
+func rolloverApplyActions(changes classosbackend.RolloverChanges) []classosbackend.DirectoryAction {
+	names := rolloverOldNames(changes)
+	actions := make([]classosbackend.DirectoryAction, 0, len(changes.Moves)+len(changes.Archived)+len(changes.Groups))
+
+	for _, move := range changes.Moves {
+		action := classosbackend.DirectoryAction{
+			Kind:              classosbackend.DirectoryActionUserMove,
+			Username:          move.Username,
+			GroupName:         names[move.ToGroupID],
+			PreviousGroupName: names[move.FromGroupID],
+		}
+		if move.AlreadyMember {
+			action = classosbackend.DirectoryAction{
+				Kind:      classosbackend.DirectoryActionUserRemove,
+				Username:  move.Username,
+				GroupName: names[move.FromGroupID],
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	for _, user := range changes.Archived {
+		actions = append(actions, classosbackend.DirectoryAction{
+			Kind:     classosbackend.DirectoryActionUserDisable,
+			Username: user.Username,
+		})
+	}
+
+	for _, group := range changes.Groups {
+		actions = append(actions, classosbackend.DirectoryAction{
+			Kind:              classosbackend.DirectoryActionGroupRename,
+			GroupName:         group.NewName,
+			PreviousGroupName: group.Name,
+		})
+	}
+
+	return actions
+}
+
+// rolloverRevertActions undo rolloverApplyActions in reverse order.
+// Accounts that were disabled before the rollover stay disabled.
+func rolloverRevertActions(changes classosbackend.RolloverChanges) []classosbackend.DirectoryAction {
+	names := rolloverOldNames(changes)
+	actions := make([]classosbackend.DirectoryAction, 0, len(changes.Moves)+len(changes.Archived)+len(changes.Groups))
+
+	for i := len(changes.Groups) - 1; i >= 0; i-- {
+		group := changes.Groups[i]
+		actions = append(actions, classosbackend.DirectoryAction{
+			Kind:              classosbackend.DirectoryActionGroupRename,
+			GroupName:         group.Name,
+			PreviousGroupName: group.NewName,
+		})
+	}
+
+	for _, move := range changes.Moves {
+		action := classosbackend.DirectoryAction{
+			Kind:              classosbackend.DirectoryActionUserMove,
+			Username:          move.Username,
+			GroupName:         names[move.FromGroupID],
+			PreviousGroupName: names[move.ToGroupID],
+		}
+		if move.AlreadyMember {
+			action = classosbackend.DirectoryAction{
+				Kind:      classosbackend.DirectoryActionUserAdd,
+				Username:  move.Username,
+				GroupName: names[move.FromGroupID],
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	for _, user := range changes.Archived {
+		if user.PreviousStatus != classosbackend.UserStatusActive {
+			continue
+		}
+		actions = append(actions, classosbackend.DirectoryAction{
+			Kind:     classosbackend.DirectoryActionUserEnable,
+			Username: user.Username,
+		})
+	}
+
+	return actions
+}
+
+// rolloverOldNames maps the groups of a rollover to their names before it.
+func rolloverOldNames(changes classosbackend.RolloverChanges) map[int]string {
+	names := make(map[int]string, len(changes.Groups)*2)
+	for _, group := range changes.Groups {
+		if group.TargetID != 0 {
+			if _, ok := names[group.TargetID]; !ok {
+				names[group.TargetID] = group.TargetName
+			}
+		}
+	}
+	// TargetName is the name after the rollover; targets renamed by it are
+	// mapped to their old name here.
+	for _, group := range changes.Groups {
+		names[group.GroupID] = group.Name
+	}
+	return names
+}
+
+// rolloverWriteError reports a conditional update that found the group or
+// user changed since the plan was checked.
+func rolloverWriteError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", classosbackend.ErrRolloverConflict, err)
+	}
+	return fmt.Errorf("failed to apply rollover in DB: %w", err)
+}
+
+func rolloverSummary(changes classosbackend.RolloverChanges) string {
+	return fmt.Sprintf("%d groups, %d moved, %d archived", len(changes.Groups), len(changes.Moves), len(changes.Archived))
+}
+
+func rolloverGroupNames(groups []classosbackend.RolloverGroup) string {
+	names := make([]string, len(groups))
+	for i, group := range groups {
+		names[i] = group.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
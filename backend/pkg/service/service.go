@@ -1,67 +1,264 @@
 package service
 
 import (
+	"io"
+
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
 
 type Authorization interface {
 	CreateUser(user classosbackend.User) (int, error)
-	GenerateToken(username, password string) (string, error)
+	SignIn(username, password string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error)
+	VerifyMFA(mfaToken, code string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error)
+	SetupMFAEnrollment(mfaToken string) (classosbackend.TOTPSetup, error)
+	CompleteMFAEnrollment(mfaToken, code string, client classosbackend.ClientInfo) (classosbackend.SignInResult, error)
+	Refresh(refreshToken string) (classosbackend.TokenPair, error)
+	Logout(refreshToken string) error
 	ParseToken(token string) (int, string, error)
-	GeneratePasswordHash(password string) string
+	GeneratePasswordHash(password string) (string, error)
 	GetUserByCredentials(username, password string) (classosbackend.User, error)
+
+	GetSessions(userId int) ([]classosbackend.AuthSession, error)
+	RevokeSession(userId int, sessionId string) error
+	RevokeAllSessions(userId int) error
+}
+
+type TwoFactor interface {
+	GetStatus(userId int) (classosbackend.TwoFactorStatus, error)
+	Setup(userId int) (classosbackend.TOTPSetup, error)
+	Enable(actor classosbackend.Actor, code string) ([]string, error)
+	Disable(actor classosbackend.Actor, code string) error
+	RegenerateRecoveryCodes(actor classosbackend.Actor, code string) ([]string, error)
+	Reset(actor classosbackend.Actor, userId int) error
+}
+
+type DirectoryOperations interface {
+	GetAll(filter classosbackend.DirectoryOperationFilter) ([]classosbackend.DirectoryOperation, error)
+	Count(filter classosbackend.DirectoryOperationFilter) (int, error)
+	GetById(id int64) (classosbackend.DirectoryOperation, error)
+	Retry(actor classosbackend.Actor, id int64) (classosbackend.DirectoryOperation, error)
+}
+
+type DirectorySync interface {
+	TestConnection() error
+	StartSync(actor classosbackend.Actor) (classosbackend.SyncRun, error)
+	ApplySync(actor classosbackend.Actor, input classosbackend.SyncApplyInput) (classosbackend.SyncRun, error)
+	GetRuns(limit, offset int) ([]classosbackend.SyncRun, error)
+	CountRuns() (int, error)
+	GetRun(id int64) (classosbackend.SyncRun, error)
+}
+
+type Rollover interface {
+	Preview(plan classosbackend.RolloverPlan) (classosbackend.RolloverChanges, error)
+	Apply(actor classosbackend.Actor, plan classosbackend.RolloverPlan) (classosbackend.Rollover, error)
+	Rollback(actor classosbackend.Actor, id int64) (classosbackend.Rollover, error)
+	GetAll(limit, offset int) ([]classosbackend.Rollover, error)
+	Count() (int, error)
+	GetById(id int64) (classosbackend.Rollover, error)
+}
+
+type Lockout interface {
+	GetLockouts() ([]classosbackend.LoginAttempts, error)
+	UnlockUser(actor classosbackend.Actor, username string) error
+	UnlockIP(actor classosbackend.Actor, ip string) error
 }
 
+// Mutating group, user and device methods take the acting user instead of a
+// bare checkerId so that the change can be written to the audit trail.
 type Group interface {
-	Create(checkerId int, group classosbackend.Group) (int, error)
-	GetAll(checkerId int) ([]classosbackend.Group, error)
+	Create(actor classosbackend.Actor, group classosbackend.Group) (int, error)
+	GetAll(checkerId int, filter classosbackend.GroupsFilter) ([]classosbackend.Group, error)
+	Count(checkerId int, filter classosbackend.GroupsFilter) (int, error)
 	GetById(checkerId, groupId int) (classosbackend.Group, error)
-	Delete(checkerId, groupId int) error
-	Update(checkerId, groupId int, input classosbackend.UpdateGroupInput) error
+	Delete(actor classosbackend.Actor, groupId int) error
+	Update(actor classosbackend.Actor, groupId int, input classosbackend.UpdateGroupInput) error
+
+	GetTeachers(checkerId, groupId int) ([]classosbackend.User, error)
+	AddTeacher(actor classosbackend.Actor, groupId, userId int) error
+	RemoveTeacher(actor classosbackend.Actor, groupId, userId int) error
+
+	GetMembers(checkerId, groupId int) ([]classosbackend.GroupMember, error)
+	AddMember(actor classosbackend.Actor, groupId, userId int) error
+	RemoveMember(actor classosbackend.Actor, groupId, userId int) error
 }
 
 type User interface {
-	Create(checkerId, groupId int, user classosbackend.User) (int, error)
-	GetAll(checkerId int) ([]classosbackend.User, error)
+	Create(actor classosbackend.Actor, groupId int, user classosbackend.User) (int, error)
+	GetAll(checkerId int, filter classosbackend.UsersFilter) ([]classosbackend.User, error)
+	Count(checkerId int, filter classosbackend.UsersFilter) (int, error)
 	GetById(checkerId, userId int) (classosbackend.User, error)
-	Delete(checkerId, userId int) error
-	Update(checkerId, userId int, input classosbackend.UpdateUserInput) error
+	Delete(actor classosbackend.Actor, userId int) error
+	Update(actor classosbackend.Actor, userId int, input classosbackend.UpdateUserInput) error
+
+	Disable(actor classosbackend.Actor, userId int) error
+	Enable(actor classosbackend.Actor, userId int) error
+	Archive(actor classosbackend.Actor, userId int) error
+	Restore(actor classosbackend.Actor, userId int) error
+}
+
+type UserImport interface {
+	Import(actor classosbackend.Actor, filename string, data []byte, options classosbackend.ImportOptions) (classosbackend.ImportReport, error)
+	WriteCredentials(w io.Writer, id string) error
+}
+
+type Whitelist interface {
+	GetAll(checkerId, groupId int) ([]classosbackend.WhitelistEntry, error)
+	GetById(checkerId, groupId, entryId int) (classosbackend.WhitelistEntry, error)
+	Create(checkerId, groupId int, entry classosbackend.WhitelistEntry) (int, error)
+	Update(checkerId, groupId, entryId int, input classosbackend.UpdateWhitelistEntryInput) error
+	Delete(checkerId, groupId, entryId int) error
+	Replace(checkerId, groupId int, entries []classosbackend.WhitelistEntry) ([]classosbackend.WhitelistEntry, error)
+}
+
+type GlobalWhitelist interface {
+	GetAll(list string) ([]classosbackend.GlobalWhitelistEntry, error)
+	GetById(entryId int) (classosbackend.GlobalWhitelistEntry, error)
+	Create(entry classosbackend.GlobalWhitelistEntry) (int, error)
+	Update(entryId int, input classosbackend.UpdateGlobalWhitelistEntryInput) error
+	Delete(entryId int) error
+}
+
+type Policy interface {
+	GetEffectivePolicy(username string) (classosbackend.Policy, error)
+	CheckAccess(username, resource string) (classosbackend.PolicyDecision, error)
+	PushToDevice(deviceName, username string) error
+	PushToGroup(groupId int) error
+	PushToAll() error
+	AcknowledgePolicy(deviceName, version string) error
+}
+
+type Agents interface {
+	Register(deviceName string, session *AgentSession)
+	Unregister(session *AgentSession)
+	IsOnline(deviceName string) bool
 }
 
 type Device interface {
 	UpsertDeviceStatus(device classosbackend.DeviceStatus) error
-	GetAllDevices() ([]classosbackend.DeviceStatus, error)
-	GetOnlineDevices() ([]classosbackend.DeviceStatus, error)
-	GetDeviceByName(deviceName string) (classosbackend.DeviceStatus, error)
-	DeleteDevice(deviceName string) error
+	GetAllDevices(checkerId int) ([]classosbackend.DeviceStatus, error)
+	GetOnlineDevices(checkerId int) ([]classosbackend.DeviceStatus, error)
+	GetDeviceByName(checkerId int, deviceName string) (classosbackend.DeviceStatus, error)
+	DeleteDevice(actor classosbackend.Actor, deviceName string) error
+
+	CreateEnrollmentCode(checkerId int, input classosbackend.CreateEnrollmentCodeInput) (classosbackend.EnrollmentCode, error)
+	EnrollDevice(input classosbackend.EnrollDeviceInput) (classosbackend.DeviceCredential, error)
+	AuthenticateDevice(deviceName, credential string) error
+	GetEnrolledDevices() ([]classosbackend.EnrolledDevice, error)
+	RevokeDevice(actor classosbackend.Actor, deviceName string) error
+	SetDeviceRoom(actor classosbackend.Actor, deviceName string, room *string) error
+}
+
+type Command interface {
+	Send(checkerId int, deviceName string, input classosbackend.SendCommandInput) (classosbackend.DeviceCommand, error)
+	SendToGroup(checkerId, groupId int, input classosbackend.SendCommandInput) (classosbackend.CommandDeliveryReport, error)
+	SendToRoom(checkerId int, room string, input classosbackend.SendCommandInput) (classosbackend.CommandDeliveryReport, error)
+	DeliverPending(deviceName string) error
+	GetById(checkerId int, commandId string) (classosbackend.DeviceCommand, error)
+	GetByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.DeviceCommand, error)
+	Acknowledge(deviceName string, ack classosbackend.CommandAck) error
+}
+
+type Exam interface {
+	Create(checkerId int, session classosbackend.ExamSession) (int, error)
+	GetAll(checkerId, groupId int) ([]classosbackend.ExamSession, error)
+	GetById(checkerId, examId int) (classosbackend.ExamSession, error)
+	Update(checkerId, examId int, input classosbackend.UpdateExamSessionInput) error
+	Delete(checkerId, examId int) error
+	GetViolations(checkerId, examId, limit, offset int) ([]classosbackend.ExamViolation, error)
+	RecordViolations(deviceName string, logs []classosbackend.UserLog) error
+}
+
+type Timetable interface {
+	GetTerms() ([]classosbackend.Term, error)
+	GetTermById(termId int) (classosbackend.Term, error)
+	CreateTerm(term classosbackend.Term) (int, error)
+	UpdateTerm(termId int, input classosbackend.UpdateTermInput) error
+	DeleteTerm(termId int) error
+
+	GetPeriods() ([]classosbackend.Period, error)
+	GetPeriodById(periodId int) (classosbackend.Period, error)
+	CreatePeriod(period classosbackend.Period) (int, error)
+	UpdatePeriod(periodId int, input classosbackend.UpdatePeriodInput) error
+	DeletePeriod(periodId int) error
+
+	GetLessons(checkerId int, filter classosbackend.LessonsFilter) ([]classosbackend.Lesson, error)
+	GetLessonById(checkerId, lessonId int) (classosbackend.Lesson, error)
+	CreateLesson(checkerId int, lesson classosbackend.Lesson) (int, error)
+	UpdateLesson(checkerId, lessonId int, input classosbackend.UpdateLessonInput) error
+	DeleteLesson(checkerId, lessonId int) error
+	GetCurrentLesson(checkerId, groupId int) (*classosbackend.CurrentLesson, error)
 }
 
 type Logs interface {
 	SaveLogs(logs []classosbackend.UserLog) error
-	GetLogsByUsername(username string, limit, offset int) ([]classosbackend.UserLog, error)
-	GetLogsByDevice(deviceName string, limit, offset int) ([]classosbackend.UserLog, error)
-	GetLogsFiltered(filter classosbackend.LogsFilter) ([]classosbackend.UserLog, error)
-	GetLogsCount(filter classosbackend.LogsFilter) (int, error)
+	GetLogsByUsername(checkerId int, username string, limit, offset int) ([]classosbackend.UserLog, error)
+	GetLogsByDevice(checkerId int, deviceName string, limit, offset int) ([]classosbackend.UserLog, error)
+	GetLogsFiltered(checkerId int, filter classosbackend.LogsFilter) ([]classosbackend.UserLog, error)
+	GetLogsCount(checkerId int, filter classosbackend.LogsFilter) (int, error)
+}
+
+type Audit interface {
+	GetAll(filter classosbackend.AuditFilter) ([]classosbackend.AuditEvent, error)
+	Count(filter classosbackend.AuditFilter) (int, error)
+	ExportCSV(w io.Writer, filter classosbackend.AuditFilter) error
 }
 
 type Service struct {
 	Authorization
 	Group
 	User
+	UserImport
+	Whitelist
+	GlobalWhitelist
+	Policy
+	Agents
 	Device
+	Command
+	Exam
+	Timetable
 	Logs
+	Audit
+	Lockout
+	TwoFactor
+	DirectoryOperations
+	DirectorySync
+	Rollover
 }
 
 func NewService(repos *repository.Repository) *Service {
 	adService := NewADService()
-	authService := NewAuthService(repos.Authorization)
+	directory := NewDirectory(adService, repos.DirectorySync)
+	auditService := NewAuditService(repos.Audit)
+	directoryJournal := NewDirectoryJournal(repos.Directory, directory, auditService)
+	directorySync := NewDirectorySyncService(repos.DirectorySync, directory, auditService)
+	loginLimiter := NewLoginLimiter(repos.LoginAttempts, auditService)
+	twoFactorService := NewTwoFactorService(repos.TwoFactor, repos.Authorization, auditService)
+	authService := NewAuthService(repos.Authorization, adService, loginLimiter, twoFactorService)
+	agentHub := NewAgentHub()
+	policyService := NewPolicyService(repos.Whitelist, repos.GlobalWhitelist, repos.Exam, repos.Device, agentHub)
+	groupService := NewIntegratedGroupService(repos.Group, repos.User, auditService, directoryJournal)
+	userService := NewIntegratedUserService(repos.User, repos.Group, authService, auditService, directoryJournal)
 
 	return &Service{
-		Authorization: authService,
-		Group:         NewIntegratedGroupService(repos.Group, adService),
-		User:          NewIntegratedUserService(repos.User, repos.Group, authService, adService),
-		Device:        NewDeviceService(repos.Device),
-		Logs:          NewLogsService(repos.Logs),
+		Authorization:       authService,
+		Group:               groupService,
+		User:                userService,
+		UserImport:          NewUserImportService(userService, groupService, repos.Group, repos.Authorization, auditService),
+		Whitelist:           NewWhitelistService(repos.Whitelist, repos.Group, policyService),
+		GlobalWhitelist:     NewGlobalWhitelistService(repos.GlobalWhitelist, policyService),
+		Policy:              policyService,
+		Agents:              agentHub,
+		Device:              NewDeviceService(repos.Device, agentHub, auditService),
+		Command:             NewCommandService(repos.Command, repos.Device, repos.Group, agentHub),
+		Exam:                NewExamService(repos.Exam, repos.Group, policyService),
+		Timetable:           NewTimetableService(repos.Timetable, repos.Group),
+		Logs:                NewLogsService(repos.Logs),
+		Audit:               auditService,
+		Lockout:             loginLimiter,
+		TwoFactor:           twoFactorService,
+		DirectoryOperations: directoryJournal,
+		DirectorySync:       directorySync,
+		Rollover:            NewRolloverService(repos.Rollover, directoryJournal, authService, auditService),
 	}
 }
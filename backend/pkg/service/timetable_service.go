@@ -0,0 +1,198 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+type TimetableService struct {
+	repo      repository.Timetable
+	groupRepo repository.Group
+	location  *time.Location
+}
+
+// NewTimetableService interprets period times in the SCHOOL_TIMEZONE
+// location, falling back to the server's local time.
+func NewTimetableService(repo repository.Timetable, groupRepo repository.Group) *TimetableService {
+	location := time.Local
+	if name := os.Getenv("SCHOOL_TIMEZONE"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			logrus.Printf("Warning: unknown SCHOOL_TIMEZONE %q, using local time: %v", name, err)
+		} else {
+			location = loc
+		}
+	}
+
+	return &TimetableService{repo: repo, groupRepo: groupRepo, location: location}
+}
+
+func (s *TimetableService) GetTerms() ([]classosbackend.Term, error) {
+	return s.repo.GetTerms()
+}
+
+func (s *TimetableService) GetTermById(termId int) (classosbackend.Term, error) {
+	return s.repo.GetTermById(termId)
+}
+
+func (s *TimetableService) CreateTerm(term classosbackend.Term) (int, error) {
+	if err := term.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.CreateTerm(term)
+}
+
+func (s *TimetableService) UpdateTerm(termId int, input classosbackend.UpdateTermInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetTermById(termId)
+	if err != nil {
+		return err
+	}
+
+	term := input.Apply(current)
+	if err := term.Validate(); err != nil {
+		return err
+	}
+	return s.repo.UpdateTerm(term)
+}
+
+func (s *TimetableService) DeleteTerm(termId int) error {
+	return s.repo.DeleteTerm(termId)
+}
+
+func (s *TimetableService) GetPeriods() ([]classosbackend.Period, error) {
+	return s.repo.GetPeriods()
+}
+
+func (s *TimetableService) GetPeriodById(periodId int) (classosbackend.Period, error) {
+	return s.repo.GetPeriodById(periodId)
+}
+
+func (s *TimetableService) CreatePeriod(period classosbackend.Period) (int, error) {
+	if err := period.Normalize(); err != nil {
+		return 0, err
+	}
+	return s.repo.CreatePeriod(period)
+}
+
+func (s *TimetableService) UpdatePeriod(periodId int, input classosbackend.UpdatePeriodInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetPeriodById(periodId)
+	if err != nil {
+		return err
+	}
+
+	period := input.Apply(current)
+	if err := period.Normalize(); err != nil {
+		return err
+	}
+	return s.repo.UpdatePeriod(period)
+}
+
+func (s *TimetableService) DeletePeriod(periodId int) error {
+	return s.repo.DeletePeriod(periodId)
+}
+
+func (s *TimetableService) GetLessons(checkerId int, filter classosbackend.LessonsFilter) ([]classosbackend.Lesson, error) {
+	if filter.GroupID != 0 {
+		if _, err := s.groupRepo.GetById(checkerId, filter.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.GetLessons(filter)
+}
+
+func (s *TimetableService) GetLessonById(checkerId, lessonId int) (classosbackend.Lesson, error) {
+	lesson, err := s.repo.GetLessonById(lessonId)
+	if err != nil {
+		return lesson, err
+	}
+
+	if _, err := s.groupRepo.GetById(checkerId, int(lesson.GroupID)); err != nil {
+		return classosbackend.Lesson{}, err
+	}
+	return lesson, nil
+}
+
+func (s *TimetableService) CreateLesson(checkerId int, lesson classosbackend.Lesson) (int, error) {
+	if _, err := s.groupRepo.GetById(checkerId, int(lesson.GroupID)); err != nil {
+		return 0, err
+	}
+
+	if err := lesson.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.CreateLesson(lesson)
+}
+
+func (s *TimetableService) UpdateLesson(checkerId, lessonId int, input classosbackend.UpdateLessonInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.GetLessonById(checkerId, lessonId)
+	if err != nil {
+		return err
+	}
+
+	lesson := input.Apply(current)
+	if err := lesson.Validate(); err != nil {
+		return err
+	}
+	return s.repo.UpdateLesson(lesson)
+}
+
+func (s *TimetableService) DeleteLesson(checkerId, lessonId int) error {
+	if _, err := s.GetLessonById(checkerId, lessonId); err != nil {
+		return err
+	}
+	return s.repo.DeleteLesson(lessonId)
+}
+
+// GetCurrentLesson returns the lesson the group is in right now, or nil
+// during breaks, outside school hours and outside every term.
+func (s *TimetableService) GetCurrentLesson(checkerId, groupId int) (*classosbackend.CurrentLesson, error) {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return nil, err
+	}
+	return s.LessonAt(groupId, time.Now())
+}
+
+// LessonAt returns the lesson of the group at the given moment, or nil if
+// there is none.
+func (s *TimetableService) LessonAt(groupId int, at time.Time) (*classosbackend.CurrentLesson, error) {
+	local := at.In(s.location)
+
+	lesson, err := s.repo.GetLessonAt(groupId, local.Format("2006-01-02"), int(local.Weekday()), local.Format("15:04"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lesson.StartsAt = s.clockOn(local, lesson.Period.StartTime)
+	lesson.EndsAt = s.clockOn(local, lesson.Period.EndTime)
+	return &lesson, nil
+}
+
+// clockOn places an "HH:MM" time of day on the calendar day of t.
+func (s *TimetableService) clockOn(t time.Time, clock string) time.Time {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), parsed.Hour(), parsed.Minute(), 0, 0, s.location)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	recoveryCodeChars  = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorNotSetUp    = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required for this account")
+)
+
+// TwoFactorService manages TOTP enrollments. With AUTH_REQUIRE_ADMIN_2FA=true
+// admins cannot sign in without a second factor and cannot turn it off.
+type TwoFactorService struct {
+	repo          repository.TwoFactor
+	authRepo      repository.Authorization
+	auditService  *AuditService
+	issuer        string
+	requireAdmins bool
+}
+
+func NewTwoFactorService(repo repository.TwoFactor, authRepo repository.Authorization, auditService *AuditService) *TwoFactorService {
+	issuer := os.Getenv("AUTH_TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "classOS"
+	}
+	requireAdmins, _ := strconv.ParseBool(os.Getenv("AUTH_REQUIRE_ADMIN_2FA"))
+
+	return &TwoFactorService{
+		repo:          repo,
+		authRepo:      authRepo,
+		auditService:  auditService,
+		issuer:        issuer,
+		requireAdmins: requireAdmins,
+	}
+}
+
+func (s *TwoFactorService) IsRequired(user classosbackend.User) bool {
+	return s.requireAdmins && user.Role == classosbackend.RoleAdmin
+}
+
+// IsEnabled reports whether the user has a confirmed enrollment.
+func (s *TwoFactorService) IsEnabled(userId int) (bool, error) {
+	twoFactor, err := s.repo.Get(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.Enabled(), nil
+}
+
+func (s *TwoFactorService) GetStatus(userId int) (classosbackend.TwoFactorStatus, error) {
+	user, err := s.authRepo.GetUserById(userId)
+	if err != nil {
+		return classosbackend.TwoFactorStatus{}, err
+	}
+	status := classosbackend.TwoFactorStatus{Required: s.IsRequired(user)}
+
+	twoFactor, err := s.repo.Get(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	if !twoFactor.Enabled() {
+		return status, nil
+	}
+
+	status.Enabled = true
+	status.EnabledAt = twoFactor.EnabledAt
+	status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(userId)
+	return status, err
+}
+
+// Setup generates a new secret. It only takes effect once Enable confirms it
+// with a code, so an unfinished setup never locks the user out.
+func (s *TwoFactorService) Setup(userId int) (classosbackend.TOTPSetup, error) {
+	user, err := s.authRepo.GetUserById(userId)
+	if err != nil {
+		return classosbackend.TOTPSetup{}, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return classosbackend.TOTPSetup{}, err
+	}
+
+	if err := s.repo.SaveSecret(userId, secret); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TOTPSetup{}, ErrTwoFactorEnabled
+		}
+		return classosbackend.TOTPSetup{}, fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+
+	return classosbackend.TOTPSetup{
+		Secret: secret,
+		URI:    totpURI(s.issuer, user.Username, secret),
+	}, nil
+}
+
+// Enable confirms the pending setup with a code from the authenticator and
+// returns the recovery codes, which are shown only this once.
+func (s *TwoFactorService) Enable(actor classosbackend.Actor, code string) (codes []string, err error) {
+	defer func() {
+		s.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditUser2FAEnable,
+			TargetType: classosbackend.AuditTargetUser,
+			TargetID:   strconv.Itoa(actor.ID),
+		}, err)
+	}()
+
+	twoFactor, err := s.repo.Get(actor.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := matchTOTP(twoFactor.Secret, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Enable(actor.ID, step, time.Now(), hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return codes, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code. Each
+// code works only once.
+func (s *TwoFactorService) Verify(userId int, code string) error {
+	twoFactor, err := s.repo.Get(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTwoFactorNotSetUp
+	}
+	if err != nil {
+		return err
+	}
+	if !twoFactor.Enabled() {
+		return ErrTwoFactorNotSetUp
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		err = s.repo.UseStep(userId, step)
+	} else {
+		err = s.repo.UseRecoveryCode(userId, hashRecoveryCode(code), time.Now())
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// Disable turns two-factor authentication off after checking a code. Admins
+// cannot do this while the policy requires it.
+func (s *TwoFactorService) Disable(actor classosbackend.Actor, code string) (err error) {
+	defer func() {
+		s.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditUser2FADisable,
+			TargetType: classosbackend.AuditTargetUser,
+			TargetID:   strconv.Itoa(actor.ID),
+		}, err)
+	}()
+
+	user, err := s.authRepo.GetUserById(actor.ID)
+	if err != nil {
+		return err
+	}
+	if s.IsRequired(user) {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.Verify(actor.ID, code); err != nil {
+		return err
+	}
+	return s.repo.Delete(actor.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(actor classosbackend.Actor, code string) (codes []string, err error) {
+	defer func() {
+		s.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditUserRecoveryCodes,
+			TargetType: classosbackend.AuditTargetUser,
+			TargetID:   strconv.Itoa(actor.ID),
+		}, err)
+	}()
+
+	if err := s.Verify(actor.ID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(actor.ID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Reset removes the enrollment of a user who lost their device. Admins are
+// asked to enroll again on their next sign-in if the policy requires it.
+func (s *TwoFactorService) Reset(actor classosbackend.Actor, userId int) (err error) {
+	defer func() {
+		s.auditService.Record(actor, classosbackend.AuditEvent{
+			Action:     classosbackend.AuditUser2FAReset,
+			TargetType: classosbackend.AuditTargetUser,
+			TargetID:   strconv.Itoa(userId),
+		}, err)
+	}()
+
+	return s.repo.Delete(userId)
+}
+
+func normalizeTwoFactorCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	return hashRefreshToken(normalizeTwoFactorCode(code))
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx for the user
+// and their hashes for storage.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for len(codes) < recoveryCodeCount {
+		code, err := randomCode(recoveryCodeLength)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		half := recoveryCodeLength / 2
+		formatted := code[:half] + "-" + code[half:]
+
+		codes = append(codes, formatted)
+		hashes = append(hashes, hashRecoveryCode(formatted))
+	}
+	return codes, hashes, nil
+}
+
+func randomCode(length int) (string, error) {
+	return randomFrom(recoveryCodeChars, length)
+}
+
+// randomFrom draws uniformly from chars, skipping the bytes that would bias
+// the modulo.
+func randomFrom(chars string, length int) (string, error) {
+	limit := 256 - 256%len(chars)
+	out := make([]byte, 0, length)
+	buf := make([]byte, length)
+
+	for len(out) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < length {
+				out = append(out, chars[int(b)%len(chars)])
+			}
+		}
+	}
+	return string(out), nil
+}
@@ -1,9 +1,6 @@
 package service
 
 import (
-	"crypto/sha1"
-	"fmt"
-
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
@@ -23,21 +20,17 @@ func (s *UserService) Create(checkerId, groupId int, user classosbackend.User) (
 		return 0, err
 	}
 
-	user.Password = s.generatePasswordHash(user.Password)
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return 0, err
+	}
+	user.Password = hash
 
 	return s.repo.Create(groupId, user)
 }
 
-
-func (s *UserService) generatePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	salt := getSalt()
-	return fmt.Sprintf("%x", hash.Sum([]byte(salt)))
-}
-
 func (s *UserService) GetAll(checkerId int) ([]classosbackend.User, error) {
-	return s.repo.GetAll(checkerId)
+	return s.repo.GetAll(checkerId, classosbackend.UsersFilter{})
 }
 
 func (s *UserService) GetById(checkerId, user_id int) (classosbackend.User, error) {
@@ -54,7 +47,10 @@ func (s *UserService) Update(checkerId, user_id int, input classosbackend.Update
 	}
 
 	if input.Password != nil {
-        hashedPassword := s.generatePasswordHash(*input.Password)
+        hashedPassword, err := HashPassword(*input.Password)
+        if err != nil {
+            return err
+        }
         input.Password = &hashedPassword
     }
 	
@@ -0,0 +1,560 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	importCredentialsTTL = time.Hour
+	importPasswordLength = 10
+	// AD limits sAMAccountName to 20 characters.
+	importUsernameMaxLen = 20
+	importNameMaxLen     = 100
+)
+
+// Letters and digits that cannot be confused when read off a printed sheet.
+const (
+	importPasswordUpper  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	importPasswordLower  = "abcdefghijkmnpqrstuvwxyz"
+	importPasswordDigits = "23456789"
+)
+
+var importUsernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Column headers accepted for every field, compared in lower case.
+var importColumns = map[string][]string{
+	"name":     {"name", "full name", "fullname", "student", "фио", "имя", "ученик"},
+	"class":    {"class", "group", "класс", "группа"},
+	"username": {"username", "login", "логин"},
+}
+
+// UserImportService onboards students in bulk. Every row goes through the
+// same path as a single createUser: database first, then the directory via
+// the journal. Generated passwords are kept in memory only, for an hour, so
+// the admin can download the credentials sheet.
+type UserImportService struct {
+	users        *IntegratedUserService
+	groups       *IntegratedGroupService
+	groupRepo    repository.Group
+	authRepo     repository.Authorization
+	auditService *AuditService
+	maxRows      int
+
+	mu          sync.Mutex
+	credentials map[string]importCredentials
+}
+
+type importCredentials struct {
+	rows      []classosbackend.ImportRow
+	expiresAt time.Time
+}
+
+func NewUserImportService(users *IntegratedUserService, groups *IntegratedGroupService, groupRepo repository.Group, authRepo repository.Authorization, auditService *AuditService) *UserImportService {
+	return &UserImportService{
+		users:        users,
+		groups:       groups,
+		groupRepo:    groupRepo,
+		authRepo:     authRepo,
+		auditService: auditService,
+		maxRows:      envInt("IMPORT_MAX_ROWS", 1000),
+		credentials:  make(map[string]importCredentials),
+	}
+}
+
+// Import validates the rows of a CSV or XLSX class list and, unless it is a
+// dry run, creates the valid ones. Problems with single rows are reported
+// per row; only a file that cannot be read at all is an error.
+func (s *UserImportService) Import(actor classosbackend.Actor, filename string, data []byte, options classosbackend.ImportOptions) (report classosbackend.ImportReport, err error) {
+	records, err := readImportFile(filename, data, s.maxRows)
+	if err != nil {
+		return report, err
+	}
+
+	rows, err := parseImportRows(records, s.maxRows)
+	if err != nil {
+		return report, err
+	}
+
+	groups, err := s.groupRepo.GetAll(actor.ID, classosbackend.GroupsFilter{})
+	if err != nil {
+		return report, fmt.Errorf("failed to load groups: %w", err)
+	}
+	groupIds := make(map[string]int, len(groups))
+	for _, group := range groups {
+		groupIds[strings.ToLower(group.Name)] = int(group.ID)
+	}
+
+	newGroups, err := s.validate(rows, groupIds, options.CreateGroups)
+	if err != nil {
+		return report, err
+	}
+
+	report = classosbackend.ImportReport{DryRun: options.DryRun, Rows: rows}
+	if options.DryRun {
+		report.NewGroups = newGroups
+		countImportRows(&report)
+		return report, nil
+	}
+
+	event := classosbackend.AuditEvent{
+		Action:     classosbackend.AuditUserImport,
+		TargetType: classosbackend.AuditTargetUser,
+		TargetName: filename,
+		Changes:    classosbackend.AuditChanges{},
+	}
+	defer func() {
+		event.Changes.Set("created", nil, report.Created)
+		event.Changes.Set("failed", nil, report.Failed)
+		event.Changes.Set("invalid", nil, report.Invalid)
+		if len(report.NewGroups) > 0 {
+			event.Changes.Set("new_groups", nil, report.NewGroups)
+		}
+		s.auditService.Record(actor, event, err)
+	}()
+
+	groupErrors := make(map[string]error)
+	for _, name := range newGroups {
+		id, err := s.groups.Create(actor, classosbackend.Group{Name: name})
+		if err != nil {
+			groupErrors[strings.ToLower(name)] = err
+			continue
+		}
+		groupIds[strings.ToLower(name)] = id
+		report.NewGroups = append(report.NewGroups, name)
+	}
+
+	var created []classosbackend.ImportRow
+	for i := range rows {
+		row := &rows[i]
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+
+		if err := groupErrors[strings.ToLower(row.Class)]; err != nil {
+			row.Status = classosbackend.ImportRowFailed
+			row.Error = fmt.Sprintf("failed to create class: %s", err)
+			continue
+		}
+
+		password, err := generateImportPassword()
+		if err != nil {
+			return report, err
+		}
+
+		class := row.Class
+		userId, err := s.users.Create(actor, groupIds[strings.ToLower(row.Class)], classosbackend.User{
+			Name:      row.Name,
+			Username:  row.Username,
+			Password:  password,
+			Role:      classosbackend.RoleClient,
+			GroupName: &class,
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("username", row.Username).Warn("Failed to import user")
+			row.Status = classosbackend.ImportRowFailed
+			row.Error = err.Error()
+			continue
+		}
+
+		row.UserID = userId
+		row.Status = classosbackend.ImportRowCreated
+		row.Password = password
+		created = append(created, *row)
+	}
+
+	countImportRows(&report)
+	if len(created) > 0 {
+		id, expiresAt, err := s.storeCredentials(created)
+		if err != nil {
+			return report, err
+		}
+		report.CredentialsID = id
+		report.CredentialsExpireAt = &expiresAt
+	}
+
+	return report, nil
+}
+
+// WriteCredentials writes the usernames and passwords created by an import
+// as CSV, ready to be printed and handed out.
+func (s *UserImportService) WriteCredentials(w io.Writer, id string) error {
+	s.mu.Lock()
+	s.pruneCredentials(time.Now())
+	credentials, ok := s.credentials[id]
+	s.mu.Unlock()
+	if !ok {
+		return classosbackend.ErrImportCredentialsExpired
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"name", "class", "username", "password"}); err != nil {
+		return err
+	}
+	for _, row := range credentials.rows {
+		if err := writer.Write([]string{csvSafe(row.Name), csvSafe(row.Class), csvSafe(row.Username), row.Password}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *UserImportService) storeCredentials(rows []classosbackend.ImportRow) (string, time.Time, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate credentials id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	now := time.Now()
+	expiresAt := now.Add(importCredentialsTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneCredentials(now)
+	s.credentials[id] = importCredentials{rows: rows, expiresAt: expiresAt}
+
+	return id, expiresAt, nil
+}
+
+// pruneCredentials forgets expired sheets; the caller holds s.mu.
+func (s *UserImportService) pruneCredentials(now time.Time) {
+	for id, credentials := range s.credentials {
+		if now.After(credentials.expiresAt) {
+			delete(s.credentials, id)
+		}
+	}
+}
+
+// validate checks every row, generates the missing usernames and returns
+// the classes that would have to be created.
+func (s *UserImportService) validate(rows []classosbackend.ImportRow, groupIds map[string]int, createGroups bool) ([]string, error) {
+	taken := make(map[string]bool)
+	for i := range rows {
+		if rows[i].Username != "" {
+			taken[strings.ToLower(rows[i].Username)] = true
+		}
+	}
+
+	var newGroups []string
+	seenGroups := make(map[string]bool)
+	for i := range rows {
+		row := &rows[i]
+		row.Status = classosbackend.ImportRowInvalid
+
+		switch {
+		case row.Name == "":
+			row.Error = "name is empty"
+			continue
+		case utf8.RuneCountInString(row.Name) > importNameMaxLen:
+			row.Error = fmt.Sprintf("name is longer than %d characters", importNameMaxLen)
+			continue
+		case row.Class == "":
+			row.Error = "class is empty"
+			continue
+		}
+
+		class := strings.ToLower(row.Class)
+		if _, ok := groupIds[class]; !ok {
+			if !createGroups {
+				row.Error = fmt.Sprintf("class %q does not exist", row.Class)
+				continue
+			}
+			row.NewGroup = true
+			if !seenGroups[class] {
+				seenGroups[class] = true
+				newGroups = append(newGroups, row.Class)
+			}
+		}
+
+		if row.Username == "" {
+			username, err := s.generateUsername(row.Name, taken)
+			if err != nil {
+				return nil, err
+			}
+			if username == "" {
+				row.Error = "cannot make a username from the name, add one to the file"
+				continue
+			}
+			row.Username = username
+			row.Generated = true
+		} else {
+			row.Username = strings.ToLower(row.Username)
+			if len(row.Username) > importUsernameMaxLen || !importUsernamePattern.MatchString(row.Username) {
+				row.Error = fmt.Sprintf("username must be up to %d latin letters, digits, dots, dashes or underscores", importUsernameMaxLen)
+				continue
+			}
+			if duplicate := s.findDuplicate(rows[:i], row.Username); duplicate != 0 {
+				row.Error = fmt.Sprintf("username is already used in row %d", duplicate)
+				continue
+			}
+			exists, err := s.usernameExists(row.Username)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				row.Error = "username already exists"
+				continue
+			}
+		}
+
+		row.Status = classosbackend.ImportRowValid
+	}
+
+	return newGroups, nil
+}
+
+func (s *UserImportService) findDuplicate(rows []classosbackend.ImportRow, username string) int {
+	for _, row := range rows {
+		if row.Status == classosbackend.ImportRowValid && row.Username == username {
+			return row.Row
+		}
+	}
+	return 0
+}
+
+func (s *UserImportService) usernameExists(username string) (bool, error) {
+	_, err := s.authRepo.GetUser(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check username %s: %w", username, err)
+	}
+	return true, nil
+}
+
+// generateUsername builds surname.name from the transliterated full name,
+// numbering it when the login is taken in the database or in the file.
+func (s *UserImportService) generateUsername(name string, taken map[string]bool) (string, error) {
+	var parts []string
+	for _, word := range strings.Fields(name) {
+		if word = transliterate(word); word != "" {
+			parts = append(parts, word)
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	base := strings.Join(parts, ".")
+
+	for n := 1; ; n++ {
+		suffix := ""
+		if n > 1 {
+			suffix = strconv.Itoa(n)
+		}
+		candidate := base
+		if len(candidate)+len(suffix) > importUsernameMaxLen {
+			candidate = strings.TrimRight(candidate[:importUsernameMaxLen-len(suffix)], ".")
+		}
+		candidate += suffix
+
+		if taken[candidate] {
+			continue
+		}
+		exists, err := s.usernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			continue
+		}
+
+		taken[candidate] = true
+		return candidate, nil
+	}
+}
+
+func countImportRows(report *classosbackend.ImportReport) {
+	report.Total = len(report.Rows)
+	for _, row := range report.Rows {
+		switch row.Status {
+		case classosbackend.ImportRowValid:
+			report.Valid++
+		case classosbackend.ImportRowInvalid:
+			report.Invalid++
+		case classosbackend.ImportRowCreated:
+			report.Created++
+		case classosbackend.ImportRowFailed:
+			report.Failed++
+		}
+	}
+}
+
+func readImportFile(filename string, data []byte, maxRows int) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		records, err := readXLSX(data, maxRows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", classosbackend.ErrInvalidImport, err)
+		}
+		return records, nil
+	case ".csv", ".txt":
+		return readImportCSV(data)
+	default:
+		return nil, fmt.Errorf("%w: expected a .csv or .xlsx file", classosbackend.ErrInvalidImport)
+	}
+}
+
+// readImportCSV accepts both comma and semicolon separated files, the latter
+// being what spreadsheets save in locales with a decimal comma.
+func readImportCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: file must be UTF-8 encoded", classosbackend.ErrInvalidImport)
+	}
+
+	firstLine, _, _ := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+	reader := csv.NewReader(bytes.NewReader(data))
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", classosbackend.ErrInvalidImport, err)
+	}
+	return records, nil
+}
+
+// parseImportRows maps the columns by the header row and numbers the rows
+// the way a spreadsheet shows them.
+func parseImportRows(records [][]string, maxRows int) ([]classosbackend.ImportRow, error) {
+	header := -1
+	for i, record := range records {
+		if !importRecordEmpty(record) {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, fmt.Errorf("%w: file is empty", classosbackend.ErrInvalidImport)
+	}
+
+	columns := map[string]int{}
+	for i, cell := range records[header] {
+		title := strings.ToLower(strings.TrimSpace(cell))
+		for field, aliases := range importColumns {
+			if _, ok := columns[field]; ok {
+				continue
+			}
+			for _, alias := range aliases {
+				if title == alias {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	for _, field := range []string{"name", "class"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("%w: %q column is missing", classosbackend.ErrInvalidImport, field)
+		}
+	}
+
+	cell := func(record []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.Join(strings.Fields(record[i]), " ")
+	}
+
+	var rows []classosbackend.ImportRow
+	for i := header + 1; i < len(records); i++ {
+		if importRecordEmpty(records[i]) {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", classosbackend.ErrInvalidImport, maxRows)
+		}
+		rows = append(rows, classosbackend.ImportRow{
+			Row:      i + 1,
+			Name:     cell(records[i], "name"),
+			Class:    cell(records[i], "class"),
+			Username: cell(records[i], "username"),
+		})
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: file has no rows", classosbackend.ErrInvalidImport)
+	}
+
+	return rows, nil
+}
+
+func importRecordEmpty(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// generateImportPassword returns a password with upper and lower case
+// letters and digits, which satisfies the default AD complexity policy.
+func generateImportPassword() (string, error) {
+	upper, err := randomFrom(importPasswordUpper, 1)
+	if err != nil {
+		return "", err
+	}
+	lower, err := randomFrom(importPasswordLower, importPasswordLength-5)
+	if err != nil {
+		return "", err
+	}
+	digits, err := randomFrom(importPasswordDigits, 4)
+	if err != nil {
+		return "", err
+	}
+	return upper + lower + digits, nil
+}
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	// Uzbek
+	'ў': "o", 'қ': "q", 'ғ': "g", 'ҳ': "h",
+}
+
+// transliterate lowercases a word to latin letters and digits, dropping
+// everything else.
+func transliterate(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(word) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteString(cyrillicToLatin[r])
+		}
+	}
+	return b.String()
+}
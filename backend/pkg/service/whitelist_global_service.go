@@ -0,0 +1,80 @@
+package service
+
+import (
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+type GlobalWhitelistService struct {
+	repo   repository.GlobalWhitelist
+	policy *PolicyService
+}
+
+func NewGlobalWhitelistService(repo repository.GlobalWhitelist, policy *PolicyService) *GlobalWhitelistService {
+	return &GlobalWhitelistService{repo: repo, policy: policy}
+}
+
+func (s *GlobalWhitelistService) GetAll(list string) ([]classosbackend.GlobalWhitelistEntry, error) {
+	return s.repo.GetAll(list)
+}
+
+func (s *GlobalWhitelistService) GetById(entryId int) (classosbackend.GlobalWhitelistEntry, error) {
+	return s.repo.GetById(entryId)
+}
+
+func (s *GlobalWhitelistService) Create(entry classosbackend.GlobalWhitelistEntry) (int, error) {
+	if err := entry.Normalize(); err != nil {
+		return 0, err
+	}
+
+	id, err := s.repo.Create(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	s.policy.notifyAll()
+	return id, nil
+}
+
+func (s *GlobalWhitelistService) Update(entryId int, input classosbackend.UpdateGlobalWhitelistEntryInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	entry, err := s.repo.GetById(entryId)
+	if err != nil {
+		return err
+	}
+
+	if input.List != nil {
+		entry.List = *input.List
+	}
+	if input.Type != nil {
+		entry.Type = *input.Type
+	}
+	if input.Value != nil {
+		entry.Value = *input.Value
+	}
+	if err := entry.Normalize(); err != nil {
+		return err
+	}
+
+	input.List = &entry.List
+	input.Type = &entry.Type
+	input.Value = &entry.Value
+	if err := s.repo.Update(entryId, input); err != nil {
+		return err
+	}
+
+	s.policy.notifyAll()
+	return nil
+}
+
+func (s *GlobalWhitelistService) Delete(entryId int) error {
+	if err := s.repo.Delete(entryId); err != nil {
+		return err
+	}
+
+	s.policy.notifyAll()
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+type WhitelistService struct {
+	repo      repository.Whitelist
+	groupRepo repository.Group
+	policy    *PolicyService
+}
+
+func NewWhitelistService(repo repository.Whitelist, groupRepo repository.Group, policy *PolicyService) *WhitelistService {
+	return &WhitelistService{repo: repo, groupRepo: groupRepo, policy: policy}
+}
+
+func (s *WhitelistService) GetAll(checkerId, groupId int) ([]classosbackend.WhitelistEntry, error) {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAll(groupId)
+}
+
+func (s *WhitelistService) GetById(checkerId, groupId, entryId int) (classosbackend.WhitelistEntry, error) {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return classosbackend.WhitelistEntry{}, err
+	}
+	return s.repo.GetById(groupId, entryId)
+}
+
+func (s *WhitelistService) Create(checkerId, groupId int, entry classosbackend.WhitelistEntry) (int, error) {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return 0, err
+	}
+
+	if err := entry.Normalize(); err != nil {
+		return 0, err
+	}
+
+	id, err := s.repo.Create(groupId, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	s.policy.notifyGroup(groupId)
+	return id, nil
+}
+
+func (s *WhitelistService) Update(checkerId, groupId, entryId int, input classosbackend.UpdateWhitelistEntryInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	current, err := s.GetById(checkerId, groupId, entryId)
+	if err != nil {
+		return err
+	}
+
+	entry := current
+	if input.Type != nil {
+		entry.Type = *input.Type
+	}
+	if input.Value != nil {
+		entry.Value = *input.Value
+	}
+	if input.Schedules != nil {
+		entry.Schedules = *input.Schedules
+	}
+	if err := entry.Normalize(); err != nil {
+		return err
+	}
+
+	input.Type = &entry.Type
+	input.Value = &entry.Value
+	if input.Schedules != nil {
+		input.Schedules = &entry.Schedules
+	}
+	if err := s.repo.Update(groupId, entryId, input); err != nil {
+		return err
+	}
+
+	s.policy.notifyGroup(groupId)
+	return nil
+}
+
+func (s *WhitelistService) Delete(checkerId, groupId, entryId int) error {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(groupId, entryId); err != nil {
+		return err
+	}
+
+	s.policy.notifyGroup(groupId)
+	return nil
+}
+
+func (s *WhitelistService) Replace(checkerId, groupId int, entries []classosbackend.WhitelistEntry) ([]classosbackend.WhitelistEntry, error) {
+	if _, err := s.groupRepo.GetById(checkerId, groupId); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(entries))
+	normalized := make([]classosbackend.WhitelistEntry, 0, len(entries))
+	for i, entry := range entries {
+		if err := entry.Normalize(); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		key := entry.Type + ":" + entry.Value + "@" + schedulesKey(entry.Schedules)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, entry)
+	}
+
+	if err := s.repo.Replace(groupId, normalized); err != nil {
+		return nil, err
+	}
+
+	s.policy.notifyGroup(groupId)
+
+	return s.repo.GetAll(groupId)
+}
+
+// schedulesKey identifies a set of schedules regardless of their order, so
+// that only entries repeating both the resource and its windows collapse.
+func schedulesKey(schedules []classosbackend.WhitelistSchedule) string {
+	keys := make([]string, len(schedules))
+	for i, schedule := range schedules {
+		keys[i] = fmt.Sprintf("%d/%s-%s/%s", schedule.Weekdays, schedule.StartTime, schedule.EndTime, schedule.Timezone)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
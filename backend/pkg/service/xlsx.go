@@ -0,0 +1,272 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// xlsxMaxColumns is the column count of a worksheet, A to XFD.
+	xlsxMaxColumns = 16384
+	// xlsxMaxCells caps the cells kept for a sheet, padding included, so that
+	// a few cells far to the right on every row cannot take up gigabytes.
+	xlsxMaxCells = 1 << 20
+	// xlsxMaxPartSize caps the uncompressed XML read from one part.
+	xlsxMaxPartSize = 64 << 20
+)
+
+// readXLSX returns the cell values of the first worksheet of an Office Open
+// XML workbook. Only what a class list needs is understood: shared, inline
+// and plain strings and numbers; styles and formulas are ignored. The sheet
+// is read row by row and given up at the first row past maxRows+1, the
+// header included, or the first cell past column XFD.
+func readXLSX(data []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings []string
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := xlsxDecode(file, &sst); err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+		for _, item := range sst.Items {
+			sharedStrings = append(sharedStrings, item.String())
+		}
+	}
+
+	file, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet %s is missing", sheetPath)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worksheet: %w", err)
+	}
+	defer reader.Close()
+
+	records, err := xlsxReadRows(xml.NewDecoder(io.LimitReader(reader, xlsxMaxPartSize)), sharedStrings, maxRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worksheet: %w", err)
+	}
+	return records, nil
+}
+
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline xlsxText `xml:"is"`
+}
+
+// xlsxReadRows walks the rows of a worksheet. Row numbers and cell
+// references are checked on the start tags, before a row or cell is kept.
+func xlsxReadRows(decoder *xml.Decoder, sharedStrings []string, maxRows int) ([][]string, error) {
+	var (
+		records [][]string
+		record  []string
+		inRow   bool
+		// position counts the cells of the row, for cells without a reference.
+		position int
+		cells    int
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "row":
+				rowIndex := len(records) + 1
+				if r := xlsxAttr(element, "r"); r != "" {
+					if rowIndex, err = strconv.Atoi(r); err != nil {
+						return nil, fmt.Errorf("row number %q is invalid", r)
+					}
+				}
+				if rowIndex > maxRows+1 {
+					return nil, fmt.Errorf("more than %d rows", maxRows)
+				}
+
+				// Empty rows are left out of the file, keep the numbering intact.
+				for rowIndex > len(records)+1 {
+					records = append(records, nil)
+				}
+				record, inRow, position = nil, true, 0
+
+			case "c":
+				if !inRow {
+					continue
+				}
+				ref := xlsxAttr(element, "r")
+				column := position
+				if index := xlsxColumn(ref); index >= 0 {
+					column = index
+				}
+				position++
+				if column >= xlsxMaxColumns {
+					return nil, fmt.Errorf("cell %s is past the last column XFD", ref)
+				}
+				if column >= len(record) {
+					if cells += column + 1 - len(record); cells > xlsxMaxCells {
+						return nil, fmt.Errorf("worksheet has more than %d cells", xlsxMaxCells)
+					}
+				}
+
+				var cell xlsxCell
+				if err := decoder.DecodeElement(&cell, &element); err != nil {
+					return nil, err
+				}
+				for len(record) <= column {
+					record = append(record, "")
+				}
+
+				switch cell.Type {
+				case "s":
+					index, err := strconv.Atoi(cell.Value)
+					if err != nil || index < 0 || index >= len(sharedStrings) {
+						return nil, fmt.Errorf("cell %s refers to a missing shared string", ref)
+					}
+					record[column] = sharedStrings[index]
+				case "inlineStr":
+					record[column] = cell.Inline.String()
+				default:
+					record[column] = cell.Value
+				}
+			}
+
+		case xml.EndElement:
+			if element.Name.Local == "row" && inRow {
+				records = append(records, record)
+				inRow = false
+			}
+		}
+	}
+}
+
+func xlsxAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// xlsxText is a string item: plain text or runs of rich text.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// xlsxFirstSheet resolves the part holding the first sheet of the workbook.
+func xlsxFirstSheet(files map[string]*zip.File) (string, error) {
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("not an xlsx file: workbook is missing")
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xlsxDecode(workbookFile, &workbook); err != nil {
+		return "", fmt.Errorf("failed to read workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xlsxDecode(relsFile, &rels); err != nil {
+		return "", fmt.Errorf("failed to read workbook relationships: %w", err)
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", fmt.Errorf("first sheet of the workbook is missing")
+}
+
+func xlsxDecode(file *zip.File, v interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return xml.NewDecoder(io.LimitReader(reader, xlsxMaxPartSize)).Decode(v)
+}
+
+// xlsxColumn turns the letters of a cell reference such as "AB12" into a
+// zero-based column index. References past the last column give
+// xlsxMaxColumns.
+func xlsxColumn(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		if column > xlsxMaxColumns {
+			return xlsxMaxColumns
+		}
+	}
+	return column - 1
+}
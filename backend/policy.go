@@ -0,0 +1,135 @@
+package classosbackend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PolicyLayerGlobalDeny  = "global_deny"
+	PolicyLayerGroupAllow  = "group_allow"
+	PolicyLayerGlobalAllow = "global_allow"
+	PolicyLayerExamAllow   = "exam_allow"
+	PolicyLayerDefault     = "default_deny"
+)
+
+// Policy is the effective set of rules an agent enforces for the user that is
+// currently logged in on the device. Deny always wins over Allow; anything
+// that matches neither list is blocked. Exam is set while an exam session
+// replaces the normal rules.
+type Policy struct {
+	Username    string            `json:"username"`
+	Version     string            `json:"version"`
+	Allow       []PolicyRule      `json:"allow"`
+	Deny        []PolicyRule      `json:"deny"`
+	Exam        *ExamRestrictions `json:"exam,omitempty"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+type PolicyRule struct {
+	Type  string `json:"type" db:"entry_type"`
+	Value string `json:"value" db:"resource"`
+}
+
+// PolicyDecision explains why a resource is allowed or blocked for a user.
+type PolicyDecision struct {
+	Username      string      `json:"username"`
+	Resource      string      `json:"resource"`
+	Allowed       bool        `json:"allowed"`
+	Layer         string      `json:"layer"`
+	MatchedRule   *PolicyRule `json:"matched_rule,omitempty"`
+	PolicyVersion string      `json:"policy_version"`
+}
+
+// Matches reports whether the rule covers the resource. Domain rules cover the
+// domain and its subdomains ("*.example.com" only the subdomains), URL rules
+// are prefix patterns where "*" matches any sequence, and app rules compare
+// the executable name regardless of its directory.
+func (r PolicyRule) Matches(resource string) bool {
+	res := strings.ToLower(strings.TrimSpace(resource))
+	if res == "" {
+		return false
+	}
+
+	switch r.Type {
+	case WhitelistTypeDomain:
+		host := resourceHost(res)
+		if strings.HasPrefix(r.Value, "*.") {
+			return strings.HasSuffix(host, r.Value[1:])
+		}
+		return host == r.Value || strings.HasSuffix(host, "."+r.Value)
+	case WhitelistTypeURL:
+		return wildcardPrefixMatch(stripScheme(r.Value), stripScheme(res))
+	case WhitelistTypeApp:
+		name := res
+		if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+			name = name[i+1:]
+		}
+		return name == r.Value
+	}
+	return false
+}
+
+func stripScheme(value string) string {
+	if _, after, ok := strings.Cut(value, "://"); ok {
+		return after
+	}
+	return value
+}
+
+func resourceHost(resource string) string {
+	host, _, _ := strings.Cut(stripScheme(resource), "/")
+	host, _, _ = strings.Cut(host, ":")
+	return host
+}
+
+// wildcardPrefixMatch matches value against pattern where "*" stands for any
+// sequence of characters and the pattern only has to match a prefix of value.
+func wildcardPrefixMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	for _, part := range parts[1:] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return true
+}
+
+// Seal sorts the rules and derives the version from their content, so the
+// same rules always produce the same version no matter when they were built.
+func (p *Policy) Seal() {
+	sortRules(p.Allow)
+	sortRules(p.Deny)
+
+	hash := sha256.New()
+	for _, rule := range p.Allow {
+		hash.Write([]byte("allow\x00" + rule.Type + "\x00" + rule.Value + "\n"))
+	}
+	for _, rule := range p.Deny {
+		hash.Write([]byte("deny\x00" + rule.Type + "\x00" + rule.Value + "\n"))
+	}
+	if p.Exam != nil {
+		fmt.Fprintf(hash, "exam\x00%d\x00%t\x00%t\x00%d\n", p.Exam.ExamID, p.Exam.BlockClipboard, p.Exam.BlockUSB, p.Exam.EndsAt.Unix())
+	}
+	p.Version = hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func sortRules(rules []PolicyRule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Type != rules[j].Type {
+			return rules[i].Type < rules[j].Type
+		}
+		return rules[i].Value < rules[j].Value
+	})
+}
@@ -0,0 +1,161 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRollover       = errors.New("invalid rollover plan")
+	ErrRolloverConflict      = errors.New("groups or users changed since the rollover was planned")
+	ErrRolloverNotRevertible = errors.New("rollover cannot be rolled back")
+)
+
+// What a rollover does to a class. Groups left out of the plan keep their
+// name and members.
+const (
+	// Rename gives the class its name for the new year, e.g. 9A to 10A.
+	RolloverRename = "rename"
+	// Merge moves the members into the target class and retires the group.
+	RolloverMerge = "merge"
+	// Archive retires the class and archives its students, e.g. graduates.
+	RolloverArchive = "archive"
+)
+
+const (
+	RolloverApplied    = "applied"
+	RolloverRolledBack = "rolled_back"
+)
+
+// RolloverStep is the plan for one group. NewName is the new name of a
+// renamed group; for merged and archived groups it is the name they are
+// kept under, "<name> (<year>)" by default, which frees the old one.
+type RolloverStep struct {
+	GroupID       int    `json:"group_id"`
+	Action        string `json:"action"`
+	NewName       string `json:"new_name,omitempty"`
+	TargetGroupID int    `json:"target_group_id,omitempty"`
+}
+
+type RolloverPlan struct {
+	Steps []RolloverStep `json:"steps"`
+}
+
+func (p *RolloverPlan) Validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("%w: plan has no steps", ErrInvalidRollover)
+	}
+
+	seen := make(map[int]bool, len(p.Steps))
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		step.NewName = strings.TrimSpace(step.NewName)
+
+		if step.GroupID <= 0 {
+			return fmt.Errorf("%w: step %d has no group_id", ErrInvalidRollover, i+1)
+		}
+		if seen[step.GroupID] {
+			return fmt.Errorf("%w: group %d is planned twice", ErrInvalidRollover, step.GroupID)
+		}
+		seen[step.GroupID] = true
+
+		switch step.Action {
+		case RolloverRename:
+			if step.NewName == "" {
+				return fmt.Errorf("%w: rename of group %d needs new_name", ErrInvalidRollover, step.GroupID)
+			}
+		case RolloverMerge:
+			if step.TargetGroupID <= 0 || step.TargetGroupID == step.GroupID {
+				return fmt.Errorf("%w: merge of group %d needs another target_group_id", ErrInvalidRollover, step.GroupID)
+			}
+		case RolloverArchive:
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidRollover, step.Action)
+		}
+	}
+	return nil
+}
+
+func (p RolloverPlan) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *RolloverPlan) Scan(src interface{}) error {
+	return scanJSON(src, p)
+}
+
+// RolloverGroup is the change of one group, listed in the order the groups
+// are renamed so that no name is taken twice at any point.
+type RolloverGroup struct {
+	GroupID    int    `json:"group_id"`
+	Action     string `json:"action"`
+	Name       string `json:"name"`
+	NewName    string `json:"new_name"`
+	Archived   bool   `json:"archived"`
+	TargetID   int    `json:"target_group_id,omitempty"`
+	TargetName string `json:"target_name,omitempty"`
+	Members    int    `json:"members"`
+}
+
+// RolloverMove is a member of a merged group moving to the target.
+// AlreadyMember is set when the user was in both groups, Primary when the
+// merged group was their primary group.
+type RolloverMove struct {
+	UserID        int    `json:"user_id"`
+	Username      string `json:"username"`
+	FromGroupID   int    `json:"from_group_id"`
+	ToGroupID     int    `json:"to_group_id"`
+	AlreadyMember bool   `json:"already_member"`
+	Primary       bool   `json:"primary,omitempty"`
+}
+
+// RolloverArchivedUser is a student archived with their class.
+type RolloverArchivedUser struct {
+	UserID         int    `json:"user_id"`
+	Username       string `json:"username"`
+	PreviousStatus string `json:"previous_status"`
+}
+
+// RolloverChanges is everything a rollover changes, shown as the preview
+// and kept to roll the rollover back.
+type RolloverChanges struct {
+	Groups   []RolloverGroup        `json:"groups"`
+	Moves    []RolloverMove         `json:"moves"`
+	Archived []RolloverArchivedUser `json:"archived"`
+}
+
+func (c RolloverChanges) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *RolloverChanges) Scan(src interface{}) error {
+	return scanJSON(src, c)
+}
+
+type Rollover struct {
+	ID            int64           `json:"id" db:"id"`
+	Plan          RolloverPlan    `json:"plan" db:"plan"`
+	Changes       RolloverChanges `json:"changes" db:"changes"`
+	Status        string          `json:"status" db:"status"`
+	ActorID       *int            `json:"actor_id,omitempty" db:"actor_id"`
+	AppliedAt     time.Time       `json:"applied_at" db:"applied_at"`
+	RollbackUntil time.Time       `json:"rollback_until" db:"rollback_until"`
+	RolledBackAt  *time.Time      `json:"rolled_back_at,omitempty" db:"rolled_back_at"`
+}
+
+func scanJSON(src interface{}, v interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unsupported json column type %T", src)
+	}
+}
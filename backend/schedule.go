@@ -0,0 +1,196 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const DefaultScheduleTimezone = "UTC"
+
+// WeekdaySet is a set of weekdays stored as a bit mask (bit 0 is Sunday, as in
+// time.Weekday) and exchanged as a JSON array of day numbers.
+type WeekdaySet uint8
+
+const AllWeekdays WeekdaySet = 1<<7 - 1
+
+func (w WeekdaySet) Has(day time.Weekday) bool {
+	return w&(1<<uint(day)) != 0
+}
+
+func (w WeekdaySet) Days() []int {
+	days := make([]int, 0, 7)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if w.Has(day) {
+			days = append(days, int(day))
+		}
+	}
+	return days
+}
+
+func (w WeekdaySet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.Days())
+}
+
+func (w *WeekdaySet) UnmarshalJSON(data []byte) error {
+	var days []int
+	if err := json.Unmarshal(data, &days); err != nil {
+		return fmt.Errorf("%w: weekdays must be a list of numbers 0-6", ErrInvalidWhitelistEntry)
+	}
+
+	var set WeekdaySet
+	for _, day := range days {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("%w: weekday %d is out of range 0-6", ErrInvalidWhitelistEntry, day)
+		}
+		set |= 1 << uint(day)
+	}
+	*w = set
+	return nil
+}
+
+func (w WeekdaySet) Value() (driver.Value, error) {
+	return int64(w), nil
+}
+
+func (w *WeekdaySet) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*w = WeekdaySet(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into WeekdaySet", src)
+	}
+}
+
+// WhitelistSchedule is a recurring window in which a whitelist entry is
+// active. Times are "HH:MM" in the schedule's timezone; an end time not after
+// the start time means the window runs past midnight into the next day.
+type WhitelistSchedule struct {
+	ID        int64      `json:"id" db:"id"`
+	EntryID   int64      `json:"-" db:"whitelist_id"`
+	Weekdays  WeekdaySet `json:"weekdays" db:"weekdays"`
+	StartTime string     `json:"start_time" db:"start_time"`
+	EndTime   string     `json:"end_time" db:"end_time"`
+	Timezone  string     `json:"timezone" db:"timezone"`
+}
+
+func (s *WhitelistSchedule) Normalize() error {
+	if s.Weekdays == 0 {
+		s.Weekdays = AllWeekdays
+	}
+	if s.Timezone == "" {
+		s.Timezone = DefaultScheduleTimezone
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidWhitelistEntry, s.Timezone)
+	}
+
+	start, err := parseClock(s.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(s.EndTime)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("%w: schedule start and end time are equal", ErrInvalidWhitelistEntry)
+	}
+
+	s.StartTime = formatClock(start)
+	s.EndTime = formatClock(end)
+	return nil
+}
+
+// Contains reports whether t falls inside the window.
+func (s WhitelistSchedule) Contains(t time.Time) bool {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false
+	}
+	start, err := parseClock(s.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(s.EndTime)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start < end {
+		return s.Weekdays.Has(local.Weekday()) && minute >= start && minute < end
+	}
+
+	// Overnight window: the evening part belongs to the listed day, the
+	// morning part to the day after it.
+	if minute >= start {
+		return s.Weekdays.Has(local.Weekday())
+	}
+	if minute < end {
+		return s.Weekdays.Has((local.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+// ActiveAt reports whether the entry applies at t. Entries without schedules
+// are always active.
+func (e WhitelistEntry) ActiveAt(t time.Time) bool {
+	if len(e.Schedules) == 0 {
+		return true
+	}
+	for _, schedule := range e.Schedules {
+		if schedule.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextScheduleBoundary returns the earliest time after t at which one of the
+// schedules opens or closes, or the zero time if there are none.
+func NextScheduleBoundary(schedules []WhitelistSchedule, t time.Time) time.Time {
+	var boundaries []time.Time
+	for _, schedule := range schedules {
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			continue
+		}
+		local := t.In(loc)
+		for _, clock := range []string{schedule.StartTime, schedule.EndTime} {
+			minute, err := parseClock(clock)
+			if err != nil {
+				continue
+			}
+			next := time.Date(local.Year(), local.Month(), local.Day(), minute/60, minute%60, 0, 0, loc)
+			if !next.After(t) {
+				next = next.AddDate(0, 0, 1)
+			}
+			boundaries = append(boundaries, next)
+		}
+	}
+
+	if len(boundaries) == 0 {
+		return time.Time{}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+	return boundaries[0]
+}
+
+func parseClock(value string) (int, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour()*60 + t.Minute(), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q is not a valid time of day (HH:MM)", ErrInvalidWhitelistEntry, value)
+}
+
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
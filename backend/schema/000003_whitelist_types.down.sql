@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_whitelist_group_id;
+
+ALTER TABLE whitelist
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS entry_type;
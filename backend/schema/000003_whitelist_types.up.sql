@@ -0,0 +1,5 @@
+ALTER TABLE whitelist
+    ADD COLUMN entry_type VARCHAR(20) NOT NULL DEFAULT 'domain' CHECK (entry_type IN ('domain', 'url', 'app')),
+    ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_whitelist_group_id ON whitelist(group_id);
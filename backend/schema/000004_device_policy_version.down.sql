@@ -0,0 +1,4 @@
+ALTER TABLE device_status
+    DROP COLUMN IF EXISTS policy_applied_at,
+    DROP COLUMN IF EXISTS policy_pushed_version,
+    DROP COLUMN IF EXISTS policy_version;
@@ -0,0 +1,4 @@
+ALTER TABLE device_status
+    ADD COLUMN policy_version VARCHAR(64),
+    ADD COLUMN policy_pushed_version VARCHAR(64),
+    ADD COLUMN policy_applied_at TIMESTAMP;
@@ -0,0 +1,8 @@
+CREATE TABLE whitelist_global (
+    id SERIAL PRIMARY KEY,
+    list_type VARCHAR(10) NOT NULL CHECK (list_type IN ('allow', 'deny')),
+    entry_type VARCHAR(20) NOT NULL CHECK (entry_type IN ('domain', 'url', 'app')),
+    resource TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (list_type, entry_type, resource)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS device_enrollment_codes;
+DROP TABLE IF EXISTS devices;
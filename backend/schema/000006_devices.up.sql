@@ -0,0 +1,19 @@
+CREATE TABLE devices (
+    id SERIAL PRIMARY KEY,
+    device_name VARCHAR(255) NOT NULL UNIQUE,
+    credential_hash VARCHAR(64) NOT NULL,
+    enrolled_by INT REFERENCES users (id) ON DELETE SET NULL,
+    enrolled_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE device_enrollment_codes (
+    id SERIAL PRIMARY KEY,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_by INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by_device VARCHAR(255)
+);
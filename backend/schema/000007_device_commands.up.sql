@@ -0,0 +1,16 @@
+CREATE TABLE device_commands (
+    id VARCHAR(36) PRIMARY KEY,
+    device_name VARCHAR(255) NOT NULL,
+    command_type VARCHAR(20) NOT NULL CHECK (command_type IN ('lock', 'unlock', 'message', 'logoff', 'shutdown')),
+    payload TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'executed', 'failed', 'expired')),
+    result TEXT,
+    created_by INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP,
+    acknowledged_at TIMESTAMP
+);
+
+CREATE INDEX idx_device_commands_device ON device_commands(device_name, created_at);
+CREATE INDEX idx_device_commands_status ON device_commands(status, expires_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_devices_room;
+
+ALTER TABLE devices DROP COLUMN IF EXISTS room;
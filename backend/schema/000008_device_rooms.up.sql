@@ -0,0 +1,3 @@
+ALTER TABLE devices ADD COLUMN room VARCHAR(100);
+
+CREATE INDEX idx_devices_room ON devices(room);
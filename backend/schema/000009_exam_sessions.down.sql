@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS exam_violations;
+DROP TABLE IF EXISTS exam_whitelist;
+DROP TABLE IF EXISTS exam_sessions;
@@ -0,0 +1,35 @@
+CREATE TABLE exam_sessions (
+    id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    block_clipboard BOOLEAN NOT NULL DEFAULT FALSE,
+    block_usb BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_exam_sessions_window ON exam_sessions(group_id, starts_at, ends_at);
+
+CREATE TABLE exam_whitelist (
+    id SERIAL PRIMARY KEY,
+    exam_id INT NOT NULL REFERENCES exam_sessions (id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL CHECK (entry_type IN ('domain', 'url', 'app')),
+    resource TEXT NOT NULL,
+    UNIQUE (exam_id, entry_type, resource)
+);
+
+CREATE TABLE exam_violations (
+    id SERIAL PRIMARY KEY,
+    exam_id INT NOT NULL REFERENCES exam_sessions (id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    device_name VARCHAR(255) NOT NULL,
+    program VARCHAR(255),
+    action TEXT,
+    occurred_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_exam_violations_exam ON exam_violations(exam_id, occurred_at);
@@ -0,0 +1,11 @@
+CREATE TABLE whitelist_schedules (
+    id SERIAL PRIMARY KEY,
+    whitelist_id INT NOT NULL REFERENCES whitelist (id) ON DELETE CASCADE,
+    weekdays SMALLINT NOT NULL DEFAULT 127 CHECK (weekdays BETWEEN 1 AND 127),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    CHECK (start_time <> end_time)
+);
+
+CREATE INDEX idx_whitelist_schedules_entry ON whitelist_schedules(whitelist_id);
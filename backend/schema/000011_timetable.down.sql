@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS lessons;
+DROP TABLE IF EXISTS timetable_periods;
+DROP TABLE IF EXISTS timetable_terms;
@@ -0,0 +1,31 @@
+CREATE TABLE timetable_terms (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    CHECK (end_date >= start_date)
+);
+
+CREATE TABLE timetable_periods (
+    id SERIAL PRIMARY KEY,
+    number INT NOT NULL UNIQUE,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    CHECK (end_time > start_time)
+);
+
+CREATE TABLE lessons (
+    id SERIAL PRIMARY KEY,
+    term_id INT NOT NULL REFERENCES timetable_terms (id) ON DELETE CASCADE,
+    group_id INT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    teacher_id INT REFERENCES users (id) ON DELETE SET NULL,
+    room VARCHAR(100) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    period_id INT NOT NULL REFERENCES timetable_periods (id) ON DELETE CASCADE,
+    UNIQUE (term_id, group_id, weekday, period_id)
+);
+
+CREATE INDEX idx_lessons_group ON lessons(group_id, weekday);
+CREATE INDEX idx_lessons_teacher ON lessons(teacher_id, weekday);
+CREATE INDEX idx_lessons_room ON lessons(room, weekday);
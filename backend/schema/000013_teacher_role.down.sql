@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS teacher_groups;
+
+UPDATE users SET role = 'client' WHERE role = 'teacher';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'client'));
@@ -0,0 +1,18 @@
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    actor_username VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    target_name VARCHAR(255) NOT NULL DEFAULT '',
+    changes JSONB NOT NULL DEFAULT '{}',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    result VARCHAR(16) NOT NULL CHECK (result IN ('success', 'failure')),
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_created ON audit_events(created_at DESC);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id);
+CREATE INDEX idx_audit_events_actor ON audit_events(actor_id);
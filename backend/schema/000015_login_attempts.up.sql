@@ -0,0 +1,8 @@
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_locked ON login_attempts(locked_until) WHERE locked_until IS NOT NULL;
@@ -0,0 +1,20 @@
+CREATE TABLE directory_operations (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    target_name VARCHAR(255) NOT NULL DEFAULT '',
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL
+        CHECK (status IN ('running', 'pending', 'compensating', 'succeeded', 'compensated', 'failed')),
+    phase VARCHAR(16) NOT NULL DEFAULT 'forward' CHECK (phase IN ('forward', 'compensate')),
+    step INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_directory_operations_due ON directory_operations(status, next_attempt_at);
+CREATE INDEX idx_directory_operations_created ON directory_operations(created_at DESC);
@@ -0,0 +1,18 @@
+CREATE TABLE directory_sync_runs (
+    id BIGSERIAL PRIMARY KEY,
+    trigger VARCHAR(16) NOT NULL CHECK (trigger IN ('manual', 'schedule')),
+    mode VARCHAR(16) NOT NULL CHECK (mode IN ('dry_run', 'apply')),
+    status VARCHAR(16) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    phase VARCHAR(16) NOT NULL DEFAULT 'reading',
+    total INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    applied INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '{"drift": []}',
+    error TEXT NOT NULL DEFAULT '',
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_directory_sync_runs_started ON directory_sync_runs(started_at DESC);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS rollovers;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS archived_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS status;
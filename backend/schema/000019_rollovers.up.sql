@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'disabled', 'archived')),
+    ADD COLUMN archived_at TIMESTAMP;
+
+ALTER TABLE groups ADD COLUMN archived_at TIMESTAMP;
+
+CREATE TABLE rollovers (
+    id BIGSERIAL PRIMARY KEY,
+    plan JSONB NOT NULL,
+    changes JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('applied', 'rolled_back')),
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rollback_until TIMESTAMP NOT NULL,
+    rolled_back_at TIMESTAMP
+);
+
+CREATE INDEX idx_rollovers_applied ON rollovers(applied_at DESC);
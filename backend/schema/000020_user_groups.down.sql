@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_users_lists_group;
+DROP INDEX IF EXISTS idx_users_lists_primary;
+
+-- Keep the primary group only, as before.
+DELETE FROM users_lists WHERE NOT is_primary
+    AND user_id IN (SELECT user_id FROM users_lists WHERE is_primary);
+
+ALTER TABLE users_lists DROP COLUMN IF EXISTS is_primary;
@@ -0,0 +1,11 @@
+-- A user is in one primary (homeroom) group and any number of others.
+ALTER TABLE users_lists ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users_lists ul SET is_primary = TRUE
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, group_id FROM users_lists ORDER BY user_id, group_id
+) p
+WHERE ul.user_id = p.user_id AND ul.group_id = p.group_id;
+
+CREATE UNIQUE INDEX idx_users_lists_primary ON users_lists(user_id) WHERE is_primary;
+CREATE INDEX idx_users_lists_group ON users_lists(group_id);
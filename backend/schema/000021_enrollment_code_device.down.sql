@@ -0,0 +1 @@
+ALTER TABLE device_enrollment_codes DROP COLUMN IF EXISTS device_name;
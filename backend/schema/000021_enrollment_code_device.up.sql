@@ -0,0 +1,2 @@
+-- A code issued for a device is the only way to re-enroll it once enrolled.
+ALTER TABLE device_enrollment_codes ADD COLUMN device_name VARCHAR(255);
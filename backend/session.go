@@ -0,0 +1,50 @@
+package classosbackend
+
+import "time"
+
+// AuthSession is a sign-in on one client. It holds the hash of the current
+// refresh token, which is replaced on every refresh; access tokens carry the
+// session id so revoking the session cuts them off too.
+type AuthSession struct {
+	ID                string     `json:"id" db:"id"`
+	UserID            int        `json:"user_id" db:"user_id"`
+	RefreshTokenHash  string     `json:"-" db:"refresh_token_hash"`
+	PreviousTokenHash *string    `json:"-" db:"previous_token_hash"`
+	UserAgent         string     `json:"user_agent" db:"user_agent"`
+	IP                string     `json:"ip" db:"ip"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt        time.Time  `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+func (s AuthSession) IsActive(at time.Time) bool {
+	return s.RevokedAt == nil && at.Before(s.ExpiresAt)
+}
+
+// ClientInfo describes the client a session is opened from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SignInResult is either an open session or, when a second factor is still
+// needed, a short-lived MFA token for the next step. RecoveryCodes are only
+// set right after an enrollment completed during sign-in.
+type SignInResult struct {
+	Tokens                TokenPair
+	User                  User
+	MFAToken              string
+	MFAEnrollmentRequired bool
+	RecoveryCodes         []string
+}
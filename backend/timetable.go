@@ -0,0 +1,253 @@
+package classosbackend
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidTimetable = errors.New("invalid timetable")
+
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day without a time of day, exchanged as "2006-01-02".
+type Date struct {
+	time.Time
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("%w: dates must be strings (YYYY-MM-DD)", ErrInvalidTimetable)
+	}
+
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a valid date (YYYY-MM-DD)", ErrInvalidTimetable, value)
+	}
+	d.Time = t
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		d.Time = time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+		return nil
+	case string:
+		return d.parse(v)
+	case []byte:
+		return d.parse(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+}
+
+func (d *Date) parse(value string) error {
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+// Term is a date range (school year, semester) the lessons belong to. Both
+// dates are inclusive.
+type Term struct {
+	ID        int64  `json:"id" db:"id"`
+	Name      string `json:"name" db:"name" binding:"required"`
+	StartDate Date   `json:"start_date" db:"start_date" binding:"required"`
+	EndDate   Date   `json:"end_date" db:"end_date" binding:"required"`
+}
+
+func (t Term) Validate() error {
+	if t.StartDate.IsZero() || t.EndDate.IsZero() {
+		return fmt.Errorf("%w: start_date and end_date are required", ErrInvalidTimetable)
+	}
+	if t.EndDate.Before(t.StartDate.Time) {
+		return fmt.Errorf("%w: end_date must not be before start_date", ErrInvalidTimetable)
+	}
+	return nil
+}
+
+type UpdateTermInput struct {
+	Name      *string `json:"name"`
+	StartDate *Date   `json:"start_date"`
+	EndDate   *Date   `json:"end_date"`
+}
+
+func (i UpdateTermInput) Validate() error {
+	if i.Name == nil && i.StartDate == nil && i.EndDate == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+func (i UpdateTermInput) Apply(term Term) Term {
+	if i.Name != nil {
+		term.Name = *i.Name
+	}
+	if i.StartDate != nil {
+		term.StartDate = *i.StartDate
+	}
+	if i.EndDate != nil {
+		term.EndDate = *i.EndDate
+	}
+	return term
+}
+
+// Period is a numbered slot of the school day, e.g. period 1 from 08:00 to
+// 08:45. Times are "HH:MM" in the school timezone.
+type Period struct {
+	ID        int64  `json:"id" db:"id"`
+	Number    int    `json:"number" db:"number" binding:"required"`
+	StartTime string `json:"start_time" db:"start_time" binding:"required"`
+	EndTime   string `json:"end_time" db:"end_time" binding:"required"`
+}
+
+func (p *Period) Normalize() error {
+	if p.Number <= 0 {
+		return fmt.Errorf("%w: period number must be positive", ErrInvalidTimetable)
+	}
+
+	start, err := parseClock(p.StartTime)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a valid time of day (HH:MM)", ErrInvalidTimetable, p.StartTime)
+	}
+	end, err := parseClock(p.EndTime)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a valid time of day (HH:MM)", ErrInvalidTimetable, p.EndTime)
+	}
+	if end <= start {
+		return fmt.Errorf("%w: period must end after it starts", ErrInvalidTimetable)
+	}
+
+	p.StartTime = formatClock(start)
+	p.EndTime = formatClock(end)
+	return nil
+}
+
+type UpdatePeriodInput struct {
+	Number    *int    `json:"number"`
+	StartTime *string `json:"start_time"`
+	EndTime   *string `json:"end_time"`
+}
+
+func (i UpdatePeriodInput) Validate() error {
+	if i.Number == nil && i.StartTime == nil && i.EndTime == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+func (i UpdatePeriodInput) Apply(period Period) Period {
+	if i.Number != nil {
+		period.Number = *i.Number
+	}
+	if i.StartTime != nil {
+		period.StartTime = *i.StartTime
+	}
+	if i.EndTime != nil {
+		period.EndTime = *i.EndTime
+	}
+	return period
+}
+
+// Lesson is one recurring timetable slot: a group has a subject with a
+// teacher in a room on a weekday (0 is Sunday, as in time.Weekday) during a
+// period, for the duration of a term.
+type Lesson struct {
+	ID        int64  `json:"id" db:"id"`
+	TermID    int64  `json:"term_id" db:"term_id" binding:"required"`
+	GroupID   int64  `json:"group_id" db:"group_id" binding:"required"`
+	TeacherID *int64 `json:"teacher_id" db:"teacher_id"`
+	Room      string `json:"room" db:"room"`
+	Subject   string `json:"subject" db:"subject" binding:"required"`
+	Weekday   int    `json:"weekday" db:"weekday"`
+	PeriodID  int64  `json:"period_id" db:"period_id" binding:"required"`
+}
+
+func (l Lesson) Validate() error {
+	if l.Weekday < 0 || l.Weekday > 6 {
+		return fmt.Errorf("%w: weekday must be between 0 and 6", ErrInvalidTimetable)
+	}
+	if l.Subject == "" {
+		return fmt.Errorf("%w: subject is required", ErrInvalidTimetable)
+	}
+	return nil
+}
+
+type UpdateLessonInput struct {
+	TermID    *int64  `json:"term_id"`
+	TeacherID *int64  `json:"teacher_id"`
+	Room      *string `json:"room"`
+	Subject   *string `json:"subject"`
+	Weekday   *int    `json:"weekday"`
+	PeriodID  *int64  `json:"period_id"`
+}
+
+func (i UpdateLessonInput) Validate() error {
+	if i.TermID == nil && i.TeacherID == nil && i.Room == nil &&
+		i.Subject == nil && i.Weekday == nil && i.PeriodID == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+func (i UpdateLessonInput) Apply(lesson Lesson) Lesson {
+	if i.TermID != nil {
+		lesson.TermID = *i.TermID
+	}
+	if i.TeacherID != nil {
+		lesson.TeacherID = i.TeacherID
+	}
+	if i.Room != nil {
+		lesson.Room = *i.Room
+	}
+	if i.Subject != nil {
+		lesson.Subject = *i.Subject
+	}
+	if i.Weekday != nil {
+		lesson.Weekday = *i.Weekday
+	}
+	if i.PeriodID != nil {
+		lesson.PeriodID = *i.PeriodID
+	}
+	return lesson
+}
+
+type LessonsFilter struct {
+	TermID    int
+	GroupID   int
+	TeacherID int
+	Room      string
+	Weekday   *int
+}
+
+// CurrentLesson is the lesson a group is in at a given moment together with
+// its period and term and the exact start and end of this occurrence.
+type CurrentLesson struct {
+	Lesson   Lesson    `json:"lesson"`
+	Period   Period    `json:"period"`
+	Term     Term      `json:"term"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
@@ -0,0 +1,42 @@
+package classosbackend
+
+import "time"
+
+// TwoFactor is the TOTP enrollment of a user. EnabledAt stays nil until the
+// user confirms the secret with a first code. LastUsedStep is the time step
+// of the last accepted code, so a code cannot be used twice.
+type TwoFactor struct {
+	UserID       int        `db:"user_id"`
+	Secret       string     `db:"secret"`
+	EnabledAt    *time.Time `db:"enabled_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+}
+
+func (t TwoFactor) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// TOTPSetup is shown once while enrolling: the secret for manual entry and
+// the otpauth URI for a QR code.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAInput is the second sign-in step; Code is not needed to start an
+// enrollment.
+type MFAInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
@@ -1,7 +1,47 @@
 package classosbackend
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
+// Admins manage everything, teachers see the groups assigned to them and
+// clients are the students signing in on the devices.
+const (
+	RoleAdmin   = "admin"
+	RoleTeacher = "teacher"
+	RoleClient  = "client"
+)
+
+// SuperAdminUsername is the built-in break-glass admin. The database keeps it
+// an admin and refuses to delete it.
+const SuperAdminUsername = "admin01"
+
+// Account states. Only active accounts can sign in; archived ones are kept
+// with their history, e.g. graduates after a rollover.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusArchived = "archived"
+)
+
+var (
+	ErrNotATeacher        = errors.New("user is not a teacher")
+	ErrUserStatusConflict = errors.New("user status does not allow this change")
+	ErrPrimaryGroup       = errors.New("the primary group cannot be left, move the user to another group instead")
+)
+
+type TeacherAssignmentInput struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+// GroupMemberInput adds a user to a group besides their primary one.
+type GroupMemberInput struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+// User is a member of one primary (homeroom) group, GroupID and GroupName,
+// and any number of other groups. Groups lists all of them, primary first.
 type User struct {
 	ID        int     `json:"id" db:"id"`
 	Name      string  `json:"name" db:"name" binding:"required"`
@@ -10,6 +50,16 @@ type User struct {
 	Role      string  `json:"role" db:"role"`
 	GroupID   *int    `json:"group_id,omitempty" db:"group_id"`
 	GroupName *string `json:"group_name" db:"group_name"`
+	Groups    []Group `json:"groups" db:"-"`
+
+	Status     string     `json:"status,omitempty" db:"status"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+}
+
+// Active reports whether the user may sign in. Users read without their
+// status count as active.
+func (u User) Active() bool {
+	return u.Status == "" || u.Status == UserStatusActive
 }
 
 type UpdateUserInput struct {
@@ -22,7 +72,7 @@ type UpdateUserInput struct {
 }
 
 func (i UpdateUserInput) Validate() error {
-	if i.Name == nil && i.Username == nil && i.Role == nil && i.GroupID == nil {
+	if i.Name == nil && i.Username == nil && i.Password == nil && i.Role == nil && i.GroupID == nil {
 		return errors.New("update structure has no values")
 	}
 
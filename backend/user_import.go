@@ -0,0 +1,57 @@
+package classosbackend
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidImport            = errors.New("invalid import file")
+	ErrImportCredentialsExpired = errors.New("import credentials not found or expired")
+)
+
+// Outcome of a single import row. A dry run stops at valid or invalid.
+const (
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowCreated = "created"
+	ImportRowFailed  = "failed"
+)
+
+// ImportRow is one student of a bulk import. Username is either taken from
+// the file or generated from the name.
+type ImportRow struct {
+	Row       int    `json:"row"`
+	Name      string `json:"name"`
+	Class     string `json:"class"`
+	Username  string `json:"username"`
+	Generated bool   `json:"generated"`
+	NewGroup  bool   `json:"new_group,omitempty"`
+	UserID    int    `json:"user_id,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Password  string `json:"-"`
+}
+
+type ImportOptions struct {
+	DryRun bool
+	// CreateGroups creates the classes missing in the database instead of
+	// rejecting their rows.
+	CreateGroups bool
+}
+
+// ImportReport is the per-row result of a bulk import. The generated
+// passwords are not part of it; they are downloaded as a credentials sheet
+// by CredentialsID until CredentialsExpireAt.
+type ImportReport struct {
+	DryRun              bool        `json:"dry_run"`
+	Total               int         `json:"total"`
+	Valid               int         `json:"valid"`
+	Invalid             int         `json:"invalid"`
+	Created             int         `json:"created"`
+	Failed              int         `json:"failed"`
+	NewGroups           []string    `json:"new_groups,omitempty"`
+	Rows                []ImportRow `json:"rows"`
+	CredentialsID       string      `json:"credentials_id,omitempty"`
+	CredentialsExpireAt *time.Time  `json:"credentials_expire_at,omitempty"`
+}
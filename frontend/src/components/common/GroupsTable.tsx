@@ -1,61 +1,56 @@
-import { useState, useMemo } from 'react';
+import { useState, useEffect } from 'react';
 import { Search, ChevronUp, ChevronDown, ChevronsUpDown, Edit, Trash2, Eye } from 'lucide-react';
-import type { GroupWithUserCount } from '../../types';
+import type { GroupWithUserCount, GroupsListParams } from '../../types';
 
 interface GroupsTableProps {
   groups: GroupWithUserCount[];
+  total: number;
+  params: GroupsListParams;
+  onParamsChange: (params: GroupsListParams) => void;
   loading?: boolean;
   onEdit: (group: GroupWithUserCount) => void;
   onDelete: (group: GroupWithUserCount) => void;
   onViewDetails: (group: GroupWithUserCount) => void;
 }
 
-type SortField = 'id' | 'name' | 'userCount';
-type SortOrder = 'asc' | 'desc';
-
-const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails }: GroupsTableProps) => {
-  const [searchQuery, setSearchQuery] = useState('');
-  const [sortField, setSortField] = useState<SortField>('id');
-  const [sortOrder, setSortOrder] = useState<SortOrder>('asc');
-  const [currentPage, setCurrentPage] = useState(1);
-  const itemsPerPage = 10;
-
-  const filteredGroups = useMemo(() => {
-    return groups.filter((group) =>
-      group.name.toLowerCase().includes(searchQuery.toLowerCase())
-    );
-  }, [groups, searchQuery]);
-
-  const sortedGroups = useMemo(() => {
-    const sorted = [...filteredGroups].sort((a, b) => {
-      const aValue = a[sortField];
-      const bValue = b[sortField];
-
-      if (typeof aValue === 'string') {
-        return sortOrder === 'asc'
-          ? aValue.localeCompare(bValue as string)
-          : (bValue as string).localeCompare(aValue);
-      }
-
-      return sortOrder === 'asc' ? (aValue as number) - (bValue as number) : (bValue as number) - (aValue as number);
-    });
-
-    return sorted;
-  }, [filteredGroups, sortField, sortOrder]);
-
-  const paginatedGroups = useMemo(() => {
-    const startIndex = (currentPage - 1) * itemsPerPage;
-    return sortedGroups.slice(startIndex, startIndex + itemsPerPage);
-  }, [sortedGroups, currentPage]);
-
-  const totalPages = Math.ceil(sortedGroups.length / itemsPerPage);
+type SortField = NonNullable<GroupsListParams['sort']>;
+
+// Поиск, сортировка и пагинация выполняются на сервере
+const GroupsTable = ({
+  groups,
+  total,
+  params,
+  onParamsChange,
+  loading = false,
+  onEdit,
+  onDelete,
+  onViewDetails,
+}: GroupsTableProps) => {
+  const [searchQuery, setSearchQuery] = useState(params.search ?? '');
+  const sortField = params.sort ?? 'id';
+  const sortOrder = params.order ?? 'asc';
+  const currentPage = params.page ?? 1;
+  const itemsPerPage = params.page_size ?? 10;
+  const totalPages = Math.ceil(total / itemsPerPage);
+
+  // Запрос уходит, когда пользователь перестал печатать
+  useEffect(() => {
+    if (searchQuery === (params.search ?? '')) return;
+    const timer = setTimeout(() => {
+      onParamsChange({ ...params, search: searchQuery || undefined, page: 1 });
+    }, 300);
+    return () => clearTimeout(timer);
+  }, [searchQuery, params, onParamsChange]);
+
+  const setCurrentPage = (page: number) => {
+    onParamsChange({ ...params, page });
+  };
 
   const handleSort = (field: SortField) => {
     if (sortField === field) {
-      setSortOrder(sortOrder === 'asc' ? 'desc' : 'asc');
+      onParamsChange({ ...params, order: sortOrder === 'asc' ? 'desc' : 'asc' });
     } else {
-      setSortField(field);
-      setSortOrder('asc');
+      onParamsChange({ ...params, sort: field, order: 'asc' });
     }
   };
 
@@ -64,6 +59,10 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
     return sortOrder === 'asc' ? <ChevronUp className="w-4 h-4" /> : <ChevronDown className="w-4 h-4" />;
   };
 
+  const visiblePages = Array.from({ length: totalPages }, (_, i) => i + 1).filter(
+    (page) => page === 1 || page === totalPages || Math.abs(page - currentPage) <= 2
+  );
+
   if (loading) {
     return (
       <div className="bg-white rounded-lg shadow p-6">
@@ -84,10 +83,7 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
             type="text"
             placeholder="Search groups by name..."
             value={searchQuery}
-            onChange={(e) => {
-              setSearchQuery(e.target.value);
-              setCurrentPage(1);
-            }}
+            onChange={(e) => setSearchQuery(e.target.value)}
             className="w-full pl-10 pr-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
           />
         </div>
@@ -114,11 +110,11 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
                 </div>
               </th>
               <th
-                onClick={() => handleSort('userCount')}
+                onClick={() => handleSort('member_count')}
                 className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider cursor-pointer hover:bg-gray-100"
               >
                 <div className="flex items-center gap-2">
-                  Users <SortIcon field="userCount" />
+                  Users <SortIcon field="member_count" />
                 </div>
               </th>
               <th className="px-6 py-3 text-right text-xs font-medium text-gray-500 uppercase tracking-wider">
@@ -127,14 +123,14 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
             </tr>
           </thead>
           <tbody className="bg-white divide-y divide-gray-200">
-            {paginatedGroups.length === 0 ? (
+            {groups.length === 0 ? (
               <tr>
                 <td colSpan={4} className="px-6 py-8 text-center text-gray-500">
                   No groups found
                 </td>
               </tr>
             ) : (
-              paginatedGroups.map((group) => (
+              groups.map((group) => (
                 <tr key={group.id} className="hover:bg-gray-50 transition-colors">
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">{group.id}</td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">
@@ -179,17 +175,17 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
         <div className="px-6 py-4 border-t border-gray-200 flex items-center justify-between">
           <div className="text-sm text-gray-600">
             Showing {(currentPage - 1) * itemsPerPage + 1} to{' '}
-            {Math.min(currentPage * itemsPerPage, sortedGroups.length)} of {sortedGroups.length} groups
+            {Math.min(currentPage * itemsPerPage, total)} of {total} groups
           </div>
           <div className="flex gap-2">
             <button
-              onClick={() => setCurrentPage((p) => Math.max(1, p - 1))}
+              onClick={() => setCurrentPage(Math.max(1, currentPage - 1))}
               disabled={currentPage === 1}
               className="px-3 py-1 border border-gray-300 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed hover:bg-gray-50"
             >
               Previous
             </button>
-            {Array.from({ length: totalPages }, (_, i) => i + 1).map((page) => (
+            {visiblePages.map((page) => (
               <button
                 key={page}
                 onClick={() => setCurrentPage(page)}
@@ -203,7 +199,7 @@ const GroupsTable = ({ groups, loading = false, onEdit, onDelete, onViewDetails
               </button>
             ))}
             <button
-              onClick={() => setCurrentPage((p) => Math.min(totalPages, p + 1))}
+              onClick={() => setCurrentPage(Math.min(totalPages, currentPage + 1))}
               disabled={currentPage === totalPages}
               className="px-3 py-1 border border-gray-300 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed hover:bg-gray-50"
             >
@@ -17,7 +17,7 @@ const createUserSchema = z.object({
   name: z.string().min(1, 'Name is required').max(100, 'Name too long'),
   username: z.string().min(1, 'Username is required').max(100, 'Username too long'),
   password: passwordSchema,
-  role: z.enum(['admin', 'client']),
+  role: z.enum(['admin', 'teacher', 'client']),
   group_id: z.number().min(1, 'Group is required'),
 });
 
@@ -33,7 +33,7 @@ const editUserSchema = z.object({
       message: 'Password must be at least 8 characters with uppercase, lowercase, number, and special character',
     }
   ),
-  role: z.enum(['admin', 'client']),
+  role: z.enum(['admin', 'teacher', 'client']),
   group_id: z.number().min(1, 'Group is required'),
 });
 
@@ -179,6 +179,7 @@ const UserModal = ({ isOpen, onClose, onSubmit, user, groups, isLoading }: UserM
                 }`}
               >
                 <option value="client">Client</option>
+                <option value="teacher">Teacher</option>
                 <option value="admin">Admin</option>
               </select>
               {errors.role && <p className="mt-1 text-sm text-red-600">{errors.role.message}</p>}
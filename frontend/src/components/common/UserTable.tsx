@@ -1,9 +1,13 @@
-import { useState, useMemo } from 'react';
+import { useState, useEffect } from 'react';
 import { Search, ChevronUp, ChevronDown, ChevronsUpDown, Edit, Trash2, Activity } from 'lucide-react';
-import type { User, UserStatus } from '../../types';
+import type { User, Group, UsersListParams } from '../../types';
 
 interface UserTableProps {
   users: User[];
+  total: number;
+  params: UsersListParams;
+  onParamsChange: (params: UsersListParams) => void;
+  groups?: Group[];
   loading?: boolean;
   onEdit?: (user: User) => void;
   onDelete?: (user: User) => void;
@@ -11,88 +15,50 @@ interface UserTableProps {
   showActions?: boolean;
 }
 
-type SortField = keyof User | 'status';
-type SortOrder = 'asc' | 'desc';
+type SortField = NonNullable<UsersListParams['sort']>;
 
-const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showActions = false }: UserTableProps) => {
-  const [searchQuery, setSearchQuery] = useState('');
-  const [roleFilter, setRoleFilter] = useState<'all' | 'admin' | 'client'>('all');
-  const [groupFilter, setGroupFilter] = useState<string>('all');
-  const [statusFilter, setStatusFilter] = useState<'all' | 'online' | 'offline'>('all');
-  const [sortField, setSortField] = useState<SortField>('id');
-  const [sortOrder, setSortOrder] = useState<SortOrder>('asc');
-  const [currentPage, setCurrentPage] = useState(1);
-  const itemsPerPage = 10;
+// Поиск, фильтры, сортировка и пагинация выполняются на сервере
+const UserTable = ({
+  users,
+  total,
+  params,
+  onParamsChange,
+  groups = [],
+  loading = false,
+  onEdit,
+  onDelete,
+  onViewLogs,
+  showActions = false,
+}: UserTableProps) => {
+  const [searchQuery, setSearchQuery] = useState(params.search ?? '');
+  const sortField = params.sort ?? 'id';
+  const sortOrder = params.order ?? 'asc';
+  const currentPage = params.page ?? 1;
+  const itemsPerPage = params.page_size ?? 10;
+  const totalPages = Math.ceil(total / itemsPerPage);
 
-  const uniqueGroups = useMemo(() => {
-    const groups = users
-      .filter((u) => u.group_name)
-      .map((u) => u.group_name);
-    return ['all', ...Array.from(new Set(groups))];
-  }, [users]);
+  // Запрос уходит, когда пользователь перестал печатать
+  useEffect(() => {
+    if (searchQuery === (params.search ?? '')) return;
+    const timer = setTimeout(() => {
+      onParamsChange({ ...params, search: searchQuery || undefined, page: 1 });
+    }, 300);
+    return () => clearTimeout(timer);
+  }, [searchQuery, params, onParamsChange]);
 
-  const usersWithStatus = useMemo(
-    () =>
-      users.map((user) => ({
-        ...user,
-        status: 'offline' as UserStatus,
-      })),
-    [users]
-  );
-
-  const filteredUsers = useMemo(() => {
-    return usersWithStatus.filter((user) => {
-      const matchesSearch =
-        searchQuery === '' ||
-        user.name.toLowerCase().includes(searchQuery.toLowerCase()) ||
-        user.username.toLowerCase().includes(searchQuery.toLowerCase());
-
-      const matchesRole = roleFilter === 'all' || user.role === roleFilter;
-
-      const matchesGroup =
-        groupFilter === 'all' ||
-        user.group_name === groupFilter ||
-        (groupFilter === 'no-group' && !user.group_name);
-
-      const matchesStatus = statusFilter === 'all' || user.status === statusFilter;
-
-      return matchesSearch && matchesRole && matchesGroup && matchesStatus;
-    });
-  }, [usersWithStatus, searchQuery, roleFilter, groupFilter, statusFilter]);
-
-  const sortedUsers = useMemo(() => {
-    const sorted = [...filteredUsers].sort((a, b) => {
-      let aValue: any = a[sortField as keyof User];
-      let bValue: any = b[sortField as keyof User];
-
-      if (aValue === null || aValue === undefined) aValue = '';
-      if (bValue === null || bValue === undefined) bValue = '';
-
-      if (typeof aValue === 'string') {
-        return sortOrder === 'asc'
-          ? aValue.localeCompare(bValue)
-          : bValue.localeCompare(aValue);
-      }
-
-      return sortOrder === 'asc' ? aValue - bValue : bValue - aValue;
-    });
-
-    return sorted;
-  }, [filteredUsers, sortField, sortOrder]);
-
-  const paginatedUsers = useMemo(() => {
-    const startIndex = (currentPage - 1) * itemsPerPage;
-    return sortedUsers.slice(startIndex, startIndex + itemsPerPage);
-  }, [sortedUsers, currentPage]);
+  const setFilter = (changes: Partial<UsersListParams>) => {
+    onParamsChange({ ...params, ...changes, page: 1 });
+  };
 
-  const totalPages = Math.ceil(sortedUsers.length / itemsPerPage);
+  const setCurrentPage = (page: number) => {
+    onParamsChange({ ...params, page });
+  };
 
   const handleSort = (field: SortField) => {
     if (sortField === field) {
-      setSortOrder(sortOrder === 'asc' ? 'desc' : 'asc');
+      onParamsChange({ ...params, order: sortOrder === 'asc' ? 'desc' : 'asc' });
     } else {
-      setSortField(field);
-      setSortOrder('asc');
+      onParamsChange({ ...params, sort: field, order: 'asc' });
     }
   };
 
@@ -105,6 +71,10 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
     );
   };
 
+  const visiblePages = Array.from({ length: totalPages }, (_, i) => i + 1).filter(
+    (page) => page === 1 || page === totalPages || Math.abs(page - currentPage) <= 2
+  );
+
   if (loading) {
     return (
       <div className="bg-white rounded-lg shadow p-6">
@@ -126,53 +96,56 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
               type="text"
               placeholder="Search by name or username..."
               value={searchQuery}
-              onChange={(e) => {
-                setSearchQuery(e.target.value);
-                setCurrentPage(1);
-              }}
+              onChange={(e) => setSearchQuery(e.target.value)}
               className="w-full pl-10 pr-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
             />
           </div>
 
           <select
-            value={roleFilter}
-            onChange={(e) => {
-              setRoleFilter(e.target.value as any);
-              setCurrentPage(1);
-            }}
+            value={params.role ?? 'all'}
+            onChange={(e) =>
+              setFilter({
+                role: e.target.value === 'all' ? undefined : (e.target.value as UsersListParams['role']),
+              })
+            }
             className="px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
           >
             <option value="all">All Roles</option>
             <option value="admin">Admin</option>
+            <option value="teacher">Teacher</option>
             <option value="client">Client</option>
           </select>
 
           <select
-            value={groupFilter}
-            onChange={(e) => {
-              setGroupFilter(e.target.value);
-              setCurrentPage(1);
-            }}
+            value={params.group_id === undefined ? 'all' : String(params.group_id)}
+            onChange={(e) =>
+              setFilter({ group_id: e.target.value === 'all' ? undefined : Number(e.target.value) })
+            }
             className="px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
           >
-            {uniqueGroups.map((group) => (
-              <option key={group} value={group}>
-                {group === 'all' ? 'All Groups' : group || 'No Group'}
+            <option value="all">All Groups</option>
+            <option value="0">No Group</option>
+            {groups.map((group) => (
+              <option key={group.id} value={group.id}>
+                {group.name}
               </option>
             ))}
           </select>
 
           <select
-            value={statusFilter}
-            onChange={(e) => {
-              setStatusFilter(e.target.value as any);
-              setCurrentPage(1);
-            }}
+            value={params.status ?? ''}
+            onChange={(e) =>
+              setFilter({
+                status: e.target.value === '' ? undefined : (e.target.value as UsersListParams['status']),
+              })
+            }
             className="px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
           >
+            <option value="">Not Archived</option>
+            <option value="active">Active</option>
+            <option value="disabled">Disabled</option>
+            <option value="archived">Archived</option>
             <option value="all">All Status</option>
-            <option value="online">Online</option>
-            <option value="offline">Offline</option>
           </select>
         </div>
       </div>
@@ -237,14 +210,14 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
             </tr>
           </thead>
           <tbody className="bg-white divide-y divide-gray-200">
-            {paginatedUsers.length === 0 ? (
+            {users.length === 0 ? (
               <tr>
                 <td colSpan={showActions ? 7 : 6} className="px-6 py-8 text-center text-gray-500">
                   No users found
                 </td>
               </tr>
             ) : (
-              paginatedUsers.map((user) => (
+              users.map((user) => (
                 <tr key={user.id} className="hover:bg-gray-50 transition-colors">
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
                     {user.id}
@@ -272,9 +245,14 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
                     )}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap">
-                    <span className="inline-flex items-center gap-1.5 px-2 py-1 text-xs font-semibold rounded-full bg-gray-100 text-gray-600">
-                      <span className="w-2 h-2 rounded-full bg-gray-400"></span>
-                      {user.status}
+                    <span
+                      className={`inline-flex items-center gap-1.5 px-2 py-1 text-xs font-semibold rounded-full ${
+                        (user.status ?? 'active') === 'active'
+                          ? 'bg-green-100 text-green-800'
+                          : 'bg-gray-100 text-gray-600'
+                      }`}
+                    >
+                      {user.status ?? 'active'}
                     </span>
                   </td>
                   {showActions && (
@@ -321,18 +299,18 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
         <div className="px-6 py-4 border-t border-gray-200 flex items-center justify-between">
           <div className="text-sm text-gray-600">
             Showing {(currentPage - 1) * itemsPerPage + 1} to{' '}
-            {Math.min(currentPage * itemsPerPage, sortedUsers.length)} of {sortedUsers.length}{' '}
+            {Math.min(currentPage * itemsPerPage, total)} of {total}{' '}
             users
           </div>
           <div className="flex gap-2">
             <button
-              onClick={() => setCurrentPage((p) => Math.max(1, p - 1))}
+              onClick={() => setCurrentPage(Math.max(1, currentPage - 1))}
               disabled={currentPage === 1}
               className="px-3 py-1 border border-gray-300 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed hover:bg-gray-50"
             >
               Previous
             </button>
-            {Array.from({ length: totalPages }, (_, i) => i + 1).map((page) => (
+            {visiblePages.map((page) => (
               <button
                 key={page}
                 onClick={() => setCurrentPage(page)}
@@ -346,7 +324,7 @@ const UserTable = ({ users, loading = false, onEdit, onDelete, onViewLogs, showA
               </button>
             ))}
             <button
-              onClick={() => setCurrentPage((p) => Math.min(totalPages, p + 1))}
+              onClick={() => setCurrentPage(Math.min(totalPages, currentPage + 1))}
               disabled={currentPage === totalPages}
               className="px-3 py-1 border border-gray-300 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed hover:bg-gray-50"
             >
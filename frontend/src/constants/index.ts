@@ -2,6 +2,11 @@ export const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localho
 
 export const AUTH_ENDPOINTS = {
   SIGN_IN: '/auth/sign-in',
+  REFRESH: '/auth/refresh',
+  LOGOUT: '/auth/logout',
+  MFA_VERIFY: '/auth/2fa/verify',
+  MFA_SETUP: '/auth/2fa/setup',
+  MFA_ENABLE: '/auth/2fa/enable',
 } as const;
 
 export const GROUPS_ENDPOINTS = {
@@ -48,6 +53,7 @@ export const LOGS_ENDPOINTS = {
 
 export const STORAGE_KEYS = {
   ACCESS_TOKEN: 'access_token',
+  REFRESH_TOKEN: 'refresh_token',
   USER_DATA: 'user_data',
 } as const;
 
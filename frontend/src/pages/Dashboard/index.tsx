@@ -1,32 +1,44 @@
-import { useQuery } from '@tanstack/react-query';
+import { useState } from 'react';
+import { useQuery, keepPreviousData } from '@tanstack/react-query';
 import { Users, UserCheck, Shield, FolderOpen } from 'lucide-react';
 import { usersService } from '../../services/users';
+import { groupsService } from '../../services/groups';
 import UserTable from '../../components/common/UserTable';
-import type { DashboardStats } from '../../types';
-import { useMemo } from 'react';
+import type { DashboardStats, UsersListParams } from '../../types';
 
 const Dashboard = () => {
-  const { data: users = [], isLoading } = useQuery({
-    queryKey: ['users'],
-    queryFn: usersService.getAll,
+  const [params, setParams] = useState<UsersListParams>({ page: 1, page_size: 10 });
+
+  // Счётчики берутся из total, сами записи не загружаются
+  const { data: stats, isLoading } = useQuery({
+    queryKey: ['users', 'stats'],
+    queryFn: async (): Promise<DashboardStats> => {
+      const [all, admins, clients, groups] = await Promise.all([
+        usersService.list({ page_size: 1 }),
+        usersService.list({ role: 'admin', page_size: 1 }),
+        usersService.list({ role: 'client', page_size: 1 }),
+        groupsService.list({ page_size: 1 }),
+      ]);
+      return {
+        totalUsers: all.total,
+        adminUsers: admins.total,
+        clientUsers: clients.total,
+        activeGroups: groups.total,
+        onlineUsers: 0,
+      };
+    },
   });
 
-  const stats: DashboardStats = useMemo(() => {
-    const totalUsers = users.length;
-    const adminUsers = users.filter((u) => u.role === 'admin').length;
-    const clientUsers = users.filter((u) => u.role === 'client').length;
-    const activeGroups = new Set(users.filter((u) => u.group_name).map((u) => u.group_name))
-      .size;
-    const onlineUsers = 0;
+  const { data: usersPage, isLoading: usersLoading } = useQuery({
+    queryKey: ['users', params],
+    queryFn: () => usersService.list(params),
+    placeholderData: keepPreviousData,
+  });
 
-    return {
-      totalUsers,
-      adminUsers,
-      clientUsers,
-      activeGroups,
-      onlineUsers,
-    };
-  }, [users]);
+  const { data: groups = [] } = useQuery({
+    queryKey: ['groups'],
+    queryFn: groupsService.getAll,
+  });
 
   return (
     <div className="space-y-6">
@@ -41,7 +53,7 @@ const Dashboard = () => {
             <div>
               <p className="text-sm font-medium text-gray-600">Total Users</p>
               <p className="text-3xl font-bold text-gray-900 mt-2">
-                {isLoading ? '...' : stats.totalUsers}
+                {isLoading ? '...' : stats?.totalUsers}
               </p>
             </div>
             <div className="bg-blue-100 p-3 rounded-full">
@@ -55,7 +67,7 @@ const Dashboard = () => {
             <div>
               <p className="text-sm font-medium text-gray-600">Admin Users</p>
               <p className="text-3xl font-bold text-gray-900 mt-2">
-                {isLoading ? '...' : stats.adminUsers}
+                {isLoading ? '...' : stats?.adminUsers}
               </p>
             </div>
             <div className="bg-purple-100 p-3 rounded-full">
@@ -69,7 +81,7 @@ const Dashboard = () => {
             <div>
               <p className="text-sm font-medium text-gray-600">Client Users</p>
               <p className="text-3xl font-bold text-gray-900 mt-2">
-                {isLoading ? '...' : stats.clientUsers}
+                {isLoading ? '...' : stats?.clientUsers}
               </p>
             </div>
             <div className="bg-green-100 p-3 rounded-full">
@@ -83,7 +95,7 @@ const Dashboard = () => {
             <div>
               <p className="text-sm font-medium text-gray-600">Active Groups</p>
               <p className="text-3xl font-bold text-gray-900 mt-2">
-                {isLoading ? '...' : stats.activeGroups}
+                {isLoading ? '...' : stats?.activeGroups}
               </p>
             </div>
             <div className="bg-orange-100 p-3 rounded-full">
@@ -93,7 +105,14 @@ const Dashboard = () => {
         </div>
       </div>
 
-      <UserTable users={users} loading={isLoading} />
+      <UserTable
+        users={usersPage?.data ?? []}
+        total={usersPage?.total ?? 0}
+        params={params}
+        onParamsChange={setParams}
+        groups={groups}
+        loading={usersLoading}
+      />
     </div>
   );
 };
@@ -1,5 +1,5 @@
 import { useState, useMemo } from 'react';
-import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
+import { useQuery, useMutation, useQueryClient, keepPreviousData } from '@tanstack/react-query';
 import { Plus } from 'lucide-react';
 import toast from 'react-hot-toast';
 import { groupsService } from '../../services/groups';
@@ -8,7 +8,7 @@ import GroupsTable from '../../components/common/GroupsTable';
 import GroupModal from '../../components/common/GroupModal';
 import DeleteConfirmDialog from '../../components/common/DeleteConfirmDialog';
 import GroupDetailsModal from '../../components/common/GroupDetailsModal';
-import type { Group, GroupWithUserCount, CreateGroupInput, UpdateGroupInput } from '../../types';
+import type { GroupWithUserCount, CreateGroupInput, UpdateGroupInput, GroupsListParams } from '../../types';
 
 const Groups = () => {
   const queryClient = useQueryClient();
@@ -18,14 +18,24 @@ const Groups = () => {
   const [isDetailsModalOpen, setIsDetailsModalOpen] = useState(false);
   const [selectedGroup, setSelectedGroup] = useState<GroupWithUserCount | null>(null);
 
-  const { data: groups = [], isLoading: loadingGroups, error: groupsError } = useQuery({
-    queryKey: ['groups'],
-    queryFn: groupsService.getAll,
+  const [params, setParams] = useState<GroupsListParams>({ page: 1, page_size: 10 });
+
+  const { data: groupsPage, isLoading: loadingGroups, error: groupsError } = useQuery({
+    queryKey: ['groups', params],
+    queryFn: () => groupsService.list(params),
+    placeholderData: keepPreviousData,
   });
 
-  const { data: allUsers = [], error: usersError } = useQuery({
-    queryKey: ['users'],
-    queryFn: usersService.getAll,
+  // Счётчики берутся из total, сами записи не загружаются
+  const { data: userCounts, error: usersError } = useQuery({
+    queryKey: ['users', 'counts'],
+    queryFn: async () => {
+      const [all, withoutGroup] = await Promise.all([
+        usersService.list({ page_size: 1 }),
+        usersService.list({ group_id: 0, page_size: 1 }),
+      ]);
+      return { total: all.total, withoutGroup: withoutGroup.total };
+    },
   });
 
   const { data: groupUsers = [], isLoading: loadingGroupUsers } = useQuery({
@@ -34,15 +44,14 @@ const Groups = () => {
     enabled: !!selectedGroup && isDetailsModalOpen,
   });
 
-  const groupsWithUserCount: GroupWithUserCount[] = useMemo(() => {
-    if (!Array.isArray(groups) || !Array.isArray(allUsers)) {
-      return [];
-    }
-    return groups.map((group) => ({
-      ...group,
-      userCount: allUsers.filter((user) => user.group_id === group.id).length,
-    }));
-  }, [groups, allUsers]);
+  const groupsWithUserCount: GroupWithUserCount[] = useMemo(
+    () =>
+      (groupsPage?.data ?? []).map((group) => ({
+        ...group,
+        userCount: group.member_count ?? 0,
+      })),
+    [groupsPage]
+  );
 
   const createMutation = useMutation({
     mutationFn: (data: CreateGroupInput) => groupsService.create(data),
@@ -144,23 +153,26 @@ const Groups = () => {
         <div className="bg-white rounded-lg shadow p-6">
           <p className="text-sm font-medium text-gray-600">Total Groups</p>
           <p className="text-3xl font-bold text-gray-900 mt-2">
-            {loadingGroups ? '...' : groups.length}
+            {loadingGroups ? '...' : groupsPage?.total ?? 0}
           </p>
         </div>
         <div className="bg-white rounded-lg shadow p-6">
           <p className="text-sm font-medium text-gray-600">Total Users</p>
-          <p className="text-3xl font-bold text-gray-900 mt-2">{allUsers.length}</p>
+          <p className="text-3xl font-bold text-gray-900 mt-2">{userCounts?.total ?? '...'}</p>
         </div>
         <div className="bg-white rounded-lg shadow p-6">
           <p className="text-sm font-medium text-gray-600">Users without Group</p>
           <p className="text-3xl font-bold text-gray-900 mt-2">
-            {allUsers.filter((u) => u.group_id === 0).length}
+            {userCounts?.withoutGroup ?? '...'}
           </p>
         </div>
       </div>
 
       <GroupsTable
         groups={groupsWithUserCount}
+        total={groupsPage?.total ?? 0}
+        params={params}
+        onParamsChange={setParams}
         loading={loadingGroups}
         onEdit={handleEdit}
         onDelete={handleDelete}
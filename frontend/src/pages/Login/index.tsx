@@ -1,13 +1,14 @@
-import { useState } from 'react';
+import { useState, type FormEvent } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useForm } from 'react-hook-form';
 import { zodResolver } from '@hookform/resolvers/zod';
 import { z } from 'zod';
 import toast from 'react-hot-toast';
-import { Eye, EyeOff, LogIn } from 'lucide-react';
+import { Eye, EyeOff, LogIn, ShieldCheck } from 'lucide-react';
 import { authService } from '../../services/auth';
 import { useAuthStore } from '../../store/authStore';
 import { ROUTES } from '../../constants';
+import type { LoginResponse, MfaChallenge, TotpSetup } from '../../types';
 
 const loginSchema = z.object({
   username: z.string().min(1, 'Username is required'),
@@ -21,6 +22,10 @@ const Login = () => {
   const setUser = useAuthStore((state) => state.setUser);
   const [showPassword, setShowPassword] = useState(false);
   const [isLoading, setIsLoading] = useState(false);
+  const [mfa, setMfa] = useState<MfaChallenge | null>(null);
+  const [totpSetup, setTotpSetup] = useState<TotpSetup | null>(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
 
   const {
     register,
@@ -30,13 +35,24 @@ const Login = () => {
     resolver: zodResolver(loginSchema),
   });
 
+  const finishSignIn = (response: LoginResponse) => {
+    setUser(response.user);
+    toast.success('Successfully logged in!');
+    navigate(ROUTES.DASHBOARD);
+  };
+
   const onSubmit = async (data: LoginFormData) => {
     setIsLoading(true);
     try {
       const response = await authService.signIn(data);
-      setUser(response.user);
-      toast.success('Successfully logged in!');
-      navigate(ROUTES.DASHBOARD);
+      if ('mfa_required' in response) {
+        setMfa(response);
+        if (response.mfa_enrollment_required) {
+          setTotpSetup(await authService.setupMfa(response.mfa_token));
+        }
+        return;
+      }
+      finishSignIn(response);
     } catch (error: any) {
       const errorMessage = error.response?.data?.message || 'Invalid credentials';
       toast.error(errorMessage);
@@ -45,6 +61,118 @@ const Login = () => {
     }
   };
 
+  const onSubmitCode = async (event: FormEvent) => {
+    event.preventDefault();
+    if (!mfa || !code.trim()) return;
+
+    setIsLoading(true);
+    try {
+      if (mfa.mfa_enrollment_required) {
+        const response = await authService.enableMfa(mfa.mfa_token, code);
+        setUser(response.user);
+        setRecoveryCodes(response.recovery_codes ?? []);
+        return;
+      }
+      finishSignIn(await authService.verifyMfa(mfa.mfa_token, code));
+    } catch (error: any) {
+      const errorMessage = error.response?.data?.message || 'Invalid code';
+      toast.error(errorMessage);
+      if (error.response?.data?.message?.includes('mfa token')) {
+        setMfa(null);
+        setTotpSetup(null);
+      }
+    } finally {
+      setCode('');
+      setIsLoading(false);
+    }
+  };
+
+  if (recoveryCodes) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-gray-900 to-gray-800">
+        <div className="max-w-md w-full space-y-6 p-8 bg-white rounded-xl shadow-2xl">
+          <h2 className="text-2xl font-bold text-gray-900">Save your recovery codes</h2>
+          <p className="text-sm text-gray-600">
+            Each code signs you in once if you lose your authenticator. They are shown only now.
+          </p>
+          <ul className="grid grid-cols-2 gap-2 font-mono text-sm bg-gray-50 p-4 rounded-lg">
+            {recoveryCodes.map((recoveryCode) => (
+              <li key={recoveryCode}>{recoveryCode}</li>
+            ))}
+          </ul>
+          <button
+            type="button"
+            onClick={() => navigate(ROUTES.DASHBOARD)}
+            className="w-full py-3 px-4 rounded-lg text-sm font-medium text-white bg-blue-600 hover:bg-blue-700 transition-all"
+          >
+            I have saved them
+          </button>
+        </div>
+      </div>
+    );
+  }
+
+  if (mfa) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-gray-900 to-gray-800">
+        <div className="max-w-md w-full space-y-6 p-8 bg-white rounded-xl shadow-2xl">
+          <div className="text-center">
+            <div className="flex justify-center mb-4">
+              <div className="bg-blue-600 p-3 rounded-full">
+                <ShieldCheck className="w-8 h-8 text-white" />
+              </div>
+            </div>
+            <h2 className="text-2xl font-bold text-gray-900">Two-factor authentication</h2>
+            <p className="mt-2 text-sm text-gray-600">
+              {mfa.mfa_enrollment_required
+                ? 'Your account requires two-factor authentication. Add this key to your authenticator app and enter the code it shows.'
+                : 'Enter the code from your authenticator app or a recovery code.'}
+            </p>
+          </div>
+
+          {totpSetup && (
+            <div className="space-y-2">
+              <p className="font-mono text-sm break-all bg-gray-50 p-3 rounded-lg">{totpSetup.secret}</p>
+              <a href={totpSetup.otpauth_uri} className="text-sm text-blue-600 hover:underline">
+                Open in authenticator app
+              </a>
+            </div>
+          )}
+
+          <form onSubmit={onSubmitCode} className="space-y-4">
+            <input
+              type="text"
+              inputMode={mfa.mfa_enrollment_required ? 'numeric' : 'text'}
+              autoComplete="one-time-code"
+              autoFocus
+              value={code}
+              onChange={(event) => setCode(event.target.value)}
+              className="w-full px-4 py-3 rounded-lg border border-gray-300 focus:outline-none focus:ring-2 focus:ring-blue-500 transition-all"
+              placeholder="123456"
+            />
+            <button
+              type="submit"
+              disabled={isLoading || !code.trim()}
+              className="w-full py-3 px-4 rounded-lg text-sm font-medium text-white bg-blue-600 hover:bg-blue-700 disabled:opacity-50 disabled:cursor-not-allowed transition-all"
+            >
+              {isLoading ? 'Checking...' : 'Verify'}
+            </button>
+            <button
+              type="button"
+              onClick={() => {
+                setMfa(null);
+                setTotpSetup(null);
+              }}
+              className="w-full text-sm text-gray-600 hover:text-gray-800"
+            >
+              Back to sign in
+            </button>
+          </form>
+        </div>
+      </div>
+    );
+  }
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-gray-900 to-gray-800">
       <div className="max-w-md w-full space-y-8 p-8 bg-white rounded-xl shadow-2xl">
@@ -1,5 +1,5 @@
 import { useState } from 'react';
-import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
+import { useQuery, useMutation, useQueryClient, keepPreviousData } from '@tanstack/react-query';
 import { Plus } from 'lucide-react';
 import toast from 'react-hot-toast';
 import { usersService } from '../../services/users';
@@ -8,7 +8,7 @@ import UserTable from '../../components/common/UserTable';
 import UserModal from '../../components/common/UserModal';
 import DeleteConfirmDialog from '../../components/common/DeleteConfirmDialog';
 import LogsModal from '../../components/common/LogsModal';
-import type { User, CreateUserInput, UpdateUserInput } from '../../types';
+import type { User, CreateUserInput, UpdateUserInput, UsersListParams } from '../../types';
 
 const Users = () => {
   const queryClient = useQueryClient();
@@ -17,10 +17,12 @@ const Users = () => {
   const [isDeleteDialogOpen, setIsDeleteDialogOpen] = useState(false);
   const [selectedUser, setSelectedUser] = useState<User | null>(null);
   const [logsUsername, setLogsUsername] = useState<string | null>(null);
+  const [params, setParams] = useState<UsersListParams>({ page: 1, page_size: 10 });
 
-  const { data: users = [], isLoading: usersLoading } = useQuery({
-    queryKey: ['users'],
-    queryFn: usersService.getAll,
+  const { data: usersPage, isLoading: usersLoading } = useQuery({
+    queryKey: ['users', params],
+    queryFn: () => usersService.list(params),
+    placeholderData: keepPreviousData,
   });
 
   const { data: groups = [] } = useQuery({
@@ -134,7 +136,11 @@ const Users = () => {
       </div>
 
       <UserTable
-        users={users}
+        users={usersPage?.data ?? []}
+        total={usersPage?.total ?? 0}
+        params={params}
+        onParamsChange={setParams}
+        groups={groups}
         loading={usersLoading}
         showActions
         onEdit={handleEditClick}
@@ -1,5 +1,5 @@
 import axios, { type AxiosError, type InternalAxiosRequestConfig } from 'axios';
-import { API_BASE_URL, STORAGE_KEYS, ROUTES } from '../../constants';
+import { API_BASE_URL, AUTH_ENDPOINTS, STORAGE_KEYS, ROUTES } from '../../constants';
 
 export const api = axios.create({
   baseURL: API_BASE_URL,
@@ -23,15 +23,57 @@ api.interceptors.request.use(
   }
 );
 
+let refreshRequest: Promise<string> | null = null;
+
+const refreshAccessToken = async (): Promise<string> => {
+  const refreshToken = localStorage.getItem(STORAGE_KEYS.REFRESH_TOKEN);
+  if (!refreshToken) {
+    throw new Error('no refresh token');
+  }
+
+  const response = await axios.post(`${API_BASE_URL}${AUTH_ENDPOINTS.REFRESH}`, {
+    refresh_token: refreshToken,
+  });
+
+  localStorage.setItem(STORAGE_KEYS.ACCESS_TOKEN, response.data.token);
+  localStorage.setItem(STORAGE_KEYS.REFRESH_TOKEN, response.data.refresh_token);
+  return response.data.token;
+};
+
+const clearSession = () => {
+  localStorage.removeItem(STORAGE_KEYS.ACCESS_TOKEN);
+  localStorage.removeItem(STORAGE_KEYS.REFRESH_TOKEN);
+  localStorage.removeItem(STORAGE_KEYS.USER_DATA);
+
+  if (window.location.pathname !== ROUTES.LOGIN) {
+    window.location.href = ROUTES.LOGIN;
+  }
+};
+
 api.interceptors.response.use(
   (response) => response,
-  (error: AxiosError) => {
+  async (error: AxiosError) => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+
     if (error.response?.status === 401) {
-      localStorage.removeItem(STORAGE_KEYS.ACCESS_TOKEN);
-      localStorage.removeItem(STORAGE_KEYS.USER_DATA);
-      
-      if (window.location.pathname !== ROUTES.LOGIN) {
-        window.location.href = ROUTES.LOGIN;
+      // Sign-in steps answer 401 for wrong credentials or codes, not for an expired session.
+      const isSignInStep = config?.url === AUTH_ENDPOINTS.SIGN_IN || config?.url?.startsWith('/auth/2fa/');
+      if (!config || config._retried || isSignInStep) {
+        clearSession();
+        return Promise.reject(error);
+      }
+
+      try {
+        // Concurrent 401s share one refresh so the rotated token is not reused.
+        refreshRequest = refreshRequest ?? refreshAccessToken();
+        const token = await refreshRequest;
+        config._retried = true;
+        config.headers.Authorization = `Bearer ${token}`;
+        return api(config);
+      } catch {
+        clearSession();
+      } finally {
+        refreshRequest = null;
       }
     }
     
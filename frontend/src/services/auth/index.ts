@@ -1,22 +1,52 @@
 import { api } from '../api/axios';
 import { AUTH_ENDPOINTS, STORAGE_KEYS } from '../../constants';
-import type { LoginRequest, LoginResponse, User } from '../../types';
+import type { LoginRequest, LoginResponse, SignInResult, TotpSetup, User } from '../../types';
+
+const storeSession = (data: LoginResponse) => {
+  if (data.token) {
+    localStorage.setItem(STORAGE_KEYS.ACCESS_TOKEN, data.token);
+    localStorage.setItem(STORAGE_KEYS.REFRESH_TOKEN, data.refresh_token);
+    localStorage.setItem(STORAGE_KEYS.USER_DATA, JSON.stringify(data.user));
+  }
+};
 
 export const authService = {
-  async signIn(credentials: LoginRequest): Promise<LoginResponse> {
+  async signIn(credentials: LoginRequest): Promise<SignInResult> {
     const response = await api.post(AUTH_ENDPOINTS.SIGN_IN, credentials);
     const data = response.data?.data || response.data;
-    
-    if (data.token) {
-      localStorage.setItem(STORAGE_KEYS.ACCESS_TOKEN, data.token);
-      localStorage.setItem(STORAGE_KEYS.USER_DATA, JSON.stringify(data.user));
+
+    if (!('mfa_required' in data)) {
+      storeSession(data);
     }
-    
+
     return data;
   },
 
+  async verifyMfa(mfaToken: string, code: string): Promise<LoginResponse> {
+    const response = await api.post(AUTH_ENDPOINTS.MFA_VERIFY, { mfa_token: mfaToken, code });
+    storeSession(response.data);
+    return response.data;
+  },
+
+  async setupMfa(mfaToken: string): Promise<TotpSetup> {
+    const response = await api.post(AUTH_ENDPOINTS.MFA_SETUP, { mfa_token: mfaToken });
+    return response.data;
+  },
+
+  async enableMfa(mfaToken: string, code: string): Promise<LoginResponse> {
+    const response = await api.post(AUTH_ENDPOINTS.MFA_ENABLE, { mfa_token: mfaToken, code });
+    storeSession(response.data);
+    return response.data;
+  },
+
   logout(): void {
+    const refreshToken = localStorage.getItem(STORAGE_KEYS.REFRESH_TOKEN);
+    if (refreshToken) {
+      api.post(AUTH_ENDPOINTS.LOGOUT, { refresh_token: refreshToken }).catch(() => undefined);
+    }
+
     localStorage.removeItem(STORAGE_KEYS.ACCESS_TOKEN);
+    localStorage.removeItem(STORAGE_KEYS.REFRESH_TOKEN);
     localStorage.removeItem(STORAGE_KEYS.USER_DATA);
   },
 
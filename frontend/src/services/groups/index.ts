@@ -1,11 +1,35 @@
 import { api } from '../api/axios';
-import type { Group, CreateGroupInput, UpdateGroupInput, User, WhitelistEntry, CreateUserInput } from '../../types';
+import type {
+  Group,
+  CreateGroupInput,
+  UpdateGroupInput,
+  User,
+  WhitelistEntry,
+  CreateUserInput,
+  GroupMember,
+  GroupsListParams,
+  PaginatedResponse,
+} from '../../types';
+
+// Сервер отдаёт не больше 500 записей за раз
+const MAX_PAGE_SIZE = 500;
 
 export const groupsService = {
+  async list(params: GroupsListParams = {}): Promise<PaginatedResponse<Group>> {
+    const response = await api.get('/api/groups/', { params });
+    const data = response.data;
+    return {
+      data: Array.isArray(data?.data) ? data.data : [],
+      total: data?.total ?? 0,
+      page: data?.page ?? 1,
+      pageSize: data?.pageSize ?? 0,
+    };
+  },
+
+  // Все группы для выпадающих списков
   async getAll(): Promise<Group[]> {
-    const response = await api.get('/api/groups/');
-    const data = response.data?.data || response.data;
-    return Array.isArray(data) ? data : [];
+    const response = await groupsService.list({ sort: 'name', page_size: MAX_PAGE_SIZE });
+    return response.data;
   },
 
   async getById(id: number): Promise<Group> {
@@ -38,6 +62,20 @@ export const groupsService = {
     return response.data?.data || response.data;
   },
 
+  async getMembers(groupId: number): Promise<GroupMember[]> {
+    const response = await api.get(`/api/groups/${groupId}/members`);
+    const data = response.data?.data || response.data;
+    return Array.isArray(data) ? data : [];
+  },
+
+  async addMember(groupId: number, userId: number): Promise<void> {
+    await api.post(`/api/groups/${groupId}/members`, { user_id: userId });
+  },
+
+  async removeMember(groupId: number, userId: number): Promise<void> {
+    await api.delete(`/api/groups/${groupId}/members/${userId}`);
+  },
+
   async getWhitelist(groupId: number): Promise<WhitelistEntry[]> {
     const response = await api.get(`/api/groups/${groupId}/whitelist`);
     const data = response.data?.data || response.data;
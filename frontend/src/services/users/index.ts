@@ -1,11 +1,16 @@
 import { api } from '../api/axios';
-import type { User } from '../../types';
+import type { User, PaginatedResponse, UsersListParams } from '../../types';
 
 export const usersService = {
-  async getAll(): Promise<User[]> {
-    const response = await api.get('/api/users/');
-    const data = response.data?.data || response.data;
-    return Array.isArray(data) ? data : [];
+  async list(params: UsersListParams = {}): Promise<PaginatedResponse<User>> {
+    const response = await api.get('/api/users/', { params });
+    const data = response.data;
+    return {
+      data: Array.isArray(data?.data) ? data.data : [],
+      total: data?.total ?? 0,
+      page: data?.page ?? 1,
+      pageSize: data?.pageSize ?? 0,
+    };
   },
 
   async getById(id: number): Promise<User> {
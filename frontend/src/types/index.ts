@@ -4,16 +4,20 @@ export interface User {
   name: string;
   username: string;
   password?: string;
-  role: 'admin' | 'client';
+  role: 'admin' | 'teacher' | 'client';
   group_id: number;
   group_name: string;
+  // Все группы пользователя, основная первой
+  groups?: Group[];
+  status?: AccountStatus;
+  archived_at?: string;
 }
 
 export interface UpdateUserInput {
   name?: string;
   username?: string;
   password?: string;
-  role?: 'admin' | 'client';
+  role?: 'admin' | 'teacher' | 'client';
   group_id?: number | null;
   group_name?: string;
 }
@@ -22,7 +26,7 @@ export interface CreateUserInput {
   name: string;
   username: string;
   password: string;
-  role: 'admin' | 'client';
+  role: 'admin' | 'teacher' | 'client';
   group_id: number;
 }
 
@@ -30,16 +34,23 @@ export interface ChangePasswordInput {
   password: string;
 }
 
-export type UserStatus = 'online' | 'offline';
-
-export interface UserWithStatus extends User {
-  status: UserStatus;
-}
+// Состояние учётной записи (не путать с онлайн-статусом устройства)
+export type AccountStatus = 'active' | 'disabled' | 'archived';
 
 // Group типы
 export interface Group {
   id: number;
   name: string;
+  member_count?: number;
+}
+
+export interface GroupMember {
+  group_id: number;
+  user_id: number;
+  username: string;
+  role: 'admin' | 'teacher' | 'client';
+  status: string;
+  primary: boolean;
 }
 
 export interface GroupWithUserCount extends Group {
@@ -78,14 +89,31 @@ export interface LoginRequest {
 
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
   user: User;
+  recovery_codes?: string[];
+}
+
+// Second sign-in step for accounts with two-factor authentication
+export interface MfaChallenge {
+  mfa_required: true;
+  mfa_enrollment_required: boolean;
+  mfa_token: string;
+}
+
+export interface TotpSetup {
+  secret: string;
+  otpauth_uri: string;
 }
 
+export type SignInResult = LoginResponse | MfaChallenge;
+
 export interface SignUpRequest {
   name: string;
   username: string;
   password: string;
-  role?: 'admin' | 'client';
+  role?: 'admin' | 'teacher' | 'client';
 }
 
 // API Response типы
@@ -101,6 +129,29 @@ export interface PaginatedResponse<T> {
   pageSize: number;
 }
 
+// Параметры серверного поиска, сортировки и пагинации
+export type SortOrder = 'asc' | 'desc';
+
+export interface ListParams {
+  search?: string;
+  sort?: string;
+  order?: SortOrder;
+  page?: number;
+  page_size?: number;
+}
+
+export interface UsersListParams extends ListParams {
+  sort?: 'id' | 'name' | 'username' | 'role' | 'group_name' | 'status';
+  // 0 — пользователи без группы
+  group_id?: number;
+  role?: 'admin' | 'teacher' | 'client';
+  status?: AccountStatus | 'all';
+}
+
+export interface GroupsListParams extends ListParams {
+  sort?: 'id' | 'name' | 'member_count';
+}
+
 // Dashboard Statistics
 export interface DashboardStats {
   totalUsers: number;